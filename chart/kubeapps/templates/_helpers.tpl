@@ -178,6 +178,13 @@ Create name for kubeops based on the fullname
 {{ template "kubeapps.fullname" . }}-internal-kubeops
 {{- end -}}
 
+{{/*
+Create name for the kubeops config based on the fullname
+*/}}
+{{- define "kubeapps.kubeops-config.fullname" -}}
+{{ template "kubeapps.fullname" . }}-internal-kubeops-config
+{{- end -}}
+
 {{/*
 Create name for the secrets related to an app repository
 */}}
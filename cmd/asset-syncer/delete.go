@@ -55,6 +55,11 @@ var deleteCmd = &cobra.Command{
 		if err = manager.Delete(repo); err != nil {
 			logrus.Fatalf("Can't delete chart repository %s from database: %v", args[0], err)
 		}
+		tarballs, err := openTarballStore(manager)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		pruneTarballs(tarballs)
 
 		logrus.Infof("Successfully deleted the chart repository %s from database", args[0])
 	},
@@ -0,0 +1,109 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	kubeappsyaml "github.com/kubeapps/kubeapps/pkg/yaml"
+	log "github.com/sirupsen/logrus"
+	helm3loader "helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+)
+
+// renderedReleaseName is the release name used to render the chart templates.
+// Some charts use it to build image references so it should look like a real
+// release name.
+const renderedReleaseName = "kubeapps"
+
+// chartImages renders the templates of a chart tarball with its default values
+// and returns the sorted list of container and init container images used in
+// the resulting manifests. Rendering is done offline, without a cluster, so
+// charts which depend on the cluster state may render differently when
+// installed.
+func chartImages(tarball []byte) ([]string, error) {
+	ch, err := helm3loader.LoadArchive(bytes.NewReader(tarball))
+	if err != nil {
+		return nil, err
+	}
+
+	values := chartutil.Values{}
+	if err := chartutil.ProcessDependencies(ch, values); err != nil {
+		return nil, err
+	}
+	options := chartutil.ReleaseOptions{Name: renderedReleaseName, Namespace: "default", Revision: 1, IsInstall: true}
+	renderValues, err := chartutil.ToRenderValues(ch, values, options, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, err
+	}
+	manifests, err := engine.Render(ch, renderValues)
+	if err != nil {
+		return nil, err
+	}
+
+	images := map[string]bool{}
+	for name, manifest := range manifests {
+		if strings.HasSuffix(name, "NOTES.txt") {
+			continue
+		}
+		objs, err := kubeappsyaml.ParseObjects(manifest)
+		if err != nil {
+			log.WithFields(log.Fields{"chart": ch.Name(), "template": name}).WithError(err).Debug("unable to parse rendered template")
+			continue
+		}
+		for _, obj := range objs {
+			collectImages(obj.Object, images)
+		}
+	}
+
+	result := []string{}
+	for image := range images {
+		result = append(result, image)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// collectImages walks a rendered object looking for container lists. Rather
+// than knowing where the pod spec lives for every workload kind (including
+// custom resources), any "containers" or "initContainers" list is inspected.
+func collectImages(obj interface{}, images map[string]bool) {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		for key, value := range o {
+			if key == "containers" || key == "initContainers" {
+				if containers, ok := value.([]interface{}); ok {
+					for _, c := range containers {
+						if container, ok := c.(map[string]interface{}); ok {
+							if image, ok := container["image"].(string); ok && image != "" {
+								images[image] = true
+							}
+						}
+					}
+				}
+			}
+			collectImages(value, images)
+		}
+	case []interface{}:
+		for _, value := range o {
+			collectImages(value, images)
+		}
+	}
+}
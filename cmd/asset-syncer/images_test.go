@@ -0,0 +1,160 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arschles/assert"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/kubeapps/kubeapps/pkg/dbutils"
+)
+
+const testChartYaml = `apiVersion: v2
+name: my-chart
+version: 1.0.0
+`
+
+const testDeploymentTemplate = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}-web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: "{{ .Values.init.image }}"
+      containers:
+      - name: web
+        image: "{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+      - name: metrics
+        image: bitnami/nginx-exporter:0.6.0
+`
+
+const testCronJobTemplate = `apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: {{ .Release.Name }}-backup
+spec:
+  schedule: "0 0 * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: backup
+            image: "{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+`
+
+const testImagesValues = `image:
+  repository: bitnami/nginx
+  tag: 1.17.8
+init:
+  image: bitnami/minideb:buster
+`
+
+func chartTarball(files []tarballFile) []byte {
+	var b bytes.Buffer
+	gzw := gzip.NewWriter(&b)
+	createTestTarball(gzw, files)
+	gzw.Close()
+	return b.Bytes()
+}
+
+func Test_chartImages(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []tarballFile
+		expected []string
+	}{
+		{
+			"chart without templates",
+			[]tarballFile{{"my-chart/Chart.yaml", testChartYaml}},
+			[]string{},
+		},
+		{
+			"chart with containers and init containers",
+			[]tarballFile{
+				{"my-chart/Chart.yaml", testChartYaml},
+				{"my-chart/values.yaml", testImagesValues},
+				{"my-chart/templates/deployment.yaml", testDeploymentTemplate},
+				{"my-chart/templates/cronjob.yaml", testCronJobTemplate},
+				{"my-chart/templates/NOTES.txt", "image: not-an-image"},
+			},
+			[]string{"bitnami/minideb:buster", "bitnami/nginx-exporter:0.6.0", "bitnami/nginx:1.17.8"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := chartImages(chartTarball(tt.files))
+			assert.NoErr(t, err)
+			assert.Equal(t, images, tt.expected, "images")
+		})
+	}
+
+	t.Run("chart failing to render", func(t *testing.T) {
+		_, err := chartImages(chartTarball([]tarballFile{
+			{"my-chart/Chart.yaml", testChartYaml},
+			{"my-chart/templates/deployment.yaml", `{{ required "a value is required" .Values.missing }}`},
+		}))
+		if err == nil {
+			t.Errorf("expected an error rendering the chart")
+		}
+	})
+}
+
+// tarballClient serves a chart tarball
+type tarballClient struct {
+	tarball []byte
+}
+
+func (h *tarballClient) Do(req *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	w.Write(h.tarball)
+	return w.Result(), nil
+}
+
+func Test_reimportOlderFilesImages(t *testing.T) {
+	m := newTestMemoryManager(t)
+	repo := &models.Repo{Namespace: "default", Name: "my-repo", URL: "https://example.com"}
+	cv := models.ChartVersion{Version: "1.0.0", Digest: "my-chart-1", URLs: []string{"my-chart-1.0.0.tgz"}}
+	assert.NoErr(t, m.Sync(*repo, []models.Chart{{ID: "my-repo/my-chart", Name: "my-chart", Repo: repo, ChartVersions: []models.ChartVersion{cv}}}))
+	// The files of the version imported before its images were
+	assert.NoErr(t, m.insertFiles("my-repo/my-chart", models.ChartFiles{ID: "my-repo/my-chart-1.0.0", Repo: repo, Digest: cv.Digest}))
+
+	netClient = &tarballClient{chartTarball([]tarballFile{
+		{"my-chart/Chart.yaml", testChartYaml},
+		{"my-chart/values.yaml", testImagesValues},
+		{"my-chart/templates/deployment.yaml", testDeploymentTemplate},
+	})}
+	fImporter := fileImporter{manager: m, report: newSyncReport(*repo, time.Now())}
+	r := &models.RepoInternal{Namespace: repo.Namespace, Name: repo.Name, URL: repo.URL}
+	assert.NoErr(t, fImporter.fetchAndImportFiles("my-chart", r, cv))
+
+	m.View(func(c *dbutils.MemoryCatalog) error {
+		files, err := c.Repo(repo.Namespace, repo.Name).Charts["my-repo/my-chart"].ChartFiles("my-repo/my-chart-1.0.0")
+		assert.NoErr(t, err)
+		assert.Equal(t, files.Images, []string{"bitnami/minideb:buster", "bitnami/nginx-exporter:0.6.0", "bitnami/nginx:1.17.8"}, "images")
+		return nil
+	})
+}
@@ -30,6 +30,7 @@ var (
 	databasePassword string
 	debug            bool
 	namespace        string
+	tarballStore     string
 )
 
 var rootCmd = &cobra.Command{
@@ -48,18 +49,19 @@ func main() {
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringVar(&databaseType, "database-type", "mongodb", "Database to use. Choice: mongodb, postgresql")
-	rootCmd.PersistentFlags().StringVar(&databaseURL, "database-url", "localhost", "Database URL")
+	rootCmd.PersistentFlags().StringVar(&databaseType, "database-type", "mongodb", "Database to use. Choice: mongodb, postgresql, memory")
+	rootCmd.PersistentFlags().StringVar(&databaseURL, "database-url", "localhost", "Database URL, a file:///path URL persists the memory database to a file")
 	rootCmd.PersistentFlags().StringVar(&databaseName, "database-name", "charts", "Name of the database to use")
 	rootCmd.PersistentFlags().StringVar(&databaseUser, "database-user", "", "Database user")
 	rootCmd.PersistentFlags().StringVar(&namespace, "namespace", "", "Namespace of the repository being synced")
 	// User agent configuration can be found in version.go. Check that file for more details
 	rootCmd.PersistentFlags().StringVar(&userAgentComment, "user-agent-comment", "", "UserAgent comment used during outbound requests")
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "verbose logging")
+	rootCmd.PersistentFlags().StringVar(&tarballStore, "tarball-store", "", "Store of the mirrored chart tarballs: \"database\" or a file:///path URL. Tarballs are not mirrored if empty")
 
 	databasePassword = os.Getenv("DB_PASSWORD")
 
-	cmds := []*cobra.Command{syncCmd, deleteCmd, invalidateCacheCmd}
+	cmds := []*cobra.Command{syncCmd, deleteCmd, invalidateCacheCmd, migrateCmd, migrateDBCmd}
 	for _, cmd := range cmds {
 		rootCmd.AddCommand(cmd)
 	}
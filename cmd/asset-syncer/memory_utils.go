@@ -0,0 +1,207 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/kubeapps/kubeapps/pkg/dbutils"
+)
+
+type memoryAssetManager struct {
+	*dbutils.MemoryAssetManager
+}
+
+func newMemoryManager(config datastore.Config, kubeappsNamespace string) assetManager {
+	return &memoryAssetManager{dbutils.NewMemoryManager(config, kubeappsNamespace)}
+}
+
+// Sync upserts the charts of a repo and removes the charts no longer in its
+// index with their files and icons. Like in PostgreSQL the icon content type
+// of a chart is kept until its icon is processed again.
+func (m *memoryAssetManager) Sync(repo models.Repo, charts []models.Chart) error {
+	infos := map[string]*dbutils.MemoryChart{}
+	for _, chart := range charts {
+		info := &dbutils.MemoryChart{ID: chart.ID}
+		if err := info.SetChart(chart); err != nil {
+			return err
+		}
+		infos[chart.ID] = info
+	}
+	return m.Update(func(c *dbutils.MemoryCatalog) error {
+		var existingCharts map[string]*dbutils.MemoryChart
+		if r := c.Repo(repo.Namespace, repo.Name); r != nil {
+			existingCharts = r.Charts
+		}
+		for id, info := range infos {
+			existing, ok := existingCharts[id]
+			if !ok {
+				continue
+			}
+			info.Icon, info.Files = existing.Icon, existing.Files
+			if existing.Icon != nil {
+				chart, err := info.Chart()
+				if err != nil {
+					return err
+				}
+				chart.IconContentType = existing.Icon.ContentType
+				if err := info.SetChart(chart); err != nil {
+					return err
+				}
+			}
+		}
+		// The charts no longer in the index are removed with their files and icons
+		c.EnsureRepo(repo.Namespace, repo.Name).Charts = infos
+		return nil
+	})
+}
+
+func (m *memoryAssetManager) RepoAlreadyProcessed(repo models.Repo, checksum string) bool {
+	processed := false
+	m.View(func(c *dbutils.MemoryCatalog) error {
+		r := c.Repo(repo.Namespace, repo.Name)
+		processed = r != nil && r.Checksum == checksum
+		return nil
+	})
+	return processed
+}
+
+func (m *memoryAssetManager) UpdateLastCheck(repoNamespace, repoName, checksum string, now time.Time) error {
+	return m.Update(func(c *dbutils.MemoryCatalog) error {
+		r := c.EnsureRepo(repoNamespace, repoName)
+		r.Checksum, r.LastUpdate = checksum, now
+		return nil
+	})
+}
+
+func (m *memoryAssetManager) Delete(repo models.Repo) error {
+	return m.Update(func(c *dbutils.MemoryCatalog) error {
+		c.DeleteRepo(repo.Namespace, repo.Name)
+		return nil
+	})
+}
+
+// updateIcon stores the icon of a chart and its content type in the chart
+func (m *memoryAssetManager) updateIcon(repo models.Repo, data []byte, contentType, ID string) error {
+	digest := sha256.Sum256(data)
+	icon := &models.ChartIcon{Data: append([]byte(nil), data...), ContentType: contentType, Digest: hex.EncodeToString(digest[:])}
+	return m.Update(func(c *dbutils.MemoryCatalog) error {
+		chart, err := m.repoChart(c, repo, ID)
+		if err != nil {
+			return err
+		}
+		info, err := chart.Chart()
+		if err != nil {
+			return err
+		}
+		info.IconContentType = contentType
+		if err := chart.SetChart(info); err != nil {
+			return err
+		}
+		chart.Icon = icon
+		return nil
+	})
+}
+
+// repoChart returns a chart of a repository, ErrNotFound if it's not synced
+func (m *memoryAssetManager) repoChart(c *dbutils.MemoryCatalog, repo models.Repo, chartID string) (*dbutils.MemoryChart, error) {
+	r := c.Repo(repo.Namespace, repo.Name)
+	if r == nil || r.Charts[chartID] == nil {
+		return nil, fmt.Errorf("chart %q of repository %s/%s: %w", chartID, repo.Namespace, repo.Name, dbutils.ErrNotFound)
+	}
+	return r.Charts[chartID], nil
+}
+
+func (m *memoryAssetManager) filesExist(repo models.Repo, chartFilesID, digest string) bool {
+	exists := false
+	m.View(func(c *dbutils.MemoryCatalog) error {
+		r := c.Repo(repo.Namespace, repo.Name)
+		if r == nil {
+			return nil
+		}
+		for _, chart := range r.Charts {
+			files, err := chart.ChartFiles(chartFilesID)
+			if err == nil && files.Digest == digest && files.FormatVersion >= models.ChartFilesFormatVersion {
+				exists = true
+				return nil
+			}
+		}
+		return nil
+	})
+	return exists
+}
+
+// insertFiles stores the files of a chart version, which can only be stored
+// once the chart is synced
+func (m *memoryAssetManager) insertFiles(chartId string, files models.ChartFiles) error {
+	if files.Repo == nil {
+		return fmt.Errorf("unable to insert file without repo: %q", files.ID)
+	}
+	return m.Update(func(c *dbutils.MemoryCatalog) error {
+		chart, err := m.repoChart(c, *files.Repo, chartId)
+		if err != nil {
+			return err
+		}
+		return chart.SetChartFiles(files)
+	})
+}
+
+func (m *memoryAssetManager) getRepoCharts(repo models.Repo) ([]models.Chart, error) {
+	result := []models.Chart{}
+	err := m.View(func(c *dbutils.MemoryCatalog) error {
+		r := c.Repo(repo.Namespace, repo.Name)
+		if r == nil {
+			return nil
+		}
+		for _, info := range r.SortedCharts() {
+			chart, err := info.Chart()
+			if err != nil {
+				return err
+			}
+			result = append(result, chart)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// insertSyncReport stores the report of a sync, keeping only the last
+// syncReportsToKeep reports of the repository
+func (m *memoryAssetManager) insertSyncReport(report models.SyncReport) error {
+	if report.Repo == nil {
+		return fmt.Errorf("unable to insert sync report without repo")
+	}
+	return m.Update(func(c *dbutils.MemoryCatalog) error {
+		r := c.EnsureRepo(report.Repo.Namespace, report.Repo.Name)
+		r.SyncReports = append(r.SyncReports, report)
+		if len(r.SyncReports) > syncReportsToKeep {
+			r.SyncReports = r.SyncReports[len(r.SyncReports)-syncReportsToKeep:]
+		}
+		return nil
+	})
+}
+
+// tarballStore returns the store of the tarballs mirrored in the catalog
+func (m *memoryAssetManager) tarballStore() blobstore.Store {
+	return dbutils.MemoryTarballStore{Manager: m.MemoryAssetManager}
+}
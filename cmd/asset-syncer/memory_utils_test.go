@@ -0,0 +1,169 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arschles/assert"
+	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/kubeapps/kubeapps/pkg/dbutils"
+)
+
+// newTestMemoryManager returns a manager of a catalog only used by the test
+func newTestMemoryManager(t *testing.T) *memoryAssetManager {
+	m := newMemoryManager(datastore.Config{URL: t.Name()}, "kubeapps").(*memoryAssetManager)
+	assert.NoErr(t, m.Init())
+	return m
+}
+
+func Test_MemorySync(t *testing.T) {
+	m := newTestMemoryManager(t)
+	repo := models.Repo{Namespace: "default", Name: "my-repo", URL: "https://example.com"}
+	charts := []models.Chart{
+		{ID: "my-repo/foo", Name: "foo", Repo: &repo, ChartVersions: []models.ChartVersion{{Version: "1.0.0", Digest: "foo-1"}}},
+		{ID: "my-repo/bar", Name: "bar", Repo: &repo, ChartVersions: []models.ChartVersion{{Version: "1.0.0", Digest: "bar-1"}}},
+	}
+	assert.NoErr(t, m.Sync(repo, charts))
+	assert.NoErr(t, m.updateIcon(repo, []byte("icon"), "image/png", "my-repo/foo"))
+	assert.NoErr(t, m.insertFiles("my-repo/foo", models.ChartFiles{ID: "my-repo/foo-1.0.0", Repo: &repo, Digest: "foo-1", FormatVersion: models.ChartFilesFormatVersion}))
+	assert.NoErr(t, m.insertFiles("my-repo/bar", models.ChartFiles{ID: "my-repo/bar-1.0.0", Repo: &repo, Digest: "bar-1", FormatVersion: models.ChartFilesFormatVersion}))
+
+	// A new version of foo is synced and bar is no longer in the index
+	charts = []models.Chart{
+		{ID: "my-repo/foo", Name: "foo", Repo: &repo, ChartVersions: []models.ChartVersion{{Version: "2.0.0", Digest: "foo-2"}, {Version: "1.0.0", Digest: "foo-1"}}},
+	}
+	assert.NoErr(t, m.Sync(repo, charts))
+
+	synced, err := m.getRepoCharts(repo)
+	assert.NoErr(t, err)
+	assert.Equal(t, len(synced), 1, "number of charts")
+	assert.Equal(t, len(synced[0].ChartVersions), 2, "number of chart versions")
+	assert.Equal(t, synced[0].IconContentType, "image/png", "icon content type kept by the sync")
+	assert.True(t, m.filesExist(repo, "my-repo/foo-1.0.0", "foo-1"), "the files of the synced chart should be kept")
+	assert.False(t, m.filesExist(repo, "my-repo/foo-1.0.0", "other-digest"), "files with another digest should not exist")
+	assert.False(t, m.filesExist(repo, "my-repo/bar-1.0.0", "bar-1"), "the files of the removed chart should be removed")
+	m.View(func(c *dbutils.MemoryCatalog) error {
+		icon := c.Repo(repo.Namespace, repo.Name).Charts["my-repo/foo"].Icon
+		assert.Equal(t, string(icon.Data), "icon", "icon")
+		return nil
+	})
+}
+
+func Test_MemoryMissingCharts(t *testing.T) {
+	m := newTestMemoryManager(t)
+	repo := models.Repo{Namespace: "default", Name: "my-repo"}
+
+	err := m.updateIcon(repo, []byte("icon"), "image/png", "my-repo/foo")
+	assert.True(t, errors.Is(err, dbutils.ErrNotFound), "unexpected error updating the icon of a missing chart: %v", err)
+	err = m.insertFiles("my-repo/foo", models.ChartFiles{ID: "my-repo/foo-1.0.0", Repo: &repo})
+	assert.True(t, errors.Is(err, dbutils.ErrNotFound), "unexpected error inserting the files of a missing chart: %v", err)
+	err = m.insertFiles("my-repo/foo", models.ChartFiles{ID: "my-repo/foo-1.0.0"})
+	assert.True(t, err != nil, "inserting files without repo should fail")
+}
+
+func Test_MemoryRepoChecks(t *testing.T) {
+	m := newTestMemoryManager(t)
+	repo := models.Repo{Namespace: "default", Name: "my-repo"}
+
+	assert.False(t, m.RepoAlreadyProcessed(repo, "abc"), "repo should not be processed before its first sync")
+	assert.NoErr(t, m.UpdateLastCheck(repo.Namespace, repo.Name, "abc", time.Now()))
+	assert.True(t, m.RepoAlreadyProcessed(repo, "abc"), "repo should be processed with the same checksum")
+	assert.False(t, m.RepoAlreadyProcessed(repo, "def"), "repo should not be processed with another checksum")
+
+	assert.NoErr(t, m.Delete(repo))
+	assert.False(t, m.RepoAlreadyProcessed(repo, "abc"), "deleted repo should not be processed")
+}
+
+func Test_MemoryInsertSyncReport(t *testing.T) {
+	m := newTestMemoryManager(t)
+	repo := models.Repo{Namespace: "default", Name: "my-repo"}
+
+	assert.True(t, m.insertSyncReport(models.SyncReport{}) != nil, "inserting a report without repo should fail")
+	for i := 0; i < syncReportsToKeep+5; i++ {
+		assert.NoErr(t, m.insertSyncReport(models.SyncReport{Repo: &repo, Checksum: fmt.Sprint(i)}))
+	}
+	m.View(func(c *dbutils.MemoryCatalog) error {
+		reports := c.Repo(repo.Namespace, repo.Name).SyncReports
+		assert.Equal(t, len(reports), syncReportsToKeep, "number of reports kept")
+		assert.Equal(t, reports[0].Checksum, "5", "oldest report kept")
+		return nil
+	})
+}
+
+func Test_MemoryImportFiles(t *testing.T) {
+	m := newTestMemoryManager(t)
+	index, err := parseRepoIndex([]byte(validRepoIndexYAML))
+	assert.NoErr(t, err)
+	repo := &models.Repo{Namespace: "default", Name: "test", URL: "http://testrepo.com"}
+	charts := chartsFromIndex(index, repo)
+	assert.NoErr(t, m.Sync(*repo, charts))
+
+	netClient = &goodTarballClient{c: charts[0]}
+	cv := charts[0].ChartVersions[0]
+	fImporter := fileImporter{manager: m, tarballs: m.tarballStore()}
+	r := &models.RepoInternal{Namespace: repo.Namespace, Name: repo.Name, URL: repo.URL}
+	assert.NoErr(t, fImporter.fetchAndImportFiles(charts[0].Name, r, cv))
+
+	filesID := fmt.Sprintf("%s-%s", charts[0].ID, cv.Version)
+	assert.True(t, m.filesExist(*repo, filesID, cv.Digest), "files should be imported")
+	m.View(func(c *dbutils.MemoryCatalog) error {
+		files, err := c.Repo(repo.Namespace, repo.Name).Charts[charts[0].ID].ChartFiles(filesID)
+		assert.NoErr(t, err)
+		assert.Equal(t, files.Readme, testChartReadme, "readme")
+		assert.Equal(t, files.Values, testChartValues, "values")
+		return nil
+	})
+}
+
+func Test_MemoryReimportOlderFiles(t *testing.T) {
+	m := newTestMemoryManager(t)
+	index, err := parseRepoIndex([]byte(validRepoIndexYAML))
+	assert.NoErr(t, err)
+	repo := &models.Repo{Namespace: "default", Name: "test", URL: "http://testrepo.com"}
+	charts := chartsFromIndex(index, repo)
+	assert.NoErr(t, m.Sync(*repo, charts))
+
+	// The files of a version imported before the dependencies, parameters
+	// and generated schemas were
+	cv := charts[0].ChartVersions[0]
+	filesID := fmt.Sprintf("%s-%s", charts[0].ID, cv.Version)
+	assert.NoErr(t, m.insertFiles(charts[0].ID, models.ChartFiles{ID: filesID, ChartID: charts[0].ID, Version: cv.Version, Repo: repo, Digest: cv.Digest, Values: testChartValues}))
+	assert.False(t, m.filesExist(*repo, filesID, cv.Digest), "files in an older format should be imported again")
+
+	requirements := "dependencies:\n- name: mariadb\n  version: 7.x.x\n  repository: https://kubernetes-charts.storage.googleapis.com/\n"
+	netClient = &goodTarballClient{c: charts[0], skipSchema: true, requirements: requirements}
+	fImporter := fileImporter{manager: m, report: newSyncReport(*repo, time.Now())}
+	r := &models.RepoInternal{Namespace: repo.Namespace, Name: repo.Name, URL: repo.URL}
+	assert.NoErr(t, fImporter.fetchAndImportFiles(charts[0].Name, r, cv))
+
+	assert.True(t, m.filesExist(*repo, filesID, cv.Digest), "files should be imported in the current format")
+	m.View(func(c *dbutils.MemoryCatalog) error {
+		files, err := c.Repo(repo.Namespace, repo.Name).Charts[charts[0].ID].ChartFiles(filesID)
+		assert.NoErr(t, err)
+		assert.Equal(t, files.FormatVersion, models.ChartFilesFormatVersion, "format version")
+		assert.Equal(t, files.SchemaGenerated, true, "schema generated")
+		assert.True(t, files.Schema != "", "the schema should be generated")
+		assert.Equal(t, files.Parameters, testChartParameters, "parameters")
+		assert.Equal(t, files.Dependencies, []models.ChartDependency{{Name: "mariadb", Version: "7.x.x", Repository: "https://kubernetes-charts.storage.googleapis.com/"}}, "dependencies")
+		return nil
+	})
+}
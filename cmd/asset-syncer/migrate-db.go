@@ -0,0 +1,306 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/kubeapps/kubeapps/pkg/dbutils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateFrom             string
+	migrateTo               string
+	migrateFromDatabaseURL  string
+	migrateFromDatabaseName string
+	migrateFromDatabaseUser string
+	migrateBatchSize        int
+	migrateResume           bool
+)
+
+var migrateDBCmd = &cobra.Command{
+	Use:   "migrate-db",
+	Short: "copies the catalog from one database type to another",
+	Long: `Copies the repositories, charts, chart files and sync reports from the
+--from database to the --to database. The --from-database-* flags configure
+the source database (its password is read from FROM_DB_PASSWORD) while the
+--database-* flags configure the target database.
+
+The tarballs mirrored in the source database are copied if --tarball-store is
+"database". Tarballs mirrored in a file:// store are shared by both databases
+so they are not copied. The sync reports of a repository are only copied if
+the target database has no report for it yet.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 0 {
+			logrus.Info("This command does not take any arguments")
+			cmd.Help()
+			return
+		}
+
+		if debug {
+			logrus.SetLevel(logrus.DebugLevel)
+		}
+
+		if migrateFrom != "mongodb" || migrateTo != "postgresql" {
+			logrus.Fatalf("Unsupported migration from %s to %s, only migrations from mongodb to postgresql are supported", migrateFrom, migrateTo)
+		}
+		if migrateBatchSize < 1 {
+			logrus.Fatalf("Invalid batch size %d", migrateBatchSize)
+		}
+
+		kubeappsNamespace := os.Getenv("POD_NAMESPACE")
+		fromConfig := datastore.Config{URL: migrateFromDatabaseURL, Database: migrateFromDatabaseName, Username: migrateFromDatabaseUser, Password: os.Getenv("FROM_DB_PASSWORD")}
+		from := &mongodbAssetManager{dbutils.NewMongoDBManager(fromConfig, kubeappsNamespace)}
+		// The source database is only read so its indexes are left untouched
+		err := from.MongodbAssetManager.Init()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		defer from.Close()
+
+		toConfig := datastore.Config{URL: databaseURL, Database: databaseName, Username: databaseUser, Password: databasePassword}
+		pgManager, err := dbutils.NewPGManager(toConfig, kubeappsNamespace)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		to := &postgresAssetManager{pgManager}
+		err = to.Init()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		defer to.Close()
+
+		migrator := dbMigrator{from: from, to: to, batchSize: migrateBatchSize, resume: migrateResume, copyTarballs: tarballStore == blobstore.DatabaseStore}
+		if err = migrator.migrate(); err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.Infof("Successfully migrated the catalog from %s to %s", migrateFrom, migrateTo)
+	},
+}
+
+func init() {
+	migrateDBCmd.Flags().StringVar(&migrateFrom, "from", "mongodb", "Database type to migrate from. Choice: mongodb")
+	migrateDBCmd.Flags().StringVar(&migrateTo, "to", "postgresql", "Database type to migrate to. Choice: postgresql")
+	migrateDBCmd.Flags().StringVar(&migrateFromDatabaseURL, "from-database-url", "localhost", "URL of the database to migrate from")
+	migrateDBCmd.Flags().StringVar(&migrateFromDatabaseName, "from-database-name", "charts", "Name of the database to migrate from")
+	migrateDBCmd.Flags().StringVar(&migrateFromDatabaseUser, "from-database-user", "", "User of the database to migrate from")
+	migrateDBCmd.Flags().IntVar(&migrateBatchSize, "batch-size", 100, "Number of charts read from the source database at once")
+	migrateDBCmd.Flags().BoolVar(&migrateResume, "resume", false, "Skip the repositories already migrated by a previous run")
+}
+
+// dbMigrator copies the catalog of a MongoDB database into a PostgreSQL one
+type dbMigrator struct {
+	from      *mongodbAssetManager
+	to        *postgresAssetManager
+	batchSize int
+	// resume skips the repositories whose checksum has been already copied,
+	// which only happens once all their charts and files are copied
+	resume bool
+	// copyTarballs copies the tarballs mirrored in the source database
+	copyTarballs bool
+}
+
+func (d *dbMigrator) migrate() error {
+	checks, err := d.from.getRepoChecks()
+	if err != nil {
+		return err
+	}
+	for _, check := range checks {
+		repo := models.Repo{Namespace: check.Namespace, Name: check.Name}
+		log := logrus.WithFields(logrus.Fields{"namespace": repo.Namespace, "repo": repo.Name})
+		if d.resume && check.Checksum != "" && d.to.RepoAlreadyProcessed(repo, check.Checksum) {
+			log.Info("Skipping repository already migrated")
+			continue
+		}
+		charts, files, err := d.migrateRepo(check)
+		if err != nil {
+			return fmt.Errorf("unable to migrate repository %s/%s: %v", repo.Namespace, repo.Name, err)
+		}
+		log.WithFields(logrus.Fields{"charts": charts, "files": files}).Info("Migrated repository")
+	}
+	return nil
+}
+
+// migrateRepo copies the charts and files of a repository in batches and
+// returns the number of charts and files copied
+func (d *dbMigrator) migrateRepo(check mongoRepoCheck) (int, int, error) {
+	repo := models.Repo{Namespace: check.Namespace, Name: check.Name}
+	_, err := d.to.EnsureRepoExists(repo.Namespace, repo.Name)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Only the IDs of the migrated charts are kept to remove the charts which
+	// are not in the source database anymore.
+	chartIDs := []models.Chart{}
+	fileIDs := []string{}
+	var last bson.ObjectId
+	for {
+		batch, err := d.from.getChartsBatch(repo, last, d.batchSize)
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		charts := []models.Chart{}
+		batchFileIDs := []string{}
+		fileCharts := map[string]string{}
+		for _, c := range batch {
+			charts = append(charts, c.Chart)
+			chartIDs = append(chartIDs, models.Chart{ID: c.ID})
+			for _, cv := range c.ChartVersions {
+				fileID := fmt.Sprintf("%s-%s", c.ID, cv.Version)
+				batchFileIDs = append(batchFileIDs, fileID)
+				fileCharts[fileID] = c.ID
+			}
+		}
+		if err = d.to.importCharts(d.to.DB, charts, repo); err != nil {
+			return 0, 0, err
+		}
+		for _, c := range charts {
+			if len(c.RawIcon) > 0 {
+				if err = d.to.updateIcon(repo, c.RawIcon, c.IconContentType, c.ID); err != nil {
+					return 0, 0, err
+				}
+			}
+		}
+
+		files, err := d.from.getRepoChartFiles(repo, batchFileIDs)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, f := range files {
+			if err = d.to.insertFiles(fileCharts[f.ID], f); err != nil {
+				return 0, 0, err
+			}
+			if err = d.copyTarball(f.Digest); err != nil {
+				return 0, 0, err
+			}
+			fileIDs = append(fileIDs, f.ID)
+		}
+
+		last = batch[len(batch)-1].ObjectID
+		if len(batch) < d.batchSize {
+			break
+		}
+	}
+	if err = d.to.removeMissingCharts(d.to.DB, repo, chartIDs); err != nil {
+		return 0, 0, err
+	}
+
+	if err = d.verifyRepo(repo, len(chartIDs), fileIDs); err != nil {
+		return 0, 0, err
+	}
+	if err = d.copySyncReports(repo); err != nil {
+		return 0, 0, err
+	}
+
+	// The checksum is copied last so a resumed migration copies again the
+	// repositories which were not completed.
+	if check.Checksum != "" {
+		if err = d.to.UpdateLastCheck(repo.Namespace, repo.Name, check.Checksum, check.LastUpdate); err != nil {
+			return 0, 0, err
+		}
+	}
+	return len(chartIDs), len(fileIDs), nil
+}
+
+// copyTarball copies the tarball with the given digest if it's mirrored in
+// the source database and missing in the target one
+func (d *dbMigrator) copyTarball(digest string) error {
+	if !d.copyTarballs || digest == "" {
+		return nil
+	}
+	to := d.to.tarballStore()
+	exists, err := to.Exists(digest)
+	if err != nil || exists {
+		return err
+	}
+	tarball, err := d.from.tarballStore().Get(digest)
+	if err == blobstore.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return to.Put(digest, tarball)
+}
+
+// copySyncReports copies the sync reports of a repository unless the target
+// database has already reports for it, like the ones of a previous run or of
+// a sync against the target database
+func (d *dbMigrator) copySyncReports(repo models.Repo) error {
+	count, err := d.to.countRepoRows(dbutils.SyncReportTable, repo)
+	if err != nil || count > 0 {
+		return err
+	}
+	reports, err := d.from.getSyncReports(repo)
+	if err != nil {
+		return err
+	}
+	for _, r := range reports {
+		if err = d.to.insertSyncReport(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyRepo compares the number of rows of a repository in the target
+// database with the documents in the source database. The target database can
+// have files which were not migrated, like the ones imported by a sync against
+// it, so only the migrated files are checked.
+func (d *dbMigrator) verifyRepo(repo models.Repo, chartCount int, fileIDs []string) error {
+	sourceCharts, err := d.from.countRepoDocuments(dbutils.ChartCollection, repo)
+	if err != nil {
+		return err
+	}
+	targetCharts, err := d.to.countRepoRows(dbutils.ChartTable, repo)
+	if err != nil {
+		return err
+	}
+	if sourceCharts != chartCount || targetCharts != chartCount {
+		return fmt.Errorf("found %d charts in mongodb and %d in postgresql, %d were migrated", sourceCharts, targetCharts, chartCount)
+	}
+
+	sourceFiles, err := d.from.countRepoDocuments(dbutils.ChartFilesCollection, repo)
+	if err != nil {
+		return err
+	}
+	fileCount := len(fileIDs)
+	targetFiles, err := d.to.countRepoFiles(repo, fileIDs)
+	if err != nil {
+		return err
+	}
+	if targetFiles != fileCount {
+		return fmt.Errorf("found %d of the migrated chart files in postgresql, %d were migrated", targetFiles, fileCount)
+	}
+	if sourceFiles > fileCount {
+		// Files of chart versions removed from the index are kept by MongoDB
+		// but they can't be stored without their chart in PostgreSQL
+		logrus.WithFields(logrus.Fields{"namespace": repo.Namespace, "repo": repo.Name}).Infof("Skipped %d chart files without a chart version", sourceFiles-fileCount)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/globalsign/mgo/bson"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/kubeapps/kubeapps/pkg/dbutils"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/mock"
+)
+
+// chartInfoWithoutIcon matches the info of a chart without its icon data
+type chartInfoWithoutIcon struct{}
+
+func (chartInfoWithoutIcon) Match(v driver.Value) bool {
+	info, ok := v.(string)
+	return ok && strings.Contains(info, `"raw_icon":null`) && strings.Contains(info, `"icon_content_type":"image/png"`)
+}
+
+func Test_migrateRepo(t *testing.T) {
+	repo := models.Repo{Namespace: "repo-namespace", Name: "repo-name"}
+	lastUpdate := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	check := mongoRepoCheck{Namespace: repo.Namespace, Name: repo.Name, Checksum: "123", LastUpdate: lastUpdate}
+	charts := []mongoChart{
+		{ObjectID: bson.ObjectIdHex("5e5b9a2e1c9d440000a1b2c3"), Chart: models.Chart{
+			ID: "repo-name/wordpress", Repo: &repo, RawIcon: []byte("icon"), IconContentType: "image/png",
+			ChartVersions: []models.ChartVersion{{Version: "2.0.0"}, {Version: "1.0.0"}},
+		}},
+	}
+	files := []models.ChartFiles{
+		{ID: "repo-name/wordpress-2.0.0", Readme: "README", Repo: &repo, Digest: "abc"},
+	}
+	reports := []models.SyncReport{
+		{Repo: &repo, StartTime: lastUpdate, Checksum: check.Checksum},
+	}
+
+	tests := []struct {
+		name          string
+		sourceCount   int
+		targetCount   int
+		targetFiles   int
+		targetReports int
+		copyTarballs  bool
+		expectedErr   string
+	}{
+		{
+			name:        "it copies the charts, files and sync reports of the repository",
+			sourceCount: 1,
+			targetCount: 1,
+			targetFiles: 1,
+		},
+		{
+			name:         "it copies the mirrored tarballs",
+			sourceCount:  1,
+			targetCount:  1,
+			targetFiles:  1,
+			copyTarballs: true,
+		},
+		{
+			name:          "it keeps the sync reports already in the target database",
+			sourceCount:   1,
+			targetCount:   1,
+			targetFiles:   1,
+			targetReports: 2,
+		},
+		{
+			name:        "it fails if the number of charts differs",
+			sourceCount: 2,
+			targetCount: 1,
+			expectedErr: "found 2 charts in mongodb and 1 in postgresql, 1 were migrated",
+		},
+		{
+			name:        "it fails if the migrated files are not found",
+			sourceCount: 1,
+			targetCount: 1,
+			targetFiles: 0,
+			expectedErr: "found 0 of the migrated chart files in postgresql, 1 were migrated",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mock.Mock{}
+			m.On("All", mock.AnythingOfType("*[]main.mongoChart")).Run(func(args mock.Arguments) {
+				*args.Get(0).(*[]mongoChart) = charts
+			}).Once()
+			m.On("All", mock.AnythingOfType("*[]models.ChartFiles")).Run(func(args mock.Arguments) {
+				*args.Get(0).(*[]models.ChartFiles) = files
+			}).Once()
+			m.On("One", mock.AnythingOfType("*main.mongoCount")).Run(func(args mock.Arguments) {
+				*args.Get(0).(*mongoCount) = mongoCount{Count: tt.sourceCount}
+			})
+			if tt.copyTarballs {
+				m.On("One", mock.AnythingOfType("*dbutils.mongoTarball")).Run(func(args mock.Arguments) {
+					reflect.ValueOf(args.Get(0)).Elem().FieldByName("Data").SetBytes([]byte("tarball"))
+				}).Once()
+			}
+			if tt.expectedErr == "" && tt.targetReports == 0 {
+				m.On("All", mock.AnythingOfType("*[]models.SyncReport")).Run(func(args mock.Arguments) {
+					*args.Get(0).(*[]models.SyncReport) = reports
+				}).Once()
+			}
+			from := getMockManager(m)
+
+			db, sqlMock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			to := &postgresAssetManager{&dbutils.PostgresAssetManager{DB: db}}
+			sqlMock.ExpectQuery("INSERT INTO repos").WithArgs(repo.Namespace, repo.Name).WillReturnRows(sqlmock.NewRows([]string{"ID"}).AddRow(1))
+			sqlMock.ExpectExec("^INSERT INTO charts").
+				WithArgs(repo.Namespace, repo.Name, "repo-name/wordpress", chartInfoWithoutIcon{}).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			sqlMock.ExpectQuery("INSERT INTO icons").
+				WithArgs("image/png", "repo-name/wordpress", repo.Namespace, repo.Name, sqlmock.AnyArg(), []byte("icon")).
+				WillReturnRows(sqlmock.NewRows([]string{"ID"}).AddRow(1))
+			sqlMock.ExpectQuery("^INSERT INTO files").
+				WithArgs("repo-name/wordpress", repo.Name, repo.Namespace, "repo-name/wordpress-2.0.0", sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{}))
+			if tt.copyTarballs {
+				sqlMock.ExpectQuery(`^SELECT EXISTS\(SELECT 1 FROM tarballs WHERE digest = \$1\)$`).
+					WithArgs("abc").
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				sqlMock.ExpectExec("^INSERT INTO tarballs").
+					WithArgs("abc", []byte("tarball")).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			sqlMock.ExpectExec(`^DELETE FROM charts WHERE repo_name = \$1 AND repo_namespace = \$2 AND chart_id <> ALL\(\$3\)$`).
+				WithArgs(repo.Name, repo.Namespace, pq.Array([]string{"repo-name/wordpress"})).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			sqlMock.ExpectQuery(`^SELECT COUNT\(\*\) FROM charts WHERE repo_name = \$1 AND repo_namespace = \$2$`).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.targetCount))
+			if tt.sourceCount == tt.targetCount {
+				sqlMock.ExpectQuery(`^SELECT COUNT\(\*\) FROM files WHERE repo_name = \$1 AND repo_namespace = \$2 AND chart_files_ID = ANY\(\$3\)$`).
+					WithArgs(repo.Name, repo.Namespace, pq.Array([]string{"repo-name/wordpress-2.0.0"})).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.targetFiles))
+			}
+			if tt.expectedErr == "" {
+				sqlMock.ExpectQuery(`^SELECT COUNT\(\*\) FROM sync_reports WHERE repo_name = \$1 AND repo_namespace = \$2$`).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.targetReports))
+				if tt.targetReports == 0 {
+					sqlMock.ExpectQuery("INSERT INTO repos").WithArgs(repo.Namespace, repo.Name).WillReturnRows(sqlmock.NewRows([]string{"ID"}).AddRow(1))
+					sqlMock.ExpectQuery("^INSERT INTO sync_reports").
+						WithArgs(repo.Namespace, repo.Name, sqlmock.AnyArg()).
+						WillReturnRows(sqlmock.NewRows([]string{}))
+					sqlMock.ExpectQuery("^DELETE FROM sync_reports").
+						WillReturnRows(sqlmock.NewRows([]string{}))
+				}
+				sqlMock.ExpectQuery("^INSERT INTO repos").
+					WithArgs(repo.Namespace, repo.Name, check.Checksum, lastUpdate.String()).
+					WillReturnRows(sqlmock.NewRows([]string{}))
+			}
+
+			migrator := dbMigrator{from: from, to: to, batchSize: 10, copyTarballs: tt.copyTarballs}
+			chartCount, fileCount, err := migrator.migrateRepo(check)
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Errorf("got: %v, want error containing %q", err, tt.expectedErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+				if chartCount != 1 || fileCount != 1 {
+					t.Errorf("got %d charts and %d files, want 1 chart and 1 file", chartCount, fileCount)
+				}
+			}
+			m.AssertExpectations(t)
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
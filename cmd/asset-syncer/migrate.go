@@ -0,0 +1,68 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+
+	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/dbutils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "applies the pending schema migrations to the database",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 0 {
+			logrus.Info("This command does not take any arguments")
+			cmd.Help()
+			return
+		}
+
+		if debug {
+			logrus.SetLevel(logrus.DebugLevel)
+		}
+
+		if databaseType != "postgresql" {
+			logrus.Infof("Schema migrations are not needed for %s", databaseType)
+			return
+		}
+
+		dbConfig := datastore.Config{URL: databaseURL, Database: databaseName, Username: databaseUser, Password: databasePassword}
+		kubeappsNamespace := os.Getenv("POD_NAMESPACE")
+		manager, err := dbutils.NewPGManager(dbConfig, kubeappsNamespace)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		err = manager.Init()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		defer manager.Close()
+
+		version, err := manager.SchemaVersion()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if err = manager.Migrate(); err != nil {
+			logrus.Fatalf("Can't migrate the database schema from version %d: %v", version, err)
+		}
+		logrus.Infof("Successfully migrated the database schema from version %d to %d", version, dbutils.LatestSchemaVersion())
+	},
+}
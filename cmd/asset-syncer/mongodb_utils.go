@@ -18,10 +18,13 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
+	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
 	"github.com/kubeapps/kubeapps/pkg/dbutils"
 )
@@ -37,6 +40,15 @@ func newMongoDBManager(config datastore.Config, kubeappsNamespace string) assetM
 	return &mongodbAssetManager{m}
 }
 
+// Init connects to the database and creates the missing indexes
+func (m *mongodbAssetManager) Init() error {
+	err := m.MongodbAssetManager.Init()
+	if err != nil {
+		return err
+	}
+	return m.EnsureIndexes()
+}
+
 // Syncing is performed in the following steps:
 // 1. Update database to match chart metadata from index
 // 2. Concurrently process icons for charts (concurrently)
@@ -84,6 +96,14 @@ func (m *mongodbAssetManager) Delete(repo models.Repo) error {
 		return err
 	}
 
+	_, err = db.C(dbutils.SyncReportCollection).RemoveAll(bson.M{
+		"repo.name":      repo.Name,
+		"repo.namespace": repo.Namespace,
+	})
+	if err != nil {
+		return err
+	}
+
 	_, err = db.C(dbutils.RepositoryCollection).RemoveAll(bson.M{
 		"name":      repo.Name,
 		"namespace": repo.Namespace,
@@ -134,7 +154,7 @@ func (m *mongodbAssetManager) updateIcon(repo models.Repo, data []byte, contentT
 func (m *mongodbAssetManager) filesExist(repo models.Repo, chartFilesID, digest string) bool {
 	db, closer := m.DBSession.DB()
 	defer closer()
-	err := db.C(dbutils.ChartFilesCollection).Find(bson.M{"file_id": chartFilesID, "repo.name": repo.Name, "repo.namespace": repo.Namespace, "digest": digest}).One(&models.ChartFiles{})
+	err := db.C(dbutils.ChartFilesCollection).Find(bson.M{"file_id": chartFilesID, "repo.name": repo.Name, "repo.namespace": repo.Namespace, "digest": digest, "formatversion": bson.M{"$gte": models.ChartFilesFormatVersion}}).One(&models.ChartFiles{})
 	return err == nil
 }
 
@@ -145,3 +165,160 @@ func (m *mongodbAssetManager) insertFiles(chartId string, files models.ChartFile
 	_, err := db.C(dbutils.ChartFilesCollection).Upsert(bson.M{"file_id": files.ID, "repo.name": files.Repo.Name, "repo.namespace": files.Repo.Namespace}, files)
 	return err
 }
+
+func (m *mongodbAssetManager) tarballStore() blobstore.Store {
+	return dbutils.MongoTarballStore{DBSession: m.DBSession}
+}
+
+func (m *mongodbAssetManager) getRepoCharts(repo models.Repo) ([]models.Chart, error) {
+	db, closer := m.DBSession.DB()
+	defer closer()
+	charts := []models.Chart{}
+	err := db.C(dbutils.ChartCollection).Find(bson.M{"repo.name": repo.Name, "repo.namespace": repo.Namespace}).Select(bson.M{
+		"chart_id": 1, "chartversions.version": 1, "chartversions.digest": 1,
+	}).All(&charts)
+	return charts, err
+}
+
+func (m *mongodbAssetManager) insertSyncReport(report models.SyncReport) error {
+	if report.Repo == nil {
+		return fmt.Errorf("unable to insert sync report without repo")
+	}
+	db, closer := m.DBSession.DB()
+	defer closer()
+	err := db.C(dbutils.SyncReportCollection).Insert(report)
+	if err != nil {
+		return err
+	}
+
+	// Remove the reports older than the latest ones
+	repoSelector := bson.M{"repo.name": report.Repo.Name, "repo.namespace": report.Repo.Namespace}
+	var reports []models.SyncReport
+	err = db.C(dbutils.SyncReportCollection).Find(repoSelector).Sort("-start_time").Select(bson.M{"start_time": 1}).All(&reports)
+	if err != nil || len(reports) <= syncReportsToKeep {
+		return err
+	}
+	repoSelector["start_time"] = bson.M{"$lt": reports[syncReportsToKeep-1].StartTime}
+	_, err = db.C(dbutils.SyncReportCollection).RemoveAll(repoSelector)
+	return err
+}
+
+// mongoRepoCheck is a document of the repositories collection
+type mongoRepoCheck struct {
+	Namespace  string    `bson:"namespace"`
+	Name       string    `bson:"name"`
+	Checksum   string    `bson:"checksum"`
+	LastUpdate time.Time `bson:"last_update"`
+}
+
+// mongoChart is a document of the charts collection, its object ID is used
+// to read the charts of a repository in batches
+type mongoChart struct {
+	ObjectID     bson.ObjectId `bson:"_id"`
+	models.Chart `bson:",inline"`
+}
+
+// getRepoChecks returns the repositories with a sync record or charts, the
+// latter being the case of repositories which never completed a sync
+func (m *mongodbAssetManager) getRepoChecks() ([]mongoRepoCheck, error) {
+	db, closer := m.DBSession.DB()
+	defer closer()
+	var checks []mongoRepoCheck
+	err := db.C(dbutils.RepositoryCollection).Find(bson.M{}).All(&checks)
+	if err != nil {
+		return nil, err
+	}
+	var chartRepos []struct {
+		Repo models.Repo `bson:"_id"`
+	}
+	err = db.C(dbutils.ChartCollection).Pipe([]bson.M{
+		{"$group": bson.M{"_id": bson.M{"namespace": "$repo.namespace", "name": "$repo.name"}}},
+	}).All(&chartRepos)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[models.Repo]bool{}
+	for _, c := range checks {
+		found[models.Repo{Namespace: c.Namespace, Name: c.Name}] = true
+	}
+	for _, r := range chartRepos {
+		if !found[models.Repo{Namespace: r.Repo.Namespace, Name: r.Repo.Name}] {
+			checks = append(checks, mongoRepoCheck{Namespace: r.Repo.Namespace, Name: r.Repo.Name})
+		}
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		if checks[i].Namespace != checks[j].Namespace {
+			return checks[i].Namespace < checks[j].Namespace
+		}
+		return checks[i].Name < checks[j].Name
+	})
+	return checks, nil
+}
+
+// getChartsBatch returns up to limit charts of a repository stored after the
+// given object ID
+func (m *mongodbAssetManager) getChartsBatch(repo models.Repo, after bson.ObjectId, limit int) ([]mongoChart, error) {
+	db, closer := m.DBSession.DB()
+	defer closer()
+	matcher := bson.M{"repo.name": repo.Name, "repo.namespace": repo.Namespace}
+	if after != "" {
+		matcher["_id"] = bson.M{"$gt": after}
+	}
+	var charts []mongoChart
+	err := db.C(dbutils.ChartCollection).Pipe([]bson.M{
+		{"$match": matcher},
+		{"$sort": bson.M{"_id": 1}},
+		{"$limit": limit},
+	}).All(&charts)
+	return charts, err
+}
+
+// getRepoChartFiles returns the files of a repository with the given IDs
+func (m *mongodbAssetManager) getRepoChartFiles(repo models.Repo, fileIDs []string) ([]models.ChartFiles, error) {
+	db, closer := m.DBSession.DB()
+	defer closer()
+	var files []models.ChartFiles
+	err := db.C(dbutils.ChartFilesCollection).Find(bson.M{
+		"repo.name": repo.Name, "repo.namespace": repo.Namespace, "file_id": bson.M{"$in": fileIDs},
+	}).All(&files)
+	return files, err
+}
+
+// getSyncReports returns the latest sync reports of a repository, the oldest
+// first
+func (m *mongodbAssetManager) getSyncReports(repo models.Repo) ([]models.SyncReport, error) {
+	db, closer := m.DBSession.DB()
+	defer closer()
+	var reports []models.SyncReport
+	err := db.C(dbutils.SyncReportCollection).Find(bson.M{"repo.name": repo.Name, "repo.namespace": repo.Namespace}).Sort("start_time").All(&reports)
+	if err != nil {
+		return nil, err
+	}
+	if len(reports) > syncReportsToKeep {
+		reports = reports[len(reports)-syncReportsToKeep:]
+	}
+	return reports, nil
+}
+
+// mongoCount is the result of a $count stage
+type mongoCount struct {
+	Count int `bson:"count"`
+}
+
+// countRepoDocuments returns the number of documents of a repository in the
+// given collection
+func (m *mongodbAssetManager) countRepoDocuments(collection string, repo models.Repo) (int, error) {
+	db, closer := m.DBSession.DB()
+	defer closer()
+	var count mongoCount
+	err := db.C(collection).Pipe([]bson.M{
+		{"$match": bson.M{"repo.name": repo.Name, "repo.namespace": repo.Namespace}},
+		{"$count": "count"},
+	}).One(&count)
+	if err == mgo.ErrNotFound {
+		// $count doesn't return a document if nothing matches
+		return 0, nil
+	}
+	return count.Count, err
+}
@@ -138,3 +138,18 @@ func Test_updateLastCheck(t *testing.T) {
 		t.Errorf("Expected one call got %d", len(m.Calls))
 	}
 }
+
+func Test_insertSyncReport(t *testing.T) {
+	m := &mock.Mock{}
+	repo := models.Repo{Name: "repo-name", Namespace: "repo-namespace"}
+	report := models.SyncReport{Repo: &repo, Checksum: "123"}
+	var reports []models.SyncReport
+	m.On("Insert", report)
+	m.On("All", &reports)
+	manager := getMockManager(m)
+	err := manager.insertSyncReport(report)
+	if err != nil {
+		t.Errorf("failed to insert sync report: %v", err)
+	}
+	m.AssertExpectations(t)
+}
@@ -24,9 +24,12 @@ package main
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"sort"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
 	"github.com/kubeapps/kubeapps/pkg/dbutils"
 	"github.com/kubeapps/kubeapps/pkg/dbutils/dbutilstest/pgtest"
@@ -122,7 +125,7 @@ func TestImportCharts(t *testing.T) {
 				t.Fatalf("%+v", err)
 			}
 
-			err = pam.importCharts(tc.charts, repo)
+			err = pam.importCharts(pam.DB, tc.charts, repo)
 			if err != nil {
 				t.Errorf("%+v", err)
 			}
@@ -384,7 +387,7 @@ func TestRemoveMissingCharts(t *testing.T) {
 				ensureFilesExist(t, pam, chartId, files)
 			}
 
-			err := pam.removeMissingCharts(repo, tc.remainingCharts)
+			err := pam.removeMissingCharts(pam.DB, repo, tc.remainingCharts)
 			if err != nil {
 				t.Fatalf("%+v", err)
 			}
@@ -464,8 +467,14 @@ func TestFilesExist(t *testing.T) {
 		t.Errorf("got: %t, want: %t", got, want)
 	}
 
-	// true when it exists in the repo with the correct digest
+	// false when it was imported in an older format
 	ensureFilesExist(t, pam, chartId, []models.ChartFiles{models.ChartFiles{ID: filesId, Repo: &repo, Digest: digest}})
+	if got, want := pam.filesExist(repo, filesId, digest), false; got != want {
+		t.Errorf("got: %t, want: %t", got, want)
+	}
+
+	// true when it exists in the repo with the correct digest
+	ensureFilesExist(t, pam, chartId, []models.ChartFiles{models.ChartFiles{ID: filesId, Repo: &repo, Digest: digest, FormatVersion: models.ChartFilesFormatVersion}})
 	if got, want := pam.filesExist(repo, filesId, digest), true; got != want {
 		t.Errorf("got: %t, want: %t", got, want)
 	}
@@ -535,3 +544,155 @@ func TestUpdateIcon(t *testing.T) {
 		})
 	}
 }
+
+func TestSync(t *testing.T) {
+	pgtest.SkipIfNoDB(t)
+	repo := models.Repo{Namespace: "my-namespace", Name: "my-repo"}
+	existingCharts := []models.Chart{
+		models.Chart{ID: "my-repo/my-chart", Name: "my-chart"},
+		models.Chart{ID: "my-repo/other-chart", Name: "other-chart"},
+	}
+	manyCharts := []models.Chart{}
+	for i := 0; i < chartsBatchSize+10; i++ {
+		manyCharts = append(manyCharts, models.Chart{ID: fmt.Sprintf("my-repo/chart-%d", i)})
+	}
+
+	testCases := []struct {
+		name           string
+		charts         []models.Chart
+		expectedErr    bool
+		expectedCharts []string
+	}{
+		{
+			name: "it upserts the charts and removes the missing ones",
+			charts: []models.Chart{
+				models.Chart{ID: "my-repo/my-chart", Name: "my-chart", Description: "updated"},
+				models.Chart{ID: "my-repo/new-chart", Name: "new-chart"},
+			},
+			expectedCharts: []string{"my-repo/my-chart", "my-repo/new-chart"},
+		},
+		{
+			name: "it handles chart IDs which aren't valid SQL literals",
+			charts: []models.Chart{
+				models.Chart{ID: "my-repo/my-chart", Name: "my-chart"},
+				models.Chart{ID: "my-repo/it's-a-chart') OR ('1' = '1", Name: "it's-a-chart"},
+			},
+			expectedCharts: []string{"my-repo/it's-a-chart') OR ('1' = '1", "my-repo/my-chart"},
+		},
+		{
+			name:           "it imports charts in several batches",
+			charts:         manyCharts,
+			expectedCharts: nil,
+		},
+		{
+			name: "it leaves the existing charts untouched if the sync fails",
+			// The same chart can't be upserted twice in the same statement
+			charts: []models.Chart{
+				models.Chart{ID: "my-repo/new-chart", Name: "new-chart"},
+				models.Chart{ID: "my-repo/new-chart", Name: "new-chart"},
+			},
+			expectedErr:    true,
+			expectedCharts: []string{"my-repo/my-chart", "my-repo/other-chart"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pam, cleanup := getInitializedManager(t)
+			defer cleanup()
+			pgtest.EnsureChartsExist(t, pam, existingCharts, repo)
+
+			err := pam.Sync(repo, tc.charts)
+			if got, want := err != nil, tc.expectedErr; got != want {
+				t.Fatalf("got error: %+v, want error: %t", err, want)
+			}
+
+			charts, err := pam.getRepoCharts(repo)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if tc.expectedCharts == nil {
+				if got, want := len(charts), len(tc.charts); got != want {
+					t.Errorf("got: %d, want: %d", got, want)
+				}
+				return
+			}
+			chartIDs := []string{}
+			for _, c := range charts {
+				chartIDs = append(chartIDs, c.ID)
+			}
+			sort.Strings(chartIDs)
+			if !cmp.Equal(chartIDs, tc.expectedCharts) {
+				t.Errorf(cmp.Diff(tc.expectedCharts, chartIDs))
+			}
+		})
+	}
+}
+
+func TestUpdateIconContentType(t *testing.T) {
+	pgtest.SkipIfNoDB(t)
+	repo := models.Repo{Namespace: "repo-namespace", Name: "repo-name"}
+	const (
+		chartId         = "repo-name/chart-id"
+		iconContentType = `image/svg+xml"; charset='utf-8'`
+	)
+
+	pam, cleanup := getInitializedManager(t)
+	defer cleanup()
+	pgtest.EnsureChartsExist(t, pam, []models.Chart{models.Chart{ID: chartId}}, repo)
+
+	err := pam.updateIcon(repo, []byte("icon-data"), iconContentType, chartId)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	charts, err := pam.getRepoCharts(repo)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if got, want := charts[0].IconContentType, iconContentType; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+	if charts[0].RawIcon != nil {
+		t.Errorf("got: %q, want the icon data stored in the icons table", charts[0].RawIcon)
+	}
+
+	var contentType string
+	var data []byte
+	err = pam.DB.QueryRow("SELECT content_type, data FROM icons WHERE repo_namespace = $1 AND repo_name = $2 AND chart_id = $3", repo.Namespace, repo.Name, chartId).Scan(&contentType, &data)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if got, want := contentType, iconContentType; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+	if got, want := string(data), "icon-data"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	pgtest.SkipIfNoDB(t)
+	pam, cleanup := getInitializedManager(t)
+	defer cleanup()
+
+	// Migrating an up to date database is a no-op
+	err := pam.Migrate()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	version, err := pam.SchemaVersion()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if got, want := version, dbutils.LatestSchemaVersion(); got != want {
+		t.Errorf("got: %d, want: %d", got, want)
+	}
+	if got, want := pgtest.CountRows(t, pam.DB, dbutils.SchemaVersionTable), dbutils.LatestSchemaVersion(); got != want {
+		t.Errorf("got: %d, want: %d", got, want)
+	}
+	if err = pam.CheckSchemaVersion(); err != nil {
+		t.Errorf("%+v", err)
+	}
+}
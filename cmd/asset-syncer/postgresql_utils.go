@@ -17,21 +17,27 @@ limitations under the License.
 package main
 
 import (
+	"crypto/sha256"
 	"database/sql"
-	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
 	"github.com/kubeapps/kubeapps/pkg/dbutils"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 var ErrMultipleRows = fmt.Errorf("more than one row returned in query result")
 
+// chartsBatchSize is the maximum number of charts upserted in a single
+// statement, each chart uses two of the 65535 parameters allowed by PostgreSQL
+const chartsBatchSize = 1000
+
 type postgresAssetManager struct {
 	*dbutils.PostgresAssetManager
 }
@@ -44,6 +50,15 @@ func newPGManager(config datastore.Config, kubeappsNamespace string) (assetManag
 	return &postgresAssetManager{m}, nil
 }
 
+// Init connects to the database and applies the pending schema migrations
+func (m *postgresAssetManager) Init() error {
+	err := m.PostgresAssetManager.Init()
+	if err != nil {
+		return err
+	}
+	return m.InitTables()
+}
+
 // Syncing is performed in the following steps:
 // 1. Update database to match chart metadata from index
 // 2. Concurrently process icons for charts (concurrently)
@@ -53,22 +68,32 @@ func newPGManager(config datastore.Config, kubeappsNamespace string) (assetManag
 // These steps are processed in this way to ensure relevant chart data is
 // imported into the database as fast as possible. E.g. we want all icons for
 // charts before fetching readmes for each chart and version pair.
+//
+// The repo and its charts are updated in a single transaction so a failed
+// sync doesn't leave the catalog half-updated. The icons and files are
+// fetched and stored once the charts are committed, each one on its own, and
+// the missing ones are imported again by the next sync.
 func (m *postgresAssetManager) Sync(repo models.Repo, charts []models.Chart) error {
-	m.InitTables()
-
-	// Ensure the repo exists so FK constraints will be met.
-	_, err := m.EnsureRepoExists(repo.Namespace, repo.Name)
+	tx, err := m.DB.Begin()
 	if err != nil {
 		return err
 	}
-
-	err = m.importCharts(charts, repo)
+	// Ensure the repo exists so FK constraints will be met.
+	_, err = dbutils.EnsureRepoExistsIn(tx, repo.Namespace, repo.Name)
+	if err == nil {
+		err = m.importCharts(tx, charts, repo)
+	}
+	if err == nil {
+		// Remove charts no longer existing in index
+		err = m.removeMissingCharts(tx, repo, charts)
+	}
 	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("%v (unable to rollback: %v)", err, rollbackErr)
+		}
 		return err
 	}
-
-	// Remove charts no longer existing in index
-	return m.removeMissingCharts(repo, charts)
+	return tx.Commit()
 }
 
 func (m *postgresAssetManager) RepoAlreadyProcessed(repo models.Repo, repoChecksum string) bool {
@@ -94,17 +119,31 @@ func (m *postgresAssetManager) UpdateLastCheck(repoNamespace, repoName, checksum
 	return err
 }
 
-func (m *postgresAssetManager) importCharts(charts []models.Chart, repo models.Repo) error {
-	for _, chart := range charts {
-		d, err := json.Marshal(chart)
-		if err != nil {
-			return err
+// importCharts upserts the charts of a repo using multi-row inserts of up to
+// chartsBatchSize charts
+func (m *postgresAssetManager) importCharts(db dbutils.PostgresQueryer, charts []models.Chart, repo models.Repo) error {
+	for start := 0; start < len(charts); start += chartsBatchSize {
+		end := start + chartsBatchSize
+		if end > len(charts) {
+			end = len(charts)
+		}
+		values := []string{}
+		args := []interface{}{repo.Namespace, repo.Name}
+		for _, chart := range charts[start:end] {
+			// Icons are stored in their own table
+			chart.RawIcon = nil
+			d, err := json.Marshal(chart)
+			if err != nil {
+				return err
+			}
+			args = append(args, chart.ID, string(d))
+			values = append(values, fmt.Sprintf("($1, $2, $%d, $%d)", len(args)-1, len(args)))
 		}
-		_, err = m.DB.Exec(fmt.Sprintf(`INSERT INTO %s (repo_namespace, repo_name, chart_id, info)
-		VALUES ($1, $2, $3, $4)
+		_, err := db.Exec(fmt.Sprintf(`INSERT INTO %s (repo_namespace, repo_name, chart_id, info)
+		VALUES %s
 		ON CONFLICT (chart_id, repo_namespace, repo_name)
-		DO UPDATE SET info = $4
-		`, dbutils.ChartTable), repo.Namespace, repo.Name, chart.ID, string(d))
+		DO UPDATE SET info = EXCLUDED.info || jsonb_strip_nulls(jsonb_build_object('icon_content_type', %s.info -> 'icon_content_type'))
+		`, dbutils.ChartTable, strings.Join(values, ", "), dbutils.ChartTable), args...)
 		if err != nil {
 			return err
 		}
@@ -113,16 +152,12 @@ func (m *postgresAssetManager) importCharts(charts []models.Chart, repo models.R
 	return nil
 }
 
-func (m *postgresAssetManager) removeMissingCharts(repo models.Repo, charts []models.Chart) error {
-	var chartIDs []string
+func (m *postgresAssetManager) removeMissingCharts(db dbutils.PostgresQueryer, repo models.Repo, charts []models.Chart) error {
+	chartIDs := []string{}
 	for _, chart := range charts {
-		chartIDs = append(chartIDs, fmt.Sprintf("'%s'", chart.ID))
-	}
-	chartIDsString := strings.Join(chartIDs, ", ")
-	rows, err := m.DB.Query(fmt.Sprintf("DELETE FROM %s WHERE chart_id NOT IN (%s) AND repo_name = $1 AND repo_namespace = $2", dbutils.ChartTable, chartIDsString), repo.Name, repo.Namespace)
-	if rows != nil {
-		defer rows.Close()
+		chartIDs = append(chartIDs, chart.ID)
 	}
+	_, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE repo_name = $1 AND repo_namespace = $2 AND chart_id <> ALL($3)", dbutils.ChartTable), repo.Name, repo.Namespace, pq.Array(chartIDs))
 	return err
 }
 
@@ -134,11 +169,21 @@ func (m *postgresAssetManager) Delete(repo models.Repo) error {
 	return err
 }
 
+// updateIcon stores the icon of a chart in the icons table, the chart info
+// only keeps its content type so the icon is not loaded with the chart
 func (m *postgresAssetManager) updateIcon(repo models.Repo, data []byte, contentType, ID string) error {
-	rows, err := m.DB.Query(fmt.Sprintf(
-		`UPDATE charts SET info = info || '{"raw_icon": "%s", "icon_content_type": "%s"}' WHERE chart_id = $1 AND repo_namespace = $2 AND repo_name = $3 RETURNING ID`,
-		base64.StdEncoding.EncodeToString(data), contentType,
-	), ID, repo.Namespace, repo.Name)
+	digest := sha256.Sum256(data)
+	rows, err := m.DB.Query(fmt.Sprintf(`WITH chart AS (
+	UPDATE %s SET info = info || jsonb_build_object('icon_content_type', $1::text)
+	WHERE chart_id = $2 AND repo_namespace = $3 AND repo_name = $4
+	RETURNING chart_id, repo_namespace, repo_name
+)
+INSERT INTO %s (chart_id, repo_namespace, repo_name, content_type, digest, data)
+SELECT chart_id, repo_namespace, repo_name, $1, $5, $6 FROM chart
+ON CONFLICT (repo_namespace, repo_name, chart_id)
+DO UPDATE SET content_type = EXCLUDED.content_type, digest = EXCLUDED.digest, data = EXCLUDED.data
+RETURNING ID`, dbutils.ChartTable, dbutils.IconTable),
+		contentType, ID, repo.Namespace, repo.Name, hex.EncodeToString(digest[:]), data)
 	if rows != nil {
 		defer rows.Close()
 		var id int
@@ -165,9 +210,10 @@ SELECT EXISTS(
 	WHERE chart_files_id = $1 AND
 		repo_name = $2 AND
 		repo_namespace = $3 AND
-		info ->> 'Digest' = $4
+		info ->> 'Digest' = $4 AND
+		COALESCE((info ->> 'FormatVersion')::int, 0) >= $5
 	)`, dbutils.ChartFilesTable),
-		chartFilesID, repo.Name, repo.Namespace, digest).Scan(&exists)
+		chartFilesID, repo.Name, repo.Namespace, digest, models.ChartFilesFormatVersion).Scan(&exists)
 	return err == nil && exists
 }
 
@@ -186,3 +232,61 @@ func (m *postgresAssetManager) insertFiles(chartId string, files models.ChartFil
 	}
 	return err
 }
+
+func (m *postgresAssetManager) tarballStore() blobstore.Store {
+	return dbutils.PostgresTarballStore{DB: m.DB}
+}
+
+func (m *postgresAssetManager) getRepoCharts(repo models.Repo) ([]models.Chart, error) {
+	charts, err := m.QueryAllCharts(fmt.Sprintf("SELECT info FROM %s WHERE repo_name = $1 AND repo_namespace = $2", dbutils.ChartTable), repo.Name, repo.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	result := []models.Chart{}
+	for _, c := range charts {
+		result = append(result, *c)
+	}
+	return result, nil
+}
+
+func (m *postgresAssetManager) insertSyncReport(report models.SyncReport) error {
+	if report.Repo == nil {
+		return fmt.Errorf("unable to insert sync report without repo")
+	}
+	// Ensure the repo exists so FK constraints will be met, the sync may
+	// have failed before it was created.
+	_, err := m.EnsureRepoExists(report.Repo.Namespace, report.Repo.Name)
+	if err != nil {
+		return err
+	}
+	rows, err := m.DB.Query(fmt.Sprintf(`INSERT INTO %s (repo_namespace, repo_name, info)
+	VALUES ($1, $2, $3)`, dbutils.SyncReportTable), report.Repo.Namespace, report.Repo.Name, report)
+	if rows != nil {
+		rows.Close()
+	}
+	if err != nil {
+		return err
+	}
+	rows, err = m.DB.Query(fmt.Sprintf(`DELETE FROM %s WHERE repo_namespace = $1 AND repo_name = $2 AND ID NOT IN (
+	SELECT ID FROM %s WHERE repo_namespace = $1 AND repo_name = $2 ORDER BY ID DESC LIMIT $3
+)`, dbutils.SyncReportTable, dbutils.SyncReportTable), report.Repo.Namespace, report.Repo.Name, syncReportsToKeep)
+	if rows != nil {
+		defer rows.Close()
+	}
+	return err
+}
+
+// countRepoRows returns the number of rows of a repository in the given table
+func (m *postgresAssetManager) countRepoRows(table string, repo models.Repo) (int, error) {
+	var count int
+	err := m.DB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE repo_name = $1 AND repo_namespace = $2", table), repo.Name, repo.Namespace).Scan(&count)
+	return count, err
+}
+
+// countRepoFiles returns the number of files of a repository with the given
+// IDs
+func (m *postgresAssetManager) countRepoFiles(repo models.Repo, fileIDs []string) (int, error) {
+	var count int
+	err := m.DB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE repo_name = $1 AND repo_namespace = $2 AND chart_files_ID = ANY($3)", dbutils.ChartFilesTable), repo.Name, repo.Namespace, pq.Array(fileIDs)).Scan(&count)
+	return count, err
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -10,6 +13,7 @@ import (
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
 	"github.com/kubeapps/kubeapps/pkg/dbutils"
 	"github.com/kubeapps/kubeapps/pkg/dbutils/dbutilstest"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -86,16 +90,132 @@ func Test_PGUpdateLastCheck(t *testing.T) {
 	m.AssertExpectations(t)
 }
 
+func Test_PGSync(t *testing.T) {
+	repo := models.Repo{Namespace: "repo-namespace", Name: "repo-name"}
+	charts := []models.Chart{{ID: "repo-name/foo"}, {ID: "repo-name/bar'; DROP TABLE charts; --"}}
+
+	t.Run("it commits the charts of the repo", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO repos").WithArgs(repo.Namespace, repo.Name).WillReturnRows(sqlmock.NewRows([]string{"ID"}).AddRow(1))
+		mock.ExpectExec(`^INSERT INTO charts \(repo_namespace, repo_name, chart_id, info\)
+		VALUES \(\$1, \$2, \$3, \$4\), \(\$1, \$2, \$5, \$6\)`).
+			WithArgs(repo.Namespace, repo.Name, charts[0].ID, sqlmock.AnyArg(), charts[1].ID, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(`^DELETE FROM charts WHERE repo_name = \$1 AND repo_namespace = \$2 AND chart_id <> ALL\(\$3\)$`).
+			WithArgs(repo.Name, repo.Namespace, pq.Array([]string{charts[0].ID, charts[1].ID})).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		pgManager := &postgresAssetManager{&dbutils.PostgresAssetManager{DB: db}}
+		err = pgManager.Sync(repo, charts)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("err %v", err)
+		}
+	})
+
+	t.Run("it rolls back if the charts can't be removed", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO repos").WillReturnRows(sqlmock.NewRows([]string{"ID"}).AddRow(1))
+		mock.ExpectExec("^INSERT INTO charts").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("^DELETE FROM charts").WillReturnError(errors.New("boom"))
+		mock.ExpectRollback()
+
+		pgManager := &postgresAssetManager{&dbutils.PostgresAssetManager{DB: db}}
+		err = pgManager.Sync(repo, charts)
+		if err == nil || err.Error() != "boom" {
+			t.Errorf("got: %v, want: boom", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("err %v", err)
+		}
+	})
+
+	t.Run("it rolls back if the repo can't be stored", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO repos").WillReturnError(errors.New("boom"))
+		mock.ExpectRollback()
+
+		pgManager := &postgresAssetManager{&dbutils.PostgresAssetManager{DB: db}}
+		err = pgManager.Sync(repo, charts)
+		if err == nil || err.Error() != "boom" {
+			t.Errorf("got: %v, want: boom", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("err %v", err)
+		}
+	})
+}
+
 func Test_PGremoveMissingCharts(t *testing.T) {
-	repo := models.Repo{Name: "repo"}
-	charts := []models.Chart{{ID: "foo", Repo: &repo}, {ID: "bar"}}
-	m := &mockDB{&mock.Mock{}}
-	man, _ := dbutils.NewPGManager(datastore.Config{URL: "localhost:4123"}, dbutilstest.KubeappsTestNamespace)
-	man.DB = m
-	pgManager := &postgresAssetManager{man}
-	m.On("Query", "DELETE FROM charts WHERE chart_id NOT IN ('foo', 'bar') AND repo_name = $1 AND repo_namespace = $2", []interface{}{repo.Name, repo.Namespace})
-	pgManager.removeMissingCharts(repo, charts)
-	m.AssertExpectations(t)
+	repo := models.Repo{Namespace: "repo-namespace", Name: "repo-name"}
+	charts := []models.Chart{{ID: "repo-name/foo"}, {ID: "repo-name/bar'; DROP TABLE charts; --"}}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	// The IDs of the charts are a parameter rather than part of the statement
+	mock.ExpectExec(`^DELETE FROM charts WHERE repo_name = \$1 AND repo_namespace = \$2 AND chart_id <> ALL\(\$3\)$`).
+		WithArgs(repo.Name, repo.Namespace, pq.Array([]string{charts[0].ID, charts[1].ID})).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	pgManager := &postgresAssetManager{&dbutils.PostgresAssetManager{DB: db}}
+	if err := pgManager.removeMissingCharts(db, repo, charts); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("err %v", err)
+	}
+}
+
+func Test_PGimportChartsInBatches(t *testing.T) {
+	repo := models.Repo{Namespace: "repo-namespace", Name: "repo-name"}
+	charts := []models.Chart{}
+	for i := 0; i < chartsBatchSize+1; i++ {
+		charts = append(charts, models.Chart{ID: fmt.Sprintf("repo-name/chart-%d", i)})
+	}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	// The first statement upserts a full batch, the second one the rest
+	firstBatchArgs := []driver.Value{repo.Namespace, repo.Name}
+	for _, c := range charts[:chartsBatchSize] {
+		firstBatchArgs = append(firstBatchArgs, c.ID, sqlmock.AnyArg())
+	}
+	mock.ExpectExec(fmt.Sprintf(`^INSERT INTO charts \(repo_namespace, repo_name, chart_id, info\)
+		VALUES \(\$1, \$2, \$3, \$4\), .*, \(\$1, \$2, \$%d, \$%d\)
+`, 2*chartsBatchSize+1, 2*chartsBatchSize+2)).
+		WithArgs(firstBatchArgs...).
+		WillReturnResult(sqlmock.NewResult(0, chartsBatchSize))
+	mock.ExpectExec(`^INSERT INTO charts \(repo_namespace, repo_name, chart_id, info\)
+		VALUES \(\$1, \$2, \$3, \$4\)
+`).
+		WithArgs(repo.Namespace, repo.Name, charts[chartsBatchSize].ID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	pgManager := &postgresAssetManager{&dbutils.PostgresAssetManager{DB: db}}
+	err = pgManager.importCharts(db, charts, repo)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("err %v", err)
+	}
 }
 
 func Test_PGupdateIcon(t *testing.T) {
@@ -108,8 +228,17 @@ func Test_PGupdateIcon(t *testing.T) {
 	pgManager := &postgresAssetManager{man}
 	m.On(
 		"Query",
-		`UPDATE charts SET info = info || '{"raw_icon": "Zm9v", "icon_content_type": "image/png"}' WHERE chart_id = $1 AND repo_namespace = $2 AND repo_name = $3 RETURNING ID`,
-		[]interface{}{"stable/wordpress", "repo-namespace", "repo-name"},
+		`WITH chart AS (
+	UPDATE charts SET info = info || jsonb_build_object('icon_content_type', $1::text)
+	WHERE chart_id = $2 AND repo_namespace = $3 AND repo_name = $4
+	RETURNING chart_id, repo_namespace, repo_name
+)
+INSERT INTO icons (chart_id, repo_namespace, repo_name, content_type, digest, data)
+SELECT chart_id, repo_namespace, repo_name, $1, $5, $6 FROM chart
+ON CONFLICT (repo_namespace, repo_name, chart_id)
+DO UPDATE SET content_type = EXCLUDED.content_type, digest = EXCLUDED.digest, data = EXCLUDED.data
+RETURNING ID`,
+		[]interface{}{"image/png", "stable/wordpress", "repo-namespace", "repo-name", "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", data},
 	)
 	err := pgManager.updateIcon(models.Repo{Namespace: "repo-namespace", Name: "repo-name"}, data, contentType, id)
 	if err != nil {
@@ -129,8 +258,9 @@ func Test_PGfilesExist(t *testing.T) {
 	WHERE chart_files_id = \$1 AND
 		repo_name = \$2 AND
 		repo_namespace = \$3 AND
-		info ->> 'Digest' = \$4
-	\)$`).WillReturnRows(rows)
+		info ->> 'Digest' = \$4 AND
+		COALESCE\(\(info ->> 'FormatVersion'\)::int, 0\) >= \$5
+	\)$`).WithArgs("stable/wordpress", "repo-name", "namespace", "foo", models.ChartFilesFormatVersion).WillReturnRows(rows)
 	id := "stable/wordpress"
 	digest := "foo"
 	man := &dbutils.PostgresAssetManager{DB: db}
@@ -0,0 +1,129 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+)
+
+// syncReportsToKeep is the number of reports stored for each repository,
+// older reports are removed when a new one is inserted.
+const syncReportsToKeep = 20
+
+// syncReport collects the outcome of a repository sync. Failures are
+// recorded concurrently by the file importer workers.
+type syncReport struct {
+	mutex  sync.Mutex
+	report models.SyncReport
+}
+
+func newSyncReport(repo models.Repo, startTime time.Time) *syncReport {
+	return &syncReport{report: models.SyncReport{
+		Repo:          &repo,
+		StartTime:     startTime,
+		ChartsAdded:   []string{},
+		ChartsUpdated: []string{},
+		ChartsRemoved: []string{},
+		Failures:      []models.SyncFailure{},
+		Missing:       []models.SyncMissingAsset{},
+	}}
+}
+
+func (r *syncReport) setChecksum(checksum string) {
+	r.report.Checksum = checksum
+}
+
+// setChartChanges compares the charts stored before the sync with the charts
+// in the repository index.
+func (r *syncReport) setChartChanges(existing, charts []models.Chart) {
+	existingDigests := map[string]string{}
+	for _, c := range existing {
+		existingDigests[c.ID] = chartVersionsDigest(c)
+	}
+	for _, c := range charts {
+		digest, ok := existingDigests[c.ID]
+		if !ok {
+			r.report.ChartsAdded = append(r.report.ChartsAdded, c.ID)
+		} else if digest != chartVersionsDigest(c) {
+			r.report.ChartsUpdated = append(r.report.ChartsUpdated, c.ID)
+		}
+		delete(existingDigests, c.ID)
+	}
+	for _, c := range existing {
+		if _, ok := existingDigests[c.ID]; ok {
+			r.report.ChartsRemoved = append(r.report.ChartsRemoved, c.ID)
+		}
+	}
+}
+
+// chartsChanged returns true if the sync updated or removed charts, the only
+// changes leaving tarballs of the catalog unreferenced
+func (r *syncReport) chartsChanged() bool {
+	return len(r.report.ChartsUpdated) > 0 || len(r.report.ChartsRemoved) > 0
+}
+
+// chartVersionsDigest identifies the content of every version of a chart
+func chartVersionsDigest(c models.Chart) string {
+	digests := []string{}
+	for _, cv := range c.ChartVersions {
+		digests = append(digests, cv.Version+"@"+cv.Digest)
+	}
+	return strings.Join(digests, ",")
+}
+
+// addFailure records an asset which could not be imported. It's safe to call
+// it on a nil report so the file importer can be used without reporting.
+func (r *syncReport) addFailure(chartID, version, asset string, err error) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.report.Failures = append(r.report.Failures, models.SyncFailure{ChartID: chartID, Version: version, Asset: asset, Error: err.Error()})
+}
+
+// addMissing records an optional asset a chart doesn't have. Like addFailure
+// it's safe to call it on a nil report.
+func (r *syncReport) addMissing(chartID, version, asset string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.report.Missing = append(r.report.Missing, models.SyncMissingAsset{ChartID: chartID, Version: version, Asset: asset})
+}
+
+// skip marks the sync as skipped since the repository didn't change
+func (r *syncReport) skip() {
+	r.report.Skipped = true
+}
+
+// finish sets the end time of the sync and, if the sync could not be
+// completed, the error which stopped it.
+func (r *syncReport) finish(endTime time.Time, err error) models.SyncReport {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.report.EndTime = endTime
+	if err != nil {
+		r.report.Error = err.Error()
+	}
+	return r.report
+}
@@ -0,0 +1,135 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+)
+
+func Test_setChartChanges(t *testing.T) {
+	existing := []models.Chart{
+		{ID: "repo/unchanged", ChartVersions: []models.ChartVersion{{Version: "1.0.0", Digest: "123"}}},
+		{ID: "repo/new-version", ChartVersions: []models.ChartVersion{{Version: "1.0.0", Digest: "456"}}},
+		{ID: "repo/removed", ChartVersions: []models.ChartVersion{{Version: "1.0.0", Digest: "789"}}},
+	}
+	charts := []models.Chart{
+		{ID: "repo/unchanged", ChartVersions: []models.ChartVersion{{Version: "1.0.0", Digest: "123"}}},
+		{ID: "repo/new-version", ChartVersions: []models.ChartVersion{{Version: "1.1.0", Digest: "abc"}, {Version: "1.0.0", Digest: "456"}}},
+		{ID: "repo/added", ChartVersions: []models.ChartVersion{{Version: "0.1.0", Digest: "def"}}},
+	}
+
+	r := newSyncReport(models.Repo{Name: "repo"}, time.Now())
+	r.setChartChanges(existing, charts)
+
+	if got, want := r.report.ChartsAdded, []string{"repo/added"}; !cmp.Equal(got, want) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+	if got, want := r.report.ChartsUpdated, []string{"repo/new-version"}; !cmp.Equal(got, want) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+	if got, want := r.report.ChartsRemoved, []string{"repo/removed"}; !cmp.Equal(got, want) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+}
+
+func Test_chartsChanged(t *testing.T) {
+	existing := []models.Chart{
+		{ID: "repo/foo", ChartVersions: []models.ChartVersion{{Version: "1.0.0", Digest: "123"}}},
+	}
+	tests := []struct {
+		name     string
+		charts   []models.Chart
+		expected bool
+	}{
+		{"unchanged charts", existing, false},
+		{"added chart", append([]models.Chart{{ID: "repo/bar"}}, existing...), false},
+		{"updated chart", []models.Chart{{ID: "repo/foo", ChartVersions: []models.ChartVersion{{Version: "1.1.0", Digest: "456"}}}}, true},
+		{"removed chart", []models.Chart{{ID: "repo/bar"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newSyncReport(models.Repo{Name: "repo"}, time.Now())
+			r.setChartChanges(existing, tt.charts)
+			if got := r.chartsChanged(); got != tt.expected {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func Test_syncReportFinish(t *testing.T) {
+	startTime := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	endTime := startTime.Add(time.Minute)
+	repo := models.Repo{Namespace: "repo-namespace", Name: "repo", URL: "https://example.com"}
+
+	t.Run("successful sync", func(t *testing.T) {
+		r := newSyncReport(repo, startTime)
+		r.setChecksum("checksum")
+		r.addFailure("repo/foo", "1.0.0", "files", errors.New("tarball request failed"))
+		r.addMissing("repo/foo", "1.0.0", "readme")
+		r.addMissing("repo/foo", "", "icon")
+
+		expected := models.SyncReport{
+			Repo:          &repo,
+			StartTime:     startTime,
+			EndTime:       endTime,
+			Checksum:      "checksum",
+			ChartsAdded:   []string{},
+			ChartsUpdated: []string{},
+			ChartsRemoved: []string{},
+			Failures: []models.SyncFailure{
+				{ChartID: "repo/foo", Version: "1.0.0", Asset: "files", Error: "tarball request failed"},
+			},
+			Missing: []models.SyncMissingAsset{
+				{ChartID: "repo/foo", Version: "1.0.0", Asset: "readme"},
+				{ChartID: "repo/foo", Asset: "icon"},
+			},
+		}
+		if got := r.finish(endTime, nil); !cmp.Equal(got, expected) {
+			t.Errorf(cmp.Diff(expected, got))
+		}
+	})
+
+	t.Run("skipped sync", func(t *testing.T) {
+		r := newSyncReport(repo, startTime)
+		r.setChecksum("checksum")
+		r.skip()
+		got := r.finish(endTime, nil)
+		if !got.Skipped || got.Error != "" {
+			t.Errorf("got: %+v, want a skipped sync without error", got)
+		}
+	})
+
+	t.Run("failed sync", func(t *testing.T) {
+		r := newSyncReport(repo, startTime)
+		got := r.finish(endTime, errors.New("repo index request failed"))
+		if got.Error != "repo index request failed" {
+			t.Errorf("got: %q, want: %q", got.Error, "repo index request failed")
+		}
+	})
+
+	t.Run("failures can be added without a report", func(t *testing.T) {
+		var r *syncReport
+		r.addFailure("repo/foo", "1.0.0", "files", errors.New("tarball request failed"))
+		r.addMissing("repo/foo", "1.0.0", "readme")
+	})
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"time"
 
@@ -52,42 +54,76 @@ var syncCmd = &cobra.Command{
 		}
 		defer manager.Close()
 
+		startTime := time.Now()
+		report := newSyncReport(models.Repo{Namespace: namespace, Name: args[0], URL: args[1]}, startTime)
+		// fatal stores the report of the failed sync before exiting
+		fatal := func(err error) {
+			if reportErr := manager.insertSyncReport(report.finish(time.Now(), err)); reportErr != nil {
+				logrus.Errorf("Can't store the sync report: %v", reportErr)
+			}
+			logrus.Fatal(err)
+		}
+
 		authorizationHeader := os.Getenv("AUTHORIZATION_HEADER")
 		repo, repoContent, err := getRepo(namespace, args[0], args[1], authorizationHeader)
 		if err != nil {
-			logrus.Fatal(err)
+			fatal(err)
 		}
+		report.setChecksum(repo.Checksum)
 
-		// Check if the repo has been already processed
+		// Check if the repo has been already processed. Runs skipping the
+		// repository store a skipped report to show the sync ran.
 		if manager.RepoAlreadyProcessed(models.Repo{Namespace: repo.Namespace, Name: repo.Name}, repo.Checksum) {
 			logrus.WithFields(logrus.Fields{"url": repo.URL}).Info("Skipping repository since there are no updates")
+			report.skip()
+			if err = manager.insertSyncReport(report.finish(time.Now(), nil)); err != nil {
+				logrus.Errorf("Can't store the sync report: %v", err)
+			}
 			return
 		}
 
 		index, err := parseRepoIndex(repoContent)
 		if err != nil {
-			logrus.Fatal(err)
+			fatal(err)
 		}
 
 		charts := chartsFromIndex(index, &models.Repo{Namespace: repo.Namespace, Name: repo.Name, URL: repo.URL})
 		if len(charts) == 0 {
-			logrus.Fatal("no charts in repository index")
+			fatal(errors.New("no charts in repository index"))
+		}
+
+		existingCharts, err := manager.getRepoCharts(models.Repo{Name: repo.Name, Namespace: repo.Namespace})
+		if err != nil {
+			fatal(fmt.Errorf("Can't get the existing charts of the repository: %v", err))
 		}
+		report.setChartChanges(existingCharts, charts)
 
 		if err = manager.Sync(models.Repo{Name: repo.Name, Namespace: repo.Namespace}, charts); err != nil {
-			logrus.Fatalf("Can't add chart repository to database: %v", err)
+			fatal(fmt.Errorf("Can't add chart repository to database: %v", err))
+		}
+
+		tarballs, err := openTarballStore(manager)
+		if err != nil {
+			fatal(err)
 		}
 
 		// Fetch and store chart icons
-		fImporter := fileImporter{manager}
+		fImporter := fileImporter{manager: manager, report: report, tarballs: tarballs}
 		fImporter.fetchFiles(charts, repo)
+		if report.chartsChanged() {
+			pruneTarballs(tarballs)
+		}
 
 		// Update cache in the database
 		if err = manager.UpdateLastCheck(repo.Namespace, repo.Name, repo.Checksum, time.Now()); err != nil {
-			logrus.Fatal(err)
+			fatal(err)
 		}
 		logrus.WithFields(logrus.Fields{"url": repo.URL}).Info("Stored repository update in cache")
 
+		if err = manager.insertSyncReport(report.finish(time.Now(), nil)); err != nil {
+			logrus.Errorf("Can't store the sync report: %v", err)
+		}
+
 		logrus.Infof("Successfully added the chart repository %s to database", args[0])
 	},
 }
@@ -39,7 +39,9 @@ import (
 	"github.com/ghodss/yaml"
 	"github.com/jinzhu/copier"
 	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/kubeapps/kubeapps/pkg/chart/parameters"
 	log "github.com/sirupsen/logrus"
 	helmrepo "k8s.io/helm/pkg/repo"
 )
@@ -85,6 +87,9 @@ type assetManager interface {
 	updateIcon(repo models.Repo, data []byte, contentType, ID string) error
 	filesExist(repo models.Repo, chartFilesID, digest string) bool
 	insertFiles(chartId string, files models.ChartFiles) error
+	getRepoCharts(repo models.Repo) ([]models.Chart, error)
+	insertSyncReport(report models.SyncReport) error
+	tarballStore() blobstore.Store
 }
 
 func newManager(databaseType string, config datastore.Config, kubeappsNamespace string) (assetManager, error) {
@@ -92,11 +97,29 @@ func newManager(databaseType string, config datastore.Config, kubeappsNamespace
 		return newMongoDBManager(config, kubeappsNamespace), nil
 	} else if databaseType == "postgresql" {
 		return newPGManager(config, kubeappsNamespace)
+	} else if databaseType == "memory" {
+		return newMemoryManager(config, kubeappsNamespace), nil
 	} else {
 		return nil, fmt.Errorf("Unsupported database type %s", databaseType)
 	}
 }
 
+// openTarballStore returns the store of the mirrored chart tarballs, nil if
+// tarballs are not mirrored
+func openTarballStore(manager assetManager) (blobstore.Store, error) {
+	return blobstore.Open(tarballStore, manager.tarballStore())
+}
+
+// pruneTarballs removes the mirrored tarballs no longer in the catalog if the
+// store supports it
+func pruneTarballs(store blobstore.Store) {
+	if pruner, ok := store.(blobstore.Pruner); ok {
+		if err := pruner.Prune(); err != nil {
+			log.WithError(err).Error("failed to prune the mirrored tarballs")
+		}
+	}
+}
+
 func getSha256(src []byte) (string, error) {
 	f := bytes.NewReader(src)
 	h := sha256.New()
@@ -165,28 +188,69 @@ func fetchRepoIndex(url, authHeader string) ([]byte, error) {
 	return body, nil
 }
 
-func parseRepoIndex(body []byte) (*helmrepo.IndexFile, error) {
+// indexMetadata are the fields of the Chart.yaml of an index entry which are
+// not part of the Helm 2 chart metadata
+type indexMetadata struct {
+	Version      string                   `json:"version"`
+	Type         string                   `json:"type"`
+	Dependencies []models.ChartDependency `json:"dependencies"`
+}
+
+// repoIndex is a repository index with the metadata of its entries missing
+// from the Helm 2 index
+type repoIndex struct {
+	*helmrepo.IndexFile
+	// metadata of the entries by chart name and version
+	metadata map[string]map[string]indexMetadata
+}
+
+func parseRepoIndex(body []byte) (*repoIndex, error) {
 	var index helmrepo.IndexFile
 	err := yaml.Unmarshal(body, &index)
 	if err != nil {
 		return nil, err
 	}
 	index.SortEntries()
-	return &index, nil
+
+	var entries struct {
+		Entries map[string][]indexMetadata `json:"entries"`
+	}
+	err = yaml.Unmarshal(body, &entries)
+	if err != nil {
+		return nil, err
+	}
+	metadata := map[string]map[string]indexMetadata{}
+	for name, versions := range entries.Entries {
+		metadata[name] = map[string]indexMetadata{}
+		for _, v := range versions {
+			metadata[name][v.Version] = v
+		}
+	}
+	return &repoIndex{IndexFile: &index, metadata: metadata}, nil
 }
 
-func chartsFromIndex(index *helmrepo.IndexFile, r *models.Repo) []models.Chart {
+func chartsFromIndex(index *repoIndex, r *models.Repo) []models.Chart {
 	var charts []models.Chart
-	for _, entry := range index.Entries {
+	for name, entry := range index.Entries {
 		if entry[0].GetDeprecated() {
 			log.WithFields(log.Fields{"name": entry[0].GetName()}).Info("skipping deprecated chart")
 			continue
 		}
-		charts = append(charts, newChart(entry, r))
+		c := newChart(entry, r)
+		for i := range c.ChartVersions {
+			cv := &c.ChartVersions[i]
+			m := index.metadata[name][cv.Version]
+			cv.Type = m.Type
+			cv.Dependencies = m.Dependencies
+		}
+		charts = append(charts, c)
 	}
 	return charts
 }
 
+// categoryAnnotation is the Chart.yaml annotation with the category of a chart
+const categoryAnnotation = "category"
+
 // Takes an entry from the index and constructs a database representation of the
 // object.
 func newChart(entry helmrepo.ChartVersions, r *models.Repo) models.Chart {
@@ -195,6 +259,16 @@ func newChart(entry helmrepo.ChartVersions, r *models.Repo) models.Chart {
 	copier.Copy(&c.ChartVersions, entry)
 	c.Repo = r
 	c.ID = fmt.Sprintf("%s/%s", r.Name, c.Name)
+	c.Category = entry[0].GetAnnotations()[categoryAnnotation]
+	for i, v := range entry {
+		cv := &c.ChartVersions[i]
+		cv.APIVersion = v.GetApiVersion()
+		cv.KubeVersion = v.GetKubeVersion()
+		cv.Deprecated = v.GetDeprecated()
+		cv.Condition = v.GetCondition()
+		cv.Tags = v.GetTags()
+		cv.Annotations = v.GetAnnotations()
+	}
 	return c
 }
 
@@ -221,6 +295,18 @@ func extractFilesFromTarball(filenames []string, tarf *tar.Reader) (map[string]s
 	return ret, nil
 }
 
+// parseDependencies returns the list of dependencies declared in the given
+// Chart.yaml or requirements.yaml content
+func parseDependencies(content []byte) ([]models.ChartDependency, error) {
+	var f struct {
+		Dependencies []models.ChartDependency `json:"dependencies"`
+	}
+	if err := yaml.Unmarshal(content, &f); err != nil {
+		return nil, err
+	}
+	return f.Dependencies, nil
+}
+
 func chartTarballURL(r *models.RepoInternal, cv models.ChartVersion) string {
 	source := cv.URLs[0]
 	if _, err := parseRepoURL(source); err != nil {
@@ -268,6 +354,11 @@ func initNetClient(additionalCA string) (*http.Client, error) {
 
 type fileImporter struct {
 	manager assetManager
+	// report records the assets which could not be imported, it can be nil
+	report *syncReport
+	// tarballs stores the mirrored chart tarballs, it's nil if tarballs are
+	// not mirrored
+	tarballs blobstore.Store
 }
 
 func (f *fileImporter) fetchFiles(charts []models.Chart, r *models.RepoInternal) {
@@ -320,12 +411,14 @@ func (f *fileImporter) importWorker(wg *sync.WaitGroup, icons <-chan models.Char
 		log.WithFields(log.Fields{"name": c.Name}).Debug("importing icon")
 		if err := f.fetchAndImportIcon(c, r); err != nil {
 			log.WithFields(log.Fields{"name": c.Name}).WithError(err).Error("failed to import icon")
+			f.report.addFailure(c.ID, "", "icon", err)
 		}
 	}
 	for j := range chartFiles {
 		log.WithFields(log.Fields{"name": j.Name, "version": j.ChartVersion.Version}).Debug("importing readme and values")
 		if err := f.fetchAndImportFiles(j.Name, r, j.ChartVersion); err != nil {
 			log.WithFields(log.Fields{"name": j.Name, "version": j.ChartVersion.Version}).WithError(err).Error("failed to import files")
+			f.report.addFailure(fmt.Sprintf("%s/%s", r.Name, j.Name), j.ChartVersion.Version, "files", err)
 		}
 	}
 }
@@ -333,6 +426,7 @@ func (f *fileImporter) importWorker(wg *sync.WaitGroup, icons <-chan models.Char
 func (f *fileImporter) fetchAndImportIcon(c models.Chart, r *models.RepoInternal) error {
 	if c.Icon == "" {
 		log.WithFields(log.Fields{"name": c.Name}).Info("icon not found")
+		f.report.addMissing(c.ID, "", "icon")
 		return nil
 	}
 
@@ -390,8 +484,10 @@ func (f *fileImporter) fetchAndImportFiles(name string, r *models.RepoInternal,
 	chartID := fmt.Sprintf("%s/%s", r.Name, name)
 	chartFilesID := fmt.Sprintf("%s-%s", chartID, cv.Version)
 
-	// Check if we already have indexed files for this chart version and digest
-	if f.manager.filesExist(models.Repo{Namespace: r.Namespace, Name: r.Name}, chartFilesID, cv.Digest) {
+	// Check if we already have indexed files for this chart version and digest,
+	// imported in the current format
+	mirror := f.tarballMissing(chartID, cv)
+	if f.manager.filesExist(models.Repo{Namespace: r.Namespace, Name: r.Name}, chartFilesID, cv.Digest) && !mirror {
 		log.WithFields(log.Fields{"name": name, "version": cv.Version}).Debug("skipping existing files")
 		return nil
 	}
@@ -416,7 +512,11 @@ func (f *fileImporter) fetchAndImportFiles(name string, r *models.RepoInternal,
 	// We read the whole chart into memory, this should be okay since the chart
 	// tarball needs to be small enough to fit into a GRPC call (Tiller
 	// requirement)
-	gzf, err := gzip.NewReader(res.Body)
+	tarball, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	gzf, err := gzip.NewReader(bytes.NewReader(tarball))
 	if err != nil {
 		return err
 	}
@@ -427,31 +527,123 @@ func (f *fileImporter) fetchAndImportFiles(name string, r *models.RepoInternal,
 	readmeFileName := name + "/README.md"
 	valuesFileName := name + "/values.yaml"
 	schemaFileName := name + "/values.schema.json"
-	filenames := []string{valuesFileName, readmeFileName, schemaFileName}
+	chartYamlFileName := name + "/Chart.yaml"
+	requirementsFileName := name + "/requirements.yaml"
+	filenames := []string{valuesFileName, readmeFileName, schemaFileName, chartYamlFileName, requirementsFileName}
 
 	files, err := extractFilesFromTarball(filenames, tarf)
 	if err != nil {
 		return err
 	}
 
-	chartFiles := models.ChartFiles{ID: chartFilesID, Repo: &models.Repo{Name: r.Name, Namespace: r.Namespace, URL: r.URL}, Digest: cv.Digest}
+	chartFiles := models.ChartFiles{
+		ID:            chartFilesID,
+		ChartID:       chartID,
+		Version:       cv.Version,
+		Repo:          &models.Repo{Name: r.Name, Namespace: r.Namespace, URL: r.URL},
+		Digest:        cv.Digest,
+		FormatVersion: models.ChartFilesFormatVersion,
+	}
 	if v, ok := files[readmeFileName]; ok {
 		chartFiles.Readme = v
 	} else {
 		log.WithFields(log.Fields{"name": name, "version": cv.Version}).Info("README.md not found")
+		f.report.addMissing(chartID, cv.Version, "readme")
 	}
 	if v, ok := files[valuesFileName]; ok {
 		chartFiles.Values = v
+		params, err := parameters.Parse([]byte(v))
+		if err != nil {
+			log.WithFields(log.Fields{"name": name, "version": cv.Version}).WithError(err).Info("unable to parse the parameters of values.yaml")
+			f.report.addFailure(chartID, cv.Version, "parameters", err)
+		}
+		chartFiles.Parameters = params
 	} else {
 		log.WithFields(log.Fields{"name": name, "version": cv.Version}).Info("values.yaml not found")
+		f.report.addMissing(chartID, cv.Version, "values")
 	}
 	if v, ok := files[schemaFileName]; ok {
 		chartFiles.Schema = v
+	} else if chartFiles.Values != "" {
+		// The schema of the default values is served instead so the charts
+		// without a schema get a basic form too
+		log.WithFields(log.Fields{"name": name, "version": cv.Version}).Info("values.schema.json not found, generating it")
+		schema, err := parameters.Schema([]byte(chartFiles.Values))
+		if err != nil {
+			log.WithFields(log.Fields{"name": name, "version": cv.Version}).WithError(err).Info("unable to generate a schema of values.yaml")
+			f.report.addFailure(chartID, cv.Version, "schema", err)
+		} else {
+			chartFiles.Schema = string(schema)
+			chartFiles.SchemaGenerated = true
+		}
 	} else {
 		log.WithFields(log.Fields{"name": name, "version": cv.Version}).Info("values.schema.json not found")
+		f.report.addMissing(chartID, cv.Version, "schema")
+	}
+	// Chart.yaml (apiVersion v2) or requirements.yaml (apiVersion v1) declare
+	// the chart dependencies. An invalid file shouldn't prevent importing the
+	// rest of the files so we only log the error.
+	for _, fileName := range []string{chartYamlFileName, requirementsFileName} {
+		if v, ok := files[fileName]; ok {
+			deps, err := parseDependencies([]byte(v))
+			if err != nil {
+				log.WithFields(log.Fields{"name": name, "version": cv.Version, "file": fileName}).WithError(err).Error("failed to parse dependencies")
+				continue
+			}
+			chartFiles.Dependencies = append(chartFiles.Dependencies, deps...)
+		}
 	}
 
+	images, err := chartImages(tarball)
+	if err != nil {
+		log.WithFields(log.Fields{"name": name, "version": cv.Version}).WithError(err).Info("unable to render chart to extract images")
+	}
+	chartFiles.Images = images
+
 	// inserts the chart files if not already indexed, or updates the existing
 	// entry if digest has changed
-	return f.manager.insertFiles(chartID, chartFiles)
+	if err := f.manager.insertFiles(chartID, chartFiles); err != nil {
+		return err
+	}
+
+	// The tarball is stored once its files are, so it's never pruned as
+	// unreferenced by a concurrent sync
+	if mirror {
+		if err := f.mirrorTarball(cv, tarball); err != nil {
+			log.WithFields(log.Fields{"name": name, "version": cv.Version}).WithError(err).Error("failed to mirror tarball")
+			f.report.addFailure(chartID, cv.Version, "tarball", err)
+		}
+	}
+	return nil
+}
+
+// tarballMissing returns true if tarballs are mirrored and the tarball of the
+// chart version is not stored yet
+func (f *fileImporter) tarballMissing(chartID string, cv models.ChartVersion) bool {
+	if f.tarballs == nil {
+		return false
+	}
+	if cv.Digest == "" {
+		f.report.addFailure(chartID, cv.Version, "tarball", errors.New("the repository index has no digest for the chart version"))
+		return false
+	}
+	exists, err := f.tarballs.Exists(cv.Digest)
+	if err != nil {
+		log.WithFields(log.Fields{"id": chartID, "version": cv.Version}).WithError(err).Error("failed to check the mirrored tarball")
+		return true
+	}
+	return !exists
+}
+
+// mirrorTarball stores the tarball of a chart version if it matches the
+// digest of the repository index
+func (f *fileImporter) mirrorTarball(cv models.ChartVersion, tarball []byte) error {
+	digest, err := getSha256(tarball)
+	if err != nil {
+		return err
+	}
+	if digest != cv.Digest {
+		return fmt.Errorf("the tarball digest %s doesn't match the digest %s of the repository index", digest, cv.Digest)
+	}
+	return f.tarballs.Put(digest, tarball)
 }
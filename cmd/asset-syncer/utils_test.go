@@ -33,11 +33,13 @@ import (
 	"path"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/arschles/assert"
 	"github.com/disintegration/imaging"
 	"github.com/globalsign/mgo/bson"
 	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/mock"
@@ -121,14 +123,17 @@ func (h *svgIconClient) Do(req *http.Request) (*http.Response, error) {
 }
 
 type goodTarballClient struct {
-	c          models.Chart
-	skipReadme bool
-	skipValues bool
-	skipSchema bool
+	c            models.Chart
+	skipReadme   bool
+	skipValues   bool
+	skipSchema   bool
+	values       string
+	requirements string
 }
 
 var testChartReadme = "# readme for chart\n\nBest chart in town"
 var testChartValues = "image: test"
+var testChartParameters = []models.ChartParameter{{Path: "image", Type: "string", Default: "test"}}
 var testChartSchema = `{"properties": {}}`
 
 func (h *goodTarballClient) Do(req *http.Request) (*http.Response, error) {
@@ -136,7 +141,11 @@ func (h *goodTarballClient) Do(req *http.Request) (*http.Response, error) {
 	gzw := gzip.NewWriter(w)
 	files := []tarballFile{{h.c.Name + "/Chart.yaml", "should be a Chart.yaml here..."}}
 	if !h.skipValues {
-		files = append(files, tarballFile{h.c.Name + "/values.yaml", testChartValues})
+		values := testChartValues
+		if h.values != "" {
+			values = h.values
+		}
+		files = append(files, tarballFile{h.c.Name + "/values.yaml", values})
 	}
 	if !h.skipReadme {
 		files = append(files, tarballFile{h.c.Name + "/README.md", testChartReadme})
@@ -144,6 +153,9 @@ func (h *goodTarballClient) Do(req *http.Request) (*http.Response, error) {
 	if !h.skipSchema {
 		files = append(files, tarballFile{h.c.Name + "/values.schema.json", testChartSchema})
 	}
+	if h.requirements != "" {
+		files = append(files, tarballFile{h.c.Name + "/requirements.yaml", h.requirements})
+	}
 	createTestTarball(gzw, files)
 	gzw.Flush()
 	return w.Result(), nil
@@ -294,6 +306,41 @@ func Test_chartsFromIndex(t *testing.T) {
 	assert.NoErr(t, err)
 	charts = chartsFromIndex(index2, r)
 	assert.Equal(t, len(charts), 2, "number of charts")
+
+	indexWithLibrary := validRepoIndexYAML + `
+  common:
+  - apiVersion: v2
+    name: common
+    version: 1.0.0
+    type: library
+    kubeVersion: ">=1.14.0"
+    annotations:
+      artifacthub.io/license: Apache-2.0
+    dependencies:
+    - name: helpers
+      version: 0.x.x
+      repository: https://charts.example.com
+      condition: helpers.enabled
+      tags:
+      - helpers`
+	index3, err := parseRepoIndex([]byte(indexWithLibrary))
+	assert.NoErr(t, err)
+	found := false
+	for _, c := range chartsFromIndex(index3, r) {
+		if c.Name != "common" {
+			continue
+		}
+		found = true
+		cv := c.ChartVersions[0]
+		assert.Equal(t, cv.APIVersion, "v2", "apiVersion")
+		assert.Equal(t, cv.Type, models.LibraryChartType, "type")
+		assert.Equal(t, cv.KubeVersion, ">=1.14.0", "kubeVersion")
+		assert.Equal(t, cv.Annotations, models.Annotations{"artifacthub.io/license": "Apache-2.0"}, "annotations")
+		assert.Equal(t, cv.Dependencies, []models.ChartDependency{
+			{Name: "helpers", Version: "0.x.x", Repository: "https://charts.example.com", Condition: "helpers.enabled", Tags: []string{"helpers"}},
+		}, "dependencies")
+	}
+	assert.Equal(t, found, true, "library chart indexed")
 }
 
 func Test_newChart(t *testing.T) {
@@ -305,6 +352,7 @@ func Test_newChart(t *testing.T) {
 	assert.Equal(t, c.Description, "new description!", "takes chart fields from latest entry")
 	assert.Equal(t, c.Repo, r, "repo set")
 	assert.Equal(t, c.ID, "test/wordpress", "id set")
+	assert.Equal(t, c.Category, "CMS", "category taken from the annotations")
 }
 
 func Test_chartTarballURL(t *testing.T) {
@@ -386,6 +434,44 @@ func Test_extractFilesFromTarball(t *testing.T) {
 	})
 }
 
+func Test_parseDependencies(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []models.ChartDependency
+	}{
+		{"no dependencies", "apiVersion: v2\nname: foo\nversion: 1.0.0\n", nil},
+		{"Chart.yaml dependencies", `apiVersion: v2
+name: foo
+version: 1.0.0
+dependencies:
+- name: common
+  version: 0.x.x
+  repository: https://charts.bitnami.com/bitnami
+- name: postgresql
+  version: ">= 8.0.0"
+  repository: "@stable"
+`, []models.ChartDependency{
+			{Name: "common", Version: "0.x.x", Repository: "https://charts.bitnami.com/bitnami"},
+			{Name: "postgresql", Version: ">= 8.0.0", Repository: "@stable"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deps, err := parseDependencies([]byte(tt.content))
+			assert.NoErr(t, err)
+			assert.Equal(t, deps, tt.expected, "dependencies")
+		})
+	}
+
+	t.Run("invalid content", func(t *testing.T) {
+		_, err := parseDependencies([]byte("should be a Chart.yaml here..."))
+		if err == nil {
+			t.Errorf("expected an error parsing an invalid Chart.yaml")
+		}
+	})
+}
+
 type tarballFile struct {
 	Name, Body string
 }
@@ -482,6 +568,7 @@ func Test_newManager(t *testing.T) {
 	}{
 		{"mongodb database", "mongodb", "charts", "example.com", "admin", "root", "&{{example.com charts admin root 0} <nil>}"},
 		{"postgresql database", "postgresql", "assets", "example.com:44124", "postgres", "root", "&{host=example.com port=44124 user=postgres password=root dbname=assets sslmode=disable <nil>}"},
+		{"memory database", "memory", "charts", "file:///tmp/charts.json", "", "", ""},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -499,8 +586,11 @@ func Test_fetchAndImportIcon(t *testing.T) {
 		m := &mock.Mock{}
 		c := models.Chart{ID: "test/acs-engine-autoscaler"}
 		manager := getMockManager(m)
-		fImporter := fileImporter{manager}
+		report := newSyncReport(models.Repo{Name: r.Name, Namespace: r.Namespace}, time.Now())
+		fImporter := fileImporter{manager: manager, report: report}
 		assert.NoErr(t, fImporter.fetchAndImportIcon(c, r))
+		assert.Equal(t, report.report.Failures, []models.SyncFailure{}, "sync failures")
+		assert.Equal(t, report.report.Missing, []models.SyncMissingAsset{{ChartID: c.ID, Asset: "icon"}}, "missing assets")
 	})
 
 	index, _ := parseRepoIndex([]byte(validRepoIndexYAML))
@@ -511,7 +601,7 @@ func Test_fetchAndImportIcon(t *testing.T) {
 		c := charts[0]
 		m := &mock.Mock{}
 		manager := getMockManager(m)
-		fImporter := fileImporter{manager}
+		fImporter := fileImporter{manager: manager}
 		assert.Err(t, fmt.Errorf("500 %s", c.Icon), fImporter.fetchAndImportIcon(c, r))
 	})
 
@@ -520,7 +610,7 @@ func Test_fetchAndImportIcon(t *testing.T) {
 		c := charts[0]
 		m := &mock.Mock{}
 		manager := getMockManager(m)
-		fImporter := fileImporter{manager}
+		fImporter := fileImporter{manager: manager}
 		assert.Err(t, image.ErrFormat, fImporter.fetchAndImportIcon(c, r))
 	})
 
@@ -530,7 +620,7 @@ func Test_fetchAndImportIcon(t *testing.T) {
 		m := &mock.Mock{}
 		m.On("Upsert", bson.M{"chart_id": c.ID, "repo.name": c.Repo.Name, "repo.namespace": c.Repo.Namespace}, bson.M{"$set": bson.M{"raw_icon": iconBytes(), "icon_content_type": "image/png"}}).Return(nil)
 		manager := getMockManager(m)
-		fImporter := fileImporter{manager}
+		fImporter := fileImporter{manager: manager}
 		assert.NoErr(t, fImporter.fetchAndImportIcon(c, r))
 		m.AssertExpectations(t)
 	})
@@ -546,7 +636,7 @@ func Test_fetchAndImportIcon(t *testing.T) {
 		m.On("Upsert", bson.M{"chart_id": c.ID, "repo.name": c.Repo.Name, "repo.namespace": c.Repo.Namespace}, bson.M{"$set": bson.M{"raw_icon": []byte("foo"), "icon_content_type": "image/svg"}}).Return(nil)
 
 		manager := getMockManager(m)
-		fImporter := fileImporter{manager}
+		fImporter := fileImporter{manager: manager}
 		assert.NoErr(t, fImporter.fetchAndImportIcon(c, r))
 		m.AssertExpectations(t)
 	})
@@ -563,7 +653,7 @@ func Test_fetchAndImportFiles(t *testing.T) {
 		m.On("One", mock.Anything).Return(errors.New("return an error when checking if readme already exists to force fetching"))
 		netClient = &badHTTPClient{}
 		manager := getMockManager(&m)
-		fImporter := fileImporter{manager}
+		fImporter := fileImporter{manager: manager}
 		assert.Err(t, io.EOF, fImporter.fetchAndImportFiles(charts[0].Name, repo, cv))
 	})
 
@@ -573,19 +663,29 @@ func Test_fetchAndImportFiles(t *testing.T) {
 		m.On("One", mock.Anything).Return(errors.New("return an error when checking if files already exists to force fetching"))
 		chartFilesID := fmt.Sprintf("%s/%s-%s", charts[0].Repo.Name, charts[0].Name, cv.Version)
 		m.On("Upsert", bson.M{"file_id": chartFilesID, "repo.name": repo.Name, "repo.namespace": repo.Namespace}, models.ChartFiles{
-			ID:     chartFilesID,
-			Readme: "",
-			Values: "",
-			Schema: "",
-			Repo:   charts[0].Repo,
-			Digest: cv.Digest,
+			ID:            chartFilesID,
+			ChartID:       charts[0].ID,
+			Version:       cv.Version,
+			Readme:        "",
+			Values:        "",
+			Schema:        "",
+			Repo:          charts[0].Repo,
+			Digest:        cv.Digest,
+			FormatVersion: models.ChartFilesFormatVersion,
 		})
 
 		manager := getMockManager(&m)
-		fImporter := fileImporter{manager}
+		report := newSyncReport(*charts[0].Repo, time.Now())
+		fImporter := fileImporter{manager: manager, report: report}
 		err := fImporter.fetchAndImportFiles(charts[0].Name, repo, cv)
 		assert.NoErr(t, err)
 		m.AssertExpectations(t)
+		assert.Equal(t, report.report.Failures, []models.SyncFailure{}, "sync failures")
+		assert.Equal(t, report.report.Missing, []models.SyncMissingAsset{
+			{ChartID: charts[0].ID, Version: cv.Version, Asset: "readme"},
+			{ChartID: charts[0].ID, Version: cv.Version, Asset: "values"},
+			{ChartID: charts[0].ID, Version: cv.Version, Asset: "schema"},
+		}, "missing assets")
 	})
 
 	t.Run("authenticated request", func(t *testing.T) {
@@ -594,15 +694,19 @@ func Test_fetchAndImportFiles(t *testing.T) {
 		m.On("One", mock.Anything).Return(errors.New("return an error when checking if files already exists to force fetching"))
 		chartFilesID := fmt.Sprintf("%s/%s-%s", charts[0].Repo.Name, charts[0].Name, cv.Version)
 		m.On("Upsert", bson.M{"file_id": chartFilesID, "repo.name": repo.Name, "repo.namespace": repo.Namespace}, models.ChartFiles{
-			ID:     chartFilesID,
-			Readme: testChartReadme,
-			Values: testChartValues,
-			Schema: testChartSchema,
-			Repo:   charts[0].Repo,
-			Digest: cv.Digest,
+			ID:            chartFilesID,
+			ChartID:       charts[0].ID,
+			Version:       cv.Version,
+			Readme:        testChartReadme,
+			Values:        testChartValues,
+			Parameters:    testChartParameters,
+			Schema:        testChartSchema,
+			Repo:          charts[0].Repo,
+			Digest:        cv.Digest,
+			FormatVersion: models.ChartFilesFormatVersion,
 		})
 		manager := getMockManager(&m)
-		fImporter := fileImporter{manager}
+		fImporter := fileImporter{manager: manager}
 		r := &models.RepoInternal{Name: repo.Name, Namespace: repo.Namespace, URL: repo.URL, AuthorizationHeader: "Bearer ThisSecretAccessTokenAuthenticatesTheClient"}
 		err := fImporter.fetchAndImportFiles(charts[0].Name, r, cv)
 		assert.NoErr(t, err)
@@ -615,18 +719,97 @@ func Test_fetchAndImportFiles(t *testing.T) {
 		m.On("One", mock.Anything).Return(errors.New("return an error when checking if files already exists to force fetching"))
 		chartFilesID := fmt.Sprintf("%s/%s-%s", charts[0].Repo.Name, charts[0].Name, cv.Version)
 		m.On("Upsert", bson.M{"file_id": chartFilesID, "repo.name": repo.Name, "repo.namespace": repo.Namespace}, models.ChartFiles{
-			ID:     chartFilesID,
-			Readme: testChartReadme,
-			Values: testChartValues,
-			Schema: testChartSchema,
-			Repo:   charts[0].Repo,
-			Digest: cv.Digest,
+			ID:            chartFilesID,
+			ChartID:       charts[0].ID,
+			Version:       cv.Version,
+			Readme:        testChartReadme,
+			Values:        testChartValues,
+			Parameters:    testChartParameters,
+			Schema:        testChartSchema,
+			Repo:          charts[0].Repo,
+			Digest:        cv.Digest,
+			FormatVersion: models.ChartFilesFormatVersion,
+		})
+		manager := getMockManager(&m)
+		fImporter := fileImporter{manager: manager}
+		err := fImporter.fetchAndImportFiles(charts[0].Name, repo, cv)
+		assert.NoErr(t, err)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("valid tarball with dependencies", func(t *testing.T) {
+		requirements := "dependencies:\n- name: mariadb\n  version: 7.x.x\n  repository: https://kubernetes-charts.storage.googleapis.com/\n"
+		netClient = &goodTarballClient{c: charts[0], requirements: requirements}
+		m := mock.Mock{}
+		m.On("One", mock.Anything).Return(errors.New("return an error when checking if files already exists to force fetching"))
+		chartFilesID := fmt.Sprintf("%s/%s-%s", charts[0].Repo.Name, charts[0].Name, cv.Version)
+		m.On("Upsert", bson.M{"file_id": chartFilesID, "repo.name": repo.Name, "repo.namespace": repo.Namespace}, models.ChartFiles{
+			ID:            chartFilesID,
+			ChartID:       charts[0].ID,
+			Version:       cv.Version,
+			Readme:        testChartReadme,
+			Values:        testChartValues,
+			Parameters:    testChartParameters,
+			Schema:        testChartSchema,
+			Repo:          charts[0].Repo,
+			Digest:        cv.Digest,
+			FormatVersion: models.ChartFilesFormatVersion,
+			Dependencies: []models.ChartDependency{
+				{Name: "mariadb", Version: "7.x.x", Repository: "https://kubernetes-charts.storage.googleapis.com/"},
+			},
+		})
+		manager := getMockManager(&m)
+		fImporter := fileImporter{manager: manager}
+		err := fImporter.fetchAndImportFiles(charts[0].Name, repo, cv)
+		assert.NoErr(t, err)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("valid tarball without values.schema.json", func(t *testing.T) {
+		netClient = &goodTarballClient{c: charts[0], skipSchema: true}
+		m := mock.Mock{}
+		m.On("One", mock.Anything).Return(errors.New("return an error when checking if files already exists to force fetching"))
+		chartFilesID := fmt.Sprintf("%s/%s-%s", charts[0].Repo.Name, charts[0].Name, cv.Version)
+		m.On("Upsert", bson.M{"file_id": chartFilesID, "repo.name": repo.Name, "repo.namespace": repo.Namespace}, models.ChartFiles{
+			ID:              chartFilesID,
+			ChartID:         charts[0].ID,
+			Version:         cv.Version,
+			Readme:          testChartReadme,
+			Values:          testChartValues,
+			Parameters:      testChartParameters,
+			Schema:          "{\n  \"$schema\": \"http://json-schema.org/draft-07/schema#\",\n  \"type\": \"object\",\n  \"properties\": {\n    \"image\": {\n      \"type\": \"string\",\n      \"default\": \"test\"\n    }\n  }\n}",
+			SchemaGenerated: true,
+			Repo:            charts[0].Repo,
+			Digest:          cv.Digest,
+			FormatVersion:   models.ChartFilesFormatVersion,
 		})
 		manager := getMockManager(&m)
-		fImporter := fileImporter{manager}
+		report := newSyncReport(*charts[0].Repo, time.Now())
+		fImporter := fileImporter{manager: manager, report: report}
+		err := fImporter.fetchAndImportFiles(charts[0].Name, repo, cv)
+		assert.NoErr(t, err)
+		m.AssertExpectations(t)
+		assert.Equal(t, report.report.Failures, []models.SyncFailure{}, "sync failures")
+		assert.Equal(t, report.report.Missing, []models.SyncMissingAsset{}, "missing assets")
+	})
+
+	t.Run("invalid values.yaml without values.schema.json", func(t *testing.T) {
+		netClient = &goodTarballClient{c: charts[0], skipSchema: true, values: "image: [test"}
+		m := mock.Mock{}
+		m.On("One", mock.Anything).Return(errors.New("return an error when checking if files already exists to force fetching"))
+		m.On("Upsert", mock.Anything, mock.Anything)
+		manager := getMockManager(&m)
+		report := newSyncReport(*charts[0].Repo, time.Now())
+		fImporter := fileImporter{manager: manager, report: report}
 		err := fImporter.fetchAndImportFiles(charts[0].Name, repo, cv)
 		assert.NoErr(t, err)
 		m.AssertExpectations(t)
+		assets := []string{}
+		for _, f := range report.report.Failures {
+			assets = append(assets, f.Asset)
+		}
+		assert.Equal(t, assets, []string{"parameters", "schema"}, "failed assets")
+		assert.Equal(t, report.report.Missing, []models.SyncMissingAsset{}, "missing assets")
 	})
 
 	t.Run("file exists", func(t *testing.T) {
@@ -634,9 +817,95 @@ func Test_fetchAndImportFiles(t *testing.T) {
 		// don't return an error when checking if files already exists
 		m.On("One", mock.Anything).Return(nil)
 		manager := getMockManager(&m)
-		fImporter := fileImporter{manager}
+		fImporter := fileImporter{manager: manager}
 		err := fImporter.fetchAndImportFiles(charts[0].Name, repo, cv)
 		assert.NoErr(t, err)
 		m.AssertNotCalled(t, "UpsertId", mock.Anything, mock.Anything)
 	})
+
+	// The digest of the tarball served by goodTarballClient
+	netClient = &goodTarballClient{c: charts[0]}
+	res, _ := netClient.Do(nil)
+	tarball, _ := ioutil.ReadAll(res.Body)
+	tarballDigest, _ := getSha256(tarball)
+	mirroredCV := cv
+	mirroredCV.Digest = tarballDigest
+	chartFilesID := fmt.Sprintf("%s/%s-%s", charts[0].Repo.Name, charts[0].Name, cv.Version)
+	mirroredFiles := models.ChartFiles{
+		ID:            chartFilesID,
+		ChartID:       charts[0].ID,
+		Version:       cv.Version,
+		Readme:        testChartReadme,
+		Values:        testChartValues,
+		Parameters:    testChartParameters,
+		Schema:        testChartSchema,
+		Repo:          charts[0].Repo,
+		Digest:        tarballDigest,
+		FormatVersion: models.ChartFilesFormatVersion,
+	}
+
+	t.Run("mirrors the tarball", func(t *testing.T) {
+		netClient = &goodTarballClient{c: charts[0]}
+		m := mock.Mock{}
+		m.On("One", mock.Anything).Return(errors.New("return an error when checking if files already exists to force fetching"))
+		m.On("Upsert", bson.M{"file_id": chartFilesID, "repo.name": repo.Name, "repo.namespace": repo.Namespace}, mirroredFiles)
+		manager := getMockManager(&m)
+		tarballs := blobstore.NewMemoryStore()
+		fImporter := fileImporter{manager: manager, tarballs: tarballs}
+		err := fImporter.fetchAndImportFiles(charts[0].Name, repo, mirroredCV)
+		assert.NoErr(t, err)
+		m.AssertExpectations(t)
+		mirrored, err := tarballs.Get(tarballDigest)
+		assert.NoErr(t, err)
+		assert.Equal(t, mirrored, tarball, "mirrored tarball")
+	})
+
+	t.Run("mirrors the tarball of existing files", func(t *testing.T) {
+		netClient = &goodTarballClient{c: charts[0]}
+		m := mock.Mock{}
+		// don't return an error when checking if files already exists
+		m.On("One", mock.Anything).Return(nil)
+		m.On("Upsert", bson.M{"file_id": chartFilesID, "repo.name": repo.Name, "repo.namespace": repo.Namespace}, mirroredFiles)
+		manager := getMockManager(&m)
+		tarballs := blobstore.NewMemoryStore()
+		fImporter := fileImporter{manager: manager, tarballs: tarballs}
+		err := fImporter.fetchAndImportFiles(charts[0].Name, repo, mirroredCV)
+		assert.NoErr(t, err)
+		m.AssertExpectations(t)
+		exists, err := tarballs.Exists(tarballDigest)
+		assert.NoErr(t, err)
+		assert.True(t, exists, "tarball mirrored")
+	})
+
+	t.Run("skips the existing files and tarball", func(t *testing.T) {
+		m := mock.Mock{}
+		m.On("One", mock.Anything).Return(nil)
+		manager := getMockManager(&m)
+		tarballs := blobstore.NewMemoryStore()
+		assert.NoErr(t, tarballs.Put(tarballDigest, tarball))
+		fImporter := fileImporter{manager: manager, tarballs: tarballs}
+		err := fImporter.fetchAndImportFiles(charts[0].Name, repo, mirroredCV)
+		assert.NoErr(t, err)
+		m.AssertNotCalled(t, "Upsert", mock.Anything, mock.Anything)
+	})
+
+	t.Run("does not mirror a tarball not matching the index digest", func(t *testing.T) {
+		netClient = &goodTarballClient{c: charts[0]}
+		m := mock.Mock{}
+		m.On("One", mock.Anything).Return(errors.New("return an error when checking if files already exists to force fetching"))
+		files := mirroredFiles
+		files.Digest = cv.Digest
+		m.On("Upsert", bson.M{"file_id": chartFilesID, "repo.name": repo.Name, "repo.namespace": repo.Namespace}, files)
+		manager := getMockManager(&m)
+		tarballs := blobstore.NewMemoryStore()
+		report := newSyncReport(*charts[0].Repo, time.Now())
+		fImporter := fileImporter{manager: manager, report: report, tarballs: tarballs}
+		err := fImporter.fetchAndImportFiles(charts[0].Name, repo, cv)
+		assert.NoErr(t, err)
+		m.AssertExpectations(t)
+		assert.Equal(t, len(report.report.Failures), 1, "sync failures")
+		assert.Equal(t, report.report.Failures[0].Asset, "tarball", "failed asset")
+		_, err = tarballs.Get(cv.Digest)
+		assert.Err(t, blobstore.ErrNotFound, err)
+	})
 }
@@ -0,0 +1,110 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kubeapps/kubeapps/pkg/auth"
+	"github.com/urfave/negroni"
+)
+
+// Modes of authorization of the namespaced routes
+const (
+	// authModeNone serves every request, the assetsvc is expected to be only
+	// reachable through a proxy authorizing the requests
+	authModeNone = "none"
+	// authModeToken requires a bearer token with access to the namespace
+	authModeToken = "token"
+	// authModeTrustedProxy serves the requests of the trusted proxies, which
+	// already authorized them, and requires a bearer token for any other one
+	authModeTrustedProxy = "trusted-proxy"
+)
+
+// authorizer authorizes the requests of the namespaced routes, every request
+// is served if nil
+var authorizer negroni.HandlerFunc
+
+// newAuthorizer returns the authorizer of the given mode. The namespace
+// access of the tokens is cached for the given duration.
+func newAuthorizer(mode, kubeappsNamespace, trustedProxies string, cacheTTL time.Duration) (negroni.HandlerFunc, error) {
+	switch mode {
+	case authModeNone:
+		return nil, nil
+	case authModeToken:
+		return auth.CachedAuthGate(kubeappsNamespace, auth.NewAccessCache(cacheTTL)), nil
+	case authModeTrustedProxy:
+		networks, err := parseCIDRs(trustedProxies)
+		if err != nil {
+			return nil, err
+		}
+		if len(networks) == 0 {
+			return nil, fmt.Errorf("the %q auth mode requires the trusted proxy CIDRs", authModeTrustedProxy)
+		}
+		return trustProxies(networks, auth.CachedAuthGate(kubeappsNamespace, auth.NewAccessCache(cacheTTL))), nil
+	}
+	return nil, fmt.Errorf("unsupported auth mode %q, use %q, %q or %q", mode, authModeNone, authModeToken, authModeTrustedProxy)
+}
+
+// parseCIDRs parses a comma separated list of CIDRs
+func parseCIDRs(cidrs string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, cidr := range strings.Split(cidrs, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy CIDR %q: %v", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// trustProxies serves the requests coming from the trusted networks and
+// authorizes any other one with the given gate
+func trustProxies(networks []*net.IPNet, gate negroni.HandlerFunc) negroni.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			host = req.RemoteAddr
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			for _, network := range networks {
+				if network.Contains(ip) {
+					next(w, req)
+					return
+				}
+			}
+		}
+		gate(w, req, next)
+	}
+}
+
+// withAuthz authorizes the requests of a namespaced route
+func withAuthz(h http.Handler) http.Handler {
+	if authorizer == nil {
+		return h
+	}
+	return negroni.New(authorizer, negroni.Wrap(h))
+}
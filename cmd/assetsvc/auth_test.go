@@ -0,0 +1,131 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_newAuthorizer(t *testing.T) {
+	tests := []struct {
+		name           string
+		mode           string
+		trustedProxies string
+		wantNil        bool
+		wantErr        bool
+	}{
+		{"no authorization", "none", "", true, false},
+		{"token", "token", "", false, false},
+		{"trusted proxies", "trusted-proxy", "10.0.0.0/8, 192.168.1.10/32", false, false},
+		{"trusted proxies without CIDRs", "trusted-proxy", "", false, true},
+		{"invalid CIDR", "trusted-proxy", "10.0.0.0", false, true},
+		{"unsupported mode", "basic", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := newAuthorizer(tt.mode, "kubeapps", tt.trustedProxies, time.Minute)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantNil, a == nil)
+		})
+	}
+}
+
+func Test_trustProxies(t *testing.T) {
+	networks, err := parseCIDRs("10.0.0.0/8,fd00::/8")
+	assert.NoError(t, err)
+	gated := false
+	h := trustProxies(networks, func(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+		gated = true
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		wantGated  bool
+	}{
+		{"trusted proxy", "10.1.2.3:41000", false},
+		{"trusted IPv6 proxy", "[fd00::1]:41000", false},
+		{"other client", "192.168.1.10:41000", true},
+		{"invalid address", "unknown", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gated = false
+			req := httptest.NewRequest("GET", "/v1/ns/default/charts", nil)
+			req.RemoteAddr = tt.remoteAddr
+			w := httptest.NewRecorder()
+			h(w, req, func(w http.ResponseWriter, req *http.Request) {})
+			assert.Equal(t, tt.wantGated, gated)
+		})
+	}
+}
+
+func Test_authorizedRoutes(t *testing.T) {
+	authorizer = func(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+		if req.Header.Get("Authorization") != "Bearer valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next(w, req)
+	}
+	defer func() { authorizer = nil }()
+	ts := httptest.NewServer(setupRoutes())
+	defer ts.Close()
+
+	var m mock.Mock
+	manager = getMockManager(&m)
+	m.On("All", &repoChecks)
+	m.On("One", &models.Chart{}).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*models.Chart) = models.Chart{Repo: testRepo, ID: "my-repo/my-chart", RawIcon: []byte("icon"), ChartVersions: []models.ChartVersion{{Version: "0.1.0"}}}
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		wantCode int
+	}{
+		{"chart without token", "/ns/default/charts/my-repo/my-chart", "", http.StatusUnauthorized},
+		{"chart with token", "/ns/default/charts/my-repo/my-chart", "valid", http.StatusOK},
+		{"logos are public", "/ns/default/assets/my-repo/my-chart/logo", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", ts.URL+pathPrefix+tt.path, nil)
+			assert.NoError(t, err)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			res, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantCode, res.StatusCode, "http status code should match")
+		})
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	log "github.com/sirupsen/logrus"
+)
+
+// versionedAssetCacheMaxAge is the number of seconds clients can cache the
+// files of a chart version, which don't change for a given digest
+const versionedAssetCacheMaxAge = 365 * 24 * 60 * 60
+
+// brotliQuality is the brotli compression level of the responses, the
+// highest levels being too slow to compress on the fly
+const brotliQuality = 5
+
+// compressedContentTypes are the media types compressed by compressResponse,
+// besides any text/* type
+var compressedContentTypes = map[string]bool{
+	"application/json":   true,
+	"application/x-yaml": true,
+	"image/svg+xml":      true,
+}
+
+// notModified sets the caching headers of a response identified by the given
+// ETag and writes a 304 if the client already has it. It returns true if the
+// response has been written.
+func notModified(w http.ResponseWriter, req *http.Request, etag, cacheControl string) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	if etagMatches(req.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// etagMatches returns true if the If-None-Match header contains the given ETag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// withCatalogETag returns 304 for the requests of clients which already have
+// the response of the current catalog. The ETag changes every time a
+// repository is synced so clients have to revalidate their responses.
+func withCatalogETag(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		version, err := manager.getCatalogVersion()
+		if err != nil {
+			log.WithError(err).Error("could not get the catalog version")
+			h.ServeHTTP(w, req)
+			return
+		}
+		// The encoding is part of the ETag since each encoding is a different
+		// representation of the response
+		digest := sha256.Sum256([]byte(strings.Join([]string{version, req.URL.RequestURI(), responseEncoding(req)}, "\n")))
+		etag := fmt.Sprintf("%q", hex.EncodeToString(digest[:]))
+		if notModified(w, req, etag, "no-cache") {
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// compressionEncodings are the supported content encodings of the
+// responses, by order of preference
+var compressionEncodings = []string{"br", "gzip"}
+
+// responseEncoding returns the content encoding used for the response of a
+// request, the supported encoding of the Accept-Encoding header with the
+// highest quality, brotli being preferred to gzip
+func responseEncoding(req *http.Request) string {
+	qualities := map[string]float64{}
+	for _, accepted := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(accepted, ";")
+		quality := 1.0
+		for _, param := range parts[1:] {
+			if q := strings.TrimSpace(param); strings.HasPrefix(q, "q=") {
+				if v, err := strconv.ParseFloat(strings.TrimPrefix(q, "q="), 64); err == nil {
+					quality = v
+				}
+			}
+		}
+		qualities[strings.ToLower(strings.TrimSpace(parts[0]))] = quality
+	}
+	encoding, best := "", 0.0
+	for _, e := range compressionEncodings {
+		// Encodings with a quality of 0 are not acceptable
+		if q, ok := qualities[e]; ok && q > best {
+			encoding, best = e, q
+		}
+	}
+	return encoding
+}
+
+// compressResponse is a middleware compressing the text and JSON responses
+// of the clients accepting a compressed response
+func compressResponse(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if responseEncoding(req) == "" {
+		next(w, req)
+		return
+	}
+	cw := &compressResponseWriter{ResponseWriter: w, encoding: responseEncoding(req)}
+	defer cw.Close()
+	next(cw, req)
+}
+
+// compressResponseWriter compresses the body of a response if its content
+// type is compressible
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding    string
+	compressor  io.WriteCloser
+	wroteHeader bool
+}
+
+func (cw *compressResponseWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	h := cw.Header()
+	if code != http.StatusNotModified && code != http.StatusNoContent && h.Get("Content-Encoding") == "" && isCompressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		if cw.encoding == "br" {
+			cw.compressor = brotli.NewWriterLevel(cw.ResponseWriter, brotliQuality)
+		} else {
+			cw.compressor = gzip.NewWriter(cw.ResponseWriter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressResponseWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		// Detect the content type as net/http does since it can't be detected
+		// once the body is compressed
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	var w io.Writer = cw.ResponseWriter
+	if cw.compressor != nil {
+		w = cw.compressor
+	}
+	return w.Write(b)
+}
+
+// Close flushes the compressed body
+func (cw *compressResponseWriter) Close() error {
+	if cw.compressor == nil {
+		return nil
+	}
+	return cw.compressor.Close()
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || compressedContentTypes[mediaType]
+}
@@ -0,0 +1,288 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_etagMatches(t *testing.T) {
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        bool
+	}{
+		{"empty header", "", false},
+		{"same etag", `"abc"`, true},
+		{"different etag", `"def"`, false},
+		{"list of etags", `"def", "abc"`, true},
+		{"weak etag", `W/"abc"`, true},
+		{"any etag", "*", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, etagMatches(tt.ifNoneMatch, `"abc"`))
+		})
+	}
+}
+
+func Test_responseEncoding(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		want           string
+	}{
+		{"no encoding", "", ""},
+		{"gzip", "gzip", "gzip"},
+		{"brotli", "br", "br"},
+		{"brotli preferred", "gzip, deflate, br", "br"},
+		{"higher quality", "br;q=0.5, gzip;q=0.8", "gzip"},
+		{"brotli not acceptable", "br;q=0, gzip", "gzip"},
+		{"gzip not acceptable", "gzip;q=0", ""},
+		{"gzip not acceptable with decimals", "gzip;q=0.000", ""},
+		{"unsupported encoding", "deflate", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			assert.Equal(t, tt.want, responseEncoding(req))
+		})
+	}
+}
+
+func Test_compressResponse(t *testing.T) {
+	body := `{"data": "some content"}`
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		wantEncoding   string
+	}{
+		{"json response", "gzip", "application/json", "gzip"},
+		{"text response", "gzip", "text/plain; charset=utf-8", "gzip"},
+		{"brotli response", "br, gzip", "application/json", "br"},
+		{"detected content type", "gzip", "", "gzip"},
+		{"image response", "gzip", "image/png", ""},
+		{"client does not accept compression", "", "application/json", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+
+			compressResponse(w, req, func(w http.ResponseWriter, req *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.Write([]byte(body))
+			})
+
+			assert.Equal(t, http.StatusOK, w.Code, "http status code should match")
+			assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+			assert.Equal(t, tt.wantEncoding, w.Header().Get("Content-Encoding"))
+			content := w.Body.Bytes()
+			switch tt.wantEncoding {
+			case "gzip":
+				gz, err := gzip.NewReader(w.Body)
+				assert.NoError(t, err)
+				content, err = ioutil.ReadAll(gz)
+				assert.NoError(t, err)
+			case "br":
+				var err error
+				content, err = ioutil.ReadAll(brotli.NewReader(w.Body))
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, body, string(content), "content of the response should match")
+		})
+	}
+}
+
+func Test_compressResponseNotModified(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	compressResponse(w, req, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotModified)
+	})
+
+	assert.Equal(t, http.StatusNotModified, w.Code, "http status code should match")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Empty(t, w.Body.Bytes())
+}
+
+func Test_withCatalogETag(t *testing.T) {
+	var m mock.Mock
+	manager = getMockManager(&m)
+	m.On("All", &repoChecks)
+
+	h := withCatalogETag(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("charts"))
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/ns/kubeapps/charts", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "http status code should match")
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// The same request returns 304 if the client already has the response
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/ns/kubeapps/charts", nil)
+	req.Header.Set("If-None-Match", etag)
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code, "http status code should match")
+	assert.Empty(t, w.Body.Bytes())
+
+	// Other requests and encodings have a different ETag
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/ns/kubeapps/charts?page=2", nil)
+	req.Header.Set("If-None-Match", etag)
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, "http status code should match")
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/ns/kubeapps/charts", nil)
+	req.Header.Set("If-None-Match", etag)
+	req.Header.Set("Accept-Encoding", "gzip")
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, "http status code should match")
+
+	m.AssertExpectations(t)
+}
+
+func Test_withCatalogETagError(t *testing.T) {
+	pg, sqlMock := newSQLMockManager(t)
+	manager = &pg
+	sqlMock.ExpectQuery("^SELECT md5").WillReturnError(errors.New("could not connect"))
+
+	h := withCatalogETag(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("charts"))
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/ns/kubeapps/charts", nil))
+
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code, "http status code should match")
+	assert.Empty(t, w.Header().Get("ETag"))
+	assert.Equal(t, "charts", w.Body.String())
+}
+
+func Test_versionedAssetNotModified(t *testing.T) {
+	tests := []struct {
+		name           string
+		files          models.ChartFiles
+		acceptEncoding string
+		ifNoneMatch    string
+		want           bool
+		wantETag       string
+	}{
+		{"files without digest", models.ChartFiles{ID: "my-repo/my-chart"}, "", `"abc"`, false, ""},
+		{"files not cached", models.ChartFiles{ID: "my-repo/my-chart", Digest: "abc"}, "", "", false, `"abc"`},
+		{"files cached", models.ChartFiles{ID: "my-repo/my-chart", Digest: "abc"}, "", `"abc"`, true, `"abc"`},
+		{"outdated files", models.ChartFiles{ID: "my-repo/my-chart", Digest: "abc"}, "", `"def"`, false, `"abc"`},
+		{"gzip files", models.ChartFiles{ID: "my-repo/my-chart", Digest: "abc"}, "gzip", "", false, `"abc-gzip"`},
+		{"gzip files cached", models.ChartFiles{ID: "my-repo/my-chart", Digest: "abc"}, "gzip", `"abc-gzip"`, true, `"abc-gzip"`},
+		{"brotli files cached", models.ChartFiles{ID: "my-repo/my-chart", Digest: "abc"}, "br", `"abc-br"`, true, `"abc-br"`},
+		{"uncompressed files cached by a gzip client", models.ChartFiles{ID: "my-repo/my-chart", Digest: "abc"}, "gzip", `"abc"`, false, `"abc-gzip"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/assets/"+tt.files.ID+"/versions/1.0.0/README.md", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+
+			assert.Equal(t, tt.want, versionedAssetNotModified(w, req, tt.files))
+			assert.Equal(t, tt.wantETag, w.Header().Get("ETag"))
+			if tt.want {
+				assert.Equal(t, http.StatusNotModified, w.Code, "http status code should match")
+			}
+			if tt.wantETag != "" {
+				assert.Equal(t, "public, max-age=31536000", w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func Test_derivedAssetNotModified(t *testing.T) {
+	tests := []struct {
+		name           string
+		files          models.ChartFiles
+		acceptEncoding string
+		ifNoneMatch    string
+		want           bool
+		wantETag       string
+	}{
+		{"files without digest", models.ChartFiles{ID: "my-repo/my-chart", FormatVersion: 1}, "", `"abc-v1"`, false, ""},
+		{"files cached", models.ChartFiles{ID: "my-repo/my-chart", Digest: "abc", FormatVersion: 1}, "", `"abc-v1"`, true, `"abc-v1"`},
+		{"gzip files cached", models.ChartFiles{ID: "my-repo/my-chart", Digest: "abc", FormatVersion: 1}, "gzip", `"abc-v1-gzip"`, true, `"abc-v1-gzip"`},
+		{"files reimported in a newer format", models.ChartFiles{ID: "my-repo/my-chart", Digest: "abc", FormatVersion: 2}, "", `"abc-v1"`, false, `"abc-v2"`},
+		{"files cached with the digest only", models.ChartFiles{ID: "my-repo/my-chart", Digest: "abc", FormatVersion: 1}, "", `"abc"`, false, `"abc-v1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/assets/"+tt.files.ID+"/versions/1.0.0/parameters.json", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+
+			assert.Equal(t, tt.want, derivedAssetNotModified(w, req, tt.files))
+			assert.Equal(t, tt.wantETag, w.Header().Get("ETag"))
+			if tt.want {
+				assert.Equal(t, http.StatusNotModified, w.Code, "http status code should match")
+			}
+		})
+	}
+}
+
+func Test_versionedAssetNotModifiedAuthorized(t *testing.T) {
+	authorizer = func(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) { next(w, req) }
+	defer func() { authorizer = nil }()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/assets/my-repo/my-chart/versions/1.0.0/README.md", nil)
+	assert.False(t, versionedAssetNotModified(w, req, models.ChartFiles{ID: "my-repo/my-chart", Digest: "abc"}))
+	// Shared caches can't keep the authorized files
+	assert.Equal(t, "private, max-age=31536000", w.Header().Get("Cache-Control"))
+}
@@ -0,0 +1,194 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/kubeapps/common/response"
+	"github.com/pmezard/go-difflib/difflib"
+	log "github.com/sirupsen/logrus"
+)
+
+// Types of the changes of a key between two documents
+const (
+	keyAdded   = "added"
+	keyRemoved = "removed"
+	keyChanged = "changed"
+)
+
+// keyChange is a key added, removed or changed between two documents. The
+// path of the key uses the dotted notation of helm --set.
+type keyChange struct {
+	Path     string      `json:"path"`
+	Type     string      `json:"type"`
+	OldValue interface{} `json:"oldValue,omitempty"`
+	NewValue interface{} `json:"newValue,omitempty"`
+}
+
+// chartVersionDiff is the difference between the files of two versions of a
+// chart
+type chartVersionDiff struct {
+	From   string      `json:"from"`
+	To     string      `json:"to"`
+	Values []keyChange `json:"values"`
+	Schema []keyChange `json:"schema"`
+	Readme string      `json:"readme"`
+}
+
+// getChartVersionDiff returns the changes of the default values, the values
+// schema and the README of a chart between the versions given by the from and
+// to query parameters
+func getChartVersionDiff(w http.ResponseWriter, req *http.Request, params Params) {
+	from, to := req.FormValue("from"), req.FormValue("to")
+	if from == "" || to == "" {
+		response.NewErrorResponse(http.StatusBadRequest, "the from and to versions are required").Write(w)
+		return
+	}
+	chartID := fmt.Sprintf("%s/%s", params["repo"], params["chartName"])
+	fromFiles, err := manager.getChartFiles(params["namespace"], fmt.Sprintf("%s-%s", chartID, from))
+	if err != nil {
+		log.WithError(err).Errorf("could not find files of %s version %s", chartID, from)
+		response.NewErrorResponse(http.StatusNotFound, "could not find chart version "+from).Write(w)
+		return
+	}
+	toFiles, err := manager.getChartFiles(params["namespace"], fmt.Sprintf("%s-%s", chartID, to))
+	if err != nil {
+		log.WithError(err).Errorf("could not find files of %s version %s", chartID, to)
+		response.NewErrorResponse(http.StatusNotFound, "could not find chart version "+to).Write(w)
+		return
+	}
+
+	diff := chartVersionDiff{From: from, To: to}
+	diff.Values, err = diffDocuments(fromFiles.Values, toFiles.Values)
+	if err != nil {
+		log.WithError(err).Errorf("could not compare the values of %s", chartID)
+		response.NewErrorResponse(http.StatusUnprocessableEntity, "could not parse the chart values: "+err.Error()).Write(w)
+		return
+	}
+	diff.Schema, err = diffDocuments(fromFiles.Schema, toFiles.Schema)
+	if err != nil {
+		log.WithError(err).Errorf("could not compare the values schema of %s", chartID)
+		response.NewErrorResponse(http.StatusUnprocessableEntity, "could not parse the values schema: "+err.Error()).Write(w)
+		return
+	}
+	diff.Readme, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(fromFiles.Readme),
+		B:        splitLines(toFiles.Readme),
+		FromFile: fmt.Sprintf("%s-%s/README.md", params["chartName"], from),
+		ToFile:   fmt.Sprintf("%s-%s/README.md", params["chartName"], to),
+		Context:  3,
+	})
+	if err != nil {
+		log.WithError(err).Errorf("could not compare the README of %s", chartID)
+		response.NewErrorResponse(http.StatusInternalServerError, "could not compare the README").Write(w)
+		return
+	}
+
+	response.NewDataResponse(apiResponse{
+		Type:       "chartVersionDiff",
+		ID:         fmt.Sprintf("%s-%s...%s", chartID, from, to),
+		Attributes: diff,
+	}).Write(w)
+}
+
+// diffDocuments returns the keys added, removed or changed between two YAML
+// documents, which includes JSON documents
+func diffDocuments(from, to string) ([]keyChange, error) {
+	var fromDoc, toDoc interface{}
+	if err := yaml.Unmarshal([]byte(from), &fromDoc); err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal([]byte(to), &toDoc); err != nil {
+		return nil, err
+	}
+	// An empty document has no keys
+	if fromDoc == nil {
+		fromDoc = map[string]interface{}{}
+	}
+	if toDoc == nil {
+		toDoc = map[string]interface{}{}
+	}
+	changes := []keyChange{}
+	diffValues("", fromDoc, toDoc, &changes)
+	return changes, nil
+}
+
+// diffValues adds the changes between two values to the list. Maps are
+// compared key by key while any other value, lists included, is compared as a
+// whole.
+func diffValues(path string, from, to interface{}, changes *[]keyChange) {
+	fromMap, fromIsMap := from.(map[string]interface{})
+	toMap, toIsMap := to.(map[string]interface{})
+	if !fromIsMap || !toIsMap {
+		if !reflect.DeepEqual(from, to) {
+			*changes = append(*changes, keyChange{Path: path, Type: keyChanged, OldValue: from, NewValue: to})
+		}
+		return
+	}
+
+	keys := []string{}
+	for k := range fromMap {
+		keys = append(keys, k)
+	}
+	for k := range toMap {
+		if _, ok := fromMap[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		keyPath := childPath(path, k)
+		fromValue, inFrom := fromMap[k]
+		toValue, inTo := toMap[k]
+		switch {
+		case !inFrom:
+			*changes = append(*changes, keyChange{Path: keyPath, Type: keyAdded, NewValue: toValue})
+		case !inTo:
+			*changes = append(*changes, keyChange{Path: keyPath, Type: keyRemoved, OldValue: fromValue})
+		default:
+			diffValues(keyPath, fromValue, toValue, changes)
+		}
+	}
+}
+
+// splitLines splits a text in lines keeping their line break, which is added
+// to the last line if missing so the unified diff has one line per line
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	lines := strings.SplitAfter(text, "\n")
+	return lines[:len(lines)-1]
+}
+
+// childPath returns the path of a key of a map, escaping the dots of the key
+func childPath(path, key string) string {
+	key = strings.Replace(key, ".", `\.`, -1)
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,178 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_diffDocuments(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		want    []keyChange
+		wantErr bool
+	}{
+		{"same documents", "a: 1\nb: [1, 2]\n", "b: [1, 2]\na: 1\n", []keyChange{}, false},
+		{"empty documents", "", "", []keyChange{}, false},
+		{
+			"added, removed and changed keys",
+			"image:\n  tag: 1.0.0\n  pullPolicy: IfNotPresent\nreplicas: 1\n",
+			"image:\n  tag: 2.0.0\nreplicas: 1\nservice:\n  type: ClusterIP\n",
+			[]keyChange{
+				{Path: "image.pullPolicy", Type: keyRemoved, OldValue: "IfNotPresent"},
+				{Path: "image.tag", Type: keyChanged, OldValue: "1.0.0", NewValue: "2.0.0"},
+				{Path: "service", Type: keyAdded, NewValue: map[string]interface{}{"type": "ClusterIP"}},
+			},
+			false,
+		},
+		{
+			"lists are compared as a whole",
+			"args: [a, b]\n",
+			"args: [a, c]\n",
+			[]keyChange{{Path: "args", Type: keyChanged, OldValue: []interface{}{"a", "b"}, NewValue: []interface{}{"a", "c"}}},
+			false,
+		},
+		{
+			"map replaced by a value",
+			"persistence:\n  enabled: true\n",
+			"persistence: false\n",
+			[]keyChange{{Path: "persistence", Type: keyChanged, OldValue: map[string]interface{}{"enabled": true}, NewValue: false}},
+			false,
+		},
+		{
+			"new document",
+			"",
+			"enabled: false\n",
+			[]keyChange{{Path: "enabled", Type: keyAdded, NewValue: false}},
+			false,
+		},
+		{
+			"keys with dots",
+			`{"annotations": {"prometheus.io/scrape": "true"}}`,
+			`{"annotations": {"prometheus.io/scrape": "false"}}`,
+			[]keyChange{{Path: `annotations.prometheus\.io/scrape`, Type: keyChanged, OldValue: "true", NewValue: "false"}},
+			false,
+		},
+		{"invalid document", "a: 1\n", "a: [1\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := diffDocuments(tt.from, tt.to)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, changes)
+		})
+	}
+}
+
+func Test_splitLines(t *testing.T) {
+	assert.Equal(t, []string{}, splitLines(""))
+	assert.Equal(t, []string{"a\n", "\n", "b\n"}, splitLines("a\n\nb\n"))
+	assert.Equal(t, []string{"a\n", "b\n"}, splitLines("a\nb"))
+}
+
+func Test_getChartVersionDiff(t *testing.T) {
+	fromFiles := models.ChartFiles{
+		ID:     "my-repo/my-chart-1.0.0",
+		Readme: "# My chart\n\nVersion 1\n",
+		Values: "image:\n  tag: 1.0.0\n",
+		Schema: `{"properties": {"image": {"type": "object"}}}`,
+	}
+	toFiles := models.ChartFiles{
+		ID:     "my-repo/my-chart-2.0.0",
+		Readme: "# My chart\n\nVersion 2\n",
+		Values: "image:\n  tag: 2.0.0\n",
+		Schema: `{"properties": {"image": {"type": "object"}}}`,
+	}
+
+	var m mock.Mock
+	manager = getMockManager(&m)
+	m.On("One", &models.ChartFiles{}).Return(nil).Once().Run(func(args mock.Arguments) {
+		*args.Get(0).(*models.ChartFiles) = fromFiles
+	})
+	m.On("One", &models.ChartFiles{}).Return(nil).Once().Run(func(args mock.Arguments) {
+		*args.Get(0).(*models.ChartFiles) = toFiles
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/ns/kubeapps/charts/my-repo/my-chart/diff?from=1.0.0&to=2.0.0", nil)
+	getChartVersionDiff(w, req, Params{"namespace": "kubeapps", "repo": "my-repo", "chartName": "my-chart"})
+
+	m.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, w.Code, "http status code should match")
+	var b struct {
+		Data struct {
+			ID         string           `json:"id"`
+			Attributes chartVersionDiff `json:"attributes"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&b))
+	assert.Equal(t, "my-repo/my-chart-1.0.0...2.0.0", b.Data.ID)
+	diff := b.Data.Attributes
+	assert.Equal(t, "1.0.0", diff.From)
+	assert.Equal(t, "2.0.0", diff.To)
+	assert.Equal(t, []keyChange{{Path: "image.tag", Type: keyChanged, OldValue: "1.0.0", NewValue: "2.0.0"}}, diff.Values)
+	assert.Equal(t, []keyChange{}, diff.Schema)
+	assert.Equal(t, "--- my-chart-1.0.0/README.md\n+++ my-chart-2.0.0/README.md\n@@ -1,3 +1,3 @@\n # My chart\n \n-Version 1\n+Version 2\n", diff.Readme)
+}
+
+func Test_getChartVersionDiffErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		err      error
+		files    models.ChartFiles
+		wantCode int
+	}{
+		{"missing versions", "?from=1.0.0", nil, models.ChartFiles{}, http.StatusBadRequest},
+		{"version does not exist", "?from=1.0.0&to=2.0.0", errors.New("not found"), models.ChartFiles{}, http.StatusNotFound},
+		{"invalid values", "?from=1.0.0&to=2.0.0", nil, models.ChartFiles{Values: "image: [1\n"}, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m mock.Mock
+			manager = getMockManager(&m)
+			if tt.err != nil {
+				m.On("One", mock.Anything).Return(tt.err)
+			} else {
+				m.On("One", &models.ChartFiles{}).Maybe().Return(nil).Run(func(args mock.Arguments) {
+					*args.Get(0).(*models.ChartFiles) = tt.files
+				})
+			}
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/ns/kubeapps/charts/my-repo/my-chart/diff"+tt.query, nil)
+			getChartVersionDiff(w, req, Params{"namespace": "kubeapps", "repo": "my-repo", "chartName": "my-chart"})
+
+			m.AssertExpectations(t)
+			assert.Equal(t, tt.wantCode, w.Code, "http status code should match")
+		})
+	}
+}
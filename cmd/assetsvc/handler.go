@@ -17,12 +17,16 @@ limitations under the License.
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/Masterminds/semver"
 	"github.com/gorilla/mux"
 	"github.com/kubeapps/common/response"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
 	log "github.com/sirupsen/logrus"
 )
@@ -41,6 +45,17 @@ func (h WithParams) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 const chartCollection = "charts"
 const filesCollection = "files"
 
+// iconCacheMaxAge is the number of seconds clients can cache an icon before
+// revalidating it with its ETag
+const iconCacheMaxAge = 7 * 24 * 60 * 60
+
+// defaultSyncReportsLimit is the number of sync reports returned if no limit is given
+const defaultSyncReportsLimit = 10
+
+// schemaGeneratedHeader is set on the values schemas inferred from the values
+// of the chart versions without a values.schema.json
+const schemaGeneratedHeader = "X-Kubeapps-Schema-Generated"
+
 type apiResponse struct {
 	ID            string      `json:"id"`
 	Type          string      `json:"type"`
@@ -65,6 +80,13 @@ type meta struct {
 	TotalPages int `json:"totalPages"`
 }
 
+// chartListMeta is the meta of a list of charts with the facets of the
+// charts matching its filters
+type chartListMeta struct {
+	TotalPages int         `json:"totalPages"`
+	Facets     chartFacets `json:"facets"`
+}
+
 // count is used to parse the result of a $count operation in the database
 type count struct {
 	Count int
@@ -83,6 +105,25 @@ func getPageNumberAndSize(req *http.Request) (int, int) {
 	return int(pageInt), int(sizeInt)
 }
 
+// getChartSort returns the sort requested with the sort param, a field name
+// optionally prefixed with "-" for a descending order. Default by name.
+func getChartSort(req *http.Request) (chartSort, error) {
+	sort := chartSort{field: sortByName}
+	value := req.FormValue("sort")
+	if strings.HasPrefix(value, "-") {
+		sort.descending = true
+		value = strings.TrimPrefix(value, "-")
+	}
+	switch value {
+	case "":
+	case sortByName, sortByUpdated, sortByCreated:
+		sort.field = value
+	default:
+		return sort, fmt.Errorf("unsupported sort field %q, choose one of %s, %s or %s", value, sortByName, sortByUpdated, sortByCreated)
+	}
+	return sort, nil
+}
+
 // showDuplicates returns if a request wants to retrieve charts. Default false
 func showDuplicates(req *http.Request) bool {
 	return len(req.FormValue("showDuplicates")) > 0
@@ -113,15 +154,95 @@ func uniqChartList(charts []*models.Chart) []*models.Chart {
 	return res
 }
 
-func getPaginatedChartList(namespace, repo string, pageNumber, pageSize int, showDuplicates bool) (apiListResponse, interface{}, error) {
-	charts, totalPages, err := manager.getPaginatedChartList(namespace, repo, pageNumber, pageSize, showDuplicates)
-	return newChartListResponse(charts), meta{totalPages}, err
+func getPaginatedChartList(namespace string, filters chartFilters, pageNumber, pageSize int, showDuplicates bool, sort chartSort, kubeVersion *semver.Version) (apiListResponse, interface{}, error) {
+	charts, totalPages, err := manager.getPaginatedChartList(namespace, filters, pageNumber, pageSize, showDuplicates, sort)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, c := range charts {
+		markIncompatibleVersions(c, kubeVersion)
+	}
+	facets, err := manager.getChartFacets(namespace, filters, showDuplicates)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Facets without values are returned as empty lists
+	for _, f := range []*[]facetCount{&facets.Keywords, &facets.Maintainers, &facets.Categories, &facets.Repos} {
+		if *f == nil {
+			*f = []facetCount{}
+		}
+	}
+	return newChartListResponse(charts), chartListMeta{totalPages, facets}, nil
+}
+
+// getChartType returns the chart type selected by the type param, the default
+// type if it's not set. Every chart type is selected by an empty type.
+func getChartType(req *http.Request, defaultType string) (string, error) {
+	switch t := req.URL.Query().Get("type"); t {
+	case "":
+		return defaultType, nil
+	case chartTypeAll:
+		return "", nil
+	case chartTypeApplication, models.LibraryChartType:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unsupported chart type %q, choose one of %s, %s or %s", t, chartTypeApplication, models.LibraryChartType, chartTypeAll)
+	}
+}
+
+// getChartFilters returns the filters of a chart list, the repo of the path
+// takes precedence over the repo params. The type param selects the type of
+// the charts, the default type is used if it's not set.
+func getChartFilters(req *http.Request, params Params, defaultType string) (chartFilters, error) {
+	query := req.URL.Query()
+	filters := chartFilters{
+		repos:      query["repo"],
+		keyword:    query.Get("keyword"),
+		maintainer: query.Get("maintainer"),
+		category:   query.Get("category"),
+		appVersion: query.Get("appVersion"),
+		chartType:  defaultType,
+	}
+	if params["repo"] != "" {
+		filters.repos = []string{params["repo"]}
+	}
+	chartType, err := getChartType(req, defaultType)
+	if err != nil {
+		return filters, err
+	}
+	filters.chartType = chartType
+	for _, a := range query["annotation"] {
+		kv := strings.SplitN(a, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return filters, fmt.Errorf("invalid annotation %q, expected key=value", a)
+		}
+		if filters.annotations == nil {
+			filters.annotations = map[string]string{}
+		}
+		filters.annotations[kv[0]] = kv[1]
+	}
+	return filters, nil
 }
 
 // listCharts returns a list of charts based on filter params
 func listCharts(w http.ResponseWriter, req *http.Request, params Params) {
 	pageNumber, pageSize := getPageNumberAndSize(req)
-	cl, meta, err := getPaginatedChartList(params["namespace"], params["repo"], pageNumber, pageSize, showDuplicates(req))
+	sort, err := getChartSort(req)
+	if err != nil {
+		response.NewErrorResponse(http.StatusBadRequest, err.Error()).Write(w)
+		return
+	}
+	filters, err := getChartFilters(req, params, chartTypeApplication)
+	if err != nil {
+		response.NewErrorResponse(http.StatusBadRequest, err.Error()).Write(w)
+		return
+	}
+	kubeVersion, err := requestKubeVersion(req)
+	if err != nil {
+		response.NewErrorResponse(http.StatusBadRequest, err.Error()).Write(w)
+		return
+	}
+	cl, meta, err := getPaginatedChartList(params["namespace"], filters, pageNumber, pageSize, showDuplicates(req), sort, kubeVersion)
 	if err != nil {
 		log.WithError(err).Error("could not fetch charts")
 		response.NewErrorResponse(http.StatusInternalServerError, "could not fetch all charts").Write(w)
@@ -130,22 +251,45 @@ func listCharts(w http.ResponseWriter, req *http.Request, params Params) {
 	response.NewDataResponseWithMeta(cl, meta).Write(w)
 }
 
-// getChart returns the chart from the given repo
-func getChart(w http.ResponseWriter, req *http.Request, params Params) {
-	chartID := fmt.Sprintf("%s/%s", params["repo"], params["chartName"])
-	chart, err := manager.getChart(params["namespace"], chartID)
+// searchCharts returns the charts matching the search query ordered by
+// relevance. Like the lists, the search returns the application charts unless
+// another type is selected.
+func searchCharts(w http.ResponseWriter, req *http.Request, params Params) {
+	query := req.FormValue("q")
+	if strings.TrimSpace(query) == "" {
+		response.NewErrorResponse(http.StatusBadRequest, "the search query is required").Write(w)
+		return
+	}
+	chartType, err := getChartType(req, chartTypeApplication)
 	if err != nil {
-		log.WithError(err).Errorf("could not find chart with id %s", chartID)
-		response.NewErrorResponse(http.StatusNotFound, "could not find chart").Write(w)
+		response.NewErrorResponse(http.StatusBadRequest, err.Error()).Write(w)
 		return
 	}
-
-	cr := newChartResponse(&chart)
-	response.NewDataResponse(cr).Write(w)
+	kubeVersion, err := requestKubeVersion(req)
+	if err != nil {
+		response.NewErrorResponse(http.StatusBadRequest, err.Error()).Write(w)
+		return
+	}
+	pageNumber, pageSize := getPageNumberAndSize(req)
+	charts, totalPages, err := manager.searchCharts(params["namespace"], query, req.FormValue("repo"), chartType, pageNumber, pageSize)
+	if err != nil {
+		log.WithError(err).Errorf("could not search charts with query %q", query)
+		response.NewErrorResponse(http.StatusInternalServerError, "could not search charts").Write(w)
+		return
+	}
+	for _, c := range charts {
+		markIncompatibleVersions(c, kubeVersion)
+	}
+	response.NewDataResponseWithMeta(newChartListResponse(charts), meta{totalPages}).Write(w)
 }
 
-// listChartVersions returns a list of chart versions for the given chart
-func listChartVersions(w http.ResponseWriter, req *http.Request, params Params) {
+// getChart returns the chart from the given repo
+func getChart(w http.ResponseWriter, req *http.Request, params Params) {
+	kubeVersion, err := requestKubeVersion(req)
+	if err != nil {
+		response.NewErrorResponse(http.StatusBadRequest, err.Error()).Write(w)
+		return
+	}
 	chartID := fmt.Sprintf("%s/%s", params["repo"], params["chartName"])
 	chart, err := manager.getChart(params["namespace"], chartID)
 	if err != nil {
@@ -153,13 +297,19 @@ func listChartVersions(w http.ResponseWriter, req *http.Request, params Params)
 		response.NewErrorResponse(http.StatusNotFound, "could not find chart").Write(w)
 		return
 	}
+	markIncompatibleVersions(&chart, kubeVersion)
 
-	cvl := newChartVersionListResponse(&chart)
-	response.NewDataResponse(cvl).Write(w)
+	cr := newChartResponse(&chart)
+	response.NewDataResponse(cr).Write(w)
 }
 
 // getChartVersion returns the given chart version
 func getChartVersion(w http.ResponseWriter, req *http.Request, params Params) {
+	kubeVersion, err := requestKubeVersion(req)
+	if err != nil {
+		response.NewErrorResponse(http.StatusBadRequest, err.Error()).Write(w)
+		return
+	}
 	chartID := fmt.Sprintf("%s/%s", params["repo"], params["chartName"])
 	chart, err := manager.getChartVersion(params["namespace"], chartID, params["version"])
 	if err != nil {
@@ -167,6 +317,7 @@ func getChartVersion(w http.ResponseWriter, req *http.Request, params Params) {
 		response.NewErrorResponse(http.StatusNotFound, "could not find chart version").Write(w)
 		return
 	}
+	markIncompatibleVersions(&chart, kubeVersion)
 
 	cvr := newChartVersionResponse(&chart, chart.ChartVersions[0])
 	response.NewDataResponse(cvr).Write(w)
@@ -175,25 +326,63 @@ func getChartVersion(w http.ResponseWriter, req *http.Request, params Params) {
 // getChartIcon returns the icon for a given chart
 func getChartIcon(w http.ResponseWriter, req *http.Request, params Params) {
 	chartID := fmt.Sprintf("%s/%s", params["repo"], params["chartName"])
-	chart, err := manager.getChart(params["namespace"], chartID)
+	icon, err := manager.getChartIcon(params["namespace"], chartID)
 	if err != nil {
-		log.WithError(err).Errorf("could not find chart with id %s", chartID)
+		log.WithError(err).Errorf("could not find icon of chart with id %s", chartID)
 		http.NotFound(w, req)
 		return
 	}
 
-	if chart.RawIcon == nil {
+	if len(icon.Data) == 0 {
 		http.NotFound(w, req)
 		return
 	}
 
-	if chart.IconContentType != "" {
+	if notModified(w, req, fmt.Sprintf("%q", icon.Digest), fmt.Sprintf("public, max-age=%d", iconCacheMaxAge)) {
+		return
+	}
+
+	if icon.ContentType != "" {
 		// Force the Content-Type header because the autogenerated type does not work for
 		// image/svg+xml. It is detected as plain text
-		w.Header().Set("Content-Type", chart.IconContentType)
+		w.Header().Set("Content-Type", icon.ContentType)
 	}
 
-	w.Write(chart.RawIcon)
+	w.Write(icon.Data)
+}
+
+// versionedAssetNotModified sets the caching headers of a file of a chart
+// version identified by the digest of the version and the encoding of the
+// response, each encoding being a different representation of the file. It
+// returns true if the client already has the file. Shared caches can't keep
+// the files when the requests are authorized.
+func versionedAssetNotModified(w http.ResponseWriter, req *http.Request, files models.ChartFiles) bool {
+	if files.Digest == "" {
+		return false
+	}
+	return assetTagNotModified(w, req, files.Digest)
+}
+
+// derivedAssetNotModified is versionedAssetNotModified for the files the
+// syncer derives from the tarball, like the parameters or a generated schema.
+// The format version of the files is part of their ETag so clients get them
+// again once they are imported by a newer syncer.
+func derivedAssetNotModified(w http.ResponseWriter, req *http.Request, files models.ChartFiles) bool {
+	if files.Digest == "" {
+		return false
+	}
+	return assetTagNotModified(w, req, fmt.Sprintf("%s-v%d", files.Digest, files.FormatVersion))
+}
+
+func assetTagNotModified(w http.ResponseWriter, req *http.Request, tag string) bool {
+	if encoding := responseEncoding(req); encoding != "" {
+		tag += "-" + encoding
+	}
+	visibility := "public"
+	if authorizer != nil {
+		visibility = "private"
+	}
+	return notModified(w, req, fmt.Sprintf("%q", tag), fmt.Sprintf("%s, max-age=%d", visibility, versionedAssetCacheMaxAge))
 }
 
 // getChartVersionReadme returns the README for a given chart
@@ -211,6 +400,9 @@ func getChartVersionReadme(w http.ResponseWriter, req *http.Request, params Para
 		http.NotFound(w, req)
 		return
 	}
+	if versionedAssetNotModified(w, req, files) {
+		return
+	}
 	w.Write(readme)
 }
 
@@ -224,6 +416,9 @@ func getChartVersionValues(w http.ResponseWriter, req *http.Request, params Para
 		return
 	}
 
+	if versionedAssetNotModified(w, req, files) {
+		return
+	}
 	w.Write([]byte(files.Values))
 }
 
@@ -237,11 +432,234 @@ func getChartVersionSchema(w http.ResponseWriter, req *http.Request, params Para
 		return
 	}
 
+	assetNotModified := versionedAssetNotModified
+	if files.SchemaGenerated {
+		assetNotModified = derivedAssetNotModified
+	}
+	if assetNotModified(w, req, files) {
+		return
+	}
+	if files.SchemaGenerated {
+		w.Header().Set(schemaGeneratedHeader, "true")
+	}
 	w.Write([]byte(files.Schema))
 }
 
+// getChartVersionParameters returns the parameters documented in the
+// values.yaml of a given chart version
+func getChartVersionParameters(w http.ResponseWriter, req *http.Request, params Params) {
+	fileID := fmt.Sprintf("%s/%s-%s", params["repo"], params["chartName"], params["version"])
+	files, err := manager.getChartFiles(params["namespace"], fileID)
+	if err != nil {
+		log.WithError(err).Errorf("could not find parameters with id %s", fileID)
+		http.NotFound(w, req)
+		return
+	}
+
+	if derivedAssetNotModified(w, req, files) {
+		return
+	}
+	parameters := files.Parameters
+	if parameters == nil {
+		parameters = []models.ChartParameter{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(parameters)
+}
+
+// getChartVersionTarball returns the mirrored tarball of a given chart version
+func getChartVersionTarball(w http.ResponseWriter, req *http.Request, params Params) {
+	fileID := fmt.Sprintf("%s/%s-%s", params["repo"], params["chartName"], params["version"])
+	files, err := manager.getChartFiles(params["namespace"], fileID)
+	if err != nil {
+		log.WithError(err).Errorf("could not find files with id %s", fileID)
+		http.NotFound(w, req)
+		return
+	}
+	if tarballs == nil || files.Digest == "" {
+		log.Errorf("the tarball of %s is not mirrored", fileID)
+		http.NotFound(w, req)
+		return
+	}
+
+	// The tarball is loaded before writing the caching headers so errors
+	// are not cached
+	tarball, err := tarballs.Get(files.Digest)
+	if err == blobstore.ErrNotFound {
+		log.Errorf("the tarball of %s is not mirrored", fileID)
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		log.WithError(err).Errorf("could not get the tarball of %s", fileID)
+		response.NewErrorResponse(http.StatusInternalServerError, "could not get the chart tarball").Write(w)
+		return
+	}
+
+	if versionedAssetNotModified(w, req, files) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-%s.tgz\"", params["chartName"], params["version"]))
+	w.Write(tarball)
+}
+
+// getChartVersionDependencies returns the dependencies declared by a given chart version
+func getChartVersionDependencies(w http.ResponseWriter, req *http.Request, params Params) {
+	fileID := fmt.Sprintf("%s/%s-%s", params["repo"], params["chartName"], params["version"])
+	files, err := manager.getChartFiles(params["namespace"], fileID)
+	if err != nil {
+		log.WithError(err).Errorf("could not find files with id %s", fileID)
+		response.NewErrorResponse(http.StatusNotFound, "could not find chart version").Write(w)
+		return
+	}
+
+	dependencies := files.Dependencies
+	if dependencies == nil {
+		dependencies = []models.ChartDependency{}
+	}
+	response.NewDataResponse(dependencies).Write(w)
+}
+
+// listChartDependents returns the chart versions declaring a dependency on the given chart
+func listChartDependents(w http.ResponseWriter, req *http.Request, params Params) {
+	chartID := fmt.Sprintf("%s/%s", params["repo"], params["chartName"])
+	chart, err := manager.getChart(params["namespace"], chartID)
+	if err != nil {
+		log.WithError(err).Errorf("could not find chart with id %s", chartID)
+		response.NewErrorResponse(http.StatusNotFound, "could not find chart").Write(w)
+		return
+	}
+
+	files, err := manager.getDependentChartFiles(params["namespace"], chart.Name)
+	if err != nil {
+		log.WithError(err).Errorf("could not fetch the dependents of chart %s", chartID)
+		response.NewErrorResponse(http.StatusInternalServerError, "could not fetch chart dependents").Write(w)
+		return
+	}
+
+	dependents := []models.ChartDependent{}
+	for _, f := range files {
+		for _, d := range f.Dependencies {
+			if d.Name == chart.Name && dependencyMatchesRepo(d, chart.Repo) {
+				dependents = append(dependents, models.ChartDependent{ChartID: f.ChartID, Version: f.Version, Repo: f.Repo, Dependency: d})
+			}
+		}
+	}
+	response.NewDataResponse(dependents).Write(w)
+}
+
+// dependencyMatchesRepo returns if the dependency can be resolved from the given repo.
+// Repository aliases (e.g. "@stable") and local paths cannot be resolved without
+// the helm configuration of the chart author so they only match by name.
+func dependencyMatchesRepo(d models.ChartDependency, r *models.Repo) bool {
+	if r == nil || !(strings.HasPrefix(d.Repository, "http://") || strings.HasPrefix(d.Repository, "https://")) {
+		return true
+	}
+	return strings.TrimSuffix(d.Repository, "/") == strings.TrimSuffix(r.URL, "/")
+}
+
+// getChartVersionImages returns the container images used by a given chart version
+func getChartVersionImages(w http.ResponseWriter, req *http.Request, params Params) {
+	fileID := fmt.Sprintf("%s/%s-%s", params["repo"], params["chartName"], params["version"])
+	files, err := manager.getChartFiles(params["namespace"], fileID)
+	if err != nil {
+		log.WithError(err).Errorf("could not find files with id %s", fileID)
+		response.NewErrorResponse(http.StatusNotFound, "could not find chart version").Write(w)
+		return
+	}
+
+	images := files.Images
+	if images == nil {
+		images = []string{}
+	}
+	response.NewDataResponse(images).Write(w)
+}
+
+// listChartImages returns the chart versions using a container image which contains the "image" param
+func listChartImages(w http.ResponseWriter, req *http.Request, params Params) {
+	image := req.FormValue("image")
+	if image == "" {
+		response.NewErrorResponse(http.StatusBadRequest, "an image is required").Write(w)
+		return
+	}
+
+	files, err := manager.getChartFilesWithImage(params["namespace"], image)
+	if err != nil {
+		log.WithError(err).Errorf("could not fetch the charts using image %s", image)
+		response.NewErrorResponse(http.StatusInternalServerError, "could not fetch charts").Write(w)
+		return
+	}
+
+	chartImages := []models.ChartImage{}
+	for _, f := range files {
+		for _, i := range f.Images {
+			if strings.Contains(i, image) {
+				chartImages = append(chartImages, models.ChartImage{ChartID: f.ChartID, Version: f.Version, Repo: f.Repo, Image: i})
+			}
+		}
+	}
+	response.NewDataResponse(chartImages).Write(w)
+}
+
+// listSyncReports returns the latest sync reports of a repository, the number
+// of reports can be limited with the "limit" param
+func listSyncReports(w http.ResponseWriter, req *http.Request, params Params) {
+	limit := defaultSyncReportsLimit
+	if l := req.FormValue("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 {
+			response.NewErrorResponse(http.StatusBadRequest, "limit should be a positive number").Write(w)
+			return
+		}
+	}
+
+	reports, err := manager.getSyncReports(params["namespace"], params["repo"], limit)
+	if err != nil {
+		log.WithError(err).Errorf("could not fetch the sync reports of repo %s", params["repo"])
+		response.NewErrorResponse(http.StatusInternalServerError, "could not fetch sync reports").Write(w)
+		return
+	}
+	if reports == nil {
+		reports = []*models.SyncReport{}
+	}
+	response.NewDataResponse(reports).Write(w)
+}
+
+// listRepos returns the synced repositories of a namespace
+func listRepos(w http.ResponseWriter, req *http.Request, params Params) {
+	repos, err := manager.getRepoSummaries(params["namespace"], "")
+	if err != nil {
+		log.WithError(err).Errorf("could not fetch the repos of namespace %s", params["namespace"])
+		response.NewErrorResponse(http.StatusInternalServerError, "could not fetch repos").Write(w)
+		return
+	}
+	response.NewDataResponse(repos).Write(w)
+}
+
+// getRepo returns the given synced repository
+func getRepo(w http.ResponseWriter, req *http.Request, params Params) {
+	repos, err := manager.getRepoSummaries(params["namespace"], params["repo"])
+	if err != nil {
+		log.WithError(err).Errorf("could not fetch repo %s", params["repo"])
+		response.NewErrorResponse(http.StatusInternalServerError, "could not fetch repo").Write(w)
+		return
+	}
+	if len(repos) == 0 {
+		response.NewErrorResponse(http.StatusNotFound, "could not find repo").Write(w)
+		return
+	}
+	response.NewDataResponse(repos[0]).Write(w)
+}
+
 // listChartsWithFilters returns the list of repos that contains the given chart and the latest version found
 func listChartsWithFilters(w http.ResponseWriter, req *http.Request, params Params) {
+	kubeVersion, err := requestKubeVersion(req)
+	if err != nil {
+		response.NewErrorResponse(http.StatusBadRequest, err.Error()).Write(w)
+		return
+	}
 	charts, err := manager.getChartsWithFilters(params["namespace"], params["chartName"], req.FormValue("version"), req.FormValue("appversion"))
 	if err != nil {
 		log.WithError(err).Errorf(
@@ -250,6 +668,9 @@ func listChartsWithFilters(w http.ResponseWriter, req *http.Request, params Para
 		)
 		// continue to return empty list
 	}
+	for _, c := range charts {
+		markIncompatibleVersions(c, kubeVersion)
+	}
 
 	chartResponse := charts
 	if !showDuplicates(req) {
@@ -278,8 +699,7 @@ func newChartResponse(c *models.Chart) *apiResponse {
 }
 
 // blankRawIconAndChartVersions returns the same chart data but with a blank raw icon field and no chartversions.
-// TODO(mnelson): The raw icon data should be stored in a separate postgresql column
-// rather than the json field so that this isn't necessary.
+// The raw icon is only loaded from MongoDB, PostgreSQL stores it in its own table.
 func blankRawIconAndChartVersions(c models.Chart) models.Chart {
 	c.RawIcon = nil
 	c.ChartVersions = []models.ChartVersion{}
@@ -302,7 +722,9 @@ func chartVersionAttributes(namespace, cid string, cv models.ChartVersion) model
 }
 
 func chartAttributes(namespace string, c models.Chart) models.Chart {
-	if c.RawIcon != nil {
+	// Charts stored in PostgreSQL don't include the icon data but its content
+	// type is set when the icon is processed
+	if c.RawIcon != nil || c.IconContentType != "" {
 		c.Icon = pathPrefix + "/ns/" + namespace + "/assets/" + c.ID + "/logo"
 	} else {
 		// If the icon wasn't processed, it is either not set or invalid
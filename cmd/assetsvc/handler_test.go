@@ -18,17 +18,22 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"image/color"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/disintegration/imaging"
 	"github.com/kubeapps/common/datastore"
 	"github.com/kubeapps/common/datastore/mockstore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
 	"github.com/kubeapps/kubeapps/pkg/dbutils"
 	"github.com/stretchr/testify/assert"
@@ -45,6 +50,7 @@ type bodyAPIResponse struct {
 }
 
 var chartsList []*models.Chart
+var repoChecks []mongoRepoCheck
 var cc count
 
 const (
@@ -283,6 +289,7 @@ func Test_listCharts(t *testing.T) {
 			m.On("All", &chartsList).Run(func(args mock.Arguments) {
 				*args.Get(0).(*[]*models.Chart) = tt.charts
 			})
+			m.On("One", &chartFacets{})
 			if tt.query != "" {
 				m.On("One", &cc).Run(func(args mock.Arguments) {
 					*args.Get(0).(*count) = count{len(tt.charts)}
@@ -346,6 +353,7 @@ func Test_listRepoCharts(t *testing.T) {
 			m.On("All", &chartsList).Run(func(args mock.Arguments) {
 				*args.Get(0).(*[]*models.Chart) = tt.charts
 			})
+			m.On("One", &chartFacets{})
 			if tt.query != "" {
 				m.On("One", &cc).Run(func(args mock.Arguments) {
 					*args.Get(0).(*count) = count{len(tt.charts)}
@@ -573,34 +581,56 @@ func Test_getChartVersion(t *testing.T) {
 }
 
 func Test_getChartIcon(t *testing.T) {
+	icon := iconBytes()
+	digest := sha256.Sum256(icon)
+	etag := fmt.Sprintf("%q", hex.EncodeToString(digest[:]))
 	tests := []struct {
-		name     string
-		err      error
-		chart    models.Chart
-		wantCode int
+		name        string
+		err         error
+		chart       models.Chart
+		ifNoneMatch string
+		wantCode    int
 	}{
 		{
 			"chart does not exist",
 			errors.New("return an error when checking if chart exists"),
 			models.Chart{ID: "my-repo/my-chart"},
+			"",
 			http.StatusNotFound,
 		},
 		{
 			"chart has icon",
 			nil,
-			models.Chart{ID: "my-repo/my-chart", RawIcon: iconBytes(), IconContentType: "image/png"},
+			models.Chart{ID: "my-repo/my-chart", RawIcon: icon, IconContentType: "image/png"},
+			"",
 			http.StatusOK,
 		},
 		{
 			"chart does not have a icon",
 			nil,
 			models.Chart{ID: "my-repo/my-chart"},
+			"",
 			http.StatusNotFound,
 		},
 		{
 			"chart has icon with custom type",
 			nil,
-			models.Chart{ID: "my-repo/my-chart", RawIcon: iconBytes(), IconContentType: "image/svg"},
+			models.Chart{ID: "my-repo/my-chart", RawIcon: icon, IconContentType: "image/svg"},
+			"",
+			http.StatusOK,
+		},
+		{
+			"icon has not been modified",
+			nil,
+			models.Chart{ID: "my-repo/my-chart", RawIcon: icon, IconContentType: "image/png"},
+			etag,
+			http.StatusNotModified,
+		},
+		{
+			"icon has been modified",
+			nil,
+			models.Chart{ID: "my-repo/my-chart", RawIcon: icon, IconContentType: "image/png"},
+			`"outdated"`,
 			http.StatusOK,
 		},
 	}
@@ -620,6 +650,9 @@ func Test_getChartIcon(t *testing.T) {
 
 			w := httptest.NewRecorder()
 			req := httptest.NewRequest("GET", "/assets/"+tt.chart.ID+"/logo", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
 			parts := strings.Split(tt.chart.ID, "/")
 			params := Params{
 				"repo":      parts[0],
@@ -634,6 +667,10 @@ func Test_getChartIcon(t *testing.T) {
 				assert.Equal(t, w.Body.Bytes(), tt.chart.RawIcon, "raw icon data should match")
 				assert.Equal(t, w.Header().Get("Content-Type"), tt.chart.IconContentType, "icon content type should match")
 			}
+			if tt.wantCode == http.StatusOK || tt.wantCode == http.StatusNotModified {
+				assert.Equal(t, etag, w.Header().Get("ETag"), "etag should match")
+				assert.Equal(t, "public, max-age=604800", w.Header().Get("Cache-Control"), "cache control should match")
+			}
 		})
 	}
 }
@@ -795,6 +832,13 @@ func Test_getChartVersionSchema(t *testing.T) {
 			models.ChartFiles{ID: "my-repo/my-chart"},
 			http.StatusOK,
 		},
+		{
+			"schema generated from the values",
+			"1.0.0",
+			nil,
+			models.ChartFiles{ID: "my-repo/my-chart", Schema: testChartSchema, SchemaGenerated: true},
+			http.StatusOK,
+		},
 	}
 
 	for _, tt := range tests {
@@ -825,6 +869,444 @@ func Test_getChartVersionSchema(t *testing.T) {
 			assert.Equal(t, tt.wantCode, w.Code, "http status code should match")
 			if tt.wantCode == http.StatusOK {
 				assert.Equal(t, string(w.Body.Bytes()), tt.files.Schema, "content of values.schema.json should match")
+				assert.Equal(t, tt.files.SchemaGenerated, w.Header().Get(schemaGeneratedHeader) == "true", "generated schema header should match")
+			}
+		})
+	}
+}
+
+func Test_getChartVersionParameters(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		files    models.ChartFiles
+		wantCode int
+		wantBody string
+	}{
+		{
+			"chart does not exist",
+			errors.New("return an error when checking if chart exists"),
+			models.ChartFiles{ID: "my-repo/my-chart"},
+			http.StatusNotFound,
+			"",
+		},
+		{
+			"chart exists",
+			nil,
+			models.ChartFiles{ID: "my-repo/my-chart", Parameters: []models.ChartParameter{
+				{Path: "image.tag", Type: "string", Default: "1.0.0", Description: "The image tag"},
+			}},
+			http.StatusOK,
+			`[{"path":"image.tag","type":"string","default":"1.0.0","description":"The image tag"}]`,
+		},
+		{
+			"chart does not have parameters",
+			nil,
+			models.ChartFiles{ID: "my-repo/my-chart"},
+			http.StatusOK,
+			"[]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m mock.Mock
+			manager = getMockManager(&m)
+
+			if tt.err != nil {
+				m.On("One", mock.Anything).Return(tt.err)
+			} else {
+				m.On("One", &models.ChartFiles{}).Return(nil).Run(func(args mock.Arguments) {
+					*args.Get(0).(*models.ChartFiles) = tt.files
+				})
+			}
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/assets/"+tt.files.ID+"/versions/0.1.0/parameters.json", nil)
+			params := Params{
+				"repo":      "my-repo",
+				"chartName": "my-chart",
+				"version":   "0.1.0",
+			}
+
+			getChartVersionParameters(w, req, params)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, tt.wantCode, w.Code, "http status code should match")
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+				assert.Equal(t, tt.wantBody, strings.TrimSpace(w.Body.String()), "content of parameters.json should match")
+			}
+		})
+	}
+}
+
+func Test_getChartVersionTarball(t *testing.T) {
+	tarball := []byte("chart tarball")
+	tarballDigest := sha256.Sum256(tarball)
+	digest := hex.EncodeToString(tarballDigest[:])
+	missingDigest := sha256.Sum256([]byte("missing"))
+	store := blobstore.NewMemoryStore()
+	store.Put(digest, tarball)
+
+	tests := []struct {
+		name        string
+		err         error
+		files       models.ChartFiles
+		tarballs    blobstore.Store
+		ifNoneMatch string
+		wantCode    int
+	}{
+		{
+			"chart does not exist",
+			errors.New("return an error when checking if chart exists"),
+			models.ChartFiles{ID: "my-repo/my-chart"},
+			store,
+			"",
+			http.StatusNotFound,
+		},
+		{
+			"tarball is mirrored",
+			nil,
+			models.ChartFiles{ID: "my-repo/my-chart", Digest: digest},
+			store,
+			"",
+			http.StatusOK,
+		},
+		{
+			"tarball has not been modified",
+			nil,
+			models.ChartFiles{ID: "my-repo/my-chart", Digest: digest},
+			store,
+			fmt.Sprintf("%q", digest),
+			http.StatusNotModified,
+		},
+		{
+			"tarball is not mirrored",
+			nil,
+			models.ChartFiles{ID: "my-repo/my-chart", Digest: hex.EncodeToString(missingDigest[:])},
+			store,
+			"",
+			http.StatusNotFound,
+		},
+		{
+			"tarballs are not mirrored",
+			nil,
+			models.ChartFiles{ID: "my-repo/my-chart", Digest: digest},
+			nil,
+			"",
+			http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m mock.Mock
+			manager = getMockManager(&m)
+			tarballs = tt.tarballs
+			defer func() { tarballs = nil }()
+
+			if tt.err != nil {
+				m.On("One", mock.Anything).Return(tt.err)
+			} else {
+				m.On("One", &models.ChartFiles{}).Return(nil).Run(func(args mock.Arguments) {
+					*args.Get(0).(*models.ChartFiles) = tt.files
+				})
+			}
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/assets/"+tt.files.ID+"/versions/1.0.0/chart.tgz", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			parts := strings.Split(tt.files.ID, "/")
+			params := Params{
+				"repo":      parts[0],
+				"chartName": parts[1],
+				"version":   "1.0.0",
+			}
+
+			getChartVersionTarball(w, req, params)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, tt.wantCode, w.Code, "http status code should match")
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, tarball, w.Body.Bytes(), "content of the tarball should match")
+				assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+				assert.Equal(t, `attachment; filename="my-chart-1.0.0.tgz"`, w.Header().Get("Content-Disposition"))
+				assert.Equal(t, fmt.Sprintf("%q", digest), w.Header().Get("ETag"))
+			}
+			if tt.wantCode == http.StatusNotFound {
+				assert.Empty(t, w.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func Test_getChartVersionDependencies(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		files        models.ChartFiles
+		wantCode     int
+		expectedDeps []models.ChartDependency
+	}{
+		{
+			"chart does not exist",
+			errors.New("return an error when checking if chart exists"),
+			models.ChartFiles{ID: "my-repo/my-chart"},
+			http.StatusNotFound,
+			nil,
+		},
+		{
+			"chart has no dependencies",
+			nil,
+			models.ChartFiles{ID: "my-repo/my-chart"},
+			http.StatusOK,
+			[]models.ChartDependency{},
+		},
+		{
+			"chart has dependencies",
+			nil,
+			models.ChartFiles{ID: "my-repo/my-chart", Dependencies: []models.ChartDependency{{Name: "mariadb", Version: "7.x.x", Repository: "https://charts.example.com"}}},
+			http.StatusOK,
+			[]models.ChartDependency{{Name: "mariadb", Version: "7.x.x", Repository: "https://charts.example.com"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m mock.Mock
+			manager = getMockManager(&m)
+
+			if tt.err != nil {
+				m.On("One", mock.Anything).Return(tt.err)
+			} else {
+				m.On("One", &models.ChartFiles{}).Return(nil).Run(func(args mock.Arguments) {
+					*args.Get(0).(*models.ChartFiles) = tt.files
+				})
+			}
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/charts/"+tt.files.ID+"/versions/0.1.0/dependencies", nil)
+			parts := strings.Split(tt.files.ID, "/")
+			params := Params{
+				"namespace": namespace,
+				"repo":      parts[0],
+				"chartName": parts[1],
+				"version":   "0.1.0",
+			}
+
+			getChartVersionDependencies(w, req, params)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, tt.wantCode, w.Code, "http status code should match")
+			if tt.wantCode == http.StatusOK {
+				var b struct {
+					Data []models.ChartDependency `json:"data"`
+				}
+				json.NewDecoder(w.Body).Decode(&b)
+				assert.Equal(t, tt.expectedDeps, b.Data, "dependencies should match")
+			}
+		})
+	}
+}
+
+func Test_listChartDependents(t *testing.T) {
+	chart := models.Chart{Repo: &models.Repo{Name: "my-repo", Namespace: namespace, URL: "https://charts.example.com/"}, ID: "my-repo/mariadb", Name: "mariadb"}
+	fromRepo := models.ChartDependency{Name: "mariadb", Version: "7.x.x", Repository: "https://charts.example.com"}
+	fromAlias := models.ChartDependency{Name: "mariadb", Version: "7.x.x", Repository: "@stable"}
+	fromOtherRepo := models.ChartDependency{Name: "mariadb", Version: "7.x.x", Repository: "https://other.example.com"}
+	tests := []struct {
+		name               string
+		err                error
+		files              []*models.ChartFiles
+		wantCode           int
+		expectedDependents []models.ChartDependent
+	}{
+		{
+			"chart does not exist",
+			errors.New("return an error when checking if chart exists"),
+			nil,
+			http.StatusNotFound,
+			nil,
+		},
+		{
+			"chart has dependents",
+			nil,
+			[]*models.ChartFiles{
+				{ChartID: "my-repo/wordpress", Version: "1.0.0", Repo: testRepo, Dependencies: []models.ChartDependency{{Name: "memcached"}, fromRepo}},
+				{ChartID: "my-repo/joomla", Version: "2.0.0", Repo: testRepo, Dependencies: []models.ChartDependency{fromAlias}},
+				{ChartID: "my-repo/drupal", Version: "3.0.0", Repo: testRepo, Dependencies: []models.ChartDependency{fromOtherRepo}},
+			},
+			http.StatusOK,
+			[]models.ChartDependent{
+				{ChartID: "my-repo/wordpress", Version: "1.0.0", Repo: testRepo, Dependency: fromRepo},
+				{ChartID: "my-repo/joomla", Version: "2.0.0", Repo: testRepo, Dependency: fromAlias},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m mock.Mock
+			manager = getMockManager(&m)
+
+			if tt.err != nil {
+				m.On("One", mock.Anything).Return(tt.err)
+			} else {
+				m.On("One", &models.Chart{}).Return(nil).Run(func(args mock.Arguments) {
+					*args.Get(0).(*models.Chart) = chart
+				})
+				m.On("All", mock.Anything).Run(func(args mock.Arguments) {
+					*args.Get(0).(*[]*models.ChartFiles) = tt.files
+				})
+			}
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/charts/"+chart.ID+"/dependents", nil)
+			params := Params{
+				"namespace": namespace,
+				"repo":      "my-repo",
+				"chartName": "mariadb",
+			}
+
+			listChartDependents(w, req, params)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, tt.wantCode, w.Code, "http status code should match")
+			if tt.wantCode == http.StatusOK {
+				var b struct {
+					Data []models.ChartDependent `json:"data"`
+				}
+				json.NewDecoder(w.Body).Decode(&b)
+				assert.Equal(t, tt.expectedDependents, b.Data, "dependents should match")
+			}
+		})
+	}
+}
+
+func Test_getChartVersionImages(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		files          models.ChartFiles
+		wantCode       int
+		expectedImages []string
+	}{
+		{
+			"chart does not exist",
+			errors.New("return an error when checking if chart exists"),
+			models.ChartFiles{ID: "my-repo/my-chart"},
+			http.StatusNotFound,
+			nil,
+		},
+		{
+			"chart has no images",
+			nil,
+			models.ChartFiles{ID: "my-repo/my-chart"},
+			http.StatusOK,
+			[]string{},
+		},
+		{
+			"chart has images",
+			nil,
+			models.ChartFiles{ID: "my-repo/my-chart", Images: []string{"bitnami/minideb:buster", "bitnami/nginx:1.17.8"}},
+			http.StatusOK,
+			[]string{"bitnami/minideb:buster", "bitnami/nginx:1.17.8"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m mock.Mock
+			manager = getMockManager(&m)
+
+			if tt.err != nil {
+				m.On("One", mock.Anything).Return(tt.err)
+			} else {
+				m.On("One", &models.ChartFiles{}).Return(nil).Run(func(args mock.Arguments) {
+					*args.Get(0).(*models.ChartFiles) = tt.files
+				})
+			}
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/charts/"+tt.files.ID+"/versions/0.1.0/images", nil)
+			parts := strings.Split(tt.files.ID, "/")
+			params := Params{
+				"namespace": namespace,
+				"repo":      parts[0],
+				"chartName": parts[1],
+				"version":   "0.1.0",
+			}
+
+			getChartVersionImages(w, req, params)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, tt.wantCode, w.Code, "http status code should match")
+			if tt.wantCode == http.StatusOK {
+				var b struct {
+					Data []string `json:"data"`
+				}
+				json.NewDecoder(w.Body).Decode(&b)
+				assert.Equal(t, tt.expectedImages, b.Data, "images should match")
+			}
+		})
+	}
+}
+
+func Test_listChartImages(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		files          []*models.ChartFiles
+		wantCode       int
+		expectedImages []models.ChartImage
+	}{
+		{
+			"missing image",
+			"",
+			nil,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"charts using the image",
+			"?image=bitnami/nginx",
+			[]*models.ChartFiles{
+				{ChartID: "my-repo/wordpress", Version: "1.0.0", Repo: testRepo, Images: []string{"bitnami/wordpress:5.3.2", "bitnami/nginx:1.17.8"}},
+				{ChartID: "my-repo/nginx", Version: "2.0.0", Repo: testRepo, Images: []string{"docker.io/bitnami/nginx:1.16.1"}},
+			},
+			http.StatusOK,
+			[]models.ChartImage{
+				{ChartID: "my-repo/wordpress", Version: "1.0.0", Repo: testRepo, Image: "bitnami/nginx:1.17.8"},
+				{ChartID: "my-repo/nginx", Version: "2.0.0", Repo: testRepo, Image: "docker.io/bitnami/nginx:1.16.1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m mock.Mock
+			manager = getMockManager(&m)
+			if tt.files != nil {
+				m.On("All", mock.Anything).Run(func(args mock.Arguments) {
+					*args.Get(0).(*[]*models.ChartFiles) = tt.files
+				})
+			}
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/images"+tt.query, nil)
+			listChartImages(w, req, Params{"namespace": namespace})
+
+			m.AssertExpectations(t)
+			assert.Equal(t, tt.wantCode, w.Code, "http status code should match")
+			if tt.wantCode == http.StatusOK {
+				var b struct {
+					Data []models.ChartImage `json:"data"`
+				}
+				json.NewDecoder(w.Body).Decode(&b)
+				assert.Equal(t, tt.expectedImages, b.Data, "images should match")
 			}
 		})
 	}
@@ -942,3 +1424,304 @@ func Test_findLatestChart(t *testing.T) {
 		assert.Equal(t, len(data), 2, "it should return both charts")
 	})
 }
+
+func Test_listSyncReports(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		reports         []*models.SyncReport
+		wantCode        int
+		queried         bool
+		expectedReports []*models.SyncReport
+	}{
+		{
+			"default limit",
+			"",
+			[]*models.SyncReport{{Repo: testRepo, Checksum: "123", Failures: []models.SyncFailure{{ChartID: "my-repo/foo", Version: "1.0.0", Asset: "readme", Error: "README.md not found"}}}},
+			http.StatusOK,
+			true,
+			[]*models.SyncReport{{Repo: testRepo, Checksum: "123", Failures: []models.SyncFailure{{ChartID: "my-repo/foo", Version: "1.0.0", Asset: "readme", Error: "README.md not found"}}}},
+		},
+		{
+			"given limit without reports",
+			"?limit=1",
+			nil,
+			http.StatusOK,
+			true,
+			[]*models.SyncReport{},
+		},
+		{
+			"invalid limit",
+			"?limit=-1",
+			nil,
+			http.StatusBadRequest,
+			false,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m mock.Mock
+			manager = getMockManager(&m)
+			if tt.queried {
+				m.On("All", mock.Anything).Run(func(args mock.Arguments) {
+					*args.Get(0).(*[]*models.SyncReport) = tt.reports
+				})
+			}
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/repos/my-repo/syncs"+tt.query, nil)
+			listSyncReports(w, req, Params{"namespace": namespace, "repo": "my-repo"})
+
+			m.AssertExpectations(t)
+			assert.Equal(t, tt.wantCode, w.Code, "http status code should match")
+			if tt.wantCode == http.StatusOK {
+				var b struct {
+					Data []*models.SyncReport `json:"data"`
+				}
+				json.NewDecoder(w.Body).Decode(&b)
+				assert.Equal(t, tt.expectedReports, b.Data, "sync reports should match")
+			}
+		})
+	}
+}
+
+func Test_searchCharts(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		charts   []*models.Chart
+		wantCode int
+		meta     meta
+	}{
+		{"missing query", "", nil, http.StatusBadRequest, meta{}},
+		{"blank query", "?q=%20", nil, http.StatusBadRequest, meta{}},
+		{"unsupported type", "?q=wordpress&type=plugin", nil, http.StatusBadRequest, meta{}},
+		{"no matches", "?q=wordpress", []*models.Chart{}, http.StatusOK, meta{1}},
+		{"matching charts", "?q=wordpress&repo=my-repo", []*models.Chart{
+			{Repo: testRepo, ID: "my-repo/wordpress", ChartVersions: []models.ChartVersion{{Version: "1.2.3", Digest: "123"}}},
+			{Repo: testRepo, ID: "my-repo/wordpress-fork", ChartVersions: []models.ChartVersion{{Version: "0.0.1", Digest: "1234"}}},
+		}, http.StatusOK, meta{1}},
+		{"matching charts with pagination", "?q=wordpress&size=1", []*models.Chart{
+			{Repo: testRepo, ID: "my-repo/wordpress", ChartVersions: []models.ChartVersion{{Version: "1.2.3", Digest: "123"}}},
+			{Repo: testRepo, ID: "my-repo/wordpress-fork", ChartVersions: []models.ChartVersion{{Version: "0.0.1", Digest: "1234"}}},
+		}, http.StatusOK, meta{2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m mock.Mock
+			manager = getMockManager(&m)
+			if tt.wantCode == http.StatusOK {
+				m.On("All", &chartsList).Run(func(args mock.Arguments) {
+					*args.Get(0).(*[]*models.Chart) = tt.charts
+				})
+				if strings.Contains(tt.query, "size=") {
+					m.On("One", &cc).Run(func(args mock.Arguments) {
+						*args.Get(0).(*count) = count{len(tt.charts)}
+					})
+				}
+			}
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/search/charts"+tt.query, nil)
+			searchCharts(w, req, Params{"namespace": namespace})
+
+			m.AssertExpectations(t)
+			assert.Equal(t, tt.wantCode, w.Code, "http status code should match")
+			if tt.wantCode == http.StatusOK {
+				var b bodyAPIListResponse
+				json.NewDecoder(w.Body).Decode(&b)
+				if b.Data == nil {
+					t.Fatal("chart list shouldn't be null")
+				}
+				data := *b.Data
+				assert.Len(t, data, len(tt.charts))
+				for i, resp := range data {
+					assert.Equal(t, resp.ID, tt.charts[i].ID, "chart id in the response should be the same")
+				}
+				assert.Equal(t, b.Meta, tt.meta, "response meta should be the same")
+			}
+		})
+	}
+}
+
+func Test_getChartSort(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		expectedSort chartSort
+		expectedErr  bool
+	}{
+		{"default sort", "", chartSort{field: sortByName}, false},
+		{"sort by name descending", "?sort=-name", chartSort{field: sortByName, descending: true}, false},
+		{"sort by latest update", "?sort=-updated", chartSort{field: sortByUpdated, descending: true}, false},
+		{"sort by creation", "?sort=created", chartSort{field: sortByCreated}, false},
+		{"unsupported field", "?sort=stars", chartSort{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/charts"+tt.query, nil)
+			sort, err := getChartSort(req)
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSort, sort, "sort should match")
+		})
+	}
+}
+
+func Test_listChartsInvalidSort(t *testing.T) {
+	var m mock.Mock
+	manager = getMockManager(&m)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/charts?sort=stars", nil)
+	listCharts(w, req, Params{"namespace": namespace})
+
+	m.AssertExpectations(t)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "http status code should match")
+}
+
+func Test_getChartFilters(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		params          Params
+		expectedFilters chartFilters
+		expectedErr     string
+	}{
+		{"no filters", "", Params{}, chartFilters{chartType: chartTypeApplication}, ""},
+		{
+			"every filter",
+			"?repo=stable&repo=bitnami&keyword=cms&maintainer=bitnami-bot&category=CMS&appVersion=4.9&annotation=category=CMS&annotation=licenses=Apache-2.0",
+			Params{},
+			chartFilters{repos: []string{"stable", "bitnami"}, keyword: "cms", maintainer: "bitnami-bot", category: "CMS", appVersion: "4.9", chartType: chartTypeApplication, annotations: map[string]string{"category": "CMS", "licenses": "Apache-2.0"}},
+			"",
+		},
+		{"repo of the path", "?repo=bitnami", Params{"repo": "stable"}, chartFilters{repos: []string{"stable"}, chartType: chartTypeApplication}, ""},
+		{"library charts", "?type=library", Params{}, chartFilters{chartType: "library"}, ""},
+		{"every type", "?type=all", Params{}, chartFilters{}, ""},
+		{"unsupported type", "?type=plugin", Params{}, chartFilters{}, `unsupported chart type "plugin", choose one of application, library or all`},
+		{"annotation without value", "?annotation=category", Params{}, chartFilters{}, `invalid annotation "category", expected key=value`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/charts"+tt.query, nil)
+			filters, err := getChartFilters(req, tt.params, chartTypeApplication)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedFilters, filters, "filters should match")
+		})
+	}
+}
+
+func Test_listChartsFacets(t *testing.T) {
+	var m mock.Mock
+	manager = getMockManager(&m)
+	m.On("All", &chartsList)
+	facets := chartFacets{
+		Keywords: []facetCount{{Value: "cms", Count: 2}, {Value: "blog", Count: 1}},
+		Repos:    []facetCount{{Value: "stable", Count: 2}},
+	}
+	m.On("One", &chartFacets{}).Run(func(args mock.Arguments) {
+		*args.Get(0).(*chartFacets) = facets
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/charts?keyword=cms", nil)
+	listCharts(w, req, Params{"namespace": namespace})
+
+	m.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, w.Code, "http status code should match")
+	var b struct {
+		Meta chartListMeta `json:"meta"`
+	}
+	json.NewDecoder(w.Body).Decode(&b)
+	expectedFacets := chartFacets{
+		Keywords:    facets.Keywords,
+		Maintainers: []facetCount{},
+		Categories:  []facetCount{},
+		Repos:       facets.Repos,
+	}
+	assert.Equal(t, chartListMeta{TotalPages: 1, Facets: expectedFacets}, b.Meta, "response meta should include the facets")
+}
+
+func Test_listRepos(t *testing.T) {
+	lastUpdate := time.Date(2020, 6, 1, 10, 30, 0, 0, time.UTC)
+	var m mock.Mock
+	manager = getMockManager(&m)
+	m.On("All", &repoChecks).Run(func(args mock.Arguments) {
+		*args.Get(0).(*[]mongoRepoCheck) = []mongoRepoCheck{
+			{Namespace: namespace, Name: "bitnami", Checksum: "abc", LastUpdate: lastUpdate},
+			{Namespace: namespace, Name: "empty", Checksum: "def", LastUpdate: lastUpdate},
+		}
+	})
+	var repoCharts []mongoRepoCharts
+	m.On("All", &repoCharts).Once().Run(func(args mock.Arguments) {
+		*args.Get(0).(*[]mongoRepoCharts) = []mongoRepoCharts{{Name: "bitnami", URL: "https://charts.bitnami.com/bitnami", Charts: 2, Versions: 5}}
+	})
+	// The URL of the repo without charts is taken from its sync reports
+	m.On("All", &repoCharts).Once().Run(func(args mock.Arguments) {
+		*args.Get(0).(*[]mongoRepoCharts) = []mongoRepoCharts{{Name: "empty", URL: "https://example.com/empty"}}
+	})
+
+	w := httptest.NewRecorder()
+	listRepos(w, httptest.NewRequest("GET", "/ns/"+namespace+"/repos", nil), Params{"namespace": namespace})
+
+	m.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, w.Code, "http status code should match")
+	var b struct {
+		Data []*repoSummary `json:"data"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&b))
+	assert.Equal(t, []*repoSummary{
+		{Namespace: namespace, Name: "bitnami", URL: "https://charts.bitnami.com/bitnami", LastUpdate: lastUpdate, Checksum: "abc", ChartCount: 2, VersionCount: 5},
+		{Namespace: namespace, Name: "empty", URL: "https://example.com/empty", LastUpdate: lastUpdate, Checksum: "def"},
+	}, b.Data)
+}
+
+func Test_getRepo(t *testing.T) {
+	tests := []struct {
+		name     string
+		checks   []mongoRepoCheck
+		wantCode int
+	}{
+		{"repo exists", []mongoRepoCheck{{Namespace: namespace, Name: "my-repo", Checksum: "abc"}}, http.StatusOK},
+		{"repo does not exist", nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m mock.Mock
+			manager = getMockManager(&m)
+			m.On("All", &repoChecks).Run(func(args mock.Arguments) {
+				*args.Get(0).(*[]mongoRepoCheck) = tt.checks
+			})
+			var repoCharts []mongoRepoCharts
+			m.On("All", &repoCharts).Run(func(args mock.Arguments) {
+				*args.Get(0).(*[]mongoRepoCharts) = []mongoRepoCharts{{Name: "my-repo", URL: "https://example.com/my-repo", Charts: 1, Versions: 1}}
+			})
+
+			w := httptest.NewRecorder()
+			getRepo(w, httptest.NewRequest("GET", "/ns/"+namespace+"/repos/my-repo", nil), Params{"namespace": namespace, "repo": "my-repo"})
+
+			m.AssertExpectations(t)
+			assert.Equal(t, tt.wantCode, w.Code, "http status code should match")
+			if tt.wantCode == http.StatusOK {
+				var b struct {
+					Data repoSummary `json:"data"`
+				}
+				assert.NoError(t, json.NewDecoder(w.Body).Decode(&b))
+				assert.Equal(t, repoSummary{Namespace: namespace, Name: "my-repo", URL: "https://example.com/my-repo", Checksum: "abc", ChartCount: 1, VersionCount: 1}, b.Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/kubeapps/common/response"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	helmrepo "k8s.io/helm/pkg/repo"
+)
+
+// getChartIndex returns a Helm repository index of the charts of a namespace,
+// or of a repo if given, so the catalog can be added as a repository to the
+// helm CLI. The index accepts the filters of the chart list.
+func getChartIndex(w http.ResponseWriter, req *http.Request, params Params) {
+	// Library charts are indexed by default since they are dependencies of
+	// other charts
+	filters, err := getChartFilters(req, params, "")
+	if err != nil {
+		response.NewErrorResponse(http.StatusBadRequest, err.Error()).Write(w)
+		return
+	}
+	charts, _, err := manager.getPaginatedChartList(params["namespace"], filters, 1, 0, showDuplicates(req), chartSort{field: sortByName})
+	if err != nil {
+		log.WithError(err).Error("could not fetch charts")
+		response.NewErrorResponse(http.StatusInternalServerError, "could not fetch all charts").Write(w)
+		return
+	}
+
+	// The mirrored tarballs are served by the assets routes of the namespace,
+	// the URLs are relative to the URL of the index
+	assetsPath := "assets"
+	if params["repo"] != "" {
+		assetsPath = "../../assets"
+	}
+	index, err := newChartIndex(charts, assetsPath)
+	if err != nil {
+		log.WithError(err).Error("could not generate the chart index")
+		response.NewErrorResponse(http.StatusInternalServerError, "could not generate the chart index").Write(w)
+		return
+	}
+	body, err := yaml.Marshal(index)
+	if err != nil {
+		log.WithError(err).Error("could not encode the chart index")
+		response.NewErrorResponse(http.StatusInternalServerError, "could not generate the chart index").Write(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-yaml")
+	w.Write(body)
+}
+
+// newChartIndex returns the Helm repository index of a list of charts. Charts
+// are indexed by name so only the first chart version with a given name and
+// version is included when several repositories have it.
+func newChartIndex(charts []*models.Chart, assetsPath string) (*helmrepo.IndexFile, error) {
+	index := helmrepo.NewIndexFile()
+	mirrored := map[string]bool{}
+	indexed := map[string]bool{}
+	for _, c := range charts {
+		for _, cv := range c.ChartVersions {
+			key := c.Name + "/" + cv.Version
+			if indexed[key] {
+				log.Debugf("skipping %s version %s already indexed from another repository", c.ID, cv.Version)
+				continue
+			}
+			chartURL, err := indexChartURL(c, cv, assetsPath, mirrored)
+			if err != nil {
+				return nil, err
+			}
+			if chartURL == "" {
+				log.Debugf("skipping %s version %s without a download URL", c.ID, cv.Version)
+				continue
+			}
+			indexed[key] = true
+			index.Entries[c.Name] = append(index.Entries[c.Name], newIndexChartVersion(c, cv, chartURL))
+		}
+	}
+	index.SortEntries()
+	return index, nil
+}
+
+// indexChartURL returns the URL of the mirrored tarball of a chart version if
+// available, or its URL in the chart repository
+func indexChartURL(c *models.Chart, cv models.ChartVersion, assetsPath string, mirrored map[string]bool) (string, error) {
+	if tarballs != nil && cv.Digest != "" {
+		exists, ok := mirrored[cv.Digest]
+		if !ok {
+			var err error
+			exists, err = tarballs.Exists(cv.Digest)
+			if err != nil {
+				return "", err
+			}
+			mirrored[cv.Digest] = exists
+		}
+		if exists {
+			return fmt.Sprintf("%s/%s/versions/%s/chart.tgz", assetsPath, c.ID, url.PathEscape(cv.Version)), nil
+		}
+	}
+	if len(cv.URLs) == 0 {
+		return "", nil
+	}
+	return upstreamChartURL(c.Repo, cv.URLs[0]), nil
+}
+
+// upstreamChartURL resolves the URL of a chart relative to its repository, as
+// the helm CLI does
+func upstreamChartURL(r *models.Repo, chartURL string) string {
+	if r == nil || r.URL == "" {
+		return chartURL
+	}
+	base, err := url.Parse(r.URL)
+	if err != nil {
+		return chartURL
+	}
+	ref, err := url.Parse(chartURL)
+	if err != nil {
+		return chartURL
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	return base.ResolveReference(ref).String()
+}
+
+func newIndexChartVersion(c *models.Chart, cv models.ChartVersion, chartURL string) *helmrepo.ChartVersion {
+	maintainers := []*chart.Maintainer{}
+	for i := range c.Maintainers {
+		maintainers = append(maintainers, &c.Maintainers[i])
+	}
+	return &helmrepo.ChartVersion{
+		Metadata: &chart.Metadata{
+			Name:        c.Name,
+			Version:     cv.Version,
+			AppVersion:  cv.AppVersion,
+			Description: c.Description,
+			Home:        c.Home,
+			Icon:        c.Icon,
+			Keywords:    c.Keywords,
+			Maintainers: maintainers,
+			Sources:     c.Sources,
+		},
+		URLs:    []string{chartURL},
+		Created: cv.Created,
+		Digest:  cv.Digest,
+	}
+}
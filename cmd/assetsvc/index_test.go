@@ -0,0 +1,177 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	helmrepo "k8s.io/helm/pkg/repo"
+)
+
+func Test_upstreamChartURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		repoURL  string
+		chartURL string
+		want     string
+	}{
+		{"absolute URL", "https://charts.example.com", "https://cdn.example.com/wordpress-1.0.0.tgz", "https://cdn.example.com/wordpress-1.0.0.tgz"},
+		{"relative URL", "https://charts.example.com/stable", "wordpress-1.0.0.tgz", "https://charts.example.com/stable/wordpress-1.0.0.tgz"},
+		{"relative URL with trailing slash", "https://charts.example.com/stable/", "charts/wordpress-1.0.0.tgz", "https://charts.example.com/stable/charts/wordpress-1.0.0.tgz"},
+		{"no repo URL", "", "wordpress-1.0.0.tgz", "wordpress-1.0.0.tgz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, upstreamChartURL(&models.Repo{Name: "stable", URL: tt.repoURL}, tt.chartURL))
+		})
+	}
+}
+
+func Test_newChartIndex(t *testing.T) {
+	mirroredTarball := []byte("mirrored tarball")
+	digest := sha256.Sum256(mirroredTarball)
+	mirroredDigest := hex.EncodeToString(digest[:])
+	store := blobstore.NewMemoryStore()
+	store.Put(mirroredDigest, mirroredTarball)
+	tarballs = store
+	defer func() { tarballs = nil }()
+
+	charts := []*models.Chart{
+		{
+			ID:          "bitnami/wordpress",
+			Name:        "wordpress",
+			Repo:        &models.Repo{Name: "bitnami", URL: "https://charts.bitnami.com/bitnami"},
+			Description: "Web publishing platform",
+			Keywords:    []string{"blog"},
+			Maintainers: []chart.Maintainer{{Name: "Bitnami"}},
+			ChartVersions: []models.ChartVersion{
+				{Version: "2.0.0", AppVersion: "5.4", Digest: mirroredDigest, URLs: []string{"wordpress-2.0.0.tgz"}},
+				{Version: "1.0.0", AppVersion: "5.3", Digest: "123", URLs: []string{"wordpress-1.0.0.tgz"}},
+			},
+		},
+		{
+			ID:   "stable/wordpress",
+			Name: "wordpress",
+			Repo: &models.Repo{Name: "stable", URL: "https://kubernetes-charts.storage.googleapis.com"},
+			ChartVersions: []models.ChartVersion{
+				{Version: "1.0.0", Digest: "456", URLs: []string{"https://kubernetes-charts.storage.googleapis.com/wordpress-1.0.0.tgz"}},
+				{Version: "0.9.0", Digest: "789", URLs: []string{"https://kubernetes-charts.storage.googleapis.com/wordpress-0.9.0.tgz"}},
+				{Version: "0.8.0", Digest: "012"},
+			},
+		},
+	}
+
+	index, err := newChartIndex(charts, "assets")
+	assert.NoError(t, err)
+	versions := index.Entries["wordpress"]
+	assert.Len(t, versions, 3)
+
+	// The mirrored tarball is preferred
+	assert.Equal(t, "2.0.0", versions[0].Version)
+	assert.Equal(t, []string{"assets/bitnami/wordpress/versions/2.0.0/chart.tgz"}, versions[0].URLs)
+	assert.Equal(t, "5.4", versions[0].AppVersion)
+	assert.Equal(t, "Web publishing platform", versions[0].Description)
+	assert.Equal(t, []string{"blog"}, versions[0].Keywords)
+	assert.Equal(t, "Bitnami", versions[0].Maintainers[0].Name)
+	assert.Equal(t, mirroredDigest, versions[0].Digest)
+
+	// The first repository wins for versions in several repositories
+	assert.Equal(t, "1.0.0", versions[1].Version)
+	assert.Equal(t, []string{"https://charts.bitnami.com/bitnami/wordpress-1.0.0.tgz"}, versions[1].URLs)
+
+	// Versions without a URL are skipped
+	assert.Equal(t, "0.9.0", versions[2].Version)
+	assert.Equal(t, []string{"https://kubernetes-charts.storage.googleapis.com/wordpress-0.9.0.tgz"}, versions[2].URLs)
+}
+
+func Test_getChartIndex(t *testing.T) {
+	charts := []*models.Chart{
+		{
+			ID:            "my-repo/my-chart",
+			Name:          "my-chart",
+			Repo:          testRepo,
+			ChartVersions: []models.ChartVersion{{Version: "0.1.0", Digest: "123", URLs: []string{"https://example.com/my-chart-0.1.0.tgz"}}},
+		},
+	}
+	tests := []struct {
+		name   string
+		params Params
+	}{
+		{"namespace index", Params{"namespace": "kubeapps"}},
+		{"repo index", Params{"namespace": "kubeapps", "repo": "my-repo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m mock.Mock
+			manager = getMockManager(&m)
+			m.On("All", &chartsList).Run(func(args mock.Arguments) {
+				*args.Get(0).(*[]*models.Chart) = charts
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/ns/kubeapps/index.yaml", nil)
+			getChartIndex(w, req, tt.params)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code, "http status code should match")
+			assert.Equal(t, "application/x-yaml", w.Header().Get("Content-Type"))
+
+			var index helmrepo.IndexFile
+			assert.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &index))
+			assert.Equal(t, helmrepo.APIVersionV1, index.APIVersion)
+			assert.Len(t, index.Entries["my-chart"], 1)
+			assert.Equal(t, "0.1.0", index.Entries["my-chart"][0].Version)
+			assert.Equal(t, []string{"https://example.com/my-chart-0.1.0.tgz"}, index.Entries["my-chart"][0].URLs)
+		})
+	}
+}
+
+func Test_getChartIndexMirroredRepo(t *testing.T) {
+	tarball := []byte("mirrored tarball")
+	digest := sha256.Sum256(tarball)
+	mirroredDigest := hex.EncodeToString(digest[:])
+	store := blobstore.NewMemoryStore()
+	store.Put(mirroredDigest, tarball)
+	tarballs = store
+	defer func() { tarballs = nil }()
+
+	var m mock.Mock
+	manager = getMockManager(&m)
+	m.On("All", &chartsList).Run(func(args mock.Arguments) {
+		*args.Get(0).(*[]*models.Chart) = []*models.Chart{
+			{ID: "my-repo/my-chart", Name: "my-chart", Repo: testRepo, ChartVersions: []models.ChartVersion{{Version: "0.1.0", Digest: mirroredDigest}}},
+		}
+	})
+
+	w := httptest.NewRecorder()
+	getChartIndex(w, httptest.NewRequest("GET", "/ns/kubeapps/repos/my-repo/index.yaml", nil), Params{"namespace": "kubeapps", "repo": "my-repo"})
+
+	var index helmrepo.IndexFile
+	assert.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &index))
+	// The URL is relative to the repo index URL
+	assert.Equal(t, []string{"../../assets/my-repo/my-chart/versions/0.1.0/chart.tgz"}, index.Entries["my-chart"][0].URLs)
+}
@@ -20,10 +20,13 @@ import (
 	"flag"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/heptiolabs/healthcheck"
 	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
+	"github.com/kubeapps/kubeapps/pkg/openapi"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/negroni"
 )
@@ -32,7 +35,24 @@ const pathPrefix = "/v1"
 
 var manager assetManager
 
+// tarballs stores the mirrored chart tarballs, it's nil if tarballs are not
+// mirrored
+var tarballs blobstore.Store
+
+// apiDocument is the OpenAPI document of the routes, it validates their
+// requests
+var apiDocument = openapi.Assetsvc()
+
 func setupRoutes() http.Handler {
+	n := negroni.Classic()
+	n.Use(negroni.HandlerFunc(compressResponse))
+	n.UseHandler(setupRouter())
+	return n
+}
+
+// setupRouter returns the router of the routes, which are documented by the
+// apiDocument
+func setupRouter() *mux.Router {
 	r := mux.NewRouter()
 
 	// Healthcheck
@@ -40,32 +60,53 @@ func setupRoutes() http.Handler {
 	r.Handle("/live", health)
 	r.Handle("/ready", health)
 
+	r.Methods("GET").Path(openapi.Path).Handler(apiDocument.Handler())
+
 	// Routes
+	// The responses of the routes with the catalog ETag only change when a
+	// repository is synced while the assets have their own ETag. Every route
+	// but the chart logos requires access to its namespace.
 	apiv1 := r.PathPrefix(pathPrefix).Subrouter()
+	apiv1.Use(apiDocument.Validate)
 	// TODO: mnelson: Seems we could use path per endpoint handling empty params? Check.
-	apiv1.Methods("GET").Path("/ns/{namespace}/charts").Queries("name", "{chartName}", "version", "{version}", "appversion", "{appversion}").Handler(WithParams(listChartsWithFilters))
-	apiv1.Methods("GET").Path("/ns/{namespace}/charts").Queries("name", "{chartName}", "version", "{version}", "appversion", "{appversion}", "showDuplicates", "{showDuplicates}").Handler(WithParams(listChartsWithFilters))
-	apiv1.Methods("GET").Path("/ns/{namespace}/charts").Handler(WithParams(listCharts))
-	apiv1.Methods("GET").Path("/ns/{namespace}/charts").Queries("showDuplicates", "{showDuplicates}").Handler(WithParams(listCharts))
-	apiv1.Methods("GET").Path("/ns/{namespace}/charts/{repo}").Handler(WithParams(listCharts))
-	apiv1.Methods("GET").Path("/ns/{namespace}/charts/{repo}/{chartName}").Handler(WithParams(getChart))
-	apiv1.Methods("GET").Path("/ns/{namespace}/charts/{repo}/{chartName}/versions").Handler(WithParams(listChartVersions))
-	apiv1.Methods("GET").Path("/ns/{namespace}/charts/{repo}/{chartName}/versions/{version}").Handler(WithParams(getChartVersion))
+	apiv1.Methods("GET").Path("/ns/{namespace}/charts").Queries("name", "{chartName}", "version", "{version}", "appversion", "{appversion}").Handler(withAuthz(withCatalogETag(WithParams(listChartsWithFilters))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/charts").Queries("name", "{chartName}", "version", "{version}", "appversion", "{appversion}", "showDuplicates", "{showDuplicates}").Handler(withAuthz(withCatalogETag(WithParams(listChartsWithFilters))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/charts").Handler(withAuthz(withCatalogETag(WithParams(listCharts))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/charts").Queries("showDuplicates", "{showDuplicates}").Handler(withAuthz(withCatalogETag(WithParams(listCharts))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/charts/{repo}").Handler(withAuthz(withCatalogETag(WithParams(listCharts))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/charts/{repo}/{chartName}").Handler(withAuthz(withCatalogETag(WithParams(getChart))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/charts/{repo}/{chartName}/dependents").Handler(withAuthz(withCatalogETag(WithParams(listChartDependents))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/charts/{repo}/{chartName}/diff").Handler(withAuthz(withCatalogETag(WithParams(getChartVersionDiff))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/charts/{repo}/{chartName}/versions").Handler(withAuthz(withCatalogETag(WithParams(listChartVersions))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/charts/{repo}/{chartName}/versions/latest").Handler(withAuthz(withCatalogETag(WithParams(getLatestChartVersion))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/charts/{repo}/{chartName}/versions/{version}").Handler(withAuthz(withCatalogETag(WithParams(getChartVersion))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/charts/{repo}/{chartName}/versions/{version}/dependencies").Handler(withAuthz(withCatalogETag(WithParams(getChartVersionDependencies))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/charts/{repo}/{chartName}/versions/{version}/images").Handler(withAuthz(withCatalogETag(WithParams(getChartVersionImages))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/search/charts").Handler(withAuthz(withCatalogETag(WithParams(searchCharts))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/images").Handler(withAuthz(withCatalogETag(WithParams(listChartImages))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/index.yaml").Handler(withAuthz(withCatalogETag(WithParams(getChartIndex))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/repos/{repo}/index.yaml").Handler(withAuthz(withCatalogETag(WithParams(getChartIndex))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/repos").Handler(withAuthz(withCatalogETag(WithParams(listRepos))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/repos/{repo}").Handler(withAuthz(withCatalogETag(WithParams(getRepo))))
+	apiv1.Methods("GET").Path("/ns/{namespace}/repos/{repo}/syncs").Handler(withAuthz(WithParams(listSyncReports)))
 	apiv1.Methods("GET").Path("/ns/{namespace}/assets/{repo}/{chartName}/logo").Handler(WithParams(getChartIcon))
-	apiv1.Methods("GET").Path("/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/README.md").Handler(WithParams(getChartVersionReadme))
-	apiv1.Methods("GET").Path("/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/values.yaml").Handler(WithParams(getChartVersionValues))
-	apiv1.Methods("GET").Path("/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/values.schema.json").Handler(WithParams(getChartVersionSchema))
-
-	n := negroni.Classic()
-	n.UseHandler(r)
-	return n
+	apiv1.Methods("GET").Path("/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/README.md").Handler(withAuthz(WithParams(getChartVersionReadme)))
+	apiv1.Methods("GET").Path("/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/values.yaml").Handler(withAuthz(WithParams(getChartVersionValues)))
+	apiv1.Methods("GET").Path("/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/values.schema.json").Handler(withAuthz(WithParams(getChartVersionSchema)))
+	apiv1.Methods("GET").Path("/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/parameters.json").Handler(withAuthz(WithParams(getChartVersionParameters)))
+	apiv1.Methods("GET").Path("/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/chart.tgz").Handler(withAuthz(WithParams(getChartVersionTarball)))
+	return r
 }
 
 func main() {
-	dbURL := flag.String("database-url", "localhost", "Database URL")
+	dbURL := flag.String("database-url", "localhost", "Database URL, a file:///path URL persists the memory database to a file")
 	dbName := flag.String("database-name", "charts", "Database database")
 	dbUsername := flag.String("database-user", "", "Database user")
-	dbType := flag.String("database-type", "mongodb", "Database type")
+	dbType := flag.String("database-type", "mongodb", "Database type: mongodb, postgresql or memory")
+	tarballStore := flag.String("tarball-store", blobstore.DatabaseStore, "Store of the chart tarballs mirrored by the asset-syncer: \"database\" or a file:///path URL")
+	authMode := flag.String("auth-mode", authModeNone, "Authorization of the requests: \"none\" when only reachable through kubeops, \"token\" to require a bearer token with access to the namespace or \"trusted-proxy\" to also serve the requests of the trusted proxies")
+	trustedProxies := flag.String("trusted-proxy-cidrs", "", "Comma separated CIDRs of the proxies authorizing the requests themselves, for the trusted-proxy auth mode")
+	authCacheTTL := flag.Duration("auth-cache-ttl", time.Minute, "Duration the namespace access of a token is cached")
 	dbPassword := os.Getenv("DB_PASSWORD")
 	flag.Parse()
 
@@ -84,6 +125,16 @@ func main() {
 	}
 	defer manager.Close()
 
+	tarballs, err = blobstore.Open(*tarballStore, manager.tarballStore())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	authorizer, err = newAuthorizer(*authMode, kubeappsNamespace, *trustedProxies, *authCacheTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	n := setupRoutes()
 
 	port := os.Getenv("PORT")
@@ -21,9 +21,12 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/gorilla/mux"
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/kubeapps/kubeapps/pkg/openapi"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -56,6 +59,75 @@ func Test_GetReady(t *testing.T) {
 	assert.Equal(t, res.StatusCode, http.StatusOK, "http status code should match")
 }
 
+// tests the GET /openapi.json endpoint
+func Test_GetOpenAPIDocument(t *testing.T) {
+	ts := httptest.NewServer(setupRoutes())
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + openapi.Path)
+	assert.NoError(t, err, "should not return an error")
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode, "http status code should match")
+	var doc openapi.Document
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&doc))
+	assert.Equal(t, openapi.Version, doc.OpenAPI)
+}
+
+// tests that the API routes match the operations of the OpenAPI document
+func Test_RoutesAreDocumented(t *testing.T) {
+	routes := map[string]bool{}
+	err := setupRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(path, pathPrefix+"/") {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			routes[method+" "+path] = true
+			assert.NotNil(t, apiDocument.Operation(method, path), "the %s %s route should be documented", method, path)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	for _, r := range apiDocument.Routes() {
+		assert.True(t, routes[r.Method+" "+r.Path], "the %s %s operation should be routed", r.Method, r.Path)
+	}
+}
+
+// tests that invalid requests are rejected before reaching the handlers
+func Test_ValidateRequests(t *testing.T) {
+	var m mock.Mock
+	manager = getMockManager(&m)
+	ts := httptest.NewServer(setupRoutes())
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		message string
+	}{
+		{"invalid page", "/charts?page=first", `the query parameter "page" should be an integer`},
+		{"invalid sort", "/charts?sort=size", "invalid query parameter: sort should be one of [name -name updated -updated created -created]"},
+		{"missing search query", "/search/charts", `the query parameter "q" is required`},
+		{"invalid limit", "/repos/my-repo/syncs?limit=0", "invalid query parameter: limit should be at least 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := http.Get(ts.URL + pathPrefix + "/ns/kubeapps" + tt.path)
+			assert.NoError(t, err, "should not return an error")
+			defer res.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode, "http status code should match")
+			var body map[string]interface{}
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+			assert.Equal(t, tt.message, body["message"])
+		})
+	}
+	m.AssertExpectations(t)
+}
+
 // tests the GET /{apiVersion}/ns/{namespace}/charts endpoint
 func Test_GetCharts(t *testing.T) {
 	ts := httptest.NewServer(setupRoutes())
@@ -79,9 +151,11 @@ func Test_GetCharts(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			var m mock.Mock
 			manager = getMockManager(&m)
+			m.On("All", &repoChecks)
 			m.On("All", &chartsList).Run(func(args mock.Arguments) {
 				*args.Get(0).(*[]*models.Chart) = tt.charts
 			})
+			m.On("One", &chartFacets{})
 
 			res, err := http.Get(ts.URL + pathPrefix + "/ns/kubeapps/charts")
 			assert.NoError(t, err)
@@ -115,15 +189,20 @@ func Test_GetChartsInRepo(t *testing.T) {
 			{Repo: testRepo, ID: "my-repo/my-chart", ChartVersions: []models.ChartVersion{{Version: "0.0.1", Digest: "123"}}},
 			{Repo: testRepo, ID: "my-repo/dokuwiki", ChartVersions: []models.ChartVersion{{Version: "1.2.3", Digest: "1234"}, {Version: "1.2.2", Digest: "12345"}}},
 		}},
+		{"repo is called search", "search", []*models.Chart{
+			{Repo: &models.Repo{Name: "search", Namespace: "kubeapps"}, ID: "search/my-chart", ChartVersions: []models.ChartVersion{{Version: "0.0.1", Digest: "123"}}},
+		}},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var m mock.Mock
 			manager = getMockManager(&m)
+			m.On("All", &repoChecks)
 			m.On("All", &chartsList).Run(func(args mock.Arguments) {
 				*args.Get(0).(*[]*models.Chart) = tt.charts
 			})
+			m.On("One", &chartFacets{})
 
 			res, err := http.Get(ts.URL + pathPrefix + "/ns/kubeapps/charts/" + tt.repo)
 			assert.NoError(t, err)
@@ -139,6 +218,33 @@ func Test_GetChartsInRepo(t *testing.T) {
 	}
 }
 
+// tests the GET /{apiVersion}/ns/{namespace}/search/charts endpoint
+func Test_SearchCharts(t *testing.T) {
+	ts := httptest.NewServer(setupRoutes())
+	defer ts.Close()
+
+	charts := []*models.Chart{
+		{Repo: testRepo, ID: "my-repo/wordpress", ChartVersions: []models.ChartVersion{{Version: "1.2.3", Digest: "123"}}},
+	}
+	var m mock.Mock
+	manager = getMockManager(&m)
+	m.On("All", &repoChecks)
+	m.On("All", &chartsList).Run(func(args mock.Arguments) {
+		*args.Get(0).(*[]*models.Chart) = charts
+	})
+
+	res, err := http.Get(ts.URL + pathPrefix + "/ns/kubeapps/search/charts?q=wordpress")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	m.AssertExpectations(t)
+	assert.Equal(t, res.StatusCode, http.StatusOK, "http status code should match")
+
+	var b bodyAPIListResponse
+	json.NewDecoder(res.Body).Decode(&b)
+	assert.Len(t, *b.Data, len(charts))
+}
+
 // tests the GET /{apiVersion}/ns/charts/{repo}/{chartName} endpoint
 func Test_GetChartInRepo(t *testing.T) {
 	ts := httptest.NewServer(setupRoutes())
@@ -174,6 +280,7 @@ func Test_GetChartInRepo(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			var m mock.Mock
 			manager = getMockManager(&m)
+			m.On("All", &repoChecks)
 			if tt.err != nil {
 				m.On("One", mock.Anything).Return(tt.err)
 			} else {
@@ -227,6 +334,7 @@ func Test_ListChartVersions(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			var m mock.Mock
 			manager = getMockManager(&m)
+			m.On("All", &repoChecks)
 			if tt.err != nil {
 				m.On("One", mock.Anything).Return(tt.err)
 			} else {
@@ -245,6 +353,29 @@ func Test_ListChartVersions(t *testing.T) {
 	}
 }
 
+// tests the GET /{apiVersion}/ns/charts/{repo}/{chartName}/versions/latest endpoint
+func Test_GetLatestChartVersion(t *testing.T) {
+	ts := httptest.NewServer(setupRoutes())
+	defer ts.Close()
+
+	var m mock.Mock
+	manager = getMockManager(&m)
+	m.On("All", &repoChecks)
+	m.On("One", &models.Chart{}).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*models.Chart) = models.Chart{Repo: testRepo, ID: "my-repo/my-chart", ChartVersions: []models.ChartVersion{{Version: "0.1.0"}, {Version: "1.0.0"}}}
+	})
+
+	res, err := http.Get(ts.URL + pathPrefix + "/ns/kubeapps/charts/my-repo/my-chart/versions/latest?constraint=%3C1.0.0")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	m.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, res.StatusCode, "http status code should match")
+	var b bodyAPIResponse
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&b))
+	assert.Equal(t, "my-repo/my-chart-0.1.0", b.Data.ID)
+}
+
 // tests the GET /{apiVersion}/ns/charts/{repo}/{chartName}/versions/{:version} endpoint
 func Test_GetChartVersion(t *testing.T) {
 	ts := httptest.NewServer(setupRoutes())
@@ -280,6 +411,7 @@ func Test_GetChartVersion(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			var m mock.Mock
 			manager = getMockManager(&m)
+			m.On("All", &repoChecks)
 			if tt.err != nil {
 				m.On("One", mock.Anything).Return(tt.err)
 			} else {
@@ -521,3 +653,26 @@ func Test_GetChartSchema(t *testing.T) {
 		})
 	}
 }
+
+// tests the GET /{apiVersion}/ns/{namespace}/index.yaml endpoints
+func Test_GetChartIndex(t *testing.T) {
+	ts := httptest.NewServer(setupRoutes())
+	defer ts.Close()
+
+	for _, path := range []string{"/ns/kubeapps/index.yaml", "/ns/kubeapps/repos/my-repo/index.yaml"} {
+		t.Run(path, func(t *testing.T) {
+			var m mock.Mock
+			manager = getMockManager(&m)
+			m.On("All", &repoChecks)
+			m.On("All", &chartsList)
+
+			res, err := http.Get(ts.URL + pathPrefix + path)
+			assert.NoError(t, err)
+			defer res.Body.Close()
+
+			m.AssertExpectations(t)
+			assert.Equal(t, res.StatusCode, http.StatusOK, "http status code should match")
+			assert.Equal(t, "application/x-yaml", res.Header.Get("Content-Type"))
+		})
+	}
+}
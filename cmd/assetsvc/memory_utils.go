@@ -0,0 +1,590 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/kubeapps/kubeapps/pkg/dbutils"
+)
+
+type memoryAssetManager struct {
+	*dbutils.MemoryAssetManager
+}
+
+func newMemoryManager(config datastore.Config, kubeappsNamespace string) assetManager {
+	return &memoryAssetManager{dbutils.NewMemoryManager(config, kubeappsNamespace)}
+}
+
+// inNamespace returns true if the repositories of a namespace are visible from
+// the given one, the repositories of the kubeapps namespace are global
+func (m *memoryAssetManager) inNamespace(repoNamespace, namespace string) bool {
+	return namespace == dbutils.AllNamespaces || repoNamespace == namespace || repoNamespace == m.GetKubeappsNamespace()
+}
+
+// charts returns the charts of the repositories for which the given function
+// returns true, ordered by repository and ID
+func (m *memoryAssetManager) charts(include func(r *dbutils.MemoryRepo) bool) ([]*models.Chart, error) {
+	charts := []*models.Chart{}
+	err := m.View(func(c *dbutils.MemoryCatalog) error {
+		for _, r := range c.SortedRepos() {
+			if !include(r) {
+				continue
+			}
+			for _, info := range r.SortedCharts() {
+				chart, err := info.Chart()
+				if err != nil {
+					return err
+				}
+				charts = append(charts, &chart)
+			}
+		}
+		return nil
+	})
+	return charts, err
+}
+
+// chartFiles returns the files of the chart versions of the repositories for
+// which the given function returns true, ordered by repository and ID
+func (m *memoryAssetManager) chartFiles(include func(r *dbutils.MemoryRepo) bool) ([]*models.ChartFiles, error) {
+	result := []*models.ChartFiles{}
+	err := m.View(func(c *dbutils.MemoryCatalog) error {
+		for _, r := range c.SortedRepos() {
+			if !include(r) {
+				continue
+			}
+			for _, chart := range r.SortedCharts() {
+				files, err := chart.SortedChartFiles()
+				if err != nil {
+					return err
+				}
+				for i := range files {
+					result = append(result, &files[i])
+				}
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// matchesFilters returns true if the chart matches every filter
+func matchesFilters(chart *models.Chart, filters chartFilters) bool {
+	if len(filters.repos) > 0 && (chart.Repo == nil || !containsString(filters.repos, chart.Repo.Name)) {
+		return false
+	}
+	if filters.keyword != "" && !containsString(chart.Keywords, filters.keyword) {
+		return false
+	}
+	if filters.maintainer != "" {
+		found := false
+		for _, maintainer := range chart.Maintainers {
+			found = found || maintainer.Name == filters.maintainer
+		}
+		if !found {
+			return false
+		}
+	}
+	if filters.category != "" && chart.Category != filters.category {
+		return false
+	}
+	if filters.appVersion != "" && (len(chart.ChartVersions) == 0 || !strings.HasPrefix(chart.ChartVersions[0].AppVersion, filters.appVersion)) {
+		return false
+	}
+	var latest models.ChartVersion
+	if len(chart.ChartVersions) > 0 {
+		latest = chart.ChartVersions[0]
+	}
+	if !matchesChartType(latest, filters.chartType) {
+		return false
+	}
+	for k, v := range filters.annotations {
+		if value, ok := latest.Annotations[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesChartType returns true if a chart version is of the chart type,
+// every chart version matches an empty type
+func matchesChartType(cv models.ChartVersion, chartType string) bool {
+	switch chartType {
+	case chartTypeApplication:
+		return cv.Type != models.LibraryChartType
+	case models.LibraryChartType:
+		return cv.Type == models.LibraryChartType
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// filteredCharts returns the charts matching the filters. Unless duplicates are
+// shown, only the first chart by name of the charts with the same digest for
+// their latest version is returned.
+func (m *memoryAssetManager) filteredCharts(namespace string, filters chartFilters, showDuplicates bool) ([]*models.Chart, error) {
+	charts, err := m.charts(func(r *dbutils.MemoryRepo) bool { return m.inNamespace(r.Namespace, namespace) })
+	if err != nil {
+		return nil, err
+	}
+	result := []*models.Chart{}
+	for _, chart := range charts {
+		if matchesFilters(chart, filters) {
+			result = append(result, chart)
+		}
+	}
+	if showDuplicates {
+		return result, nil
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	digests := map[string]bool{}
+	unique := []*models.Chart{}
+	for _, chart := range result {
+		if len(chart.ChartVersions) > 0 {
+			if digests[chart.ChartVersions[0].Digest] {
+				continue
+			}
+			digests[chart.ChartVersions[0].Digest] = true
+		}
+		unique = append(unique, chart)
+	}
+	return unique, nil
+}
+
+// sortCharts sorts the charts by the given sort, charts without versions are
+// sorted last by date and charts with the same value are sorted by ID so
+// pages are stable
+func sortCharts(charts []*models.Chart, s chartSort) {
+	created := func(chart *models.Chart) (time.Time, bool) {
+		if len(chart.ChartVersions) == 0 {
+			return time.Time{}, false
+		}
+		if s.field == sortByCreated {
+			return chart.ChartVersions[len(chart.ChartVersions)-1].Created, true
+		}
+		return chart.ChartVersions[0].Created, true
+	}
+	// compare returns a negative number if a is sorted before b, 0 if they
+	// have the same value
+	compare := func(a, b *models.Chart) int {
+		direction := 1
+		if s.descending {
+			direction = -1
+		}
+		switch s.field {
+		case sortByUpdated, sortByCreated:
+			aTime, aOk := created(a)
+			bTime, bOk := created(b)
+			switch {
+			case !aOk || !bOk:
+				if aOk != bOk {
+					if aOk {
+						return -1
+					}
+					return 1
+				}
+			case aTime.Before(bTime):
+				return -direction
+			case bTime.Before(aTime):
+				return direction
+			}
+		default:
+			if c := strings.Compare(a.Name, b.Name); c != 0 {
+				return c * direction
+			}
+		}
+		if c := strings.Compare(a.ID, b.ID); c != 0 {
+			return c
+		}
+		if a.Repo != nil && b.Repo != nil {
+			return strings.Compare(a.Repo.Namespace, b.Repo.Namespace)
+		}
+		return 0
+	}
+	sort.SliceStable(charts, func(i, j int) bool { return compare(charts[i], charts[j]) < 0 })
+}
+
+// page returns the charts of a page and the number of pages, every chart is
+// returned if the page size is 0
+func page(charts []*models.Chart, pageNumber, pageSize int) ([]*models.Chart, int) {
+	if pageSize == 0 {
+		return charts, 1
+	}
+	totalPages, offset := paginate(len(charts), pageNumber, pageSize)
+	if offset >= len(charts) {
+		return []*models.Chart{}, totalPages
+	}
+	end := offset + pageSize
+	if end > len(charts) {
+		end = len(charts)
+	}
+	return charts[offset:end], totalPages
+}
+
+func (m *memoryAssetManager) getPaginatedChartList(namespace string, filters chartFilters, pageNumber, pageSize int, showDuplicates bool, sort chartSort) ([]*models.Chart, int, error) {
+	charts, err := m.filteredCharts(namespace, filters, showDuplicates)
+	if err != nil {
+		return nil, 0, err
+	}
+	sortCharts(charts, sort)
+	charts, totalPages := page(charts, pageNumber, pageSize)
+	return charts, totalPages, nil
+}
+
+// countFacet returns the number of charts of every value, ordered from the
+// most common value
+func countFacet(counts map[string]int) []facetCount {
+	var result []facetCount
+	for value, count := range counts {
+		result = append(result, facetCount{Value: value, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+	return result
+}
+
+func (m *memoryAssetManager) getChartFacets(namespace string, filters chartFilters, showDuplicates bool) (chartFacets, error) {
+	charts, err := m.filteredCharts(namespace, filters, showDuplicates)
+	if err != nil {
+		return chartFacets{}, err
+	}
+	keywords, maintainers, categories, repos := map[string]int{}, map[string]int{}, map[string]int{}, map[string]int{}
+	for _, chart := range charts {
+		for _, keyword := range chart.Keywords {
+			if keyword != "" {
+				keywords[keyword]++
+			}
+		}
+		for _, maintainer := range chart.Maintainers {
+			if maintainer.Name != "" {
+				maintainers[maintainer.Name]++
+			}
+		}
+		if chart.Category != "" {
+			categories[chart.Category]++
+		}
+		if chart.Repo != nil && chart.Repo.Name != "" {
+			repos[chart.Repo.Name]++
+		}
+	}
+	return chartFacets{
+		Keywords:    countFacet(keywords),
+		Maintainers: countFacet(maintainers),
+		Categories:  countFacet(categories),
+		Repos:       countFacet(repos),
+	}, nil
+}
+
+// searchWords splits a text in lowercase words
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// searchScore returns the relevance of a chart for the words of a query, 0 if
+// any word is not found. Fields are weighted like the PostgreSQL search and a
+// query word matches the words of a field starting with it.
+func searchScore(chart *models.Chart, query []string) int {
+	maintainers := []string{}
+	for _, maintainer := range chart.Maintainers {
+		maintainers = append(maintainers, maintainer.Name)
+	}
+	fields := []struct {
+		words  []string
+		weight int
+	}{
+		{searchWords(chart.Name), 8},
+		{searchWords(strings.Join(chart.Keywords, " ")), 4},
+		{searchWords(chart.Description), 2},
+		{searchWords(strings.Join(maintainers, " ")), 1},
+		{searchWords(strings.Join(chart.Sources, " ")), 1},
+	}
+	score := 0
+	for _, q := range query {
+		found := false
+		for _, field := range fields {
+			for _, word := range field.words {
+				if strings.HasPrefix(word, q) {
+					score += field.weight
+					found = true
+				}
+			}
+		}
+		if !found {
+			return 0
+		}
+	}
+	return score
+}
+
+func (m *memoryAssetManager) searchCharts(namespace, query, repo, chartType string, pageNumber, pageSize int) ([]*models.Chart, int, error) {
+	words := searchWords(query)
+	charts, err := m.charts(func(r *dbutils.MemoryRepo) bool {
+		return m.inNamespace(r.Namespace, namespace) && (repo == "" || r.Name == repo)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	scores := map[*models.Chart]int{}
+	result := []*models.Chart{}
+	for _, chart := range charts {
+		var latest models.ChartVersion
+		if len(chart.ChartVersions) > 0 {
+			latest = chart.ChartVersions[0]
+		}
+		if !matchesChartType(latest, chartType) {
+			continue
+		}
+		if score := searchScore(chart, words); score > 0 {
+			scores[chart] = score
+			result = append(result, chart)
+		}
+	}
+	// Order by relevance, then by name
+	sort.SliceStable(result, func(i, j int) bool {
+		if scores[result[i]] != scores[result[j]] {
+			return scores[result[i]] > scores[result[j]]
+		}
+		return result[i].Name < result[j].Name
+	})
+	result, totalPages := page(result, pageNumber, pageSize)
+	return result, totalPages, nil
+}
+
+// chart returns a chart of a namespace
+func (m *memoryAssetManager) chart(namespace, chartID string) (models.Chart, *models.ChartIcon, error) {
+	var chart models.Chart
+	var icon *models.ChartIcon
+	err := m.View(func(c *dbutils.MemoryCatalog) error {
+		for _, r := range c.SortedRepos() {
+			if info, ok := r.Charts[chartID]; ok && r.Namespace == namespace {
+				var err error
+				chart, err = info.Chart()
+				icon = info.Icon
+				return err
+			}
+		}
+		return fmt.Errorf("chart %q: %w", chartID, dbutils.ErrNotFound)
+	})
+	return chart, icon, err
+}
+
+func (m *memoryAssetManager) getChart(namespace, chartID string) (models.Chart, error) {
+	chart, _, err := m.chart(namespace, chartID)
+	return chart, err
+}
+
+// getChartVersions returns a chart with all its versions, or without its
+// prerelease versions, keeping the order of the index
+func (m *memoryAssetManager) getChartVersions(namespace, chartID string, prereleases bool) (models.Chart, error) {
+	chart, err := m.getChart(namespace, chartID)
+	if err != nil || prereleases {
+		return chart, err
+	}
+	versions := []models.ChartVersion{}
+	for _, cv := range chart.ChartVersions {
+		if !strings.Contains(strings.SplitN(cv.Version, "+", 2)[0], "-") {
+			versions = append(versions, cv)
+		}
+	}
+	chart.ChartVersions = versions
+	return chart, nil
+}
+
+func (m *memoryAssetManager) getChartIcon(namespace, chartID string) (models.ChartIcon, error) {
+	_, icon, err := m.chart(namespace, chartID)
+	if err != nil || icon == nil {
+		return models.ChartIcon{}, err
+	}
+	return *icon, nil
+}
+
+func (m *memoryAssetManager) getChartVersion(namespace, chartID, version string) (models.Chart, error) {
+	chart, err := m.getChart(namespace, chartID)
+	if err != nil {
+		return models.Chart{}, err
+	}
+	for _, cv := range chart.ChartVersions {
+		if cv.Version == version {
+			chart.ChartVersions = []models.ChartVersion{cv}
+			return chart, nil
+		}
+	}
+	return models.Chart{}, ErrChartVersionNotFound
+}
+
+func (m *memoryAssetManager) getChartFiles(namespace, filesID string) (models.ChartFiles, error) {
+	var files models.ChartFiles
+	err := m.View(func(c *dbutils.MemoryCatalog) error {
+		for _, r := range c.SortedRepos() {
+			if r.Namespace != namespace {
+				continue
+			}
+			for _, chart := range r.Charts {
+				if _, ok := chart.Files[filesID]; ok {
+					var err error
+					files, err = chart.ChartFiles(filesID)
+					return err
+				}
+			}
+		}
+		return fmt.Errorf("chart files %q: %w", filesID, dbutils.ErrNotFound)
+	})
+	return files, err
+}
+
+func (m *memoryAssetManager) getChartsWithFilters(namespace, name, version, appVersion string) ([]*models.Chart, error) {
+	charts, err := m.charts(func(r *dbutils.MemoryRepo) bool { return r.Namespace == namespace })
+	if err != nil {
+		return nil, err
+	}
+	result := []*models.Chart{}
+	for _, c := range charts {
+		if _, found := containsVersionAndAppVersion(c.ChartVersions, version, appVersion); found && c.Name == name {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+func (m *memoryAssetManager) getDependentChartFiles(namespace, chartName string) ([]*models.ChartFiles, error) {
+	files, err := m.chartFiles(func(r *dbutils.MemoryRepo) bool { return m.inNamespace(r.Namespace, namespace) })
+	if err != nil {
+		return nil, err
+	}
+	result := []*models.ChartFiles{}
+	for _, f := range files {
+		for _, dependency := range f.Dependencies {
+			if dependency.Name == chartName {
+				result = append(result, f)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (m *memoryAssetManager) getChartFilesWithImage(namespace, image string) ([]*models.ChartFiles, error) {
+	files, err := m.chartFiles(func(r *dbutils.MemoryRepo) bool { return m.inNamespace(r.Namespace, namespace) })
+	if err != nil {
+		return nil, err
+	}
+	result := []*models.ChartFiles{}
+	for _, f := range files {
+		for _, i := range f.Images {
+			if strings.Contains(i, image) {
+				result = append(result, f)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (m *memoryAssetManager) getSyncReports(namespace, repo string, limit int) ([]*models.SyncReport, error) {
+	reports := []*models.SyncReport{}
+	err := m.View(func(c *dbutils.MemoryCatalog) error {
+		r := c.Repo(namespace, repo)
+		if r == nil {
+			return nil
+		}
+		for i := len(r.SyncReports) - 1; i >= 0 && len(reports) < limit; i-- {
+			report := r.SyncReports[i]
+			reports = append(reports, &report)
+		}
+		return nil
+	})
+	return reports, err
+}
+
+// getRepoSummaries returns the synced repositories of a namespace, or the
+// given one, with their number of charts and chart versions. The URL of a repo
+// is not stored with its last sync so it is taken from its charts or, if it
+// has none, from its latest sync report.
+func (m *memoryAssetManager) getRepoSummaries(namespace, repo string) ([]*repoSummary, error) {
+	repos := []*repoSummary{}
+	err := m.View(func(c *dbutils.MemoryCatalog) error {
+		for _, r := range c.SortedRepos() {
+			if r.Namespace != namespace || (repo != "" && r.Name != repo) {
+				continue
+			}
+			summary := &repoSummary{Namespace: r.Namespace, Name: r.Name, LastUpdate: r.LastUpdate, Checksum: r.Checksum}
+			for _, info := range r.Charts {
+				chart, err := info.Chart()
+				if err != nil {
+					return err
+				}
+				summary.ChartCount++
+				summary.VersionCount += len(chart.ChartVersions)
+				if chart.Repo != nil && chart.Repo.URL > summary.URL {
+					summary.URL = chart.Repo.URL
+				}
+			}
+			if summary.URL == "" && len(r.SyncReports) > 0 {
+				if latest := r.SyncReports[len(r.SyncReports)-1]; latest.Repo != nil {
+					summary.URL = latest.Repo.URL
+				}
+			}
+			repos = append(repos, summary)
+		}
+		return nil
+	})
+	return repos, err
+}
+
+// getCatalogVersion returns a digest of the checksum and last update of every
+// repository, which changes every time a repository is synced
+func (m *memoryAssetManager) getCatalogVersion() (string, error) {
+	digest := sha256.New()
+	err := m.View(func(c *dbutils.MemoryCatalog) error {
+		for _, r := range c.SortedRepos() {
+			fmt.Fprintf(digest, "%s/%s:%s:%s,", r.Namespace, r.Name, r.Checksum, r.LastUpdate.UTC().Format(time.RFC3339Nano))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// tarballStore returns the store of the tarballs mirrored in the catalog
+func (m *memoryAssetManager) tarballStore() blobstore.Store {
+	return dbutils.MemoryTarballStore{Manager: m.MemoryAssetManager}
+}
@@ -0,0 +1,356 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/kubeapps/kubeapps/pkg/dbutils"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+var (
+	memoryRepo      = &models.Repo{Namespace: "default", Name: "my-repo", URL: "https://example.com/my-repo"}
+	memoryOtherRepo = &models.Repo{Namespace: "other", Name: "other-repo", URL: "https://example.com/other-repo"}
+	memoryGlobal    = &models.Repo{Namespace: "kubeapps", Name: "stable", URL: "https://example.com/stable"}
+	memoryCreated   = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func memoryChart(repo *models.Repo, name, category string, keywords []string, versions ...models.ChartVersion) models.Chart {
+	return models.Chart{
+		ID:            repo.Name + "/" + name,
+		Name:          name,
+		Repo:          repo,
+		Description:   "The " + name + " chart",
+		Category:      category,
+		Keywords:      keywords,
+		Maintainers:   []chart.Maintainer{{Name: "Bitnami"}},
+		ChartVersions: versions,
+	}
+}
+
+func memoryVersion(version, appVersion, digest string, days int) models.ChartVersion {
+	return models.ChartVersion{Version: version, AppVersion: appVersion, Digest: digest, Created: memoryCreated.AddDate(0, 0, days)}
+}
+
+// newTestMemoryManager returns a manager of a catalog only used by the test
+// with the given charts and files
+func newTestMemoryManager(t *testing.T, charts []models.Chart, files []models.ChartFiles) *memoryAssetManager {
+	m := newMemoryManager(datastore.Config{URL: t.Name()}, "kubeapps").(*memoryAssetManager)
+	assert.NoError(t, m.Init())
+	assert.NoError(t, m.Update(func(c *dbutils.MemoryCatalog) error {
+		for _, chart := range charts {
+			r := c.EnsureRepo(chart.Repo.Namespace, chart.Repo.Name)
+			info := &dbutils.MemoryChart{ID: chart.ID}
+			if err := info.SetChart(chart); err != nil {
+				return err
+			}
+			r.Charts[chart.ID] = info
+		}
+		for _, f := range files {
+			if err := c.Repo(f.Repo.Namespace, f.Repo.Name).Charts[f.ChartID].SetChartFiles(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	return m
+}
+
+func chartIDs(charts []*models.Chart) []string {
+	ids := []string{}
+	for _, c := range charts {
+		ids = append(ids, c.Repo.Namespace+":"+c.ID)
+	}
+	return ids
+}
+
+func Test_MemoryGetPaginatedChartList(t *testing.T) {
+	m := newTestMemoryManager(t, []models.Chart{
+		memoryChart(memoryRepo, "wordpress", "CMS", []string{"blog"}, memoryVersion("2.0.0", "5.4", "wp-2", 10), memoryVersion("1.0.0", "5.3", "wp-1", 1)),
+		memoryChart(memoryRepo, "apache", "Web", []string{"http"}, memoryVersion("1.0.0", "2.4", "apache-1", 5)),
+		memoryChart(memoryGlobal, "wordpress", "CMS", []string{"blog"}, memoryVersion("2.0.0", "5.4", "wp-2", 10)),
+		memoryChart(memoryGlobal, "nginx", "Web", nil, memoryVersion("1.0.0", "1.19", "nginx-1", 20)),
+		memoryChart(memoryGlobal, "empty", "", nil),
+		memoryChart(memoryOtherRepo, "redis", "Database", nil, memoryVersion("1.0.0", "6.0", "redis-1", 3)),
+	}, nil)
+
+	tests := []struct {
+		name           string
+		namespace      string
+		filters        chartFilters
+		showDuplicates bool
+		sort           chartSort
+		pageNumber     int
+		pageSize       int
+		want           []string
+		wantPages      int
+	}{
+		{"namespace and global charts without duplicates", "default", chartFilters{}, false, chartSort{field: sortByName}, 1, 0,
+			[]string{"default:my-repo/apache", "kubeapps:stable/empty", "kubeapps:stable/nginx", "default:my-repo/wordpress"}, 1},
+		{"duplicates", "default", chartFilters{}, true, chartSort{field: sortByName}, 1, 0,
+			[]string{"default:my-repo/apache", "kubeapps:stable/empty", "kubeapps:stable/nginx", "default:my-repo/wordpress", "kubeapps:stable/wordpress"}, 1},
+		{"all namespaces", dbutils.AllNamespaces, chartFilters{repos: []string{"other-repo"}}, false, chartSort{field: sortByName}, 1, 0,
+			[]string{"other:other-repo/redis"}, 1},
+		{"filters", "default", chartFilters{repos: []string{"my-repo", "stable"}, keyword: "blog", maintainer: "Bitnami", category: "CMS", appVersion: "5."}, true, chartSort{field: sortByName}, 1, 0,
+			[]string{"default:my-repo/wordpress", "kubeapps:stable/wordpress"}, 1},
+		{"recently updated first, charts without versions last", "default", chartFilters{}, false, chartSort{field: sortByUpdated, descending: true}, 1, 0,
+			[]string{"kubeapps:stable/nginx", "default:my-repo/wordpress", "default:my-repo/apache", "kubeapps:stable/empty"}, 1},
+		{"oldest first", "default", chartFilters{}, false, chartSort{field: sortByCreated}, 1, 0,
+			[]string{"default:my-repo/wordpress", "default:my-repo/apache", "kubeapps:stable/nginx", "kubeapps:stable/empty"}, 1},
+		{"second page", "default", chartFilters{}, false, chartSort{field: sortByName}, 2, 3,
+			[]string{"default:my-repo/wordpress"}, 2},
+		{"no charts", "default", chartFilters{keyword: "none"}, false, chartSort{field: sortByName}, 1, 10,
+			[]string{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			charts, totalPages, err := m.getPaginatedChartList(tt.namespace, tt.filters, tt.pageNumber, tt.pageSize, tt.showDuplicates, tt.sort)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, chartIDs(charts))
+			assert.Equal(t, tt.wantPages, totalPages)
+		})
+	}
+}
+
+func Test_MemoryChartTypeAndAnnotationFilters(t *testing.T) {
+	library := memoryVersion("1.0.0", "", "common-1", 1)
+	library.Type = models.LibraryChartType
+	annotated := memoryVersion("1.0.0", "5.4", "wp-1", 1)
+	annotated.Annotations = models.Annotations{"category": "CMS", "artifacthub.io/license": "Apache-2.0"}
+	m := newTestMemoryManager(t, []models.Chart{
+		memoryChart(memoryRepo, "common", "", nil, library),
+		memoryChart(memoryRepo, "wordpress", "CMS", nil, annotated),
+		memoryChart(memoryRepo, "empty", "", nil),
+	}, nil)
+
+	tests := []struct {
+		name    string
+		filters chartFilters
+		want    []string
+	}{
+		{"every type", chartFilters{}, []string{"default:my-repo/common", "default:my-repo/empty", "default:my-repo/wordpress"}},
+		{"applications", chartFilters{chartType: chartTypeApplication}, []string{"default:my-repo/empty", "default:my-repo/wordpress"}},
+		{"libraries", chartFilters{chartType: models.LibraryChartType}, []string{"default:my-repo/common"}},
+		{"annotations", chartFilters{annotations: map[string]string{"category": "CMS", "artifacthub.io/license": "Apache-2.0"}}, []string{"default:my-repo/wordpress"}},
+		{"annotation with another value", chartFilters{annotations: map[string]string{"category": "Database"}}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			charts, _, err := m.getPaginatedChartList("default", tt.filters, 1, 0, true, chartSort{field: sortByName})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, chartIDs(charts))
+		})
+	}
+}
+
+func Test_MemoryGetChartFacets(t *testing.T) {
+	m := newTestMemoryManager(t, []models.Chart{
+		memoryChart(memoryRepo, "wordpress", "CMS", []string{"blog", "cms"}, memoryVersion("1.0.0", "5.4", "wp-1", 0)),
+		memoryChart(memoryRepo, "drupal", "CMS", []string{"cms"}, memoryVersion("1.0.0", "9.0", "drupal-1", 0)),
+		memoryChart(memoryGlobal, "nginx", "", nil, memoryVersion("1.0.0", "1.19", "nginx-1", 0)),
+	}, nil)
+
+	facets, err := m.getChartFacets("default", chartFilters{}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, chartFacets{
+		Keywords:    []facetCount{{"cms", 2}, {"blog", 1}},
+		Maintainers: []facetCount{{"Bitnami", 3}},
+		Categories:  []facetCount{{"CMS", 2}},
+		Repos:       []facetCount{{"my-repo", 2}, {"stable", 1}},
+	}, facets)
+}
+
+func Test_MemorySearchCharts(t *testing.T) {
+	wordpress := memoryChart(memoryRepo, "wordpress", "", []string{"blog"}, memoryVersion("1.0.0", "5.4", "wp-1", 0))
+	ghost := memoryChart(memoryRepo, "ghost", "", []string{"blogging"}, memoryVersion("1.0.0", "3.0", "ghost-1", 0))
+	ghost.Description = "A simple blog engine"
+	blogCommon := memoryChart(memoryRepo, "blog-common", "", nil, memoryVersion("1.0.0", "", "common-1", 0))
+	blogCommon.ChartVersions[0].Type = models.LibraryChartType
+	m := newTestMemoryManager(t, []models.Chart{
+		wordpress,
+		ghost,
+		blogCommon,
+		memoryChart(memoryOtherRepo, "blog", "", nil, memoryVersion("1.0.0", "1.0", "blog-1", 0)),
+	}, nil)
+
+	tests := []struct {
+		name      string
+		namespace string
+		query     string
+		repo      string
+		chartType string
+		want      []string
+	}{
+		{"ordered by relevance", "default", "blog", "", chartTypeApplication, []string{"default:my-repo/ghost", "default:my-repo/wordpress"}},
+		{"every word must match", "default", "Blog Engine", "", chartTypeApplication, []string{"default:my-repo/ghost"}},
+		{"all namespaces", dbutils.AllNamespaces, "blog", "", chartTypeApplication, []string{"other:other-repo/blog", "default:my-repo/ghost", "default:my-repo/wordpress"}},
+		{"repo", dbutils.AllNamespaces, "blog", "other-repo", chartTypeApplication, []string{"other:other-repo/blog"}},
+		{"no match", "default", "database", "", chartTypeApplication, []string{}},
+		{"library charts", "default", "blog", "", models.LibraryChartType, []string{"default:my-repo/blog-common"}},
+		{"every type", "default", "common", "", "", []string{"default:my-repo/blog-common"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			charts, totalPages, err := m.searchCharts(tt.namespace, tt.query, tt.repo, tt.chartType, 1, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, chartIDs(charts))
+			assert.Equal(t, 1, totalPages)
+		})
+	}
+}
+
+func Test_MemoryGetChart(t *testing.T) {
+	m := newTestMemoryManager(t, []models.Chart{
+		memoryChart(memoryRepo, "wordpress", "", nil, memoryVersion("2.0.0-beta.1", "5.5", "wp-3", 2), memoryVersion("1.0.0+build-1", "5.4", "wp-1", 1)),
+	}, nil)
+	assert.NoError(t, m.Update(func(c *dbutils.MemoryCatalog) error {
+		c.Repo("default", "my-repo").Charts["my-repo/wordpress"].Icon = &models.ChartIcon{Data: []byte("icon"), ContentType: "image/png", Digest: "abc"}
+		return nil
+	}))
+
+	chart, err := m.getChart("default", "my-repo/wordpress")
+	assert.NoError(t, err)
+	assert.Len(t, chart.ChartVersions, 2)
+	_, err = m.getChart("other", "my-repo/wordpress")
+	assert.Error(t, err)
+
+	chart, err = m.getChartVersions("default", "my-repo/wordpress", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ChartVersion{memoryVersion("1.0.0+build-1", "5.4", "wp-1", 1)}, chart.ChartVersions)
+
+	chart, err = m.getChartVersion("default", "my-repo/wordpress", "2.0.0-beta.1")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ChartVersion{memoryVersion("2.0.0-beta.1", "5.5", "wp-3", 2)}, chart.ChartVersions)
+	_, err = m.getChartVersion("default", "my-repo/wordpress", "3.0.0")
+	assert.Equal(t, ErrChartVersionNotFound, err)
+
+	charts, err := m.getChartsWithFilters("default", "wordpress", "1.0.0+build-1", "5.4")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"default:my-repo/wordpress"}, chartIDs(charts))
+
+	icon, err := m.getChartIcon("default", "my-repo/wordpress")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ChartIcon{Data: []byte("icon"), ContentType: "image/png", Digest: "abc"}, icon)
+}
+
+func Test_MemoryGetChartFiles(t *testing.T) {
+	files := []models.ChartFiles{
+		{ID: "my-repo/wordpress-1.0.0", ChartID: "my-repo/wordpress", Repo: memoryRepo, Readme: "# WordPress", Dependencies: []models.ChartDependency{{Name: "mariadb"}}, Images: []string{"docker.io/bitnami/wordpress:5.4"}},
+		{ID: "stable/ghost-1.0.0", ChartID: "stable/ghost", Repo: memoryGlobal, Dependencies: []models.ChartDependency{{Name: "mariadb"}}, Images: []string{"docker.io/bitnami/ghost:3.0"}},
+		{ID: "other-repo/drupal-1.0.0", ChartID: "other-repo/drupal", Repo: memoryOtherRepo, Dependencies: []models.ChartDependency{{Name: "mariadb"}}},
+	}
+	m := newTestMemoryManager(t, []models.Chart{
+		memoryChart(memoryRepo, "wordpress", "", nil, memoryVersion("1.0.0", "5.4", "wp-1", 0)),
+		memoryChart(memoryGlobal, "ghost", "", nil, memoryVersion("1.0.0", "3.0", "ghost-1", 0)),
+		memoryChart(memoryOtherRepo, "drupal", "", nil, memoryVersion("1.0.0", "9.0", "drupal-1", 0)),
+	}, files)
+
+	f, err := m.getChartFiles("default", "my-repo/wordpress-1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, files[0], f)
+	_, err = m.getChartFiles("default", "my-repo/wordpress-2.0.0")
+	assert.Error(t, err)
+
+	dependents, err := m.getDependentChartFiles("default", "mariadb")
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.ChartFiles{&files[0], &files[1]}, dependents)
+
+	withImage, err := m.getChartFilesWithImage(dbutils.AllNamespaces, "bitnami/ghost")
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.ChartFiles{&files[1]}, withImage)
+}
+
+func Test_MemoryGetRepoSummaries(t *testing.T) {
+	lastUpdate := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	m := newTestMemoryManager(t, []models.Chart{
+		memoryChart(memoryRepo, "wordpress", "", nil, memoryVersion("2.0.0", "5.4", "wp-2", 0), memoryVersion("1.0.0", "5.3", "wp-1", 0)),
+		memoryChart(memoryRepo, "apache", "", nil, memoryVersion("1.0.0", "2.4", "apache-1", 0)),
+	}, nil)
+	assert.NoError(t, m.Update(func(c *dbutils.MemoryCatalog) error {
+		r := c.Repo("default", "my-repo")
+		r.Checksum, r.LastUpdate = "abc", lastUpdate
+		empty := c.EnsureRepo("default", "empty")
+		for i := 0; i < 3; i++ {
+			empty.SyncReports = append(empty.SyncReports, models.SyncReport{
+				Repo:     &models.Repo{Namespace: "default", Name: "empty", URL: "https://example.com/empty"},
+				Checksum: string(rune('a' + i)),
+			})
+		}
+		return nil
+	}))
+	version, err := m.getCatalogVersion()
+	assert.NoError(t, err)
+
+	repos, err := m.getRepoSummaries("default", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []*repoSummary{
+		{Namespace: "default", Name: "empty", URL: "https://example.com/empty"},
+		{Namespace: "default", Name: "my-repo", URL: memoryRepo.URL, LastUpdate: lastUpdate, Checksum: "abc", ChartCount: 2, VersionCount: 3},
+	}, repos)
+
+	reports, err := m.getSyncReports("default", "empty", 2)
+	assert.NoError(t, err)
+	assert.Len(t, reports, 2)
+	assert.Equal(t, "c", reports[0].Checksum)
+
+	// The catalog version changes when a repository is synced
+	assert.NoError(t, m.Update(func(c *dbutils.MemoryCatalog) error {
+		c.Repo("default", "my-repo").LastUpdate = lastUpdate.Add(time.Hour)
+		return nil
+	}))
+	newVersion, err := m.getCatalogVersion()
+	assert.NoError(t, err)
+	assert.NotEqual(t, version, newVersion)
+}
+
+func Test_MemoryRoutes(t *testing.T) {
+	wordpress := memoryChart(memoryRepo, "wordpress", "", nil, memoryVersion("1.0.0", "5.4", "wp-1", 0))
+	m := newTestMemoryManager(t, []models.Chart{wordpress}, []models.ChartFiles{
+		{ID: "my-repo/wordpress-1.0.0", ChartID: "my-repo/wordpress", Repo: memoryRepo, Readme: "# WordPress"},
+	})
+	manager = m
+	ts := httptest.NewServer(setupRoutes())
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + pathPrefix + "/ns/default/charts/my-repo/wordpress")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	var b struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&b))
+	assert.Equal(t, "my-repo/wordpress", b.Data.ID)
+
+	res, err = http.Get(ts.URL + pathPrefix + "/ns/default/assets/my-repo/wordpress/versions/1.0.0/README.md")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	readme, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "# WordPress", string(readme))
+}
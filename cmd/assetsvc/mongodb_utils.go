@@ -17,10 +17,17 @@ limitations under the License.
 package main
 
 import (
-	"math"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
 
+	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
 	"github.com/kubeapps/kubeapps/pkg/dbutils"
 )
@@ -34,19 +41,64 @@ func newMongoDBManager(config datastore.Config, kubeappsNamespace string) assetM
 	return &mongodbAssetManager{m}
 }
 
-func (m *mongodbAssetManager) getPaginatedChartList(namespace, repo string, pageNumber, pageSize int, showDuplicates bool) ([]*models.Chart, int, error) {
-	db, closer := m.DBSession.DB()
-	defer closer()
-	var charts []*models.Chart
+// mongoChartSort returns the stages sorting charts by the given sort, charts
+// with the same value are sorted by ID so pages are stable
+func mongoChartSort(sort chartSort) []bson.M {
+	direction := 1
+	if sort.descending {
+		direction = -1
+	}
+	stages := []bson.M{}
+	field := "name"
+	switch sort.field {
+	case sortByUpdated:
+		stages = append(stages, bson.M{"$addFields": bson.M{"sortChartVersion": bson.M{"$arrayElemAt": []interface{}{"$chartversions", 0}}}})
+		field = "sortChartVersion.created"
+	case sortByCreated:
+		stages = append(stages, bson.M{"$addFields": bson.M{"sortChartVersion": bson.M{"$arrayElemAt": []interface{}{"$chartversions", -1}}}})
+		field = "sortChartVersion.created"
+	}
+	return append(stages, bson.M{"$sort": bson.D{{Name: field, Value: direction}, {Name: "chart_id", Value: 1}, {Name: "repo.namespace", Value: 1}}})
+}
 
-	c := db.C(chartCollection)
+// filteredCharts returns the stages of a pipeline selecting the charts
+// matching the filters
+func (m *mongodbAssetManager) filteredCharts(namespace string, filters chartFilters, showDuplicates bool) []bson.M {
 	pipeline := []bson.M{}
 	matcher := bson.M{}
 	if namespace != dbutils.AllNamespaces {
 		matcher["repo.namespace"] = bson.M{"$in": []string{namespace, m.KubeappsNamespace}}
 	}
-	if repo != "" {
-		matcher["repo.name"] = repo
+	if len(filters.repos) == 1 {
+		matcher["repo.name"] = filters.repos[0]
+	} else if len(filters.repos) > 1 {
+		matcher["repo.name"] = bson.M{"$in": filters.repos}
+	}
+	if filters.keyword != "" {
+		matcher["keywords"] = filters.keyword
+	}
+	if filters.maintainer != "" {
+		matcher["maintainers.name"] = filters.maintainer
+	}
+	if filters.category != "" {
+		matcher["category"] = filters.category
+	}
+	if filters.appVersion != "" {
+		matcher["chartversions.0.appversion"] = bson.M{"$regex": "^" + regexp.QuoteMeta(filters.appVersion)}
+	}
+	matchChartType(matcher, filters.chartType)
+	if len(filters.annotations) > 0 {
+		// Annotations are stored as key-value pairs, see models.Annotations
+		keys := []string{}
+		for k := range filters.annotations {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		annotations := []bson.M{}
+		for _, k := range keys {
+			annotations = append(annotations, bson.M{"$elemMatch": bson.M{"key": k, "value": filters.annotations[k]}})
+		}
+		matcher["chartversions.0.annotations"] = bson.M{"$all": annotations}
 	}
 	if len(matcher) > 0 {
 		pipeline = append(pipeline, bson.M{"$match": matcher})
@@ -63,29 +115,47 @@ func (m *mongodbAssetManager) getPaginatedChartList(namespace, repo string, page
 			bson.M{"$replaceRoot": bson.M{"newRoot": "$chart"}},
 		)
 	}
+	return pipeline
+}
+
+// matchChartType adds the condition selecting the charts whose latest version
+// is of the chart type to a matcher
+func matchChartType(matcher bson.M, chartType string) {
+	switch chartType {
+	case chartTypeApplication:
+		matcher["chartversions.0.type"] = bson.M{"$ne": models.LibraryChartType}
+	case models.LibraryChartType:
+		matcher["chartversions.0.type"] = models.LibraryChartType
+	}
+}
+
+func (m *mongodbAssetManager) getPaginatedChartList(namespace string, filters chartFilters, pageNumber, pageSize int, showDuplicates bool, sort chartSort) ([]*models.Chart, int, error) {
+	db, closer := m.DBSession.DB()
+	defer closer()
+	var charts []*models.Chart
 
-	// Order by name
-	pipeline = append(pipeline, bson.M{"$sort": bson.M{"name": 1}})
+	c := db.C(chartCollection)
+	pipeline := m.filteredCharts(namespace, filters, showDuplicates)
 
 	totalPages := 1
+	skip := 0
 	if pageSize != 0 {
 		// If a pageSize is given, returns only the the specified number of charts and
 		// the number of pages
 		countPipeline := append(pipeline, bson.M{"$count": "count"})
 		cc := count{}
 		err := c.Pipe(countPipeline).One(&cc)
-		if err != nil {
+		// No document is returned if there are no charts
+		if err != nil && err != mgo.ErrNotFound {
 			return charts, 0, err
 		}
-		totalPages = int(math.Ceil(float64(cc.Count) / float64(pageSize)))
-
-		// If the page number is out of range, return the last one
-		if pageNumber > totalPages {
-			pageNumber = totalPages
-		}
+		totalPages, skip = paginate(cc.Count, pageNumber, pageSize)
+	}
 
+	pipeline = append(pipeline, mongoChartSort(sort)...)
+	if pageSize != 0 {
 		pipeline = append(pipeline,
-			bson.M{"$skip": pageSize * (pageNumber - 1)},
+			bson.M{"$skip": skip},
 			bson.M{"$limit": pageSize},
 		)
 	}
@@ -105,6 +175,42 @@ func (m *mongodbAssetManager) getChart(namespace, chartID string) (models.Chart,
 	return chart, err
 }
 
+// getChartVersions returns a chart with all its versions, or without its
+// prerelease versions. Build metadata may contain hyphens so it is stripped
+// before looking for the prerelease separator.
+func (m *mongodbAssetManager) getChartVersions(namespace, chartID string, prereleases bool) (models.Chart, error) {
+	if prereleases {
+		return m.getChart(namespace, chartID)
+	}
+	db, closer := m.DBSession.DB()
+	defer closer()
+	var chart models.Chart
+	release := bson.M{"$eq": []interface{}{
+		bson.M{"$indexOfCP": []interface{}{
+			bson.M{"$arrayElemAt": []interface{}{bson.M{"$split": []interface{}{"$$cv.version", "+"}}, 0}},
+			"-",
+		}},
+		-1,
+	}}
+	err := db.C(chartCollection).Pipe([]bson.M{
+		{"$match": bson.M{"repo.namespace": namespace, "chart_id": chartID}},
+		{"$addFields": bson.M{"chartversions": bson.M{"$filter": bson.M{"input": "$chartversions", "as": "cv", "cond": release}}}},
+	}).One(&chart)
+	return chart, err
+}
+
+func (m *mongodbAssetManager) getChartIcon(namespace, chartID string) (models.ChartIcon, error) {
+	db, closer := m.DBSession.DB()
+	defer closer()
+	var chart models.Chart
+	err := db.C(chartCollection).Find(bson.M{"repo.namespace": namespace, "chart_id": chartID}).Select(bson.M{"raw_icon": 1, "icon_content_type": 1}).One(&chart)
+	if err != nil || chart.RawIcon == nil {
+		return models.ChartIcon{}, err
+	}
+	digest := sha256.Sum256(chart.RawIcon)
+	return models.ChartIcon{Data: chart.RawIcon, ContentType: chart.IconContentType, Digest: hex.EncodeToString(digest[:])}, nil
+}
+
 func (m *mongodbAssetManager) getChartVersion(namespace, chartID, version string) (models.Chart, error) {
 	db, closer := m.DBSession.DB()
 	defer closer()
@@ -144,23 +250,217 @@ func (m *mongodbAssetManager) getChartsWithFilters(namespace, name, version, app
 	return charts, err
 }
 
-func (m *mongodbAssetManager) searchCharts(query, repo string) ([]*models.Chart, error) {
+func (m *mongodbAssetManager) getDependentChartFiles(namespace, chartName string) ([]*models.ChartFiles, error) {
+	db, closer := m.DBSession.DB()
+	defer closer()
+	var files []*models.ChartFiles
+	matcher := bson.M{"dependencies.name": chartName}
+	if namespace != dbutils.AllNamespaces {
+		matcher["repo.namespace"] = bson.M{"$in": []string{namespace, m.KubeappsNamespace}}
+	}
+	err := db.C(filesCollection).Find(matcher).All(&files)
+	return files, err
+}
+
+func (m *mongodbAssetManager) getChartFilesWithImage(namespace, image string) ([]*models.ChartFiles, error) {
+	db, closer := m.DBSession.DB()
+	defer closer()
+	var files []*models.ChartFiles
+	matcher := bson.M{"images": bson.M{"$regex": regexp.QuoteMeta(image)}}
+	if namespace != dbutils.AllNamespaces {
+		matcher["repo.namespace"] = bson.M{"$in": []string{namespace, m.KubeappsNamespace}}
+	}
+	err := db.C(filesCollection).Find(matcher).All(&files)
+	return files, err
+}
+
+func (m *mongodbAssetManager) getSyncReports(namespace, repo string, limit int) ([]*models.SyncReport, error) {
+	db, closer := m.DBSession.DB()
+	defer closer()
+	var reports []*models.SyncReport
+	err := db.C(dbutils.SyncReportCollection).Pipe([]bson.M{
+		{"$match": bson.M{"repo.namespace": namespace, "repo.name": repo}},
+		{"$sort": bson.M{"start_time": -1}},
+		{"$limit": limit},
+	}).All(&reports)
+	return reports, err
+}
+
+func (m *mongodbAssetManager) getChartFacets(namespace string, filters chartFilters, showDuplicates bool) (chartFacets, error) {
+	db, closer := m.DBSession.DB()
+	defer closer()
+	facets := chartFacets{}
+	pipeline := append(m.filteredCharts(namespace, filters, showDuplicates), bson.M{"$facet": bson.M{
+		"keywords":    []bson.M{{"$unwind": "$keywords"}, {"$sortByCount": "$keywords"}},
+		"maintainers": []bson.M{{"$unwind": "$maintainers"}, {"$sortByCount": "$maintainers.name"}},
+		"categories":  []bson.M{{"$match": bson.M{"category": bson.M{"$nin": []interface{}{nil, ""}}}}, {"$sortByCount": "$category"}},
+		"repos":       []bson.M{{"$sortByCount": "$repo.name"}},
+	}})
+	err := db.C(chartCollection).Pipe(pipeline).One(&facets)
+	return facets, err
+}
+
+// searchPipeline returns the stages of a pipeline selecting the charts
+// matching a search query, ordered by relevance
+func (m *mongodbAssetManager) searchPipeline(namespace, query, repo, chartType string) []bson.M {
+	// The $text match uses the text index and has to be the first stage
+	matcher := bson.M{"$text": bson.M{"$search": query}}
+	if namespace != dbutils.AllNamespaces {
+		matcher["repo.namespace"] = bson.M{"$in": []string{namespace, m.KubeappsNamespace}}
+	}
+	if repo != "" {
+		matcher["repo.name"] = repo
+	}
+	matchChartType(matcher, chartType)
+	return []bson.M{
+		{"$match": matcher},
+		// Order by relevance, then by name
+		{"$sort": bson.D{{Name: "score", Value: bson.M{"$meta": "textScore"}}, {Name: "name", Value: 1}}},
+	}
+}
+
+func (m *mongodbAssetManager) searchCharts(namespace, query, repo, chartType string, pageNumber, pageSize int) ([]*models.Chart, int, error) {
 	db, closer := m.DBSession.DB()
 	defer closer()
 	var charts []*models.Chart
-	conditions := bson.M{
-		"$or": []bson.M{
-			{"name": bson.M{"$regex": query}},
-			{"description": bson.M{"$regex": query}},
-			{"repo.name": bson.M{"$regex": query}},
-			{"keywords": bson.M{"$elemMatch": bson.M{"$regex": query}}},
-			{"sources": bson.M{"$elemMatch": bson.M{"$regex": query}}},
-			{"maintainers": bson.M{"$elemMatch": bson.M{"name": bson.M{"$regex": query}}}},
-		},
+
+	c := db.C(chartCollection)
+	pipeline := m.searchPipeline(namespace, query, repo, chartType)
+
+	totalPages := 1
+	if pageSize != 0 {
+		countPipeline := append(pipeline, bson.M{"$count": "count"})
+		cc := count{}
+		err := c.Pipe(countPipeline).One(&cc)
+		if err != nil && err != mgo.ErrNotFound {
+			return charts, 0, err
+		}
+		var skip int
+		totalPages, skip = paginate(cc.Count, pageNumber, pageSize)
+
+		pipeline = append(pipeline,
+			bson.M{"$skip": skip},
+			bson.M{"$limit": pageSize},
+		)
+	}
+	err := c.Pipe(pipeline).All(&charts)
+	if err != nil {
+		return charts, 0, err
 	}
+	return charts, totalPages, nil
+}
+
+// mongoRepoCheck is the last sync of a repository
+type mongoRepoCheck struct {
+	Namespace  string    `bson:"namespace"`
+	Name       string    `bson:"name"`
+	Checksum   string    `bson:"checksum"`
+	LastUpdate time.Time `bson:"last_update"`
+}
+
+// mongoRepoCharts is the URL and the number of charts and chart versions of
+// a repository
+type mongoRepoCharts struct {
+	Name     string `bson:"_id"`
+	URL      string `bson:"url"`
+	Charts   int    `bson:"charts"`
+	Versions int    `bson:"versions"`
+}
+
+// getRepoSummaries returns the synced repositories of a namespace, or the
+// given one, with their number of charts and chart versions. The URL of a repo
+// is not stored with its last sync so it is taken from its charts or, if it
+// has none, from its latest sync report.
+func (m *mongodbAssetManager) getRepoSummaries(namespace, repo string) ([]*repoSummary, error) {
+	db, closer := m.DBSession.DB()
+	defer closer()
+	repoQuery := bson.M{"namespace": namespace}
+	chartQuery := bson.M{"repo.namespace": namespace}
 	if repo != "" {
-		conditions["repo.name"] = repo
+		repoQuery["name"] = repo
+		chartQuery["repo.name"] = repo
 	}
-	err := db.C(chartCollection).Find(conditions).All(&charts)
-	return charts, err
+	var checks []mongoRepoCheck
+	err := db.C(dbutils.RepositoryCollection).Find(repoQuery).Sort("name").All(&checks)
+	if err != nil {
+		return nil, err
+	}
+	var counts []mongoRepoCharts
+	err = db.C(chartCollection).Pipe([]bson.M{
+		{"$match": chartQuery},
+		{"$group": bson.M{
+			"_id":      "$repo.name",
+			"url":      bson.M{"$max": "$repo.url"},
+			"charts":   bson.M{"$sum": 1},
+			"versions": bson.M{"$sum": bson.M{"$size": bson.M{"$ifNull": []interface{}{"$chartversions", []interface{}{}}}}},
+		}},
+	}).All(&counts)
+	if err != nil {
+		return nil, err
+	}
+	repoCharts := map[string]mongoRepoCharts{}
+	for _, c := range counts {
+		repoCharts[c.Name] = c
+	}
+
+	repos := []*repoSummary{}
+	missingURL := false
+	for _, c := range checks {
+		rc := repoCharts[c.Name]
+		missingURL = missingURL || rc.URL == ""
+		repos = append(repos, &repoSummary{
+			Namespace:    c.Namespace,
+			Name:         c.Name,
+			URL:          rc.URL,
+			LastUpdate:   c.LastUpdate,
+			Checksum:     c.Checksum,
+			ChartCount:   rc.Charts,
+			VersionCount: rc.Versions,
+		})
+	}
+	if !missingURL {
+		return repos, nil
+	}
+
+	var reportURLs []mongoRepoCharts
+	err = db.C(dbutils.SyncReportCollection).Pipe([]bson.M{
+		{"$match": chartQuery},
+		{"$sort": bson.M{"start_time": -1}},
+		{"$group": bson.M{"_id": "$repo.name", "url": bson.M{"$first": "$repo.url"}}},
+	}).All(&reportURLs)
+	if err != nil {
+		return nil, err
+	}
+	urls := map[string]string{}
+	for _, r := range reportURLs {
+		urls[r.Name] = r.URL
+	}
+	for _, r := range repos {
+		if r.URL == "" {
+			r.URL = urls[r.Name]
+		}
+	}
+	return repos, nil
+}
+
+// getCatalogVersion returns a digest of the checksum and last update of every
+// repository, which changes every time a repository is synced
+func (m *mongodbAssetManager) getCatalogVersion() (string, error) {
+	db, closer := m.DBSession.DB()
+	defer closer()
+	var checks []mongoRepoCheck
+	err := db.C(dbutils.RepositoryCollection).Find(bson.M{}).Sort("namespace", "name").All(&checks)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.New()
+	for _, c := range checks {
+		fmt.Fprintf(digest, "%s/%s:%s:%s,", c.Namespace, c.Name, c.Checksum, c.LastUpdate.UTC().Format(time.RFC3339Nano))
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// tarballStore returns the store of the tarballs mirrored in the database
+func (m *mongodbAssetManager) tarballStore() blobstore.Store {
+	return dbutils.MongoTarballStore{DBSession: m.DBSession}
 }
@@ -0,0 +1,58 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/kubeapps/kubeapps/pkg/dbutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_MongoSearchPipeline(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		repo      string
+		chartType string
+		want      bson.M
+	}{
+		{"application charts", dbutils.AllNamespaces, "", chartTypeApplication, bson.M{
+			"$text":                bson.M{"$search": "wordpress"},
+			"chartversions.0.type": bson.M{"$ne": models.LibraryChartType},
+		}},
+		{"library charts of a repo", "default", "stable", models.LibraryChartType, bson.M{
+			"$text":                bson.M{"$search": "wordpress"},
+			"repo.namespace":       bson.M{"$in": []string{"default", "kubeapps"}},
+			"repo.name":            "stable",
+			"chartversions.0.type": models.LibraryChartType,
+		}},
+		{"every type", dbutils.AllNamespaces, "", "", bson.M{
+			"$text": bson.M{"$search": "wordpress"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m mock.Mock
+			pipeline := getMockManager(&m).searchPipeline(tt.namespace, "wordpress", tt.repo, tt.chartType)
+			assert.Equal(t, bson.M{"$match": tt.want}, pipeline[0])
+		})
+	}
+}
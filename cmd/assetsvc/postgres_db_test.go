@@ -23,13 +23,16 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
 	"github.com/kubeapps/kubeapps/pkg/dbutils/dbutilstest"
 	"github.com/kubeapps/kubeapps/pkg/dbutils/dbutilstest/pgtest"
 	_ "github.com/lib/pq"
+	"k8s.io/helm/pkg/proto/hapi/chart"
 )
 
 func getInitializedManager(t *testing.T) (*postgresAssetManager, func()) {
@@ -193,6 +196,88 @@ func TestGetVersion(t *testing.T) {
 	}
 }
 
+func TestGetChartVersions(t *testing.T) {
+	pgtest.SkipIfNoDB(t)
+	const repoName = "repo-name"
+	chart := models.Chart{ID: "chart-1", ChartVersions: []models.ChartVersion{
+		models.ChartVersion{Version: "2.0.0-beta.1"},
+		models.ChartVersion{Version: "1.2.3+build-1"},
+		models.ChartVersion{Version: "1.2.3-rc.1+build"},
+		models.ChartVersion{Version: "1.0.0"},
+	}}
+
+	testCases := []struct {
+		name             string
+		prereleases      bool
+		expectedVersions []string
+	}{
+		{
+			name:             "it returns all the versions",
+			prereleases:      true,
+			expectedVersions: []string{"2.0.0-beta.1", "1.2.3+build-1", "1.2.3-rc.1+build", "1.0.0"},
+		},
+		{
+			name:             "it returns the versions without the prereleases in the same order",
+			prereleases:      false,
+			expectedVersions: []string{"1.2.3+build-1", "1.0.0"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pam, cleanup := getInitializedManager(t)
+			defer cleanup()
+			pgtest.EnsureChartsExist(t, pam, []models.Chart{chart}, models.Repo{Name: repoName, Namespace: "namespace-1"})
+
+			got, err := pam.getChartVersions("namespace-1", "chart-1", tc.prereleases)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			versions := []string{}
+			for _, cv := range got.ChartVersions {
+				versions = append(versions, cv.Version)
+			}
+			if !cmp.Equal(versions, tc.expectedVersions) {
+				t.Errorf("mismatch (-want +got):\n%s", cmp.Diff(tc.expectedVersions, versions))
+			}
+		})
+	}
+}
+
+func TestGetRepoSummaries(t *testing.T) {
+	pgtest.SkipIfNoDB(t)
+	pam, cleanup := getInitializedManager(t)
+	defer cleanup()
+
+	bitnami := models.Repo{Name: "bitnami", Namespace: "namespace-1", URL: "https://charts.bitnami.com/bitnami"}
+	pgtest.EnsureChartsExist(t, pam, []models.Chart{
+		models.Chart{ID: "bitnami/apache", Repo: &bitnami, ChartVersions: []models.ChartVersion{{Version: "2.0.0"}, {Version: "1.0.0"}}},
+		models.Chart{ID: "bitnami/nginx", Repo: &bitnami, ChartVersions: []models.ChartVersion{{Version: "1.0.0"}}},
+	}, bitnami)
+	pgtest.EnsureChartsExist(t, pam, []models.Chart{}, models.Repo{Name: "empty", Namespace: "namespace-1"})
+	pgtest.EnsureChartsExist(t, pam, []models.Chart{}, models.Repo{Name: "other", Namespace: "namespace-2"})
+
+	repos, err := pam.getRepoSummaries("namespace-1", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expected := []*repoSummary{
+		{Namespace: "namespace-1", Name: "bitnami", URL: bitnami.URL, ChartCount: 2, VersionCount: 3},
+		{Namespace: "namespace-1", Name: "empty"},
+	}
+	if !cmp.Equal(repos, expected) {
+		t.Errorf("mismatch (-want +got):\n%s", cmp.Diff(expected, repos))
+	}
+
+	repos, err = pam.getRepoSummaries("namespace-1", "empty")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if got, want := len(repos), 1; got != want {
+		t.Errorf("got: %d, want: %d", got, want)
+	}
+}
+
 func TestGetPaginatedChartList(t *testing.T) {
 	pgtest.SkipIfNoDB(t)
 	const (
@@ -384,8 +469,11 @@ func TestGetPaginatedChartList(t *testing.T) {
 				}
 			}
 
-			// The actual pagination isn't currently implemented as its not yet used by Kubeapps.
-			charts, _, err := pam.getPaginatedChartList(tc.namespace, tc.repo, 1, 10, tc.showDups)
+			filters := chartFilters{}
+			if tc.repo != "" {
+				filters.repos = []string{tc.repo}
+			}
+			charts, _, err := pam.getPaginatedChartList(tc.namespace, filters, 1, 10, tc.showDups, chartSort{field: sortByName})
 
 			if got, want := err, tc.expectedErr; got != want {
 				t.Fatalf("got: %+v, want: %+v", got, want)
@@ -396,3 +484,188 @@ func TestGetPaginatedChartList(t *testing.T) {
 		})
 	}
 }
+
+func TestGetPaginatedChartListPages(t *testing.T) {
+	pgtest.SkipIfNoDB(t)
+	repo := models.Repo{Name: "repo-name", Namespace: "namespace-1"}
+	day := func(d int) []models.ChartVersion {
+		return []models.ChartVersion{{Digest: fmt.Sprintf("digest-%d", d), Created: time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC)}}
+	}
+
+	pam, cleanup := getInitializedManager(t)
+	defer cleanup()
+	pgtest.EnsureChartsExist(t, pam, []models.Chart{
+		models.Chart{ID: "repo-name/apache", Name: "apache", ChartVersions: day(3)},
+		models.Chart{ID: "repo-name/mysql", Name: "mysql", ChartVersions: day(1)},
+		models.Chart{ID: "repo-name/redis", Name: "redis", ChartVersions: day(2)},
+		models.Chart{ID: "repo-name/redis-copy", Name: "redis-copy", ChartVersions: day(2)},
+	}, repo)
+
+	testCases := []struct {
+		name               string
+		pageNumber         int
+		sort               chartSort
+		expectedCharts     []string
+		expectedTotalPages int
+	}{
+		{
+			name:               "it returns the first page sorted by name",
+			pageNumber:         1,
+			sort:               chartSort{field: sortByName},
+			expectedCharts:     []string{"repo-name/apache", "repo-name/mysql"},
+			expectedTotalPages: 2,
+		},
+		{
+			name:               "it returns the last page without duplicates",
+			pageNumber:         2,
+			sort:               chartSort{field: sortByName},
+			expectedCharts:     []string{"repo-name/redis"},
+			expectedTotalPages: 2,
+		},
+		{
+			name:               "it returns the last page if the page is out of range",
+			pageNumber:         3,
+			sort:               chartSort{field: sortByName},
+			expectedCharts:     []string{"repo-name/redis"},
+			expectedTotalPages: 2,
+		},
+		{
+			name:               "it sorts by the latest update",
+			pageNumber:         1,
+			sort:               chartSort{field: sortByUpdated, descending: true},
+			expectedCharts:     []string{"repo-name/apache", "repo-name/redis"},
+			expectedTotalPages: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			charts, totalPages, err := pam.getPaginatedChartList(repo.Namespace, chartFilters{}, tc.pageNumber, 2, false, tc.sort)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			chartIDs := []string{}
+			for _, c := range charts {
+				chartIDs = append(chartIDs, c.ID)
+			}
+			if got, want := chartIDs, tc.expectedCharts; !cmp.Equal(want, got) {
+				t.Errorf("mismatch (-want +got):\n%s", cmp.Diff(want, got))
+			}
+			if got, want := totalPages, tc.expectedTotalPages; got != want {
+				t.Errorf("got: %d, want: %d", got, want)
+			}
+		})
+	}
+}
+
+func TestFilterChartsWithFacets(t *testing.T) {
+	pgtest.SkipIfNoDB(t)
+	const namespace = "namespace-1"
+	bot := []chart.Maintainer{{Name: "bitnami-bot"}}
+	versions := func(digest, appVersion string) []models.ChartVersion {
+		return []models.ChartVersion{{Digest: digest, AppVersion: appVersion}}
+	}
+
+	pam, cleanup := getInitializedManager(t)
+	defer cleanup()
+	pgtest.EnsureChartsExist(t, pam, []models.Chart{
+		models.Chart{ID: "stable/wordpress", Name: "wordpress", Keywords: []string{"cms", "blog"}, Maintainers: bot, Category: "CMS", ChartVersions: versions("1", "5.4.1")},
+		models.Chart{ID: "stable/drupal", Name: "drupal", Keywords: []string{"cms"}, Category: "CMS", ChartVersions: versions("2", "8.8.5")},
+	}, models.Repo{Name: "stable", Namespace: namespace})
+	pgtest.EnsureChartsExist(t, pam, []models.Chart{
+		models.Chart{ID: "bitnami/redis", Name: "redis", Maintainers: bot, Category: "Database", ChartVersions: versions("3", "5.0.9")},
+	}, models.Repo{Name: "bitnami", Namespace: namespace})
+
+	testCases := []struct {
+		name           string
+		filters        chartFilters
+		expectedCharts []string
+		expectedFacets chartFacets
+	}{
+		{
+			name:           "it filters by keyword",
+			filters:        chartFilters{keyword: "cms"},
+			expectedCharts: []string{"stable/drupal", "stable/wordpress"},
+			expectedFacets: chartFacets{
+				Keywords:    []facetCount{{Value: "cms", Count: 2}, {Value: "blog", Count: 1}},
+				Maintainers: []facetCount{{Value: "bitnami-bot", Count: 1}},
+				Categories:  []facetCount{{Value: "CMS", Count: 2}},
+				Repos:       []facetCount{{Value: "stable", Count: 2}},
+			},
+		},
+		{
+			name:           "it filters by maintainer and app version prefix",
+			filters:        chartFilters{maintainer: "bitnami-bot", appVersion: "5."},
+			expectedCharts: []string{"bitnami/redis", "stable/wordpress"},
+			expectedFacets: chartFacets{
+				Keywords:    []facetCount{{Value: "blog", Count: 1}, {Value: "cms", Count: 1}},
+				Maintainers: []facetCount{{Value: "bitnami-bot", Count: 2}},
+				Categories:  []facetCount{{Value: "CMS", Count: 1}, {Value: "Database", Count: 1}},
+				Repos:       []facetCount{{Value: "bitnami", Count: 1}, {Value: "stable", Count: 1}},
+			},
+		},
+		{
+			name:           "it filters by category and several repos",
+			filters:        chartFilters{category: "Database", repos: []string{"stable", "bitnami"}},
+			expectedCharts: []string{"bitnami/redis"},
+			expectedFacets: chartFacets{
+				Maintainers: []facetCount{{Value: "bitnami-bot", Count: 1}},
+				Categories:  []facetCount{{Value: "Database", Count: 1}},
+				Repos:       []facetCount{{Value: "bitnami", Count: 1}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			charts, _, err := pam.getPaginatedChartList(namespace, tc.filters, 1, 0, false, chartSort{field: sortByName})
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			chartIDs := []string{}
+			for _, c := range charts {
+				chartIDs = append(chartIDs, c.ID)
+			}
+			if got, want := chartIDs, tc.expectedCharts; !cmp.Equal(want, got) {
+				t.Errorf("mismatch (-want +got):\n%s", cmp.Diff(want, got))
+			}
+
+			facets, err := pam.getChartFacets(namespace, tc.filters, false)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if got, want := facets, tc.expectedFacets; !cmp.Equal(want, got) {
+				t.Errorf("mismatch (-want +got):\n%s", cmp.Diff(want, got))
+			}
+		})
+	}
+}
+
+func TestSearchCharts(t *testing.T) {
+	pgtest.SkipIfNoDB(t)
+	repo := models.Repo{Name: "repo-name", Namespace: "namespace-1"}
+
+	pam, cleanup := getInitializedManager(t)
+	defer cleanup()
+	pgtest.EnsureChartsExist(t, pam, []models.Chart{
+		models.Chart{ID: "repo-name/blog", Name: "blog", Description: "A blog engine", Keywords: []string{"wordpress"}},
+		models.Chart{ID: "repo-name/wordpress", Name: "wordpress", Description: "Web publishing platform"},
+		models.Chart{ID: "repo-name/redis", Name: "redis", Description: "Key-value store", Keywords: nil},
+	}, repo)
+
+	charts, totalPages, err := pam.searchCharts(repo.Namespace, "wordpress", "", chartTypeApplication, 1, 0)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	chartIDs := []string{}
+	for _, c := range charts {
+		chartIDs = append(chartIDs, c.ID)
+	}
+	// Matches in the name rank higher than matches in the keywords
+	if got, want := chartIDs, []string{"repo-name/wordpress", "repo-name/blog"}; !cmp.Equal(got, want) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+	if got, want := totalPages, 1; got != want {
+		t.Errorf("got: %d, want: %d", got, want)
+	}
+}
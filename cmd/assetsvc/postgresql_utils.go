@@ -17,15 +17,17 @@ limitations under the License.
 package main
 
 import (
-	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
 	"github.com/kubeapps/kubeapps/pkg/dbutils"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // TODO(mnelson): standardise error API for package.
@@ -43,81 +45,247 @@ func newPGManager(config datastore.Config, kubeappsNamespace string) (assetManag
 	return &postgresAssetManager{m}, nil
 }
 
-func exists(current []string, str string) bool {
-	for _, s := range current {
-		if s == str {
-			return true
-		}
+// Init connects to the database and ensures its schema is the one expected
+func (m *postgresAssetManager) Init() error {
+	err := m.PostgresAssetManagerIface.Init()
+	if err != nil {
+		return err
 	}
-	return false
+	return m.CheckSchemaVersion()
+}
+
+// pgChartSortColumns are the expressions used to sort charts by each field
+var pgChartSortColumns = map[string]string{
+	sortByName:    "info ->> 'name'",
+	sortByUpdated: "(info -> 'chartVersions' -> 0 ->> 'created')::timestamptz",
+	sortByCreated: "(info -> 'chartVersions' -> -1 ->> 'created')::timestamptz",
 }
 
-func (m *postgresAssetManager) getPaginatedChartList(namespace, repo string, pageNumber, pageSize int, showDuplicates bool) ([]*models.Chart, int, error) {
+// pgChartOrder returns the ORDER BY expression of the given sort, charts with
+// the same value are sorted by ID so pages are stable
+func pgChartOrder(sort chartSort) string {
+	column, ok := pgChartSortColumns[sort.field]
+	if !ok {
+		column = pgChartSortColumns[sortByName]
+	}
+	direction := "ASC"
+	if sort.descending {
+		direction = "DESC NULLS LAST"
+	}
+	return fmt.Sprintf("%s %s, chart_id ASC, repo_namespace ASC", column, direction)
+}
+
+// filteredCharts returns the FROM expression of the charts matching the
+// filters and its query params
+func (m *postgresAssetManager) filteredCharts(namespace string, filters chartFilters, showDuplicates bool) (string, []interface{}, error) {
 	clauses := []string{}
 	queryParams := []interface{}{}
 	if namespace != dbutils.AllNamespaces {
 		queryParams = append(queryParams, namespace, m.GetKubeappsNamespace())
 		clauses = append(clauses, "(repo_namespace = $1 OR repo_namespace = $2)")
 	}
-	if repo != "" {
-		queryParams = append(queryParams, repo)
+	if len(filters.repos) == 1 {
+		queryParams = append(queryParams, filters.repos[0])
 		clauses = append(clauses, fmt.Sprintf("repo_name = $%d", len(queryParams)))
+	} else if len(filters.repos) > 1 {
+		queryParams = append(queryParams, pq.Array(filters.repos))
+		clauses = append(clauses, fmt.Sprintf("repo_name = ANY($%d)", len(queryParams)))
+	}
+	if filters.keyword != "" {
+		queryParams = append(queryParams, filters.keyword)
+		clauses = append(clauses, fmt.Sprintf("info -> 'keywords' ? $%d", len(queryParams)))
+	}
+	if filters.maintainer != "" {
+		maintainer, err := json.Marshal([]map[string]string{{"name": filters.maintainer}})
+		if err != nil {
+			return "", nil, err
+		}
+		queryParams = append(queryParams, string(maintainer))
+		clauses = append(clauses, fmt.Sprintf("info -> 'maintainers' @> $%d::jsonb", len(queryParams)))
 	}
-	repoQuery := ""
+	if filters.category != "" {
+		queryParams = append(queryParams, filters.category)
+		clauses = append(clauses, fmt.Sprintf("info ->> 'category' = $%d", len(queryParams)))
+	}
+	if filters.appVersion != "" {
+		queryParams = append(queryParams, likeEscaper.Replace(filters.appVersion)+"%")
+		clauses = append(clauses, fmt.Sprintf("info -> 'chartVersions' -> 0 ->> 'app_version' LIKE $%d", len(queryParams)))
+	}
+	queryParams, clauses = pgChartTypeClause(filters.chartType, queryParams, clauses)
+	if len(filters.annotations) > 0 {
+		annotations, err := json.Marshal(filters.annotations)
+		if err != nil {
+			return "", nil, err
+		}
+		queryParams = append(queryParams, string(annotations))
+		clauses = append(clauses, fmt.Sprintf("info -> 'chartVersions' -> 0 -> 'annotations' @> $%d::jsonb", len(queryParams)))
+	}
+	from := dbutils.ChartTable
 	if len(clauses) > 0 {
-		repoQuery = strings.Join(clauses, " AND ")
-		repoQuery = "WHERE " + repoQuery
+		from = fmt.Sprintf("%s WHERE %s", from, strings.Join(clauses, " AND "))
 	}
-	dbQuery := fmt.Sprintf("SELECT info FROM %s %s ORDER BY info ->> 'name' ASC", dbutils.ChartTable, repoQuery)
-	charts, err := m.QueryAllCharts(dbQuery, queryParams...)
+	if !showDuplicates {
+		// Group by unique digest for the latest version (remove duplicates),
+		// keeping the first chart by name
+		digest := "COALESCE(info -> 'chartVersions' -> 0 ->> 'digest', ID::text)"
+		from = fmt.Sprintf("(SELECT DISTINCT ON (%s) chart_id, repo_namespace, repo_name, info FROM %s ORDER BY %s, info ->> 'name' ASC, chart_id ASC) AS charts", digest, from, digest)
+	}
+	return from, queryParams, nil
+}
+
+// pgChartTypeClause appends the clause selecting the charts whose latest
+// version is of the chart type, and its param
+func pgChartTypeClause(chartType string, queryParams []interface{}, clauses []string) ([]interface{}, []string) {
+	switch chartType {
+	case chartTypeApplication:
+		queryParams = append(queryParams, models.LibraryChartType)
+		clauses = append(clauses, fmt.Sprintf("COALESCE(info -> 'chartVersions' -> 0 ->> 'type', '') <> $%d", len(queryParams)))
+	case models.LibraryChartType:
+		queryParams = append(queryParams, models.LibraryChartType)
+		clauses = append(clauses, fmt.Sprintf("info -> 'chartVersions' -> 0 ->> 'type' = $%d", len(queryParams)))
+	}
+	return queryParams, clauses
+}
+
+func (m *postgresAssetManager) getPaginatedChartList(namespace string, filters chartFilters, pageNumber, pageSize int, showDuplicates bool, sort chartSort) ([]*models.Chart, int, error) {
+	from, queryParams, err := m.filteredCharts(namespace, filters, showDuplicates)
 	if err != nil {
-		return nil, 0, nil
+		return nil, 0, err
 	}
-	if !showDuplicates {
-		// Group by unique digest for the latest version (remove duplicates)
-		uniqueCharts := []*models.Chart{}
-		digests := []string{}
-		for _, c := range charts {
-			if len(c.ChartVersions) == 0 {
-				return nil, 0, fmt.Errorf("chart %q missing chart versions", c.ID)
-			}
-			if !exists(digests, c.ChartVersions[0].Digest) {
-				digests = append(digests, c.ChartVersions[0].Digest)
-				uniqueCharts = append(uniqueCharts, c)
-			}
+
+	totalPages := 1
+	pageQuery := ""
+	if pageSize != 0 {
+		var total int
+		err := m.GetDB().QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", from), queryParams...).Scan(&total)
+		if err != nil {
+			return nil, 0, err
 		}
-		// TODO(andresmgot): Implement pagination but currently Kubeapps don't support it
-		return uniqueCharts, 1, nil
+		var offset int
+		totalPages, offset = paginate(total, pageNumber, pageSize)
+		queryParams = append(queryParams, pageSize, offset)
+		pageQuery = fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(queryParams)-1, len(queryParams))
+	}
+
+	dbQuery := fmt.Sprintf("SELECT info FROM %s ORDER BY %s%s", from, pgChartOrder(sort), pageQuery)
+	charts, err := m.QueryAllCharts(dbQuery, queryParams...)
+	if err != nil {
+		return nil, 0, err
 	}
-	return charts, 1, nil
+	return charts, totalPages, nil
 }
 
-func (m *postgresAssetManager) getChart(namespace, chartID string) (models.Chart, error) {
-	var chart models.ChartIconString
-	err := m.QueryOne(&chart, fmt.Sprintf("SELECT info FROM %s WHERE repo_namespace = $1 AND chart_id = $2", dbutils.ChartTable), namespace, chartID)
+func (m *postgresAssetManager) getChartFacets(namespace string, filters chartFilters, showDuplicates bool) (chartFacets, error) {
+	facets := chartFacets{}
+	from, queryParams, err := m.filteredCharts(namespace, filters, showDuplicates)
 	if err != nil {
-		return models.Chart{}, err
+		return facets, err
+	}
+	rows, err := m.GetDB().Query(fmt.Sprintf(`WITH filtered AS (SELECT repo_name, info FROM %s)
+SELECT facet, value, COUNT(*) FROM (
+	SELECT 'keywords' AS facet, keyword AS value FROM filtered
+	CROSS JOIN LATERAL jsonb_array_elements_text(CASE WHEN jsonb_typeof(info -> 'keywords') = 'array' THEN info -> 'keywords' END) AS keyword
+	UNION ALL
+	SELECT 'maintainers', maintainer ->> 'name' FROM filtered
+	CROSS JOIN LATERAL jsonb_array_elements(CASE WHEN jsonb_typeof(info -> 'maintainers') = 'array' THEN info -> 'maintainers' END) AS maintainer
+	UNION ALL
+	SELECT 'categories', info ->> 'category' FROM filtered
+	UNION ALL
+	SELECT 'repos', repo_name FROM filtered
+) AS facets
+WHERE value <> ''
+GROUP BY facet, value
+ORDER BY facet, COUNT(*) DESC, value ASC`, from), queryParams...)
+	if rows != nil {
+		defer rows.Close()
+	}
+	if err != nil {
+		return facets, err
 	}
+	for rows.Next() {
+		var facet string
+		var fc facetCount
+		if err := rows.Scan(&facet, &fc.Value, &fc.Count); err != nil {
+			return facets, err
+		}
+		switch facet {
+		case "keywords":
+			facets.Keywords = append(facets.Keywords, fc)
+		case "maintainers":
+			facets.Maintainers = append(facets.Maintainers, fc)
+		case "categories":
+			facets.Categories = append(facets.Categories, fc)
+		case "repos":
+			facets.Repos = append(facets.Repos, fc)
+		}
+	}
+	return facets, rows.Err()
+}
 
-	// TODO(andresmgot): Store raw_icon as a byte array
-	icon, err := base64.StdEncoding.DecodeString(chart.RawIcon)
+func (m *postgresAssetManager) searchCharts(namespace, query, repo, chartType string, pageNumber, pageSize int) ([]*models.Chart, int, error) {
+	queryParams := []interface{}{query}
+	clauses := []string{"search @@ plainto_tsquery('english', $1)"}
+	if namespace != dbutils.AllNamespaces {
+		queryParams = append(queryParams, namespace, m.GetKubeappsNamespace())
+		clauses = append(clauses, fmt.Sprintf("(repo_namespace = $%d OR repo_namespace = $%d)", len(queryParams)-1, len(queryParams)))
+	}
+	if repo != "" {
+		queryParams = append(queryParams, repo)
+		clauses = append(clauses, fmt.Sprintf("repo_name = $%d", len(queryParams)))
+	}
+	queryParams, clauses = pgChartTypeClause(chartType, queryParams, clauses)
+	whereQuery := strings.Join(clauses, " AND ")
+
+	totalPages := 1
+	pageQuery := ""
+	if pageSize != 0 {
+		var total int
+		err := m.GetDB().QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", dbutils.ChartTable, whereQuery), queryParams...).Scan(&total)
+		if err != nil {
+			return nil, 0, err
+		}
+		var offset int
+		totalPages, offset = paginate(total, pageNumber, pageSize)
+		queryParams = append(queryParams, pageSize, offset)
+		pageQuery = fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(queryParams)-1, len(queryParams))
+	}
+
+	// Order by relevance, then by name
+	dbQuery := fmt.Sprintf("SELECT info FROM %s WHERE %s ORDER BY ts_rank(search, plainto_tsquery('english', $1)) DESC, info ->> 'name' ASC%s", dbutils.ChartTable, whereQuery, pageQuery)
+	charts, err := m.QueryAllCharts(dbQuery, queryParams...)
 	if err != nil {
-		return models.Chart{}, err
+		return nil, 0, err
 	}
-	return models.Chart{
-		ID:              chart.ID,
-		Name:            chart.Name,
-		Repo:            chart.Repo,
-		Description:     chart.Description,
-		Home:            chart.Home,
-		Keywords:        chart.Keywords,
-		Maintainers:     chart.Maintainers,
-		Sources:         chart.Sources,
-		Icon:            chart.Icon,
-		RawIcon:         icon,
-		IconContentType: chart.IconContentType,
-		ChartVersions:   chart.ChartVersions,
-	}, nil
+	return charts, totalPages, nil
+}
+
+func (m *postgresAssetManager) getChart(namespace, chartID string) (models.Chart, error) {
+	var chart models.Chart
+	err := m.QueryOne(&chart, fmt.Sprintf("SELECT info FROM %s WHERE repo_namespace = $1 AND chart_id = $2", dbutils.ChartTable), namespace, chartID)
+	return chart, err
+}
+
+// getChartVersions returns a chart with all its versions, or without its
+// prerelease versions, keeping the order of the index
+func (m *postgresAssetManager) getChartVersions(namespace, chartID string, prereleases bool) (models.Chart, error) {
+	if prereleases {
+		return m.getChart(namespace, chartID)
+	}
+	var chart models.Chart
+	query := fmt.Sprintf(`SELECT info || jsonb_build_object('chartVersions', COALESCE((
+		SELECT jsonb_agg(cv ORDER BY idx)
+		FROM jsonb_array_elements(info -> 'chartVersions') WITH ORDINALITY AS versions(cv, idx)
+		WHERE split_part(cv ->> 'version', '+', 1) NOT LIKE '%%-%%'
+	), '[]'::jsonb))
+	FROM %s WHERE repo_namespace = $1 AND chart_id = $2`, dbutils.ChartTable)
+	err := m.QueryOne(&chart, query, namespace, chartID)
+	return chart, err
+}
+
+func (m *postgresAssetManager) getChartIcon(namespace, chartID string) (models.ChartIcon, error) {
+	var icon models.ChartIcon
+	err := m.GetDB().QueryRow(fmt.Sprintf("SELECT content_type, digest, data FROM %s WHERE repo_namespace = $1 AND chart_id = $2", dbutils.IconTable), namespace, chartID).Scan(&icon.ContentType, &icon.Digest, &icon.Data)
+	return icon, err
 }
 
 func (m *postgresAssetManager) getChartVersion(namespace, chartID, version string) (models.Chart, error) {
@@ -171,3 +339,111 @@ func (m *postgresAssetManager) getChartsWithFilters(namespace, name, version, ap
 	}
 	return result, nil
 }
+
+func (m *postgresAssetManager) getDependentChartFiles(namespace, chartName string) ([]*models.ChartFiles, error) {
+	dependency, err := json.Marshal([]map[string]string{{"name": chartName}})
+	if err != nil {
+		return nil, err
+	}
+	queryParams := []interface{}{string(dependency)}
+	namespaceQuery := ""
+	if namespace != dbutils.AllNamespaces {
+		queryParams = append(queryParams, namespace, m.GetKubeappsNamespace())
+		namespaceQuery = " AND (repo_namespace = $2 OR repo_namespace = $3)"
+	}
+	return m.QueryAllChartFiles(fmt.Sprintf("SELECT info FROM %s WHERE info -> 'Dependencies' @> $1::jsonb%s", dbutils.ChartFilesTable, namespaceQuery), queryParams...)
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (m *postgresAssetManager) getChartFilesWithImage(namespace, image string) ([]*models.ChartFiles, error) {
+	// Image references don't contain characters escaped in JSON strings so it's
+	// enough to look for the image in the text representation of the list.
+	queryParams := []interface{}{"%" + likeEscaper.Replace(image) + "%"}
+	namespaceQuery := ""
+	if namespace != dbutils.AllNamespaces {
+		queryParams = append(queryParams, namespace, m.GetKubeappsNamespace())
+		namespaceQuery = " AND (repo_namespace = $2 OR repo_namespace = $3)"
+	}
+	return m.QueryAllChartFiles(fmt.Sprintf("SELECT info FROM %s WHERE info ->> 'Images' LIKE $1%s", dbutils.ChartFilesTable, namespaceQuery), queryParams...)
+}
+
+func (m *postgresAssetManager) getSyncReports(namespace, repo string, limit int) ([]*models.SyncReport, error) {
+	return m.QueryAllSyncReports(
+		fmt.Sprintf("SELECT info FROM %s WHERE repo_namespace = $1 AND repo_name = $2 ORDER BY ID DESC LIMIT $3", dbutils.SyncReportTable),
+		namespace, repo, limit,
+	)
+}
+
+// getRepoSummaries returns the synced repositories of a namespace, or the
+// given one, with their number of charts and chart versions. The URL of a repo
+// is not stored with its last sync so it is taken from its charts or, if it
+// has none, from its latest sync report.
+func (m *postgresAssetManager) getRepoSummaries(namespace, repo string) ([]*repoSummary, error) {
+	query := fmt.Sprintf(`SELECT r.namespace, r.name, COALESCE(r.checksum, ''), COALESCE(r.last_update, ''),
+		COALESCE(c.url, (
+			SELECT s.info -> 'repo' ->> 'url' FROM %s s
+			WHERE s.repo_namespace = r.namespace AND s.repo_name = r.name ORDER BY s.ID DESC LIMIT 1
+		), ''),
+		c.charts, c.versions
+	FROM %s r
+	CROSS JOIN LATERAL (
+		SELECT MAX(info -> 'repo' ->> 'url') AS url, COUNT(*) AS charts,
+			COALESCE(SUM(CASE WHEN jsonb_typeof(info -> 'chartVersions') = 'array' THEN jsonb_array_length(info -> 'chartVersions') ELSE 0 END), 0) AS versions
+		FROM %s WHERE repo_namespace = r.namespace AND repo_name = r.name
+	) c
+	WHERE r.namespace = $1`, dbutils.SyncReportTable, dbutils.RepositoryTable, dbutils.ChartTable)
+	queryParams := []interface{}{namespace}
+	if repo != "" {
+		queryParams = append(queryParams, repo)
+		query += " AND r.name = $2"
+	}
+	query += " ORDER BY r.name"
+
+	rows, err := m.GetDB().Query(query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	repos := []*repoSummary{}
+	for rows.Next() {
+		var r repoSummary
+		var lastUpdate string
+		if err := rows.Scan(&r.Namespace, &r.Name, &r.Checksum, &lastUpdate, &r.URL, &r.ChartCount, &r.VersionCount); err != nil {
+			return nil, err
+		}
+		if lastUpdate != "" {
+			if r.LastUpdate, err = parseLastUpdate(lastUpdate); err != nil {
+				return nil, err
+			}
+		}
+		repos = append(repos, &r)
+	}
+	return repos, rows.Err()
+}
+
+// parseLastUpdate parses the last update of a repo, which the asset-syncer
+// stores in the format of time.Time.String, possibly with a monotonic clock
+// reading
+func parseLastUpdate(lastUpdate string) (time.Time, error) {
+	if i := strings.Index(lastUpdate, " m="); i >= 0 {
+		lastUpdate = lastUpdate[:i]
+	}
+	return time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", lastUpdate)
+}
+
+// getCatalogVersion returns a digest of the checksum and last update of every
+// repository, which changes every time a repository is synced
+func (m *postgresAssetManager) getCatalogVersion() (string, error) {
+	var version string
+	err := m.GetDB().QueryRow(fmt.Sprintf(
+		"SELECT md5(COALESCE(string_agg(namespace || '/' || name || ':' || COALESCE(checksum, '') || ':' || COALESCE(last_update, ''), ',' ORDER BY namespace, name), '')) FROM %s",
+		dbutils.RepositoryTable)).Scan(&version)
+	return version, err
+}
+
+// tarballStore returns the store of the tarballs mirrored in the database
+func (m *postgresAssetManager) tarballStore() blobstore.Store {
+	return dbutils.PostgresTarballStore{DB: m.GetDB()}
+}
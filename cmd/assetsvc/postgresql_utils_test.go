@@ -17,10 +17,12 @@ limitations under the License.
 package main
 
 import (
-	"encoding/base64"
+	"database/sql/driver"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/go-cmp/cmp"
 	"github.com/kubeapps/common/datastore"
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
@@ -52,6 +54,20 @@ func (f *fakePGManager) QueryAllCharts(query string, args ...interface{}) ([]*mo
 	return chartsResponse, nil
 }
 
+var chartFilesResponse []*models.ChartFiles
+
+func (f *fakePGManager) QueryAllChartFiles(query string, args ...interface{}) ([]*models.ChartFiles, error) {
+	f.Called(query, args)
+	return chartFilesResponse, nil
+}
+
+var syncReportsResponse []*models.SyncReport
+
+func (f *fakePGManager) QueryAllSyncReports(query string, args ...interface{}) ([]*models.SyncReport, error) {
+	f.Called(query, args)
+	return syncReportsResponse, nil
+}
+
 func (f *fakePGManager) InvalidateCache() error {
 	return nil
 }
@@ -60,6 +76,10 @@ func (f *fakePGManager) InitTables() error {
 	return nil
 }
 
+func (f *fakePGManager) CheckSchemaVersion() error {
+	return nil
+}
+
 func (f *fakePGManager) EnsureRepoExists(namespace, name string) (int, error) {
 	return 0, nil
 }
@@ -72,6 +92,20 @@ func (f *fakePGManager) GetKubeappsNamespace() string {
 	return "kubeapps"
 }
 
+// newSQLMockManager returns a manager using a mocked database
+func newSQLMockManager(t *testing.T) (postgresAssetManager, sqlmock.Sqlmock) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	pgManager, err := dbutils.NewPGManager(datastore.Config{URL: "localhost:5432"}, "kubeapps")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	pgManager.DB = db
+	return postgresAssetManager{pgManager}, sqlMock
+}
+
 func Test_NewPGManager(t *testing.T) {
 	config := datastore.Config{URL: "10.11.12.13:5432"}
 	_, err := newPGManager(config, "kubeapps")
@@ -85,26 +119,203 @@ func Test_PGgetChart(t *testing.T) {
 	fpg := &fakePGManager{m}
 	pg := postgresAssetManager{fpg}
 
-	icon := []byte("test")
-	iconB64 := base64.StdEncoding.EncodeToString(icon)
-	dbChart := models.ChartIconString{
-		Chart:   models.Chart{ID: "foo"},
-		RawIcon: iconB64,
-	}
-	m.On("QueryOne", &models.ChartIconString{}, "SELECT info FROM charts WHERE repo_namespace = $1 AND chart_id = $2", []interface{}{"namespace", "foo"}).Run(func(args mock.Arguments) {
-		*args.Get(0).(*models.ChartIconString) = dbChart
+	dbChart := models.Chart{ID: "foo", IconContentType: "image/png"}
+	m.On("QueryOne", &models.Chart{}, "SELECT info FROM charts WHERE repo_namespace = $1 AND chart_id = $2", []interface{}{"namespace", "foo"}).Run(func(args mock.Arguments) {
+		*args.Get(0).(*models.Chart) = dbChart
 	})
 
 	chart, err := pg.getChart("namespace", "foo")
 	if err != nil {
 		t.Errorf("Found error %v", err)
 	}
-	expectedChart := models.Chart{
-		ID:      "foo",
-		RawIcon: icon,
+	if !cmp.Equal(chart, dbChart) {
+		t.Errorf("Unexpected result %v", cmp.Diff(chart, dbChart))
 	}
-	if !cmp.Equal(chart, expectedChart) {
-		t.Errorf("Unexpected result %v", cmp.Diff(chart, expectedChart))
+}
+
+func Test_PGsearchCharts(t *testing.T) {
+	tests := []struct {
+		name               string
+		namespace          string
+		repo               string
+		chartType          string
+		pageNumber         int
+		pageSize           int
+		total              int
+		expectedCountQuery string
+		expectedQuery      string
+		expectedArgs       []driver.Value
+		expectedTotalPages int
+	}{
+		{
+			name:               "it searches the charts of every namespace",
+			namespace:          dbutils.AllNamespaces,
+			expectedQuery:      `^SELECT info FROM charts WHERE search @@ plainto_tsquery\('english', \$1\) ORDER BY ts_rank\(search, plainto_tsquery\('english', \$1\)\) DESC, info ->> 'name' ASC$`,
+			expectedArgs:       []driver.Value{"wordpress"},
+			expectedTotalPages: 1,
+		},
+		{
+			name:               "it searches a page of the charts of a repo",
+			namespace:          "namespace",
+			repo:               "stable",
+			pageNumber:         2,
+			pageSize:           10,
+			total:              25,
+			expectedCountQuery: `^SELECT COUNT\(\*\) FROM charts WHERE search @@ plainto_tsquery\('english', \$1\) AND \(repo_namespace = \$2 OR repo_namespace = \$3\) AND repo_name = \$4$`,
+			expectedQuery:      `^SELECT info FROM charts WHERE search @@ plainto_tsquery\('english', \$1\) AND \(repo_namespace = \$2 OR repo_namespace = \$3\) AND repo_name = \$4 ORDER BY ts_rank\(search, plainto_tsquery\('english', \$1\)\) DESC, info ->> 'name' ASC LIMIT \$5 OFFSET \$6$`,
+			expectedArgs:       []driver.Value{"wordpress", "namespace", "kubeapps", "stable", 10, 10},
+			expectedTotalPages: 3,
+		},
+		{
+			name:               "it returns the last page if the page is out of range",
+			namespace:          dbutils.AllNamespaces,
+			pageNumber:         5,
+			pageSize:           10,
+			total:              15,
+			expectedCountQuery: `^SELECT COUNT\(\*\) FROM charts WHERE search @@ plainto_tsquery\('english', \$1\)$`,
+			expectedQuery:      `LIMIT \$2 OFFSET \$3$`,
+			expectedArgs:       []driver.Value{"wordpress", 10, 10},
+			expectedTotalPages: 2,
+		},
+		{
+			name:               "it searches the application charts",
+			namespace:          dbutils.AllNamespaces,
+			chartType:          chartTypeApplication,
+			expectedQuery:      `^SELECT info FROM charts WHERE search @@ plainto_tsquery\('english', \$1\) AND COALESCE\(info -> 'chartVersions' -> 0 ->> 'type', ''\) <> \$2 ORDER BY`,
+			expectedArgs:       []driver.Value{"wordpress", "library"},
+			expectedTotalPages: 1,
+		},
+		{
+			name:               "it searches the library charts of a repo",
+			namespace:          dbutils.AllNamespaces,
+			repo:               "stable",
+			chartType:          models.LibraryChartType,
+			expectedQuery:      `^SELECT info FROM charts WHERE search @@ plainto_tsquery\('english', \$1\) AND repo_name = \$2 AND info -> 'chartVersions' -> 0 ->> 'type' = \$3 ORDER BY`,
+			expectedArgs:       []driver.Value{"wordpress", "stable", "library"},
+			expectedTotalPages: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pg, sqlMock := newSQLMockManager(t)
+
+			if tt.expectedCountQuery != "" {
+				sqlMock.ExpectQuery(tt.expectedCountQuery).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.total))
+			}
+			sqlMock.ExpectQuery(tt.expectedQuery).WithArgs(tt.expectedArgs...).
+				WillReturnRows(sqlmock.NewRows([]string{"info"}).AddRow(`{"ID": "stable/wordpress"}`))
+
+			charts, totalPages, err := pg.searchCharts(tt.namespace, "wordpress", tt.repo, tt.chartType, tt.pageNumber, tt.pageSize)
+			if err != nil {
+				t.Fatalf("Found error %v", err)
+			}
+			expectedCharts := []*models.Chart{{ID: "stable/wordpress"}}
+			if !cmp.Equal(charts, expectedCharts) {
+				t.Errorf("Unexpected result %v", cmp.Diff(charts, expectedCharts))
+			}
+			if totalPages != tt.expectedTotalPages {
+				t.Errorf("got %d pages, want %d", totalPages, tt.expectedTotalPages)
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_PGgetChartIcon(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	pg := postgresAssetManager{&dbutils.PostgresAssetManager{DB: db}}
+
+	expectedIcon := models.ChartIcon{Data: []byte("icon"), ContentType: "image/png", Digest: "abc"}
+	sqlMock.ExpectQuery(`^SELECT content_type, digest, data FROM icons WHERE repo_namespace = \$1 AND chart_id = \$2$`).
+		WithArgs("namespace", "foo").
+		WillReturnRows(sqlmock.NewRows([]string{"content_type", "digest", "data"}).AddRow(expectedIcon.ContentType, expectedIcon.Digest, expectedIcon.Data))
+
+	icon, err := pg.getChartIcon("namespace", "foo")
+	if err != nil {
+		t.Errorf("Found error %v", err)
+	}
+	if !cmp.Equal(icon, expectedIcon) {
+		t.Errorf("Unexpected result %v", cmp.Diff(icon, expectedIcon))
+	}
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_PGgetCatalogVersion(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	pg := postgresAssetManager{&dbutils.PostgresAssetManager{DB: db}}
+
+	sqlMock.ExpectQuery(`^SELECT md5\(.*\) FROM repos$`).
+		WillReturnRows(sqlmock.NewRows([]string{"md5"}).AddRow("abc"))
+
+	version, err := pg.getCatalogVersion()
+	if err != nil {
+		t.Errorf("Found error %v", err)
+	}
+	if version != "abc" {
+		t.Errorf("Expecting version abc, got %s", version)
+	}
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_PGgetRepoSummaries(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	pg := postgresAssetManager{&dbutils.PostgresAssetManager{DB: db}}
+
+	lastUpdate := time.Date(2020, 6, 1, 10, 30, 0, 0, time.UTC)
+	sqlMock.ExpectQuery(`FROM repos r .* WHERE r.namespace = \$1 AND r.name = \$2 ORDER BY r.name$`).
+		WithArgs("kubeapps", "bitnami").
+		WillReturnRows(sqlmock.NewRows([]string{"namespace", "name", "checksum", "last_update", "url", "charts", "versions"}).
+			AddRow("kubeapps", "bitnami", "abc", lastUpdate.String()+" m=+12.345", "https://charts.bitnami.com/bitnami", 2, 5))
+
+	repos, err := pg.getRepoSummaries("kubeapps", "bitnami")
+	if err != nil {
+		t.Fatalf("Found error %v", err)
+	}
+	expected := []*repoSummary{{
+		Namespace:    "kubeapps",
+		Name:         "bitnami",
+		URL:          "https://charts.bitnami.com/bitnami",
+		LastUpdate:   lastUpdate,
+		Checksum:     "abc",
+		ChartCount:   2,
+		VersionCount: 5,
+	}}
+	if !cmp.Equal(repos, expected) {
+		t.Errorf("Unexpected result %v", cmp.Diff(expected, repos))
+	}
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_parseLastUpdate(t *testing.T) {
+	now := time.Now()
+	got, err := parseLastUpdate(now.String())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !got.Equal(now) {
+		t.Errorf("Expecting %v, got %v", now, got)
+	}
+	if _, err := parseLastUpdate("yesterday"); err == nil {
+		t.Errorf("Expecting an error parsing an invalid date")
 	}
 }
 
@@ -190,68 +401,269 @@ func Test_getChartWithFilters(t *testing.T) {
 }
 
 func Test_getPaginatedChartList(t *testing.T) {
-	availableCharts := []*models.Chart{
-		{ID: "foo", ChartVersions: []models.ChartVersion{{Digest: "123"}}},
-		{ID: "bar", ChartVersions: []models.ChartVersion{{Digest: "456"}}},
-		{ID: "copyFoo", ChartVersions: []models.ChartVersion{{Digest: "123"}}},
-	}
+	const dedupedCharts = `\(SELECT DISTINCT ON \(COALESCE\(info -> 'chartVersions' -> 0 ->> 'digest', ID::text\)\) chart_id, repo_namespace, repo_name, info FROM charts WHERE \(repo_namespace = \$1 OR repo_namespace = \$2\) ORDER BY COALESCE\(info -> 'chartVersions' -> 0 ->> 'digest', ID::text\), info ->> 'name' ASC, chart_id ASC\) AS charts`
 	tests := []struct {
 		name               string
 		namespace          string
-		repo               string
+		filters            chartFilters
 		pageNumber         int
 		pageSize           int
 		showDuplicates     bool
-		expectedCharts     []*models.Chart
+		sort               chartSort
+		total              int
+		expectedCountQuery string
+		expectedQuery      string
+		expectedArgs       []driver.Value
 		expectedTotalPages int
 	}{
 		{
-			name:               "one page with duplicates with repo",
+			name:               "all charts of a repo with duplicates",
+			namespace:          "other-namespace",
+			filters:            chartFilters{repos: []string{"bitnami"}},
+			showDuplicates:     true,
+			sort:               chartSort{field: sortByName},
+			expectedQuery:      `^SELECT info FROM charts WHERE \(repo_namespace = \$1 OR repo_namespace = \$2\) AND repo_name = \$3 ORDER BY info ->> 'name' ASC, chart_id ASC, repo_namespace ASC$`,
+			expectedArgs:       []driver.Value{"other-namespace", "kubeapps", "bitnami"},
+			expectedTotalPages: 1,
+		},
+		{
+			name:               "all charts of every namespace",
+			namespace:          dbutils.AllNamespaces,
+			showDuplicates:     true,
+			sort:               chartSort{field: sortByCreated},
+			expectedQuery:      `^SELECT info FROM charts ORDER BY \(info -> 'chartVersions' -> -1 ->> 'created'\)::timestamptz ASC, chart_id ASC, repo_namespace ASC$`,
+			expectedArgs:       []driver.Value{},
+			expectedTotalPages: 1,
+		},
+		{
+			name:               "a page without duplicates",
 			namespace:          "other-namespace",
-			repo:               "bitnami",
-			pageNumber:         1,
-			pageSize:           100,
+			pageNumber:         2,
+			pageSize:           10,
+			sort:               chartSort{field: sortByUpdated, descending: true},
+			total:              15,
+			expectedCountQuery: `^SELECT COUNT\(\*\) FROM ` + dedupedCharts + `$`,
+			expectedQuery:      `^SELECT info FROM ` + dedupedCharts + ` ORDER BY \(info -> 'chartVersions' -> 0 ->> 'created'\)::timestamptz DESC NULLS LAST, chart_id ASC, repo_namespace ASC LIMIT \$3 OFFSET \$4$`,
+			expectedArgs:       []driver.Value{"other-namespace", "kubeapps", 10, 10},
+			expectedTotalPages: 2,
+		},
+		{
+			name:      "charts matching every filter",
+			namespace: "other-namespace",
+			filters: chartFilters{
+				repos:      []string{"stable", "bitnami"},
+				keyword:    "cms",
+				maintainer: "bitnami-bot",
+				category:   "CMS",
+				appVersion: "4_9",
+			},
+			showDuplicates:     true,
+			sort:               chartSort{field: sortByName},
+			expectedQuery:      `^SELECT info FROM charts WHERE \(repo_namespace = \$1 OR repo_namespace = \$2\) AND repo_name = ANY\(\$3\) AND info -> 'keywords' \? \$4 AND info -> 'maintainers' @> \$5::jsonb AND info ->> 'category' = \$6 AND info -> 'chartVersions' -> 0 ->> 'app_version' LIKE \$7 ORDER BY`,
+			expectedArgs:       []driver.Value{"other-namespace", "kubeapps", `{"stable","bitnami"}`, "cms", `[{"name":"bitnami-bot"}]`, "CMS", `4\_9%`},
+			expectedTotalPages: 1,
+		},
+		{
+			name:      "application charts with annotations",
+			namespace: "other-namespace",
+			filters: chartFilters{
+				chartType:   chartTypeApplication,
+				annotations: map[string]string{"category": "CMS"},
+			},
 			showDuplicates:     true,
-			expectedCharts:     availableCharts,
+			sort:               chartSort{field: sortByName},
+			expectedQuery:      `^SELECT info FROM charts WHERE \(repo_namespace = \$1 OR repo_namespace = \$2\) AND COALESCE\(info -> 'chartVersions' -> 0 ->> 'type', ''\) <> \$3 AND info -> 'chartVersions' -> 0 -> 'annotations' @> \$4::jsonb ORDER BY`,
+			expectedArgs:       []driver.Value{"other-namespace", "kubeapps", "library", `{"category":"CMS"}`},
 			expectedTotalPages: 1,
 		},
 		{
-			name:               "one page withuot duplicates",
+			name:               "library charts",
 			namespace:          "other-namespace",
-			repo:               "",
-			pageNumber:         1,
-			pageSize:           100,
-			showDuplicates:     false,
-			expectedCharts:     []*models.Chart{availableCharts[0], availableCharts[1]},
+			filters:            chartFilters{chartType: models.LibraryChartType},
+			showDuplicates:     true,
+			sort:               chartSort{field: sortByName},
+			expectedQuery:      `^SELECT info FROM charts WHERE \(repo_namespace = \$1 OR repo_namespace = \$2\) AND info -> 'chartVersions' -> 0 ->> 'type' = \$3 ORDER BY`,
+			expectedArgs:       []driver.Value{"other-namespace", "kubeapps", "library"},
 			expectedTotalPages: 1,
 		},
-		// TODO(andresmgot): several pages
+		{
+			name:               "a page out of range",
+			namespace:          "other-namespace",
+			pageNumber:         3,
+			pageSize:           10,
+			sort:               chartSort{field: sortByName},
+			total:              15,
+			expectedCountQuery: `^SELECT COUNT\(\*\) FROM ` + dedupedCharts + `$`,
+			expectedQuery:      `LIMIT \$3 OFFSET \$4$`,
+			expectedArgs:       []driver.Value{"other-namespace", "kubeapps", 10, 10},
+			expectedTotalPages: 2,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			m := &mock.Mock{}
-			fpg := &fakePGManager{m}
-			pg := postgresAssetManager{fpg}
+			pg, sqlMock := newSQLMockManager(t)
 
-			chartsResponse = availableCharts
-			expectedQuery := "WHERE (repo_namespace = $1 OR repo_namespace = $2)"
-			expectedParams := []interface{}{"other-namespace", "kubeapps"}
-			if tt.repo != "" {
-				expectedQuery = expectedQuery + " AND repo_name = $3"
-				expectedParams = append(expectedParams, "bitnami")
+			if tt.expectedCountQuery != "" {
+				sqlMock.ExpectQuery(tt.expectedCountQuery).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.total))
 			}
-			expectedQuery = fmt.Sprintf("SELECT info FROM %s %s ORDER BY info ->> 'name' ASC", dbutils.ChartTable, expectedQuery)
-			m.On("QueryAllCharts", expectedQuery, expectedParams)
-			charts, totalPages, err := pg.getPaginatedChartList(tt.namespace, tt.repo, tt.pageNumber, tt.pageSize, tt.showDuplicates)
+			sqlMock.ExpectQuery(tt.expectedQuery).WithArgs(tt.expectedArgs...).
+				WillReturnRows(sqlmock.NewRows([]string{"info"}).AddRow(`{"ID": "foo"}`))
+
+			charts, totalPages, err := pg.getPaginatedChartList(tt.namespace, tt.filters, tt.pageNumber, tt.pageSize, tt.showDuplicates, tt.sort)
 			if err != nil {
 				t.Errorf("Found error %v", err)
 			}
 			if totalPages != tt.expectedTotalPages {
 				t.Errorf("Unexpected number of pages, got %d expecting %d", totalPages, tt.expectedTotalPages)
 			}
-			if !cmp.Equal(charts, tt.expectedCharts) {
-				t.Errorf("Unexpected result %v", cmp.Diff(charts, tt.expectedCharts))
+			expectedCharts := []*models.Chart{{ID: "foo"}}
+			if !cmp.Equal(charts, expectedCharts) {
+				t.Errorf("Unexpected result %v", cmp.Diff(charts, expectedCharts))
+			}
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
 			}
 		})
 	}
 }
+
+func Test_PGgetChartFacets(t *testing.T) {
+	pg, sqlMock := newSQLMockManager(t)
+	sqlMock.ExpectQuery(`^WITH filtered AS \(SELECT repo_name, info FROM charts WHERE \(repo_namespace = \$1 OR repo_namespace = \$2\) AND info ->> 'category' = \$3\)`).
+		WithArgs("namespace", "kubeapps", "CMS").
+		WillReturnRows(sqlmock.NewRows([]string{"facet", "value", "count"}).
+			AddRow("categories", "CMS", 2).
+			AddRow("keywords", "cms", 2).
+			AddRow("keywords", "blog", 1).
+			AddRow("repos", "stable", 2))
+
+	facets, err := pg.getChartFacets("namespace", chartFilters{category: "CMS"}, true)
+	if err != nil {
+		t.Fatalf("Found error %v", err)
+	}
+	expectedFacets := chartFacets{
+		Keywords:   []facetCount{{Value: "cms", Count: 2}, {Value: "blog", Count: 1}},
+		Categories: []facetCount{{Value: "CMS", Count: 2}},
+		Repos:      []facetCount{{Value: "stable", Count: 2}},
+	}
+	if !cmp.Equal(facets, expectedFacets) {
+		t.Errorf("Unexpected result %v", cmp.Diff(facets, expectedFacets))
+	}
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_getPaginatedChartListError(t *testing.T) {
+	pg, sqlMock := newSQLMockManager(t)
+	sqlMock.ExpectQuery("^SELECT info FROM charts").WillReturnError(fmt.Errorf("connection lost"))
+
+	_, _, err := pg.getPaginatedChartList(dbutils.AllNamespaces, chartFilters{}, 1, 0, true, chartSort{field: sortByName})
+	if err == nil || err.Error() != "connection lost" {
+		t.Errorf("got: %v, want the query error", err)
+	}
+}
+
+func Test_PGgetDependentChartFiles(t *testing.T) {
+	tests := []struct {
+		name           string
+		namespace      string
+		expectedQuery  string
+		expectedParams []interface{}
+	}{
+		{
+			name:           "in a namespace",
+			namespace:      "other-namespace",
+			expectedQuery:  "SELECT info FROM files WHERE info -> 'Dependencies' @> $1::jsonb AND (repo_namespace = $2 OR repo_namespace = $3)",
+			expectedParams: []interface{}{`[{"name":"mariadb"}]`, "other-namespace", "kubeapps"},
+		},
+		{
+			name:           "in all namespaces",
+			namespace:      dbutils.AllNamespaces,
+			expectedQuery:  "SELECT info FROM files WHERE info -> 'Dependencies' @> $1::jsonb",
+			expectedParams: []interface{}{`[{"name":"mariadb"}]`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mock.Mock{}
+			fpg := &fakePGManager{m}
+			pg := postgresAssetManager{fpg}
+
+			chartFilesResponse = []*models.ChartFiles{{ID: "stable/wordpress-1.0.0", Dependencies: []models.ChartDependency{{Name: "mariadb"}}}}
+			m.On("QueryAllChartFiles", tt.expectedQuery, tt.expectedParams)
+
+			files, err := pg.getDependentChartFiles(tt.namespace, "mariadb")
+			if err != nil {
+				t.Errorf("Found error %v", err)
+			}
+			m.AssertExpectations(t)
+			if !cmp.Equal(files, chartFilesResponse) {
+				t.Errorf("Unexpected result %v", cmp.Diff(files, chartFilesResponse))
+			}
+		})
+	}
+}
+
+func Test_PGgetChartFilesWithImage(t *testing.T) {
+	tests := []struct {
+		name           string
+		namespace      string
+		image          string
+		expectedQuery  string
+		expectedParams []interface{}
+	}{
+		{
+			name:           "in a namespace",
+			namespace:      "other-namespace",
+			image:          "bitnami/nginx",
+			expectedQuery:  "SELECT info FROM files WHERE info ->> 'Images' LIKE $1 AND (repo_namespace = $2 OR repo_namespace = $3)",
+			expectedParams: []interface{}{"%bitnami/nginx%", "other-namespace", "kubeapps"},
+		},
+		{
+			name:           "in all namespaces escaping wildcards",
+			namespace:      dbutils.AllNamespaces,
+			image:          "my_image:100%",
+			expectedQuery:  "SELECT info FROM files WHERE info ->> 'Images' LIKE $1",
+			expectedParams: []interface{}{`%my\_image:100\%%`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mock.Mock{}
+			fpg := &fakePGManager{m}
+			pg := postgresAssetManager{fpg}
+
+			chartFilesResponse = []*models.ChartFiles{{ID: "stable/wordpress-1.0.0", Images: []string{"bitnami/nginx:1.17.8"}}}
+			m.On("QueryAllChartFiles", tt.expectedQuery, tt.expectedParams)
+
+			files, err := pg.getChartFilesWithImage(tt.namespace, tt.image)
+			if err != nil {
+				t.Errorf("Found error %v", err)
+			}
+			m.AssertExpectations(t)
+			if !cmp.Equal(files, chartFilesResponse) {
+				t.Errorf("Unexpected result %v", cmp.Diff(files, chartFilesResponse))
+			}
+		})
+	}
+}
+
+func Test_PGgetSyncReports(t *testing.T) {
+	m := &mock.Mock{}
+	fpg := &fakePGManager{m}
+	pg := postgresAssetManager{fpg}
+
+	syncReportsResponse = []*models.SyncReport{{Repo: &models.Repo{Namespace: "default", Name: "stable"}, Checksum: "123"}}
+	m.On("QueryAllSyncReports", "SELECT info FROM sync_reports WHERE repo_namespace = $1 AND repo_name = $2 ORDER BY ID DESC LIMIT $3", []interface{}{"default", "stable", 5})
+
+	reports, err := pg.getSyncReports("default", "stable", 5)
+	if err != nil {
+		t.Errorf("Found error %v", err)
+	}
+	m.AssertExpectations(t)
+	if !cmp.Equal(reports, syncReportsResponse) {
+		t.Errorf("Unexpected result %v", cmp.Diff(reports, syncReportsResponse))
+	}
+}
@@ -18,19 +18,113 @@ package main
 
 import (
 	"fmt"
+	"math"
+	"time"
 
 	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
 )
 
 type assetManager interface {
 	Init() error
 	Close() error
-	getPaginatedChartList(namespace, repo string, pageNumber, pageSize int, showDuplicates bool) ([]*models.Chart, int, error)
+	getPaginatedChartList(namespace string, filters chartFilters, pageNumber, pageSize int, showDuplicates bool, sort chartSort) ([]*models.Chart, int, error)
+	getChartFacets(namespace string, filters chartFilters, showDuplicates bool) (chartFacets, error)
+	searchCharts(namespace, query, repo, chartType string, pageNumber, pageSize int) ([]*models.Chart, int, error)
 	getChart(namespace, chartID string) (models.Chart, error)
+	getChartVersions(namespace, chartID string, prereleases bool) (models.Chart, error)
+	getChartIcon(namespace, chartID string) (models.ChartIcon, error)
 	getChartVersion(namespace, chartID, version string) (models.Chart, error)
 	getChartFiles(namespace, filesID string) (models.ChartFiles, error)
 	getChartsWithFilters(namespace, name, version, appVersion string) ([]*models.Chart, error)
+	getDependentChartFiles(namespace, chartName string) ([]*models.ChartFiles, error)
+	getChartFilesWithImage(namespace, image string) ([]*models.ChartFiles, error)
+	getSyncReports(namespace, repo string, limit int) ([]*models.SyncReport, error)
+	getRepoSummaries(namespace, repo string) ([]*repoSummary, error)
+	getCatalogVersion() (string, error)
+	tarballStore() blobstore.Store
+}
+
+// Fields charts can be sorted by
+const (
+	// sortByName sorts charts by their name
+	sortByName = "name"
+	// sortByUpdated sorts charts by the creation date of their latest version
+	sortByUpdated = "updated"
+	// sortByCreated sorts charts by the creation date of their first version
+	sortByCreated = "created"
+)
+
+// chartSort is the order of a list of charts
+type chartSort struct {
+	field      string
+	descending bool
+}
+
+// Types of the charts of a list besides models.LibraryChartType
+const (
+	// chartTypeApplication selects the charts which can be installed, the
+	// charts without a type are applications
+	chartTypeApplication = "application"
+	// chartTypeAll selects the charts of every type
+	chartTypeAll = "all"
+)
+
+// chartFilters are the conditions the charts of a list must match, empty
+// conditions match every chart
+type chartFilters struct {
+	repos      []string
+	keyword    string
+	maintainer string
+	category   string
+	// appVersion is a prefix of the app version of the latest chart version
+	appVersion string
+	// chartType is the type of the latest chart version, either
+	// chartTypeApplication or models.LibraryChartType
+	chartType string
+	// annotations are annotations of the latest chart version
+	annotations map[string]string
+}
+
+// facetCount is the number of charts with a value of a facet
+type facetCount struct {
+	Value string `json:"value" bson:"_id"`
+	Count int    `json:"count" bson:"count"`
+}
+
+// chartFacets are the values found in a list of charts with their number
+// of charts, ordered from the most common value
+type chartFacets struct {
+	Keywords    []facetCount `json:"keywords" bson:"keywords"`
+	Maintainers []facetCount `json:"maintainers" bson:"maintainers"`
+	Categories  []facetCount `json:"categories" bson:"categories"`
+	Repos       []facetCount `json:"repos" bson:"repos"`
+}
+
+// repoSummary is a repository of the catalog with its last sync and the
+// number of charts and chart versions imported
+type repoSummary struct {
+	Namespace    string    `json:"namespace"`
+	Name         string    `json:"name"`
+	URL          string    `json:"url"`
+	LastUpdate   time.Time `json:"lastUpdate"`
+	Checksum     string    `json:"checksum"`
+	ChartCount   int       `json:"chartCount"`
+	VersionCount int       `json:"versionCount"`
+}
+
+// paginate returns the number of pages of a list of total items and the
+// offset of the given page. Pages out of range return the last page.
+func paginate(total, pageNumber, pageSize int) (int, int) {
+	totalPages := int(math.Ceil(float64(total) / float64(pageSize)))
+	if pageNumber > totalPages {
+		pageNumber = totalPages
+	}
+	if pageNumber < 1 {
+		pageNumber = 1
+	}
+	return totalPages, pageSize * (pageNumber - 1)
 }
 
 func newManager(databaseType string, config datastore.Config, kubeappsNamespace string) (assetManager, error) {
@@ -38,6 +132,8 @@ func newManager(databaseType string, config datastore.Config, kubeappsNamespace
 		return newMongoDBManager(config, kubeappsNamespace), nil
 	} else if databaseType == "postgresql" {
 		return newPGManager(config, kubeappsNamespace)
+	} else if databaseType == "memory" {
+		return newMemoryManager(config, kubeappsNamespace), nil
 	} else {
 		return nil, fmt.Errorf("Unsupported database type %s", databaseType)
 	}
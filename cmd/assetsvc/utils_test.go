@@ -0,0 +1,44 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import "testing"
+
+func Test_paginate(t *testing.T) {
+	tests := []struct {
+		name               string
+		total              int
+		pageNumber         int
+		expectedTotalPages int
+		expectedOffset     int
+	}{
+		{"first page", 25, 1, 3, 0},
+		{"middle page", 25, 2, 3, 10},
+		{"page out of range", 25, 7, 3, 20},
+		{"invalid page", 25, 0, 3, 0},
+		{"no items", 0, 1, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			totalPages, offset := paginate(tt.total, tt.pageNumber, 10)
+			if totalPages != tt.expectedTotalPages || offset != tt.expectedOffset {
+				t.Errorf("got %d pages and offset %d, want %d pages and offset %d", totalPages, offset, tt.expectedTotalPages, tt.expectedOffset)
+			}
+		})
+	}
+}
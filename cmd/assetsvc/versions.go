@@ -0,0 +1,177 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/Masterminds/semver"
+	"github.com/kubeapps/common/response"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/kubeapps/kubeapps/pkg/kubeversion"
+	log "github.com/sirupsen/logrus"
+)
+
+// includePrereleases returns false if the request excludes the prerelease
+// versions with prerelease=false
+func includePrereleases(req *http.Request) bool {
+	include, err := strconv.ParseBool(req.FormValue("prerelease"))
+	return err != nil || include
+}
+
+// versionConstraint returns the semver constraint of the request, if any
+func versionConstraint(req *http.Request) (*semver.Constraints, error) {
+	constraint := req.FormValue("constraint")
+	if constraint == "" {
+		return nil, nil
+	}
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version constraint %q: %v", constraint, err)
+	}
+	return c, nil
+}
+
+// requestKubeVersion returns the Kubernetes version of the request, if any
+func requestKubeVersion(req *http.Request) (*semver.Version, error) {
+	version := req.FormValue("kubeVersion")
+	if version == "" {
+		return nil, nil
+	}
+	return kubeversion.Parse(version)
+}
+
+// compatibleChartVersions returns the chart versions supporting the
+// Kubernetes version, every version if it's nil
+func compatibleChartVersions(versions []models.ChartVersion, kubeVersion *semver.Version) []models.ChartVersion {
+	if kubeVersion == nil {
+		return versions
+	}
+	compatible := []models.ChartVersion{}
+	for _, cv := range versions {
+		if kubeversion.Compatible(cv.KubeVersion, kubeVersion) {
+			compatible = append(compatible, cv)
+		}
+	}
+	return compatible
+}
+
+// markIncompatibleVersions flags the versions of a chart which don't support
+// the Kubernetes version, if any
+func markIncompatibleVersions(c *models.Chart, kubeVersion *semver.Version) {
+	if kubeVersion == nil {
+		return
+	}
+	for i := range c.ChartVersions {
+		cv := &c.ChartVersions[i]
+		cv.Incompatible = !kubeversion.Compatible(cv.KubeVersion, kubeVersion)
+	}
+}
+
+// sortChartVersions returns the chart versions sorted from the highest to the
+// lowest semver precedence, keeping only the ones satisfying the constraint if
+// given. Versions which are not valid semver are kept at the end, in the order
+// of the index, unless there is a constraint.
+func sortChartVersions(versions []models.ChartVersion, constraint *semver.Constraints) []models.ChartVersion {
+	type parsedVersion struct {
+		cv      models.ChartVersion
+		version *semver.Version
+	}
+	parsed := []parsedVersion{}
+	for _, cv := range versions {
+		v, err := semver.NewVersion(cv.Version)
+		if err != nil && constraint != nil {
+			continue
+		}
+		if constraint != nil && !constraint.Check(v) {
+			continue
+		}
+		parsed = append(parsed, parsedVersion{cv, v})
+	}
+	sort.SliceStable(parsed, func(i, j int) bool {
+		vi, vj := parsed[i].version, parsed[j].version
+		if vi == nil || vj == nil {
+			return vj == nil && vi != nil
+		}
+		return vi.GreaterThan(vj)
+	})
+	sorted := make([]models.ChartVersion, len(parsed))
+	for i, p := range parsed {
+		sorted[i] = p.cv
+	}
+	return sorted
+}
+
+// getVersionsMatchingRequest returns the chart of the request with the
+// versions satisfying its constraint and supporting its Kubernetes version.
+// The versions are sorted from the highest to the lowest if sorted is set or
+// there is a constraint, otherwise they are kept in the stored order.
+func getVersionsMatchingRequest(w http.ResponseWriter, req *http.Request, params Params, sorted bool) (models.Chart, bool) {
+	constraint, err := versionConstraint(req)
+	if err != nil {
+		response.NewErrorResponse(http.StatusBadRequest, err.Error()).Write(w)
+		return models.Chart{}, false
+	}
+	kubeVersion, err := requestKubeVersion(req)
+	if err != nil {
+		response.NewErrorResponse(http.StatusBadRequest, err.Error()).Write(w)
+		return models.Chart{}, false
+	}
+	chartID := fmt.Sprintf("%s/%s", params["repo"], params["chartName"])
+	chart, err := manager.getChartVersions(params["namespace"], chartID, includePrereleases(req))
+	if err != nil {
+		log.WithError(err).Errorf("could not find chart with id %s", chartID)
+		response.NewErrorResponse(http.StatusNotFound, "could not find chart").Write(w)
+		return models.Chart{}, false
+	}
+	if sorted || constraint != nil {
+		chart.ChartVersions = sortChartVersions(chart.ChartVersions, constraint)
+	}
+	chart.ChartVersions = compatibleChartVersions(chart.ChartVersions, kubeVersion)
+	return chart, true
+}
+
+// listChartVersions returns a list of chart versions for the given chart,
+// filtered by the Kubernetes version if given. The versions are kept in the
+// stored order unless a constraint is given, then they are filtered by it and
+// sorted by semver precedence.
+func listChartVersions(w http.ResponseWriter, req *http.Request, params Params) {
+	chart, ok := getVersionsMatchingRequest(w, req, params, false)
+	if !ok {
+		return
+	}
+	cvl := newChartVersionListResponse(&chart)
+	response.NewDataResponse(cvl).Write(w)
+}
+
+// getLatestChartVersion returns the highest version of the given chart
+// satisfying the constraint and the Kubernetes version if given
+func getLatestChartVersion(w http.ResponseWriter, req *http.Request, params Params) {
+	chart, ok := getVersionsMatchingRequest(w, req, params, true)
+	if !ok {
+		return
+	}
+	if len(chart.ChartVersions) == 0 {
+		response.NewErrorResponse(http.StatusNotFound, "could not find a chart version matching the constraint").Write(w)
+		return
+	}
+	cvr := newChartVersionResponse(&chart, chart.ChartVersions[0])
+	response.NewDataResponse(cvr).Write(w)
+}
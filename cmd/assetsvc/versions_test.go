@@ -0,0 +1,200 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func chartVersions(versions ...string) []models.ChartVersion {
+	cvs := []models.ChartVersion{}
+	for _, v := range versions {
+		cvs = append(cvs, models.ChartVersion{Version: v})
+	}
+	return cvs
+}
+
+func Test_includePrereleases(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{"no parameter", "", true},
+		{"prereleases excluded", "prerelease=false", false},
+		{"prereleases included", "prerelease=true", true},
+		{"invalid value", "prerelease=maybe", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/versions?"+tt.query, nil)
+			assert.Equal(t, tt.want, includePrereleases(req))
+		})
+	}
+}
+
+func Test_sortChartVersions(t *testing.T) {
+	versions := chartVersions("1.10.0", "not-semver", "1.9.0", "2.0.0-rc.1", "1.2.0", "v1.4.0", "2.0.0")
+	tests := []struct {
+		name       string
+		constraint string
+		want       []string
+	}{
+		{"no constraint", "", []string{"2.0.0", "2.0.0-rc.1", "1.10.0", "1.9.0", "v1.4.0", "1.2.0", "not-semver"}},
+		{"range", ">=1.4, <2.0.0", []string{"1.10.0", "1.9.0", "v1.4.0"}},
+		{"major version", "1.x", []string{"1.10.0", "1.9.0", "v1.4.0", "1.2.0"}},
+		{"prerelease constraint", ">=2.0.0-0", []string{"2.0.0", "2.0.0-rc.1"}},
+		{"no matching version", ">3", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var constraint *semver.Constraints
+			if tt.constraint != "" {
+				var err error
+				constraint, err = semver.NewConstraint(tt.constraint)
+				assert.NoError(t, err)
+			}
+			got := []string{}
+			for _, cv := range sortChartVersions(versions, constraint) {
+				got = append(got, cv.Version)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_listChartVersionsWithConstraint(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		wantCode     int
+		wantVersions []string
+	}{
+		{"stored order without constraint", "", http.StatusOK, []string{"1.9.0", "2.0.0", "1.2.0", "1.10.0"}},
+		{"with constraint", "?constraint=>=1.4,<2.0.0", http.StatusOK, []string{"1.10.0", "1.9.0"}},
+		{"invalid constraint", "?constraint=not-a-constraint", http.StatusBadRequest, nil},
+		{"compatible with the Kubernetes version", "?kubeVersion=v1.16.3-gke.1", http.StatusOK, []string{"1.9.0", "1.2.0", "1.10.0"}},
+		{"with constraint and Kubernetes version", "?constraint=>=1.4&kubeVersion=1.19.0", http.StatusOK, []string{"2.0.0", "1.10.0", "1.9.0"}},
+		{"invalid Kubernetes version", "?kubeVersion=latest", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m mock.Mock
+			manager = getMockManager(&m)
+			versions := chartVersions("1.9.0", "2.0.0", "1.2.0", "1.10.0")
+			versions[1].KubeVersion = ">=1.18.0"
+			m.On("One", &models.Chart{}).Maybe().Return(nil).Run(func(args mock.Arguments) {
+				*args.Get(0).(*models.Chart) = models.Chart{Repo: testRepo, ID: "my-repo/my-chart", ChartVersions: versions}
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/charts/my-repo/my-chart/versions"+tt.query, nil)
+			listChartVersions(w, req, Params{"namespace": "kubeapps", "repo": "my-repo", "chartName": "my-chart"})
+
+			m.AssertExpectations(t)
+			assert.Equal(t, tt.wantCode, w.Code, "http status code should match")
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var b bodyAPIListResponse
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&b))
+			got := []string{}
+			for _, cv := range *b.Data {
+				got = append(got, cv.Attributes.(map[string]interface{})["version"].(string))
+			}
+			assert.Equal(t, tt.wantVersions, got)
+		})
+	}
+}
+
+func Test_getLatestChartVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantCode    int
+		wantVersion string
+	}{
+		{"latest version", "", http.StatusOK, "2.0.0-beta.1"},
+		{"latest release", "?prerelease=false", http.StatusOK, "1.10.0"},
+		{"latest version matching the constraint", "?constraint=~1.9", http.StatusOK, "1.9.3"},
+		{"no version matching the constraint", "?constraint=>=3", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m mock.Mock
+			manager = getMockManager(&m)
+			versions := chartVersions("1.9.0", "2.0.0-beta.1", "1.10.0", "1.9.3")
+			if tt.query == "?prerelease=false" {
+				// The prerelease versions are filtered out by the database
+				versions = chartVersions("1.9.0", "1.10.0", "1.9.3")
+			}
+			m.On("One", &models.Chart{}).Return(nil).Run(func(args mock.Arguments) {
+				*args.Get(0).(*models.Chart) = models.Chart{Repo: testRepo, ID: "my-repo/my-chart", ChartVersions: versions}
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/charts/my-repo/my-chart/versions/latest"+tt.query, nil)
+			getLatestChartVersion(w, req, Params{"namespace": "kubeapps", "repo": "my-repo", "chartName": "my-chart"})
+
+			m.AssertExpectations(t)
+			assert.Equal(t, tt.wantCode, w.Code, "http status code should match")
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var b bodyAPIResponse
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&b))
+			assert.Equal(t, "my-repo/my-chart-"+tt.wantVersion, b.Data.ID)
+		})
+	}
+}
+
+func Test_markIncompatibleVersions(t *testing.T) {
+	versions := chartVersions("2.0.0", "1.0.0", "0.1.0")
+	versions[0].KubeVersion = ">=1.18.0"
+	versions[2].KubeVersion = "<1.10.0"
+	tests := []struct {
+		name        string
+		kubeVersion string
+		want        []bool
+	}{
+		{"no Kubernetes version", "", []bool{false, false, false}},
+		{"old cluster", "v1.9.11", []bool{true, false, false}},
+		{"recent cluster", "v1.18.2", []bool{false, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/charts/my-repo/my-chart?kubeVersion="+tt.kubeVersion, nil)
+			kubeVersion, err := requestKubeVersion(req)
+			assert.NoError(t, err)
+			c := models.Chart{ChartVersions: append([]models.ChartVersion{}, versions...)}
+			markIncompatibleVersions(&c, kubeVersion)
+			got := []bool{}
+			for _, cv := range c.ChartVersions {
+				got = append(got, cv.Incompatible)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/kubeapps/kubeapps/pkg/auth"
+	"k8s.io/client-go/rest"
+)
+
+// DefaultClusterName is the name of the cluster Kubeapps is running on. The
+// routes without a cluster manage the releases of the default cluster.
+const DefaultClusterName = "default"
+
+// ClusterConfig is the configuration of a cluster whose releases are managed
+// by kubeops with the token of the user for the cluster.
+type ClusterConfig struct {
+	Name string `json:"name"`
+	// APIServiceURL is the URL of the API server of the cluster. The default
+	// cluster can omit it to be reached from within the pod.
+	APIServiceURL string `json:"apiServiceURL"`
+	// CertificateAuthorityData is the base64 encoded PEM of the CA of the API
+	// server, the system CAs are trusted if empty
+	CertificateAuthorityData string `json:"certificateAuthorityData,omitempty"`
+	// Insecure skips the verification of the certificate of the API server
+	Insecure bool `json:"insecure,omitempty"`
+	// TokenHeader is the request header with the bearer token of the user for
+	// the cluster, the Authorization header if empty. It lets an auth proxy
+	// pass a different token per cluster.
+	TokenHeader string `json:"tokenHeader,omitempty"`
+	// CAFile is the file the decoded CertificateAuthorityData is written to
+	CAFile string `json:"-"`
+}
+
+// ClustersConfig holds the configured clusters by name
+type ClustersConfig map[string]ClusterConfig
+
+// ErrClusterNotConfigured is returned for the requests of unknown clusters
+type ErrClusterNotConfigured string
+
+func (e ErrClusterNotConfigured) Error() string {
+	return fmt.Sprintf("cluster %q is not configured", string(e))
+}
+
+// ParseClustersConfig parses the JSON list of clusters of the clusters
+// configuration file. The CAs of the clusters are written to caFilesDir since
+// the Helm clients only read them from files.
+func ParseClustersConfig(data []byte, caFilesDir string) (ClustersConfig, error) {
+	var list []ClusterConfig
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("unable to parse the clusters configuration: %v", err)
+	}
+	clusters := ClustersConfig{}
+	for _, c := range list {
+		if c.Name == "" {
+			return nil, fmt.Errorf("a cluster has no name")
+		}
+		if _, ok := clusters[c.Name]; ok {
+			return nil, fmt.Errorf("cluster %q is configured twice", c.Name)
+		}
+		if c.APIServiceURL == "" {
+			if c.Name != DefaultClusterName {
+				return nil, fmt.Errorf("cluster %q has no apiServiceURL", c.Name)
+			}
+		} else if u, err := url.Parse(c.APIServiceURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("cluster %q has an invalid apiServiceURL %q", c.Name, c.APIServiceURL)
+		}
+		if strings.ContainsAny(c.TokenHeader, " \t\r\n:") {
+			return nil, fmt.Errorf("cluster %q has an invalid tokenHeader %q", c.Name, c.TokenHeader)
+		}
+		if c.CertificateAuthorityData != "" {
+			if c.Insecure {
+				return nil, fmt.Errorf("cluster %q can't be insecure and have a certificateAuthorityData", c.Name)
+			}
+			ca, err := base64.StdEncoding.DecodeString(c.CertificateAuthorityData)
+			if err != nil {
+				return nil, fmt.Errorf("cluster %q has an invalid certificateAuthorityData: %v", c.Name, err)
+			}
+			c.CAFile = filepath.Join(caFilesDir, c.Name+".crt")
+			if err := ioutil.WriteFile(c.CAFile, ca, 0644); err != nil {
+				return nil, fmt.Errorf("unable to write the CA of cluster %q: %v", c.Name, err)
+			}
+		}
+		clusters[c.Name] = c
+	}
+	return clusters, nil
+}
+
+// NewClusterConfig returns the config of a cluster with the token of the user
+// found in the token header of the cluster of the request headers. The default
+// cluster is reached with the in-cluster config unless it has an
+// apiServiceURL.
+func NewClusterConfig(header http.Header, cluster string, clusters ClustersConfig) (*rest.Config, error) {
+	if cluster == "" {
+		cluster = DefaultClusterName
+	}
+	c, ok := clusters[cluster]
+	if !ok && cluster != DefaultClusterName {
+		return nil, ErrClusterNotConfigured(cluster)
+	}
+	tokenHeader := c.TokenHeader
+	if tokenHeader == "" {
+		tokenHeader = authHeader
+	}
+	token := auth.ExtractToken(header.Get(tokenHeader))
+	if c.APIServiceURL == "" {
+		return NewInClusterConfig(token)
+	}
+	return &rest.Config{
+		Host:        c.APIServiceURL,
+		BearerToken: token,
+		TLSClientConfig: rest.TLSClientConfig{
+			CAFile:   c.CAFile,
+			Insecure: c.Insecure,
+		},
+	}, nil
+}
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/client-go/rest"
+)
+
+func TestParseClustersConfig(t *testing.T) {
+	caFilesDir, err := ioutil.TempDir("", "clusters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(caFilesDir)
+	ca := "-----BEGIN CERTIFICATE-----\nfoo\n-----END CERTIFICATE-----\n"
+	caData := base64.StdEncoding.EncodeToString([]byte(ca))
+
+	testCases := []struct {
+		name          string
+		config        string
+		expected      ClustersConfig
+		expectedError bool
+	}{
+		{
+			name: "clusters with and without CA",
+			config: `[
+				{"name": "default"},
+				{"name": "second", "apiServiceURL": "https://second.example.com", "certificateAuthorityData": "` + caData + `"},
+				{"name": "third", "apiServiceURL": "https://third.example.com:6443", "insecure": true, "tokenHeader": "X-Third-Authorization"}
+			]`,
+			expected: ClustersConfig{
+				"default": {Name: "default"},
+				"second": {
+					Name:                     "second",
+					APIServiceURL:            "https://second.example.com",
+					CertificateAuthorityData: caData,
+					CAFile:                   filepath.Join(caFilesDir, "second.crt"),
+				},
+				"third": {Name: "third", APIServiceURL: "https://third.example.com:6443", Insecure: true, TokenHeader: "X-Third-Authorization"},
+			},
+		},
+		{
+			name:     "no clusters",
+			config:   `[]`,
+			expected: ClustersConfig{},
+		},
+		{
+			name:          "invalid JSON",
+			config:        `{"name": "default"}`,
+			expectedError: true,
+		},
+		{
+			name:          "cluster without name",
+			config:        `[{"apiServiceURL": "https://second.example.com"}]`,
+			expectedError: true,
+		},
+		{
+			name:          "duplicated cluster",
+			config:        `[{"name": "default"}, {"name": "default"}]`,
+			expectedError: true,
+		},
+		{
+			name:          "additional cluster without URL",
+			config:        `[{"name": "second"}]`,
+			expectedError: true,
+		},
+		{
+			name:          "invalid URL",
+			config:        `[{"name": "second", "apiServiceURL": "second.example.com"}]`,
+			expectedError: true,
+		},
+		{
+			name:          "invalid CA",
+			config:        `[{"name": "second", "apiServiceURL": "https://second.example.com", "certificateAuthorityData": "not base64"}]`,
+			expectedError: true,
+		},
+		{
+			name:          "invalid token header",
+			config:        `[{"name": "second", "apiServiceURL": "https://second.example.com", "tokenHeader": "X-Second: Authorization"}]`,
+			expectedError: true,
+		},
+		{
+			name:          "insecure cluster with CA",
+			config:        `[{"name": "second", "apiServiceURL": "https://second.example.com", "certificateAuthorityData": "` + caData + `", "insecure": true}]`,
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clusters, err := ParseClustersConfig([]byte(tc.config), caFilesDir)
+			if tc.expectedError {
+				if err == nil {
+					t.Errorf("expected an error, got %v", clusters)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got, want := clusters, tc.expected; !cmp.Equal(want, got) {
+				t.Errorf(cmp.Diff(want, got))
+			}
+			for _, c := range clusters {
+				if c.CAFile == "" {
+					continue
+				}
+				written, err := ioutil.ReadFile(c.CAFile)
+				if err != nil {
+					t.Fatalf("unable to read the CA file: %v", err)
+				}
+				if got, want := string(written), ca; got != want {
+					t.Errorf("got: %q, want: %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewClusterConfig(t *testing.T) {
+	clusters := ClustersConfig{
+		"second": {Name: "second", APIServiceURL: "https://second.example.com", CAFile: "/tmp/second.crt"},
+		"third":  {Name: "third", APIServiceURL: "https://third.example.com", Insecure: true},
+		"fourth": {Name: "fourth", APIServiceURL: "https://fourth.example.com", TokenHeader: "X-Fourth-Authorization"},
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer foo")
+	header.Set("X-Fourth-Authorization", "Bearer bar")
+
+	testCases := []struct {
+		name          string
+		cluster       string
+		expected      *rest.Config
+		expectedError error
+	}{
+		{
+			name:    "cluster with CA",
+			cluster: "second",
+			expected: &rest.Config{
+				Host:            "https://second.example.com",
+				BearerToken:     "foo",
+				TLSClientConfig: rest.TLSClientConfig{CAFile: "/tmp/second.crt"},
+			},
+		},
+		{
+			name:    "insecure cluster",
+			cluster: "third",
+			expected: &rest.Config{
+				Host:            "https://third.example.com",
+				BearerToken:     "foo",
+				TLSClientConfig: rest.TLSClientConfig{Insecure: true},
+			},
+		},
+		{
+			name:    "cluster with a token header",
+			cluster: "fourth",
+			expected: &rest.Config{
+				Host:        "https://fourth.example.com",
+				BearerToken: "bar",
+			},
+		},
+		{
+			name:          "unknown cluster",
+			cluster:       "fifth",
+			expectedError: ErrClusterNotConfigured("fifth"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := NewClusterConfig(header, tc.cluster, clusters)
+			if got, want := err, tc.expectedError; got != want {
+				t.Fatalf("got: %v, want: %v", got, want)
+			}
+			if got, want := config, tc.expected; !cmp.Equal(want, got) {
+				t.Errorf(cmp.Diff(want, got))
+			}
+		})
+	}
+}
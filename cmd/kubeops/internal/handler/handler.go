@@ -22,6 +22,7 @@ import (
 
 const (
 	authHeader     = "Authorization"
+	clusterParam   = "cluster"
 	namespaceParam = "namespace"
 	nameParam      = "releaseName"
 	authUserError  = "Unexpected error while configuring authentication"
@@ -41,6 +42,10 @@ type Options struct {
 	Timeout           int64
 	UserAgent         string
 	KubeappsNamespace string
+	// AssetsvcURL is the URL of the assetsvc serving the mirrored charts
+	AssetsvcURL string
+	// ClustersConfig are the clusters of the /clusters/{cluster} routes
+	ClustersConfig ClustersConfig
 }
 
 // Config represents data needed by each handler to be able to create Helm 3 actions.
@@ -69,13 +74,16 @@ func WithHandlerConfig(storageForDriver agent.StorageForDriver, options Options)
 	return func(f dependentHandler) handlerutil.WithParams {
 		return func(w http.ResponseWriter, req *http.Request, params handlerutil.Params) {
 			namespace := params[namespaceParam]
-			token := auth.ExtractToken(req.Header.Get(authHeader))
 
 			// User configuration and clients, using user token
-			// Used to perform Helm operations
-			restConfig, err := NewInClusterConfig(token)
+			// Used to perform Helm operations on the cluster of the request
+			restConfig, err := NewClusterConfig(req.Header, params[clusterParam], options.ClustersConfig)
+			if _, ok := err.(ErrClusterNotConfigured); ok {
+				response.NewErrorResponse(http.StatusNotFound, err.Error()).Write(w)
+				return
+			}
 			if err != nil {
-				log.Errorf("Failed to create in-cluster config with user token: %v", err)
+				log.Errorf("Failed to create cluster config with user token: %v", err)
 				response.NewErrorResponse(http.StatusInternalServerError, authUserError).Write(w)
 				return
 			}
@@ -99,10 +107,14 @@ func WithHandlerConfig(storageForDriver agent.StorageForDriver, options Options)
 				return
 			}
 
+			chartClient := chartUtils.NewChartClient(kubeHandler, options.KubeappsNamespace, options.UserAgent, options.AssetsvcURL)
+			// The assetsvc runs on the default cluster so it's always queried with
+			// the token of the Authorization header
+			chartClient.SetAssetsvcToken(auth.ExtractToken(req.Header.Get(authHeader)))
 			cfg := Config{
 				Options:      options,
 				ActionConfig: actionConfig,
-				ChartClient:  chartUtils.NewChartClient(kubeHandler, options.KubeappsNamespace, options.UserAgent),
+				ChartClient:  chartClient,
 			}
 			f(cfg, w, req, params)
 		}
@@ -271,3 +283,59 @@ func DeleteRelease(cfg Config, w http.ResponseWriter, req *http.Request, params
 	w.Header().Set("Status-Code", "200")
 	w.Write([]byte("OK"))
 }
+
+// RenderRelease renders the manifests of a new release without installing it.
+func RenderRelease(cfg Config, w http.ResponseWriter, req *http.Request, params handlerutil.Params) {
+	chartDetails, chartMulti, err := handlerutil.ParseAndGetChart(req, cfg.ChartClient, isV1SupportRequired)
+	if err != nil {
+		returnErrMessage(err, w)
+		return
+	}
+	rendered, err := agent.RenderNewRelease(cfg.ActionConfig, chartDetails.ReleaseName, params[namespaceParam], chartDetails.Values, chartMulti.Helm3Chart)
+	if err != nil {
+		returnRenderErrMessage(err, w)
+		return
+	}
+	response.NewDataResponse(rendered).Write(w)
+}
+
+// RenderReleaseUpgrade renders the manifests of an upgrade of a release without upgrading it.
+func RenderReleaseUpgrade(cfg Config, w http.ResponseWriter, req *http.Request, params handlerutil.Params) {
+	chartDetails, chartMulti, err := handlerutil.ParseAndGetChart(req, cfg.ChartClient, isV1SupportRequired)
+	if err != nil {
+		returnErrMessage(err, w)
+		return
+	}
+	rendered, err := agent.RenderReleaseUpgrade(cfg.ActionConfig, params[nameParam], chartDetails.Values, chartMulti.Helm3Chart)
+	if err != nil {
+		returnRenderErrMessage(err, w)
+		return
+	}
+	response.NewDataResponse(rendered).Write(w)
+}
+
+// renderErrorResponse is the error response of the templates which could not
+// be rendered, located in the templates when possible
+type renderErrorResponse struct {
+	response.ErrorResponse
+	*agent.RenderError
+}
+
+func returnRenderErrMessage(err error, w http.ResponseWriter) {
+	renderErr, ok := err.(*agent.RenderError)
+	if !ok {
+		returnErrMessage(err, w)
+		return
+	}
+	body, err := json.Marshal(renderErrorResponse{
+		ErrorResponse: response.NewErrorResponse(http.StatusUnprocessableEntity, renderErr.Error()),
+		RenderError:   renderErr,
+	})
+	if err != nil {
+		returnErrMessage(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	w.Write(body)
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/kubeapps/kubeapps/pkg/agent"
 	chartFake "github.com/kubeapps/kubeapps/pkg/chart/fake"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
@@ -260,6 +261,69 @@ func TestActions(t *testing.T) {
 			StatusCode:        403,
 			RemainingReleases: nil,
 			ResponseBody:      `{"code":403,"message":"[{\"apiGroup\":\"\",\"resource\":\"secrets\",\"namespace\":\"default\",\"clusterWide\":false,\"verbs\":[\"create\"]}]"}`,
+		},		{
+			// Scenario params
+			Description:      "Render a new release",
+			ExistingReleases: []*release.Release{},
+			// Request params
+			RequestBody: `{"chartName": "foo", "releaseName": "foobar",	"version": "1.0.0"}`,
+			RequestQuery: "",
+			Action:       "render",
+			Params:       map[string]string{"namespace": "default"},
+			// Expected result
+			StatusCode:        200,
+			RemainingReleases: nil,
+			ResponseBody:      `{"data":{"manifests":[],"hooks":[],"notes":""}}`,
+		},
+		{
+			// Scenario params
+			Description: "Render a conflicting release",
+			ExistingReleases: []*release.Release{
+				createRelease("foo", "foobar", "default", 1, release.StatusDeployed),
+			},
+			// Request params
+			RequestBody: `{"chartName": "foo", "releaseName": "foobar",	"version": "1.0.0"}`,
+			RequestQuery: "",
+			Action:       "render",
+			Params:       map[string]string{"namespace": "default"},
+			// Expected result
+			StatusCode: 409,
+			RemainingReleases: []*release.Release{
+				createRelease("foo", "foobar", "default", 1, release.StatusDeployed),
+			},
+			ResponseBody: "",
+		},
+		{
+			// Scenario params
+			Description: "Render the upgrade of a release",
+			ExistingReleases: []*release.Release{
+				createRelease("foo", "foobar", "default", 1, release.StatusDeployed),
+			},
+			// Request params
+			RequestBody: `{"chartName": "foo", "releaseName": "foobar",	"version": "1.0.0"}`,
+			RequestQuery: "",
+			Action:       "renderUpgrade",
+			Params:       map[string]string{"namespace": "default", "releaseName": "foobar"},
+			// Expected result
+			StatusCode: 200,
+			RemainingReleases: []*release.Release{
+				createRelease("foo", "foobar", "default", 1, release.StatusDeployed),
+			},
+			ResponseBody: `{"data":{"manifests":[],"hooks":[],"notes":""}}`,
+		},
+		{
+			// Scenario params
+			Description:      "Render the upgrade of a missing release",
+			ExistingReleases: []*release.Release{},
+			// Request params
+			RequestBody: `{"chartName": "foo", "releaseName": "foobar",	"version": "1.0.0"}`,
+			RequestQuery: "",
+			Action:       "renderUpgrade",
+			Params:       map[string]string{"namespace": "default", "releaseName": "foobar"},
+			// Expected result
+			StatusCode:        404,
+			RemainingReleases: nil,
+			ResponseBody:      "",
 		},
 	}
 
@@ -290,6 +354,10 @@ func TestActions(t *testing.T) {
 				CreateRelease(*cfg, response, req, test.Params)
 			case "delete":
 				DeleteRelease(*cfg, response, req, test.Params)
+			case "render":
+				RenderRelease(*cfg, response, req, test.Params)
+			case "renderUpgrade":
+				RenderReleaseUpgrade(*cfg, response, req, test.Params)
 			default:
 				t.Errorf("Unexpected action %s", test.Action)
 			}
@@ -522,3 +590,49 @@ func TestUpgradeAction(t *testing.T) {
 		})
 	}
 }
+
+func TestReturnRenderErrMessage(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		err          error
+		statusCode   int
+		responseBody string
+	}{
+		{
+			desc: "a located render error",
+			err: &agent.RenderError{
+				Err:      errors.New("parse error at (foo/templates/svc.yaml:2): function \"bar\" not defined"),
+				Template: "foo/templates/svc.yaml",
+				Line:     2,
+				Context:  []agent.SourceLine{{Line: 1, Text: "kind: Service"}, {Line: 2, Text: "name: {{ bar }}"}},
+			},
+			statusCode:   422,
+			responseBody: `{"code":422,"message":"parse error at (foo/templates/svc.yaml:2): function \"bar\" not defined","template":"foo/templates/svc.yaml","line":2,"context":[{"line":1,"text":"kind: Service"},{"line":2,"text":"name: {{ bar }}"}]}`,
+		},
+		{
+			desc:         "a validation error",
+			err:          &agent.RenderError{Err: errors.New("unable to build kubernetes objects from release manifest")},
+			statusCode:   422,
+			responseBody: `{"code":422,"message":"unable to build kubernetes objects from release manifest"}`,
+		},
+		{
+			desc:         "another error",
+			err:          errors.New("release: not found"),
+			statusCode:   404,
+			responseBody: `{"code":404,"message":"release: not found"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			response := httptest.NewRecorder()
+			returnRenderErrMessage(tc.err, response)
+			if got, want := response.Code, tc.statusCode; got != want {
+				t.Errorf("got: %d, want: %d", got, want)
+			}
+			if got, want := strings.TrimSpace(response.Body.String()), tc.responseBody; got != want {
+				t.Errorf(cmp.Diff(want, got))
+			}
+		})
+	}
+}
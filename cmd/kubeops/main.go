@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -16,6 +17,7 @@ import (
 	"github.com/kubeapps/kubeapps/pkg/agent"
 	"github.com/kubeapps/kubeapps/pkg/auth"
 	backendHandlers "github.com/kubeapps/kubeapps/pkg/http-handler"
+	"github.com/kubeapps/kubeapps/pkg/openapi"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"github.com/urfave/negroni"
@@ -29,6 +31,7 @@ var (
 	userAgentComment string
 	listLimit        int
 	timeout          int64
+	clustersConfig   string
 )
 
 func init() {
@@ -39,6 +42,7 @@ func init() {
 	pflag.StringVar(&userAgentComment, "user-agent-comment", "", "UserAgent comment used during outbound requests")
 	// Default timeout from https://github.com/helm/helm/blob/b0b0accdfc84e154b3d48ec334cd5b4f9b345667/cmd/helm/install.go#L216
 	pflag.Int64Var(&timeout, "timeout", 300, "Timeout to perform release operations (install, upgrade, rollback, delete)")
+	pflag.StringVar(&clustersConfig, "clusters-config-path", "", "JSON file listing the clusters whose releases can be managed")
 }
 
 func main() {
@@ -54,6 +58,21 @@ func main() {
 		ListLimit:         listLimit,
 		Timeout:           timeout,
 		KubeappsNamespace: kubeappsNamespace,
+		AssetsvcURL:       assetsvcURL,
+	}
+	if clustersConfig != "" {
+		data, err := ioutil.ReadFile(clustersConfig)
+		if err != nil {
+			log.Fatalf("Unable to read the clusters configuration: %v", err)
+		}
+		caFilesDir, err := ioutil.TempDir("", "clusters")
+		if err != nil {
+			log.Fatalf("Unable to create the directory of the cluster CAs: %v", err)
+		}
+		options.ClustersConfig, err = handler.ParseClustersConfig(data, caFilesDir)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	storageForDriver := agent.StorageForSecrets
@@ -73,6 +92,12 @@ func main() {
 	r.Handle("/live", health)
 	r.Handle("/ready", health)
 
+	// The requests of the documented routes are validated before reaching
+	// their handlers
+	apiDocument := openapi.Kubeops()
+	r.Methods("GET").Path(openapi.Path).Handler(apiDocument.Handler())
+	r.Use(apiDocument.Validate)
+
 	// Routes
 	// Auth not necessary here with Helm 3 because it's done by Kubernetes.
 	addRoute := handler.AddRouteWith(r.PathPrefix("/v1").Subrouter(), withHandlerConfig)
@@ -82,6 +107,17 @@ func main() {
 	addRoute("GET", "/namespaces/{namespace}/releases/{releaseName}", handler.GetRelease)
 	addRoute("PUT", "/namespaces/{namespace}/releases/{releaseName}", handler.OperateRelease)
 	addRoute("DELETE", "/namespaces/{namespace}/releases/{releaseName}", handler.DeleteRelease)
+	addRoute("POST", "/namespaces/{namespace}/releases/render", handler.RenderRelease)
+	addRoute("POST", "/namespaces/{namespace}/releases/{releaseName}/render", handler.RenderReleaseUpgrade)
+	// The same routes for the releases of the configured clusters
+	addRoute("GET", "/clusters/{cluster}/releases", handler.ListAllReleases)
+	addRoute("GET", "/clusters/{cluster}/namespaces/{namespace}/releases", handler.ListReleases)
+	addRoute("POST", "/clusters/{cluster}/namespaces/{namespace}/releases", handler.CreateRelease)
+	addRoute("GET", "/clusters/{cluster}/namespaces/{namespace}/releases/{releaseName}", handler.GetRelease)
+	addRoute("PUT", "/clusters/{cluster}/namespaces/{namespace}/releases/{releaseName}", handler.OperateRelease)
+	addRoute("DELETE", "/clusters/{cluster}/namespaces/{namespace}/releases/{releaseName}", handler.DeleteRelease)
+	addRoute("POST", "/clusters/{cluster}/namespaces/{namespace}/releases/render", handler.RenderRelease)
+	addRoute("POST", "/clusters/{cluster}/namespaces/{namespace}/releases/{releaseName}/render", handler.RenderReleaseUpgrade)
 
 	// Backend routes unrelated to kubeops functionality.
 	err := backendHandlers.SetupDefaultRoutes(r.PathPrefix("/backend/v1").Subrouter())
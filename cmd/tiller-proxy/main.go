@@ -138,7 +138,7 @@ func main() {
 		log.Fatalf("Failed to create handler: %v", err)
 	}
 
-	chartClient := chartUtils.NewChartClient(kubeHandler, kubeappsNamespace, userAgent())
+	chartClient := chartUtils.NewChartClient(kubeHandler, kubeappsNamespace, userAgent(), assetsvcURL)
 
 	r := mux.NewRouter()
 
@@ -6,8 +6,9 @@ replace github.com/docker/docker => github.com/docker/docker v0.0.0-201907311503
 
 require (
 	github.com/DATA-DOG/go-sqlmock v1.3.3
-	github.com/Masterminds/semver v1.5.0 // indirect
+	github.com/Masterminds/semver v1.5.0
 	github.com/Masterminds/sprig v2.22.0+incompatible // indirect
+	github.com/andybalholm/brotli v0.0.0-20190621154722-5f990b63d2d6
 	github.com/arschles/assert v1.0.0
 	github.com/disintegration/imaging v1.6.2
 	github.com/ghodss/yaml v1.0.0
@@ -21,6 +22,7 @@ require (
 	github.com/kubeapps/common v0.0.0-20200304064434-f6ba82e79f47
 	github.com/lib/pq v1.2.0
 	github.com/pkg/errors v0.8.1
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/pflag v1.0.5
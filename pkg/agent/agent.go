@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/kubeapps/kubeapps/pkg/chart/helm3to2"
+	"github.com/kubeapps/kubeapps/pkg/kubeversion"
 	"github.com/kubeapps/kubeapps/pkg/proxy"
 	log "github.com/sirupsen/logrus"
 	"helm.sh/helm/v3/pkg/action"
@@ -16,6 +17,7 @@ import (
 	"helm.sh/helm/v3/pkg/storage"
 	"helm.sh/helm/v3/pkg/storage/driver"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/yaml"
@@ -75,6 +77,9 @@ func CreateRelease(actionConfig *action.Configuration, name, namespace, valueStr
 	if err == nil {
 		return nil, fmt.Errorf("release %s already exists", name)
 	}
+	if err := checkKubeVersion(actionConfig, ch); err != nil {
+		return nil, err
+	}
 	cmd := action.NewInstall(actionConfig)
 	cmd.ReleaseName = name
 	cmd.Namespace = namespace
@@ -101,6 +106,9 @@ func UpgradeRelease(actionConfig *action.Configuration, name, valuesYaml string,
 	if err != nil {
 		return nil, err
 	}
+	if err := checkKubeVersion(actionConfig, ch); err != nil {
+		return nil, err
+	}
 	log.Printf("Upgrading release %s", name)
 	cmd := action.NewUpgrade(actionConfig)
 	values, err := chartutil.ReadValues([]byte(valuesYaml))
@@ -114,6 +122,56 @@ func UpgradeRelease(actionConfig *action.Configuration, name, valuesYaml string,
 	return res, nil
 }
 
+// capabilities returns the capabilities of the cluster of the action config,
+// discovered like Helm does unless they are set.
+func capabilities(actionConfig *action.Configuration) (*chartutil.Capabilities, error) {
+	if actionConfig.Capabilities != nil {
+		return actionConfig.Capabilities, nil
+	}
+	dc, err := actionConfig.RESTClientGetter.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+	dc.Invalidate()
+	version, err := dc.ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+	apiVersions, err := action.GetVersionSet(dc)
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+	return &chartutil.Capabilities{
+		APIVersions: apiVersions,
+		KubeVersion: chartutil.KubeVersion{Version: version.GitVersion, Major: version.Major, Minor: version.Minor},
+	}, nil
+}
+
+// checkKubeVersion returns a kubeversion.IncompatibleError if the kubeVersion
+// of a chart is not satisfied by the Kubernetes version of the cluster.
+func checkKubeVersion(actionConfig *action.Configuration, ch *chart.Chart) error {
+	if ch.Metadata == nil || ch.Metadata.KubeVersion == "" {
+		return nil
+	}
+	caps, err := capabilities(actionConfig)
+	if err != nil {
+		return fmt.Errorf("Unable to get the Kubernetes version of the cluster: %v", err)
+	}
+	version, err := kubeversion.Parse(caps.KubeVersion.Version)
+	if err != nil {
+		return err
+	}
+	if !kubeversion.Compatible(ch.Metadata.KubeVersion, version) {
+		return &kubeversion.IncompatibleError{Chart: ch.Name() + "-" + ch.Metadata.Version, KubeVersion: ch.Metadata.KubeVersion, ClusterVersion: caps.KubeVersion.Version}
+	}
+	// Helm checks the kubeVersion again with the version of the capabilities,
+	// which is set without its prerelease so managed clusters pass both checks.
+	parsedCaps := *caps
+	parsedCaps.KubeVersion.Version = "v" + version.String()
+	actionConfig.Capabilities = &parsedCaps
+	return nil
+}
+
 // RollbackRelease rolls back a release to the specified revision.
 func RollbackRelease(actionConfig *action.Configuration, releaseName string, revision int) (*release.Release, error) {
 	log.Printf("Rolling back %s to revision %d.", releaseName, revision)
@@ -165,7 +223,7 @@ func NewActionConfig(storageForDriver StorageForDriver, config *rest.Config, cli
 // NewConfigFlagsFromCluster returns ConfigFlags with default values set from within cluster.
 func NewConfigFlagsFromCluster(namespace string, clusterConfig *rest.Config) *genericclioptions.ConfigFlags {
 	impersonateGroup := []string{}
-	insecure := false
+	insecure := clusterConfig.Insecure
 
 	// CertFile and KeyFile must be nil for the BearerToken to be used for authentication and authorization instead of the pod's service account.
 	return &genericclioptions.ConfigFlags{
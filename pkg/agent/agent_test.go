@@ -1,12 +1,14 @@
 package agent
 
 import (
+	"errors"
 	"io/ioutil"
 	"sort"
 	"testing"
 
 	kubechart "github.com/kubeapps/kubeapps/pkg/chart"
 	chartFake "github.com/kubeapps/kubeapps/pkg/chart/fake"
+	"github.com/kubeapps/kubeapps/pkg/kubeversion"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chartutil"
@@ -137,6 +139,8 @@ func TestCreateReleases(t *testing.T) {
 		releaseName       string
 		namespace         string
 		chartName         string
+		kubeVersion       string
+		clusterVersion    string
 		values            string
 		version           int
 		existingReleases  []releaseStub
@@ -179,17 +183,49 @@ func TestCreateReleases(t *testing.T) {
 			remainingReleases: 1,
 			shouldFail:        true,
 		},
+		{
+			desc:              "install a chart supporting the cluster",
+			chartName:         "mychart",
+			kubeVersion:       ">=1.14.0",
+			namespace:         "default",
+			version:           1,
+			remainingReleases: 1,
+			shouldFail:        false,
+		},
+		{
+			desc:              "install a chart supporting a managed cluster",
+			chartName:         "mychart",
+			kubeVersion:       ">=1.14.0",
+			clusterVersion:    "v1.16.3-gke.1",
+			namespace:         "default",
+			version:           1,
+			remainingReleases: 1,
+			shouldFail:        false,
+		},
+		{
+			desc:              "install a chart incompatible with the cluster",
+			chartName:         "mychart",
+			kubeVersion:       ">=1.18.0",
+			namespace:         "default",
+			version:           1,
+			remainingReleases: 0,
+			shouldFail:        true,
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
 			// Initialize environment for test
 			actionConfig := newActionConfigFixture(t)
+			if tc.clusterVersion != "" {
+				actionConfig.Capabilities = &chartutil.Capabilities{APIVersions: chartutil.DefaultVersionSet, KubeVersion: chartutil.KubeVersion{Version: tc.clusterVersion}}
+			}
 			makeReleases(t, actionConfig, tc.existingReleases)
 			fakechart := chartFake.FakeChart{}
 			ch, _ := fakechart.GetChart(&kubechart.Details{
 				ChartName: tc.chartName,
 			}, nil, false)
+			ch.Helm3Chart.Metadata.KubeVersion = tc.kubeVersion
 			// Perform test
 			rls, err := CreateRelease(actionConfig, tc.chartName, tc.namespace, tc.values, ch.Helm3Chart)
 			// Check result
@@ -210,6 +246,58 @@ func TestCreateReleases(t *testing.T) {
 	}
 }
 
+func TestCheckKubeVersion(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		kubeVersion     string
+		clusterVersion  string
+		expectedVersion string
+		expectedErr     error
+	}{
+		{
+			desc:            "chart without kubeVersion",
+			clusterVersion:  "v1.16.3-gke.1",
+			expectedVersion: "v1.16.3-gke.1",
+		},
+		{
+			desc:            "chart supporting a managed cluster",
+			kubeVersion:     ">=1.14.0",
+			clusterVersion:  "v1.16.3-gke.1",
+			expectedVersion: "v1.16.3",
+		},
+		{
+			desc:            "chart incompatible with the cluster",
+			kubeVersion:     ">=1.18.0",
+			clusterVersion:  "v1.16.3-gke.1",
+			expectedVersion: "v1.16.3-gke.1",
+			expectedErr:     &kubeversion.IncompatibleError{Chart: "mychart-1.0.0", KubeVersion: ">=1.18.0", ClusterVersion: "v1.16.3-gke.1"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			caps := &chartutil.Capabilities{KubeVersion: chartutil.KubeVersion{Version: tc.clusterVersion}}
+			actionConfig := &action.Configuration{Capabilities: caps}
+			ch := &chart.Chart{Metadata: &chart.Metadata{Name: "mychart", Version: "1.0.0", KubeVersion: tc.kubeVersion}}
+
+			err := checkKubeVersion(actionConfig, ch)
+			var incompatible *kubeversion.IncompatibleError
+			if tc.expectedErr != nil && !errors.As(err, &incompatible) {
+				t.Fatalf("Expecting an incompatible version error, got %v", err)
+			}
+			if got, want := err, tc.expectedErr; !cmp.Equal(want, got) {
+				t.Errorf("mismatch (-want +got):\n%s", cmp.Diff(want, got))
+			}
+			// Helm checks the kubeVersion with the version of the capabilities
+			if got, want := actionConfig.Capabilities.KubeVersion.Version, tc.expectedVersion; got != want {
+				t.Errorf("got: %q, want: %q", got, want)
+			}
+			if got, want := caps.KubeVersion.Version, tc.clusterVersion; got != want {
+				t.Errorf("the capabilities should not be modified, got: %q, want: %q", got, want)
+			}
+		})
+	}
+}
+
 func TestListReleases(t *testing.T) {
 	testCases := []struct {
 		name         string
@@ -638,6 +726,7 @@ func TestUpgradeRelease(t *testing.T) {
 		release     string
 		valuesYaml  string
 		chartName   string
+		kubeVersion string
 		shouldFail  bool
 	}{
 		{
@@ -668,6 +757,16 @@ func TestUpgradeRelease(t *testing.T) {
 			chartName:  "mynewchart",
 			shouldFail: true,
 		},
+		{
+			description: "upgrade to a chart incompatible with the cluster",
+			releases: []releaseStub{
+				releaseStub{"myrls", "default", revisionBeingUpdated, "mychart", release.StatusDeployed},
+			},
+			release:     "myrls",
+			chartName:   "mynewchart",
+			kubeVersion: "<1.16.0",
+			shouldFail:  true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -678,6 +777,7 @@ func TestUpgradeRelease(t *testing.T) {
 			ch, _ := fakechart.GetChart(&kubechart.Details{
 				ChartName: tc.chartName,
 			}, nil, false)
+			ch.Helm3Chart.Metadata.KubeVersion = tc.kubeVersion
 			newRelease, err := UpgradeRelease(cfg, tc.release, tc.valuesYaml, ch.Helm3Chart)
 			// Check for errors
 			if got, want := err != nil, tc.shouldFail; got != want {
@@ -0,0 +1,239 @@
+package agent
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"sigs.k8s.io/yaml"
+)
+
+// contextLines is the number of lines shown before and after the line of a
+// render error
+const contextLines = 2
+
+var (
+	// sourceRegex matches the "# Source: template" header Helm writes before
+	// every manifest of a release
+	sourceRegex   = regexp.MustCompile(`^# Source: (.*)$`)
+	separateRegex = regexp.MustCompile(`(?m)^---\s*$`)
+	// The locations of the template errors, e.g. "parse error at
+	// (foo/templates/svc.yaml:3): ..." or "template: foo/templates/svc.yaml:3:10:
+	// executing ..."
+	locatedErrorRegex  = regexp.MustCompile(`(?:(?:parse|execution) error at \(|template: )([^\s:()]+):(\d+)`)
+	templateErrorRegex = regexp.MustCompile(`parse error in \(([^)]+)\)`)
+	// The line of the YAML errors is the one of the rendered document
+	yamlErrorRegex       = regexp.MustCompile(`YAML parse error on ([^:]+):.*line (\d+)`)
+	validationErrorRegex = regexp.MustCompile(`unable to build kubernetes objects|error validating`)
+)
+
+// RenderedRelease holds the manifests a release would apply, rendered by a dry
+// run of its install or upgrade.
+type RenderedRelease struct {
+	Manifests []RenderedManifest `json:"manifests"`
+	// Hooks are the manifests applied on the events of their annotations
+	Hooks []RenderedManifest `json:"hooks"`
+	Notes string             `json:"notes"`
+}
+
+// RenderedManifest is a rendered resource of a release
+type RenderedManifest struct {
+	// Template is the template the resource is rendered from
+	Template   string `json:"template"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	// Events are the events of a hook
+	Events   []string `json:"events,omitempty"`
+	Manifest string   `json:"manifest"`
+}
+
+// RenderError is an error rendering or validating the manifests of a release.
+// The template and the line are set when Helm reports them.
+type RenderError struct {
+	Err      error  `json:"-"`
+	Template string `json:"template,omitempty"`
+	// Line is the line of the template, or of the rendered document for the
+	// YAML errors
+	Line int `json:"line,omitempty"`
+	// Context are the lines of the template around Line
+	Context []SourceLine `json:"context,omitempty"`
+}
+
+// SourceLine is a numbered line of a template
+type SourceLine struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+func (e *RenderError) Error() string {
+	return e.Err.Error()
+}
+
+// RenderNewRelease renders the manifests of a new release with a dry run of
+// its install.
+func RenderNewRelease(actionConfig *action.Configuration, name, namespace, valueString string, ch *chart.Chart) (*RenderedRelease, error) {
+	// Helm doesn't check the name of the release in a dry run
+	_, err := GetRelease(actionConfig, name)
+	if err == nil {
+		return nil, fmt.Errorf("release %s already exists", name)
+	}
+	if err := checkKubeVersion(actionConfig, ch); err != nil {
+		return nil, err
+	}
+	cmd := action.NewInstall(actionConfig)
+	cmd.ReleaseName = name
+	cmd.Namespace = namespace
+	cmd.DryRun = true
+	values, err := getValues([]byte(valueString))
+	if err != nil {
+		return nil, err
+	}
+	rel, err := cmd.Run(ch, values)
+	if err != nil {
+		return nil, newRenderError(err, ch)
+	}
+	return renderedRelease(rel)
+}
+
+// RenderReleaseUpgrade renders the manifests of an upgrade of a release with
+// a dry run.
+func RenderReleaseUpgrade(actionConfig *action.Configuration, name, valuesYaml string, ch *chart.Chart) (*RenderedRelease, error) {
+	// Check if the release already exists:
+	_, err := GetRelease(actionConfig, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKubeVersion(actionConfig, ch); err != nil {
+		return nil, err
+	}
+	cmd := action.NewUpgrade(actionConfig)
+	cmd.DryRun = true
+	values, err := chartutil.ReadValues([]byte(valuesYaml))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to render the upgrade because values could not be parsed: %v", err)
+	}
+	rel, err := cmd.Run(name, ch, values)
+	if err != nil {
+		return nil, newRenderError(err, ch)
+	}
+	return renderedRelease(rel)
+}
+
+// renderedRelease splits the manifest of a release per resource
+func renderedRelease(rel *release.Release) (*RenderedRelease, error) {
+	rendered := &RenderedRelease{Manifests: []RenderedManifest{}, Hooks: []RenderedManifest{}}
+	if rel.Info != nil {
+		rendered.Notes = rel.Info.Notes
+	}
+	for _, doc := range separateRegex.Split(rel.Manifest, -1) {
+		doc = strings.TrimSpace(doc)
+		if doc == "" {
+			continue
+		}
+		var template string
+		lines := strings.SplitN(doc, "\n", 2)
+		if m := sourceRegex.FindStringSubmatch(lines[0]); m != nil {
+			template = m[1]
+			doc = ""
+			if len(lines) > 1 {
+				doc = lines[1]
+			}
+		}
+		manifest, err := newRenderedManifest(template, doc)
+		if err != nil {
+			return nil, err
+		}
+		rendered.Manifests = append(rendered.Manifests, manifest)
+	}
+	for _, hook := range rel.Hooks {
+		manifest, err := newRenderedManifest(hook.Path, strings.TrimSpace(hook.Manifest))
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range hook.Events {
+			manifest.Events = append(manifest.Events, event.String())
+		}
+		rendered.Hooks = append(rendered.Hooks, manifest)
+	}
+	return rendered, nil
+}
+
+func newRenderedManifest(template, doc string) (RenderedManifest, error) {
+	var head releaseutil.SimpleHead
+	if err := yaml.Unmarshal([]byte(doc), &head); err != nil {
+		return RenderedManifest{}, fmt.Errorf("Unable to parse the manifest of %s: %v", template, err)
+	}
+	manifest := RenderedManifest{
+		Template:   template,
+		APIVersion: head.Version,
+		Kind:       head.Kind,
+		Manifest:   doc + "\n",
+	}
+	if head.Metadata != nil {
+		manifest.Name = head.Metadata.Name
+	}
+	return manifest, nil
+}
+
+// newRenderError returns a RenderError for the templating, YAML and
+// validation errors of a dry run, other errors are returned as is.
+func newRenderError(err error, ch *chart.Chart) error {
+	msg := err.Error()
+	if m := locatedErrorRegex.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[2])
+		return &RenderError{Err: err, Template: m[1], Line: line, Context: sourceContext(ch, m[1], line)}
+	}
+	if m := yamlErrorRegex.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[2])
+		return &RenderError{Err: err, Template: m[1], Line: line}
+	}
+	if m := templateErrorRegex.FindStringSubmatch(msg); m != nil {
+		return &RenderError{Err: err, Template: m[1]}
+	}
+	if validationErrorRegex.MatchString(msg) {
+		return &RenderError{Err: err}
+	}
+	return err
+}
+
+// sourceContext returns the lines around a line of a template of a chart or
+// of its dependencies, named after the path of the chart as Helm does
+func sourceContext(ch *chart.Chart, name string, line int) []SourceLine {
+	data := findTemplate(ch, name)
+	if data == nil {
+		return nil
+	}
+	lines := strings.Split(string(data), "\n")
+	if line < 1 || line > len(lines) {
+		return nil
+	}
+	context := []SourceLine{}
+	for i := line - contextLines; i <= line+contextLines; i++ {
+		if i >= 1 && i <= len(lines) {
+			context = append(context, SourceLine{Line: i, Text: lines[i-1]})
+		}
+	}
+	return context
+}
+
+func findTemplate(ch *chart.Chart, name string) []byte {
+	for _, t := range ch.Templates {
+		if path.Join(ch.ChartFullPath(), t.Name) == name {
+			return t.Data
+		}
+	}
+	for _, dep := range ch.Dependencies() {
+		if data := findTemplate(dep, name); data != nil {
+			return data
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// newChartFixture returns a chart with the given templates
+func newChartFixture(templates map[string]string) *chart.Chart {
+	ch := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "mychart", Version: "1.0.0"},
+		Values:   map[string]interface{}{"port": 80},
+	}
+	for name, data := range templates {
+		ch.Templates = append(ch.Templates, &chart.File{Name: name, Data: []byte(data)})
+	}
+	return ch
+}
+
+const serviceTemplate = `apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  ports:
+  - port: {{ .Values.port }}
+`
+
+const jobTemplate = `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{ .Release.Name }}-migrate
+  annotations:
+    "helm.sh/hook": pre-install,pre-upgrade
+`
+
+func TestRenderNewRelease(t *testing.T) {
+	testCases := []struct {
+		desc             string
+		templates        map[string]string
+		values           string
+		existingReleases []releaseStub
+		expected         *RenderedRelease
+		expectedError    *RenderError
+		shouldFail       bool
+	}{
+		{
+			desc: "render the manifests, hooks and notes",
+			templates: map[string]string{
+				"templates/service.yaml": serviceTemplate,
+				"templates/job.yaml":     jobTemplate,
+				"templates/NOTES.txt":    "Installed {{ .Release.Name }}",
+			},
+			values: "port: 8080",
+			expected: &RenderedRelease{
+				Manifests: []RenderedManifest{
+					{
+						Template:   "mychart/templates/service.yaml",
+						APIVersion: "v1",
+						Kind:       "Service",
+						Name:       "foo",
+						Manifest:   "apiVersion: v1\nkind: Service\nmetadata:\n  name: foo\nspec:\n  ports:\n  - port: 8080\n",
+					},
+				},
+				Hooks: []RenderedManifest{
+					{
+						Template:   "mychart/templates/job.yaml",
+						APIVersion: "batch/v1",
+						Kind:       "Job",
+						Name:       "foo-migrate",
+						Events:     []string{"pre-install", "pre-upgrade"},
+						Manifest:   "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: foo-migrate\n  annotations:\n    \"helm.sh/hook\": pre-install,pre-upgrade\n",
+					},
+				},
+				Notes: "Installed foo",
+			},
+		},
+		{
+			desc: "locate an execution error",
+			templates: map[string]string{
+				"templates/service.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: {{ required \"name is required\" .Values.name }}\n",
+			},
+			expectedError: &RenderError{
+				Template: "mychart/templates/service.yaml",
+				Line:     4,
+				Context: []SourceLine{
+					{Line: 2, Text: "kind: Service"},
+					{Line: 3, Text: "metadata:"},
+					{Line: 4, Text: "  name: {{ required \"name is required\" .Values.name }}"},
+					{Line: 5, Text: ""},
+				},
+			},
+		},
+		{
+			desc: "locate a parse error",
+			templates: map[string]string{
+				"templates/service.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: {{ undefinedFunction }}\n",
+			},
+			expectedError: &RenderError{
+				Template: "mychart/templates/service.yaml",
+				Line:     4,
+				Context: []SourceLine{
+					{Line: 2, Text: "kind: Service"},
+					{Line: 3, Text: "metadata:"},
+					{Line: 4, Text: "  name: {{ undefinedFunction }}"},
+					{Line: 5, Text: ""},
+				},
+			},
+		},
+		{
+			desc: "locate a YAML error",
+			templates: map[string]string{
+				"templates/service.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: [foo\n",
+			},
+			expectedError: &RenderError{
+				Template: "mychart/templates/service.yaml",
+				Line:     4,
+			},
+		},
+		{
+			desc:      "render with an existing name",
+			templates: map[string]string{"templates/service.yaml": serviceTemplate},
+			existingReleases: []releaseStub{
+				releaseStub{"foo", "default", 1, "1.0.0", release.StatusDeployed},
+			},
+			shouldFail: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			actionConfig := newActionConfigFixture(t)
+			makeReleases(t, actionConfig, tc.existingReleases)
+			rendered, err := RenderNewRelease(actionConfig, "foo", "default", tc.values, newChartFixture(tc.templates))
+			if tc.expectedError != nil {
+				renderErr, ok := err.(*RenderError)
+				if !ok {
+					t.Fatalf("expected a render error, got %v", err)
+				}
+				renderErr.Err = nil
+				if got, want := renderErr, tc.expectedError; !cmp.Equal(want, got) {
+					t.Errorf(cmp.Diff(want, got))
+				}
+				return
+			}
+			if got, want := err != nil, tc.shouldFail; got != want {
+				t.Fatalf("got error: %v, want error: %v (%v)", got, want, err)
+			}
+			if got, want := rendered, tc.expected; !cmp.Equal(want, got) {
+				t.Errorf(cmp.Diff(want, got))
+			}
+			// Nothing is installed by a dry run
+			rlss, err := actionConfig.Releases.ListReleases()
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if got, want := len(rlss), len(tc.existingReleases); got != want {
+				t.Errorf("got: %d releases, want: %d", got, want)
+			}
+		})
+	}
+}
+
+func TestRenderReleaseUpgrade(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		releases   []releaseStub
+		values     string
+		expected   *RenderedRelease
+		shouldFail bool
+	}{
+		{
+			desc: "render an upgrade",
+			releases: []releaseStub{
+				releaseStub{"foo", "default", 1, "1.0.0", release.StatusDeployed},
+			},
+			values: "port: 8080",
+			expected: &RenderedRelease{
+				Manifests: []RenderedManifest{
+					{
+						Template:   "mychart/templates/service.yaml",
+						APIVersion: "v1",
+						Kind:       "Service",
+						Name:       "foo",
+						Manifest:   "apiVersion: v1\nkind: Service\nmetadata:\n  name: foo\nspec:\n  ports:\n  - port: 8080\n",
+					},
+				},
+				Hooks: []RenderedManifest{},
+			},
+		},
+		{
+			desc:       "render the upgrade of a missing release",
+			shouldFail: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cfg := newActionConfigFixture(t)
+			makeReleases(t, cfg, tc.releases)
+			ch := newChartFixture(map[string]string{"templates/service.yaml": serviceTemplate})
+			rendered, err := RenderReleaseUpgrade(cfg, "foo", tc.values, ch)
+			if got, want := err != nil, tc.shouldFail; got != want {
+				t.Fatalf("got error: %v, want error: %v (%v)", got, want, err)
+			}
+			if got, want := rendered, tc.expected; !cmp.Equal(want, got) {
+				t.Errorf(cmp.Diff(want, got))
+			}
+			if tc.shouldFail {
+				return
+			}
+			// The upgrade is not recorded by a dry run
+			if _, err := cfg.Releases.Get("foo", 2); err == nil {
+				t.Errorf("the dry run should not store a new revision")
+			}
+		})
+	}
+}
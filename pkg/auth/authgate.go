@@ -34,10 +34,20 @@ func AuthCheckerForRequest(req *http.Request) (Checker, error) {
 //   * If the namespace is the global chart namespace (ie. kubeappsNamespace) then
 //     we allow read access regardless.
 func AuthGate(kubeappsNamespace string) negroni.HandlerFunc {
+	return authGate(kubeappsNamespace, AuthCheckerForRequest, nil)
+}
+
+// CachedAuthGate is an AuthGate keeping the namespace access of the tokens in
+// the given cache, for the services checking every request themselves.
+func CachedAuthGate(kubeappsNamespace string, cache *AccessCache) negroni.HandlerFunc {
+	return authGate(kubeappsNamespace, AuthCheckerForRequest, cache)
+}
+
+func authGate(kubeappsNamespace string, checkerForRequest CheckerForRequest, cache *AccessCache) negroni.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
-		userAuth, err := AuthCheckerForRequest(req)
-		if err != nil {
-			response.NewErrorResponse(http.StatusUnauthorized, err.Error()).Write(w)
+		token := ExtractToken(req.Header.Get("Authorization"))
+		if token == "" {
+			response.NewErrorResponse(http.StatusUnauthorized, "Authorization token missing").Write(w)
 			return
 		}
 		namespace := mux.Vars(req)["namespace"]
@@ -47,11 +57,24 @@ func AuthGate(kubeappsNamespace string) negroni.HandlerFunc {
 
 		// If the request is for the global public charts (ie. kubeappsNamespace)
 		// we do not check authz.
-		authz := false
 		if namespace == kubeappsNamespace {
-			authz = true
-		} else {
+			next(w, req)
+			return
+		}
+
+		authz, cached := cache.get(token, namespace)
+		var err error
+		if !cached {
+			var userAuth Checker
+			userAuth, err = checkerForRequest(req)
+			if err != nil {
+				response.NewErrorResponse(http.StatusUnauthorized, err.Error()).Write(w)
+				return
+			}
 			authz, err = userAuth.ValidateForNamespace(namespace)
+			if err == nil {
+				cache.set(token, namespace, authz)
+			}
 		}
 
 		if err != nil || !authz {
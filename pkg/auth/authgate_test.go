@@ -0,0 +1,135 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// countingChecker counts the namespace access reviews
+type countingChecker struct {
+	allowed bool
+	err     error
+	reviews *int
+}
+
+func (c countingChecker) ValidateForNamespace(namespace string) (bool, error) {
+	*c.reviews++
+	return c.allowed, c.err
+}
+
+func (c countingChecker) GetForbiddenActions(namespace, action, manifest string) ([]Action, error) {
+	return nil, nil
+}
+
+func serveGate(gate func(w http.ResponseWriter, req *http.Request, next http.HandlerFunc), token, namespace string) int {
+	req := httptest.NewRequest("GET", "/ns/"+namespace+"/charts", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req = mux.SetURLVars(req, map[string]string{"namespace": namespace})
+	w := httptest.NewRecorder()
+	gate(w, req, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return w.Code
+}
+
+func TestAuthGate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		token     string
+		namespace string
+		allowed   bool
+		err       error
+		checkErr  error
+		expected  int
+	}{
+		{"missing token", "", "default", true, nil, nil, http.StatusUnauthorized},
+		{"unable to create the checker", "abc", "default", true, nil, errors.New("not in cluster"), http.StatusUnauthorized},
+		{"allowed", "abc", "default", true, nil, nil, http.StatusOK},
+		{"forbidden", "abc", "default", false, nil, nil, http.StatusForbidden},
+		{"review error", "abc", "default", true, errors.New("boom"), nil, http.StatusForbidden},
+		{"kubeapps namespace", "abc", "kubeapps", false, nil, nil, http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reviews := 0
+			gate := authGate("kubeapps", func(req *http.Request) (Checker, error) {
+				return countingChecker{tc.allowed, tc.err, &reviews}, tc.checkErr
+			}, nil)
+			if got := serveGate(gate, tc.token, tc.namespace); got != tc.expected {
+				t.Errorf("Expecting status %d, got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCachedAuthGate(t *testing.T) {
+	now := time.Now()
+	cache := NewAccessCache(time.Minute)
+	cache.now = func() time.Time { return now }
+	reviews := 0
+	allowed := map[string]bool{"allowed-token": true}
+	var reviewErr error
+	gate := authGate("kubeapps", func(req *http.Request) (Checker, error) {
+		return countingChecker{allowed[ExtractToken(req.Header.Get("Authorization"))], reviewErr, &reviews}, nil
+	}, cache)
+
+	// Both allowed and forbidden results are cached per token and namespace
+	for i := 0; i < 2; i++ {
+		if got := serveGate(gate, "allowed-token", "default"); got != http.StatusOK {
+			t.Errorf("Expecting status %d, got %d", http.StatusOK, got)
+		}
+		if got := serveGate(gate, "other-token", "default"); got != http.StatusForbidden {
+			t.Errorf("Expecting status %d, got %d", http.StatusForbidden, got)
+		}
+	}
+	if reviews != 2 {
+		t.Errorf("Expecting 2 reviews, got %d", reviews)
+	}
+	serveGate(gate, "allowed-token", "other-namespace")
+	if reviews != 3 {
+		t.Errorf("Expecting 3 reviews, got %d", reviews)
+	}
+
+	// Expired results are reviewed again
+	now = now.Add(time.Minute)
+	serveGate(gate, "allowed-token", "default")
+	if reviews != 4 {
+		t.Errorf("Expecting 4 reviews, got %d", reviews)
+	}
+	if len(cache.entries) != 1 {
+		t.Errorf("Expecting the expired entries to be removed, got %d entries", len(cache.entries))
+	}
+
+	// Errors are not cached
+	now = now.Add(time.Minute)
+	reviewErr = errors.New("boom")
+	serveGate(gate, "allowed-token", "default")
+	reviewErr = nil
+	serveGate(gate, "allowed-token", "default")
+	if reviews != 6 {
+		t.Errorf("Expecting 6 reviews, got %d", reviews)
+	}
+}
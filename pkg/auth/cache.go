@@ -0,0 +1,86 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// AccessCache keeps the result of the namespace access reviews of the tokens
+// for a while, so a user browsing the catalog doesn't trigger a
+// SelfSubjectAccessReview for every request. Tokens are only kept hashed.
+type AccessCache struct {
+	ttl     time.Duration
+	now     func() time.Time
+	mutex   sync.Mutex
+	entries map[string]accessEntry
+}
+
+type accessEntry struct {
+	allowed bool
+	expires time.Time
+}
+
+// NewAccessCache returns a cache keeping the access reviews for the given
+// duration
+func NewAccessCache(ttl time.Duration) *AccessCache {
+	return &AccessCache{ttl: ttl, now: time.Now, entries: map[string]accessEntry{}}
+}
+
+func accessKey(token, namespace string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:]) + "/" + namespace
+}
+
+// get returns the cached access of a token to a namespace, if any
+func (c *AccessCache) get(token, namespace string) (bool, bool) {
+	if c == nil {
+		return false, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := accessKey(token, namespace)
+	entry, ok := c.entries[key]
+	if !ok {
+		return false, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return false, false
+	}
+	return entry.allowed, true
+}
+
+// set caches the access of a token to a namespace, dropping the expired
+// entries so the cache doesn't grow with the tokens no longer used
+func (c *AccessCache) set(token, namespace string, allowed bool) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := c.now()
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[accessKey(token, namespace)] = accessEntry{allowed: allowed, expires: now.Add(c.ttl)}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package blobstore stores content addressed blobs, like the chart tarballs
+// mirrored by the asset-syncer and served by the assetsvc.
+package blobstore
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// DatabaseStore is the store URL of the blobs stored in the catalog database
+	DatabaseStore = "database"
+	// FileScheme is the scheme of the store URL of the blobs stored in a directory
+	FileScheme = "file"
+)
+
+// ErrNotFound is returned when getting a blob which is not stored
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs identified by the hex encoded sha256 digest of their content
+type Store interface {
+	Exists(digest string) (bool, error)
+	Put(digest string, data []byte) error
+	Get(digest string) ([]byte, error)
+}
+
+// Pruner is implemented by the stores which can remove the blobs no longer
+// referenced by the catalog
+type Pruner interface {
+	Prune() error
+}
+
+// Open returns the store of a store URL, which is either "database" to use the
+// given database store or a "file:///path" URL to store the blobs in a
+// directory. No store is returned for an empty URL.
+func Open(storeURL string, database Store) (Store, error) {
+	if storeURL == "" {
+		return nil, nil
+	}
+	if storeURL == DatabaseStore {
+		return database, nil
+	}
+	u, err := url.Parse(storeURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blob store %q: %v", storeURL, err)
+	}
+	if u.Scheme != FileScheme || u.Path == "" {
+		return nil, fmt.Errorf("unsupported blob store %q, use %q or a %s:// URL", storeURL, DatabaseStore, FileScheme)
+	}
+	return NewFilesystemStore(u.Path)
+}
+
+// validDigest returns an error if the digest is not a sha256 hex digest, so
+// it can be safely used as a key
+func validDigest(digest string) error {
+	b, err := hex.DecodeString(digest)
+	if err != nil || len(b) != 32 {
+		return fmt.Errorf("invalid blob digest %q", digest)
+	}
+	return nil
+}
+
+type memoryStore struct {
+	mutex sync.RWMutex
+	blobs map[string][]byte
+}
+
+// NewMemoryStore returns a store keeping the blobs in memory
+func NewMemoryStore() Store {
+	return &memoryStore{blobs: map[string][]byte{}}
+}
+
+func (s *memoryStore) Exists(digest string) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, ok := s.blobs[digest]
+	return ok, nil
+}
+
+func (s *memoryStore) Put(digest string, data []byte) error {
+	if err := validDigest(digest); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.blobs[digest] = data
+	return nil
+}
+
+func (s *memoryStore) Get(digest string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	data, ok := s.blobs[digest]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+type filesystemStore struct {
+	dir string
+}
+
+// NewFilesystemStore returns a store keeping the blobs as files of a
+// directory, which is created if missing
+func NewFilesystemStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create the blob store directory: %v", err)
+	}
+	return &filesystemStore{dir: dir}, nil
+}
+
+func (s *filesystemStore) path(digest string) (string, error) {
+	if err := validDigest(digest); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, digest), nil
+}
+
+func (s *filesystemStore) Exists(digest string) (bool, error) {
+	p, err := s.path(digest)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(p)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Put writes the blob to a temporary file renamed once complete so readers
+// never get a partial blob
+func (s *filesystemStore) Put(digest string, data []byte) error {
+	p, err := s.path(digest)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.dir, digest+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *filesystemStore) Get(digest string) ([]byte, error) {
+	p, err := s.path(digest)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
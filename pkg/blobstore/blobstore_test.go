@@ -0,0 +1,139 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func digestOf(data []byte) string {
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
+
+func testStore(t *testing.T, s Store) {
+	data := []byte("chart tarball")
+	digest := digestOf(data)
+
+	exists, err := s.Exists(digest)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if exists {
+		t.Errorf("Expecting the blob to not exist")
+	}
+	if _, err := s.Get(digest); err != ErrNotFound {
+		t.Errorf("Expecting ErrNotFound, got %v", err)
+	}
+
+	if err := s.Put(digest, data); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	exists, err = s.Exists(digest)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !exists {
+		t.Errorf("Expecting the blob to exist")
+	}
+	got, err := s.Get(digest)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("Expecting %q, got %q", data, got)
+	}
+
+	if err := s.Put("../outside", data); err == nil {
+		t.Errorf("Expecting an error storing a blob with an invalid digest")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFilesystemStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobstore")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFilesystemStore(filepath.Join(dir, "tarballs"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	testStore(t, s)
+
+	// Only the blob is left in the directory
+	files, err := ioutil.ReadDir(filepath.Join(dir, "tarballs"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("Expecting 1 file, got %d", len(files))
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobstore")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	database := NewMemoryStore()
+
+	tests := []struct {
+		name     string
+		storeURL string
+		wantNil  bool
+		wantDB   bool
+		wantErr  bool
+	}{
+		{"no store", "", true, false, false},
+		{"database store", "database", false, true, false},
+		{"filesystem store", "file://" + dir, false, false, false},
+		{"unsupported scheme", "s3://bucket", false, false, true},
+		{"filesystem store without path", "file://", false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Open(tt.storeURL, database)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expecting an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if got := s == nil; got != tt.wantNil {
+				t.Errorf("Expecting nil store %v, got %v", tt.wantNil, got)
+			}
+			if got := s == database; got != tt.wantDB {
+				t.Errorf("Expecting database store %v, got %v", tt.wantDB, got)
+			}
+		})
+	}
+}
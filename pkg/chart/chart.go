@@ -27,6 +27,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/ghodss/yaml"
 	appRepov1 "github.com/kubeapps/kubeapps/cmd/apprepository-controller/pkg/apis/apprepository/v1alpha1"
@@ -84,23 +85,42 @@ type Resolver interface {
 	InitNetClient(details *Details) (kube.HTTPClient, error)
 }
 
+// mirrorTimeoutSeconds is the timeout of the requests for the charts mirrored
+// by the assetsvc
+const mirrorTimeoutSeconds = 30
+
 // ChartClient struct contains the clients required to retrieve charts info
 type ChartClient struct {
 	appRepoHandler    kube.AuthHandler
 	userAgent         string
 	kubeappsNamespace string
 	appRepo           *appRepov1.AppRepository
+	// assetsvcURL is the URL of the assetsvc serving the mirrored charts, the
+	// charts are downloaded from the repository if empty
+	assetsvcURL  string
+	mirrorClient kube.HTTPClient
+	// assetsvcToken authorizes the requests for the mirrored charts when the
+	// assetsvc checks the namespace access itself
+	assetsvcToken string
 }
 
 // NewChartClient returns a new ChartClient
-func NewChartClient(appRepoHandler kube.AuthHandler, kubeappsNamespace, userAgent string) *ChartClient {
+func NewChartClient(appRepoHandler kube.AuthHandler, kubeappsNamespace, userAgent, assetsvcURL string) *ChartClient {
 	return &ChartClient{
 		appRepoHandler:    appRepoHandler,
 		userAgent:         userAgent,
 		kubeappsNamespace: kubeappsNamespace,
+		assetsvcURL:       assetsvcURL,
+		mirrorClient:      &http.Client{Timeout: time.Second * mirrorTimeoutSeconds},
 	}
 }
 
+// SetAssetsvcToken sets the bearer token sent to the assetsvc to download the
+// mirrored charts
+func (c *ChartClient) SetAssetsvcToken(token string) {
+	c.assetsvcToken = token
+}
+
 func getReq(rawURL string) (*http.Request, error) {
 	parsedURL, err := url.ParseRequestURI(rawURL)
 	if err != nil {
@@ -233,6 +253,11 @@ func fetchChart(netClient *kube.HTTPClient, chartURL string, requireV1Support bo
 	if err != nil {
 		return nil, err
 	}
+	return loadChart(data, requireV1Support)
+}
+
+// loadChart returns the Chart content given its tarball
+func loadChart(data []byte, requireV1Support bool) (*ChartMultiVersion, error) {
 	// We only return an error when loading using the helm2loader (ie. chart v1)
 	// if we require v1 support, otherwise we continue to load using the
 	// helm3 v2 loader.
@@ -301,9 +326,48 @@ func (c *ChartClient) InitNetClient(details *Details) (kube.HTTPClient, error) {
 	return kube.InitNetClient(appRepo, caCertSecret, authSecret, http.Header{"User-Agent": []string{c.userAgent}})
 }
 
+// mirroredChartURL returns the URL of a chart tarball mirrored by the assetsvc
+func (c *ChartClient) mirroredChartURL(details *Details) string {
+	return fmt.Sprintf("%s/v1/ns/%s/assets/%s/%s/versions/%s/chart.tgz",
+		strings.TrimSuffix(c.assetsvcURL, "/"),
+		url.PathEscape(c.appRepo.Namespace),
+		url.PathEscape(c.appRepo.Name),
+		url.PathEscape(details.ChartName),
+		url.PathEscape(details.Version))
+}
+
+// fetchMirroredChart returns the tarball of a chart mirrored by the assetsvc
+func (c *ChartClient) fetchMirroredChart(details *Details) ([]byte, error) {
+	req, err := getReq(c.mirroredChartURL(details))
+	if err != nil {
+		return nil, err
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	if c.assetsvcToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.assetsvcToken)
+	}
+	res, err := c.mirrorClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return readResponseBody(res)
+}
+
 // GetChart retrieves and loads a Chart from a registry in both
-// v2 and v3 formats.
+// v2 and v3 formats. The chart mirrored by the assetsvc is preferred so
+// installs don't depend on the availability of the repository.
 func (c *ChartClient) GetChart(details *Details, netClient kube.HTTPClient, requireV1Support bool) (*ChartMultiVersion, error) {
+	if c.assetsvcURL != "" && c.mirrorClient != nil {
+		data, err := c.fetchMirroredChart(details)
+		if err == nil {
+			log.Printf("Using the mirrored chart %s-%s", details.ChartName, details.Version)
+			return loadChart(data, requireV1Support)
+		}
+		log.Printf("Unable to get the mirrored chart %s-%s, downloading it from the repository: %v", details.ChartName, details.Version, err)
+	}
+
 	indexURL := strings.TrimSuffix(strings.TrimSpace(c.appRepo.Spec.URL), "/") + "/index.yaml"
 
 	repoIndex, err := fetchRepoIndex(&netClient, indexURL)
@@ -25,6 +25,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
@@ -524,6 +525,100 @@ func TestGetChart(t *testing.T) {
 	}
 }
 
+// Fake assetsvc serving the mirrored charts of the testdata directory
+type fakeMirrorClient struct {
+	assetsvcURL string
+	mirrored    bool
+	requests    []*http.Request
+}
+
+func (f *fakeMirrorClient) Do(h *http.Request) (*http.Response, error) {
+	f.requests = append(f.requests, h)
+	if !f.mirrored {
+		return &http.Response{StatusCode: 404, Body: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+	}
+	// The path is /v1/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/chart.tgz
+	parts := strings.Split(strings.TrimPrefix(h.URL.String(), f.assetsvcURL), "/")
+	if len(parts) != 10 || parts[9] != "chart.tgz" {
+		return nil, fmt.Errorf("Unexpected path %q", h.URL.String())
+	}
+	f2, err := os.Open(path.Join(".", "testdata", fmt.Sprintf("%s-%s.tgz", parts[6], parts[8])))
+	if err != nil {
+		return &http.Response{StatusCode: 404, Body: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+	}
+	return &http.Response{StatusCode: 200, Body: f2}, nil
+}
+
+func TestGetMirroredChart(t *testing.T) {
+	const repoName = "foo-repo"
+	const repoURL = "http://example.com/"
+	const assetsvcURL = "http://assetsvc:8080"
+	testCases := []struct {
+		name             string
+		mirrored         bool
+		wantRepoRequests int
+	}{
+		{
+			name:             "gets the mirrored chart",
+			mirrored:         true,
+			wantRepoRequests: 0,
+		},
+		{
+			name:             "downloads the chart from the repository if it's not mirrored",
+			mirrored:         false,
+			wantRepoRequests: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		target := Details{
+			AppRepositoryResourceName: repoName,
+			ChartName:                 "nginx",
+			ReleaseName:               "foo",
+			Version:                   "5.1.1-apiVersionV1",
+		}
+		t.Run(tc.name, func(t *testing.T) {
+			httpClient := newHTTPClient(repoURL, []Details{target}, "")
+			mirrorClient := &fakeMirrorClient{assetsvcURL: assetsvcURL, mirrored: tc.mirrored}
+			chUtils := ChartClient{
+				appRepo: &appRepov1.AppRepository{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      repoName,
+						Namespace: metav1.NamespaceSystem,
+					},
+					Spec: appRepov1.AppRepositorySpec{
+						URL: repoURL,
+					},
+				},
+				assetsvcURL:  assetsvcURL,
+				mirrorClient: mirrorClient,
+			}
+			chUtils.SetAssetsvcToken("user-token")
+			ch, err := chUtils.GetChart(&target, httpClient, false)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got, want := ch.Helm3Chart.Name(), "nginx"; got != want {
+				t.Errorf("got: %q, want: %q", got, want)
+			}
+
+			if got, want := len(mirrorClient.requests), 1; got != want {
+				t.Fatalf("got: %d, want %d", got, want)
+			}
+			if got, want := mirrorClient.requests[0].URL.String(), "http://assetsvc:8080/v1/ns/kube-system/assets/foo-repo/nginx/versions/5.1.1-apiVersionV1/chart.tgz"; got != want {
+				t.Errorf("got: %q, want: %q", got, want)
+			}
+			// The user token authorizes the request for the mirrored chart
+			if got, want := mirrorClient.requests[0].Header.Get("Authorization"), "Bearer user-token"; got != want {
+				t.Errorf("got: %q, want: %q", got, want)
+			}
+			if got, want := len(getFakeClientRequests(t, httpClient)), tc.wantRepoRequests; got != want {
+				t.Errorf("got: %d, want %d", got, want)
+			}
+		})
+	}
+}
+
 func TestGetIndexFromCache(t *testing.T) {
 	repoURL := "https://test.com"
 	data := []byte("foo")
@@ -18,10 +18,12 @@ package models
 
 import (
 	"encoding/json"
+	"sort"
 	"time"
 
 	"database/sql/driver"
 
+	"github.com/globalsign/mgo/bson"
 	"k8s.io/helm/pkg/proto/hapi/chart"
 )
 
@@ -54,14 +56,15 @@ type Chart struct {
 	Icon            string             `json:"icon"`
 	RawIcon         []byte             `json:"raw_icon" bson:"raw_icon"`
 	IconContentType string             `json:"icon_content_type" bson:"icon_content_type,omitempty"`
+	Category        string             `json:"category,omitempty" bson:"category,omitempty"`
 	ChartVersions   []ChartVersion     `json:"chartVersions"`
 }
 
-// ChartIconString is a higher-level representation of a chart package
-// TODO(andresmgot) Replace this type when the icon is stored as a binary
-type ChartIconString struct {
-	Chart
-	RawIcon string `json:"raw_icon" bson:"raw_icon"`
+// ChartIcon is the icon of a chart, the digest identifies its content
+type ChartIcon struct {
+	Data        []byte
+	ContentType string
+	Digest      string
 }
 
 // ChartVersion is a representation of a specific version of a chart
@@ -77,16 +80,129 @@ type ChartVersion struct {
 	Readme string `json:"readme" bson:"-"`
 	Values string `json:"values" bson:"-"`
 	Schema string `json:"schema" bson:"-"`
+	// The following fields are the Chart.yaml metadata of the version found
+	// in the repository index
+	APIVersion  string      `json:"apiVersion,omitempty" bson:"apiversion,omitempty"`
+	KubeVersion string      `json:"kubeVersion,omitempty" bson:"kubeversion,omitempty"`
+	Type        string      `json:"type,omitempty" bson:"type,omitempty"`
+	Deprecated  bool        `json:"deprecated,omitempty" bson:"deprecated,omitempty"`
+	Condition   string      `json:"condition,omitempty" bson:"condition,omitempty"`
+	Tags        string      `json:"tags,omitempty" bson:"tags,omitempty"`
+	Annotations Annotations `json:"annotations,omitempty" bson:"annotations,omitempty"`
+	// Dependencies are only listed in the index for apiVersion v2 charts
+	Dependencies []ChartDependency `json:"dependencies,omitempty" bson:"dependencies,omitempty"`
+	// Incompatible is set in the responses when the kubeVersion of the
+	// version is not satisfied by the Kubernetes version of the request
+	Incompatible bool `json:"incompatible,omitempty" bson:"-"`
 }
 
+// LibraryChartType is the type of the charts which can't be installed,
+// charts without a type are applications
+const LibraryChartType = "library"
+
+// Annotations are the annotations of a Chart.yaml. MongoDB stores them as a
+// list of key-value pairs since their keys often contain dots.
+type Annotations map[string]string
+
+// annotation is an annotation stored in MongoDB
+type annotation struct {
+	Key   string `bson:"key"`
+	Value string `bson:"value"`
+}
+
+// GetBSON implements bson.Getter
+func (a Annotations) GetBSON() (interface{}, error) {
+	if a == nil {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	list := make([]annotation, 0, len(a))
+	for _, k := range keys {
+		list = append(list, annotation{Key: k, Value: a[k]})
+	}
+	return list, nil
+}
+
+// SetBSON implements bson.Setter
+func (a *Annotations) SetBSON(raw bson.Raw) error {
+	var list []annotation
+	if err := raw.Unmarshal(&list); err != nil {
+		return err
+	}
+	*a = Annotations{}
+	for _, item := range list {
+		(*a)[item.Key] = item.Value
+	}
+	return nil
+}
+
+// ChartFilesFormatVersion is the version of the data derived from the tarball
+// of a chart version: its dependencies, images, parameters and generated
+// schema. It's increased when that data changes so the files imported by an
+// older syncer are imported again.
+const ChartFilesFormatVersion = 2
+
 // ChartFiles holds the README and values for a given chart version
 type ChartFiles struct {
-	ID     string `bson:"file_id"`
-	Readme string
-	Values string
-	Schema string
-	Repo   *Repo
-	Digest string
+	ID      string `bson:"file_id"`
+	ChartID string `bson:"chart_id"`
+	Version string
+	Readme  string
+	Values  string
+	Schema  string
+	// SchemaGenerated is set when the schema is inferred from the values
+	// since the chart version has no values.schema.json
+	SchemaGenerated bool `json:",omitempty" bson:",omitempty"`
+	Repo            *Repo
+	Digest          string
+	Dependencies    []ChartDependency
+	Images          []string
+	Parameters      []ChartParameter
+	// FormatVersion is the ChartFilesFormatVersion of the syncer which
+	// imported the files
+	FormatVersion int `json:",omitempty" bson:",omitempty"`
+}
+
+// ChartParameter is a value of a chart version documented by the comments of
+// its values.yaml
+type ChartParameter struct {
+	// Path is the dotted path of the value, e.g. image.tag
+	Path string `json:"path"`
+	// Type is the JSON type of the value, empty if unknown
+	Type        string      `json:"type,omitempty" bson:"type,omitempty"`
+	Default     interface{} `json:"default"`
+	Description string      `json:"description"`
+}
+
+// ChartDependency is a dependency declared by a chart version, either in its
+// Chart.yaml (apiVersion v2) or in its requirements.yaml (apiVersion v1)
+type ChartDependency struct {
+	Name       string   `json:"name"`
+	Version    string   `json:"version"`
+	Repository string   `json:"repository"`
+	Condition  string   `json:"condition,omitempty" bson:"condition,omitempty"`
+	Tags       []string `json:"tags,omitempty" bson:"tags,omitempty"`
+	Alias      string   `json:"alias,omitempty" bson:"alias,omitempty"`
+}
+
+// ChartImage is a container image used by a chart version
+type ChartImage struct {
+	ChartID string `json:"chartID"`
+	Version string `json:"version"`
+	Repo    *Repo  `json:"repo"`
+	Image   string `json:"image"`
+}
+
+// ChartDependent is a chart version declaring a dependency on another chart
+type ChartDependent struct {
+	ChartID    string          `json:"chartID"`
+	Version    string          `json:"version"`
+	Repo       *Repo           `json:"repo"`
+	Dependency ChartDependency `json:"dependency"`
 }
 
 // Allow to convert ChartFiles to a sql JSON
@@ -94,6 +210,52 @@ func (a ChartFiles) Value() (driver.Value, error) {
 	return json.Marshal(a)
 }
 
+// SyncReport summarizes an asset-syncer run for a repository
+type SyncReport struct {
+	Repo          *Repo         `json:"repo"`
+	StartTime     time.Time     `json:"startTime" bson:"start_time"`
+	EndTime       time.Time     `json:"endTime" bson:"end_time"`
+	Checksum      string        `json:"checksum"`
+	ChartsAdded   []string      `json:"chartsAdded" bson:"charts_added"`
+	ChartsUpdated []string      `json:"chartsUpdated" bson:"charts_updated"`
+	ChartsRemoved []string      `json:"chartsRemoved" bson:"charts_removed"`
+	Failures      []SyncFailure `json:"failures"`
+	// Missing are the optional assets the charts don't have, like an icon or
+	// a README
+	Missing []SyncMissingAsset `json:"missing"`
+	// Skipped is set if the repository didn't change since its last sync, so
+	// nothing was imported
+	Skipped bool `json:"skipped,omitempty" bson:"skipped,omitempty"`
+	// Error is set if the sync could not be completed
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// SyncFailure is a chart asset which could not be imported during a sync
+type SyncFailure struct {
+	ChartID string `json:"chartID" bson:"chart_id"`
+	// Version is empty for failures related to the chart rather than to a
+	// specific version (e.g. the icon)
+	Version string `json:"version,omitempty" bson:"version,omitempty"`
+	// Asset is one of icon, files, parameters, schema or tarball
+	Asset string `json:"asset"`
+	Error string `json:"error"`
+}
+
+// SyncMissingAsset is an optional chart asset not found during a sync
+type SyncMissingAsset struct {
+	ChartID string `json:"chartID" bson:"chart_id"`
+	// Version is empty for the assets of the chart rather than of a specific
+	// version (e.g. the icon)
+	Version string `json:"version,omitempty" bson:"version,omitempty"`
+	// Asset is one of icon, readme, values or schema
+	Asset string `json:"asset"`
+}
+
+// Allow to convert SyncReport to a sql JSON
+func (r SyncReport) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
 type RepoCheck struct {
 	ID         string    `bson:"_id"`
 	LastUpdate time.Time `bson:"last_update"`
@@ -0,0 +1,309 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package parameters parses the documentation of the values of a chart from
+// the comments of its values.yaml and infers a JSON schema of the values.
+package parameters
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+)
+
+var (
+	// annotationRegex matches the "## @param path [modifiers] description"
+	// comments of the Bitnami readme generator
+	annotationRegex = regexp.MustCompile(`^#+\s*@(param|extra)\s+(\S+)\s*(.*)$`)
+	modifiersRegex  = regexp.MustCompile(`^\[([^\]]*)\]\s*(.*)$`)
+	// helmDocsRegex matches the "# -- description" comments of helm-docs and
+	// the older "# path -- description" ones
+	helmDocsRegex = regexp.MustCompile(`^#+\s*([\w./-]*)\s*--(\s+(.*))?$`)
+	defaultRegex  = regexp.MustCompile(`^#+\s*@default\s*--\s*(.*)$`)
+	typeRegex     = regexp.MustCompile(`^\((\w+)\)\s*(.*)$`)
+	keyRegex      = regexp.MustCompile(`^("[^"]*"|'[^']*'|[^\s#"'-][^:#]*?|-[^\s:#][^:#]*?)\s*:(\s+(.*))?$`)
+)
+
+// doc is the documentation of a value
+type doc struct {
+	description string
+	typ         string
+	// def replaces the default value if set
+	def *string
+}
+
+// key is a key of the values, indented by its depth
+type key struct {
+	indent int
+	name   string
+}
+
+// Parse returns the parameters documented in the comments of a values.yaml.
+// If any value is annotated with "## @param path [modifiers] description", as
+// the Bitnami readme generator expects, the annotated values are returned in
+// the order of the annotations. Otherwise every value is returned in the
+// order of the file, described by the helm-docs "# -- description" comment
+// above its key. The values documented as a whole hide their nested values.
+func Parse(values []byte) ([]models.ChartParameter, error) {
+	params, _, err := parse(values)
+	return params, err
+}
+
+// parse returns the parameters documented in the comments of a values.yaml
+// and the plain comments above the keys which are not documented, by path
+func parse(values []byte) ([]models.ChartParameter, map[string]string, error) {
+	var parsed map[string]interface{}
+	if err := yaml.Unmarshal(values, &parsed); err != nil {
+		return nil, nil, err
+	}
+
+	annotated := []string{}
+	annotations := map[string]doc{}
+	extra := map[string]bool{}
+	order := []string{}
+	segments := map[string][]string{}
+	documented := map[string]doc{}
+	plain := map[string]string{}
+
+	var stack []key
+	var comments []string
+	// The lines indented deeper than skipIndent belong to a list or a block
+	// scalar, the keys nested in lists are not documented
+	skipIndent := -1
+	for _, line := range strings.Split(string(values), "\n") {
+		trimmed := strings.TrimSpace(line)
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		switch {
+		case trimmed == "":
+			comments = nil
+			continue
+		case strings.HasPrefix(trimmed, "#"):
+			if m := annotationRegex.FindStringSubmatch(trimmed); m != nil {
+				path := m[2]
+				if _, ok := annotations[path]; !ok {
+					annotated = append(annotated, path)
+				}
+				annotations[path] = parseAnnotation(m[3])
+				extra[path] = m[1] == "extra"
+				continue
+			}
+			comments = append(comments, trimmed)
+			continue
+		case trimmed == "---":
+			stack = nil
+			comments = nil
+			continue
+		}
+		if skipIndent >= 0 && (indent > skipIndent || (indent == skipIndent && strings.HasPrefix(trimmed, "-"))) {
+			comments = nil
+			continue
+		}
+		skipIndent = -1
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			skipIndent = indent
+			comments = nil
+			continue
+		}
+		m := keyRegex.FindStringSubmatch(trimmed)
+		if m == nil {
+			comments = nil
+			continue
+		}
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, key{indent, strings.Trim(m[1], `"'`)})
+		names := make([]string, len(stack))
+		for i, k := range stack {
+			names[i] = k.name
+		}
+		path := strings.Join(names, ".")
+		if _, ok := segments[path]; !ok {
+			order = append(order, path)
+			segments[path] = names
+		}
+		docs := parseHelmDocs(comments)
+		for p, d := range docs {
+			if p == "" {
+				p = path
+			}
+			documented[p] = d
+		}
+		if len(docs) == 0 && len(comments) > 0 {
+			plain[path] = plainComment(comments)
+		}
+		comments = nil
+		if v := strings.TrimSpace(m[3]); strings.HasPrefix(v, "|") || strings.HasPrefix(v, ">") {
+			skipIndent = indent
+		}
+	}
+
+	params := []models.ChartParameter{}
+	if len(annotated) > 0 {
+		for _, path := range annotated {
+			var value interface{}
+			if !extra[path] {
+				names, ok := segments[path]
+				if !ok {
+					names = strings.Split(path, ".")
+				}
+				value = lookup(parsed, names)
+			}
+			params = append(params, newParameter(path, value, annotations[path]))
+		}
+		return params, plain, nil
+	}
+	for _, path := range order {
+		if documentedAncestor(path, segments[path], documented) {
+			continue
+		}
+		value := lookup(parsed, segments[path])
+		d, ok := documented[path]
+		if m, isMap := value.(map[string]interface{}); isMap && len(m) > 0 && !ok {
+			continue
+		}
+		params = append(params, newParameter(path, value, d))
+	}
+	return params, plain, nil
+}
+
+// parseAnnotation parses the "[modifiers] description" of an annotation
+func parseAnnotation(text string) doc {
+	d := doc{description: text}
+	m := modifiersRegex.FindStringSubmatch(text)
+	if m == nil {
+		return d
+	}
+	d.description = m[2]
+	for _, modifier := range strings.Split(m[1], ",") {
+		modifier = strings.TrimSpace(modifier)
+		switch {
+		case modifier == "array" || modifier == "object" || modifier == "string":
+			d.typ = modifier
+		case strings.HasPrefix(modifier, "default:"):
+			def := strings.TrimSpace(strings.TrimPrefix(modifier, "default:"))
+			d.def = &def
+		}
+	}
+	return d
+}
+
+// parseHelmDocs returns the documentation of the helm-docs comments above a
+// key by path, the empty path being the key itself
+func parseHelmDocs(comments []string) map[string]doc {
+	docs := map[string]doc{}
+	var current *doc
+	var currentPath string
+	for _, c := range comments {
+		if m := defaultRegex.FindStringSubmatch(c); m != nil {
+			if current != nil {
+				def := m[1]
+				current.def = &def
+				docs[currentPath] = *current
+			}
+			continue
+		}
+		if m := helmDocsRegex.FindStringSubmatch(c); m != nil {
+			currentPath = m[1]
+			current = &doc{description: m[3]}
+			if t := typeRegex.FindStringSubmatch(current.description); t != nil {
+				current.typ, current.description = t[1], t[2]
+			}
+			docs[currentPath] = *current
+			continue
+		}
+		// Comments following a description continue it
+		if current != nil {
+			text := strings.TrimSpace(strings.TrimLeft(c, "#"))
+			current.description = strings.TrimSpace(current.description + " " + text)
+			docs[currentPath] = *current
+		}
+	}
+	return docs
+}
+
+// plainComment returns the text of the comment lines above a key
+func plainComment(comments []string) string {
+	lines := []string{}
+	for _, c := range comments {
+		if text := strings.TrimSpace(strings.TrimLeft(c, "#")); text != "" {
+			lines = append(lines, text)
+		}
+	}
+	return strings.Join(lines, " ")
+}
+
+// documentedAncestor returns true if a parent of the path is documented
+func documentedAncestor(path string, names []string, documented map[string]doc) bool {
+	for i := 1; i < len(names); i++ {
+		if _, ok := documented[strings.Join(names[:i], ".")]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the value at the path of the values, nil if not found
+func lookup(values map[string]interface{}, names []string) interface{} {
+	var value interface{} = values
+	for _, name := range names {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[name]
+	}
+	return value
+}
+
+func newParameter(path string, value interface{}, d doc) models.ChartParameter {
+	p := models.ChartParameter{
+		Path:        path,
+		Type:        d.typ,
+		Default:     value,
+		Description: d.description,
+	}
+	if p.Type == "" {
+		p.Type = valueType(value)
+	}
+	if d.def != nil {
+		p.Default = *d.def
+	}
+	return p
+}
+
+// valueType returns the JSON schema type of a value, empty for null values
+func valueType(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return ""
+}
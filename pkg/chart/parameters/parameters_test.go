@@ -0,0 +1,143 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parameters
+
+import (
+	"testing"
+
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   string
+		expected []models.ChartParameter
+	}{
+		{
+			name:     "empty values",
+			values:   "",
+			expected: []models.ChartParameter{},
+		},
+		{
+			name: "undocumented values",
+			values: `# Default values for foo.
+replicaCount: 1
+image:
+  repository: nginx
+  pullPolicy: IfNotPresent
+  tag:
+resources: {}
+`,
+			expected: []models.ChartParameter{
+				{Path: "replicaCount", Type: "integer", Default: float64(1)},
+				{Path: "image.repository", Type: "string", Default: "nginx"},
+				{Path: "image.pullPolicy", Type: "string", Default: "IfNotPresent"},
+				{Path: "image.tag"},
+				{Path: "resources", Type: "object", Default: map[string]interface{}{}},
+			},
+		},
+		{
+			name: "helm-docs comments",
+			values: `image:
+  # -- The image repository
+  repository: nginx
+  # -- (string) Overrides the image tag
+  # whose default is the chart appVersion
+  # @default -- the appVersion
+  tag:
+
+# A comment which is not a description
+ratio: 0.5
+
+# -- Labels of the pods
+podLabels:
+  app: foo
+  tier: web
+
+# image.pullPolicy -- The pull policy
+ingress:
+  hosts:
+  - host: foo.local
+    paths: []
+  annotations: |
+    foo: bar
+  enabled: false
+`,
+			expected: []models.ChartParameter{
+				{Path: "image.repository", Type: "string", Default: "nginx", Description: "The image repository"},
+				{Path: "image.tag", Type: "string", Default: "the appVersion", Description: "Overrides the image tag whose default is the chart appVersion"},
+				{Path: "ratio", Type: "number", Default: 0.5},
+				{Path: "podLabels", Type: "object", Default: map[string]interface{}{"app": "foo", "tier": "web"}, Description: "Labels of the pods"},
+				{Path: "ingress.hosts", Type: "array", Default: []interface{}{map[string]interface{}{"host": "foo.local", "paths": []interface{}{}}}},
+				{Path: "ingress.annotations", Type: "string", Default: "foo: bar\n"},
+				{Path: "ingress.enabled", Type: "boolean", Default: false},
+			},
+		},
+		{
+			name: "readme generator annotations",
+			values: `## @section Global parameters
+## @param global.imageRegistry Global Docker image registry
+## @param global.imagePullSecrets [array] Global registry secret names
+global:
+  imageRegistry: ""
+  imagePullSecrets: []
+
+## @param image.tag [default: latest] Image tag
+image:
+  tag: 1.0.0
+  ## Not annotated
+  pullPolicy: Always
+
+## @param podAnnotations [object] Annotations of the pods
+podAnnotations:
+  foo: bar
+## @extra ingress.tls TLS configuration of the ingress
+`,
+			expected: []models.ChartParameter{
+				{Path: "global.imageRegistry", Type: "string", Default: "", Description: "Global Docker image registry"},
+				{Path: "global.imagePullSecrets", Type: "array", Default: []interface{}{}, Description: "Global registry secret names"},
+				{Path: "image.tag", Type: "string", Default: "latest", Description: "Image tag"},
+				{Path: "podAnnotations", Type: "object", Default: map[string]interface{}{"foo": "bar"}, Description: "Annotations of the pods"},
+				{Path: "ingress.tls", Description: "TLS configuration of the ingress"},
+			},
+		},
+		{
+			name: "keys with dots",
+			values: `podAnnotations:
+  # -- Scrape the pods
+  "prometheus.io/scrape": "true"
+`,
+			expected: []models.ChartParameter{
+				{Path: "podAnnotations.prometheus.io/scrape", Type: "string", Default: "true", Description: "Scrape the pods"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := Parse([]byte(tt.values))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, params)
+		})
+	}
+}
+
+func TestParseInvalidValues(t *testing.T) {
+	_, err := Parse([]byte("foo: [bar"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,99 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parameters
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// SchemaDraft is the JSON schema version of the generated schemas
+const SchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// jsonSchema is the subset of a JSON schema inferred from the values
+type jsonSchema struct {
+	Schema      string                 `json:"$schema,omitempty"`
+	Type        string                 `json:"type,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Default     interface{}            `json:"default,omitempty"`
+	Properties  map[string]*jsonSchema `json:"properties,omitempty"`
+	Items       *jsonSchema            `json:"items,omitempty"`
+}
+
+// Schema returns a JSON schema of a values.yaml for the charts without a
+// values.schema.json. The types are inferred from the default values, which
+// are the defaults of the schema, and the descriptions are the ones of the
+// documented parameters. The values which are not documented are described by
+// the comment lines right above their key, if any.
+func Schema(values []byte) ([]byte, error) {
+	var parsed map[string]interface{}
+	if err := yaml.Unmarshal(values, &parsed); err != nil {
+		return nil, err
+	}
+	params, plain, err := parse(values)
+	if err != nil {
+		return nil, err
+	}
+	docs := map[string]doc{}
+	for path, description := range plain {
+		docs[path] = doc{description: description}
+	}
+	for _, p := range params {
+		d := doc{description: p.Description, typ: p.Type}
+		if d.description == "" {
+			d.description = docs[p.Path].description
+		}
+		docs[p.Path] = d
+	}
+
+	schema := inferSchema(nil, parsed, docs, true)
+	schema.Schema = SchemaDraft
+	schema.Type = "object"
+	schema.Default = nil
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// inferSchema returns the schema of the value at a path of the values. The
+// items of the arrays are inferred from their first item, without defaults.
+func inferSchema(names []string, value interface{}, docs map[string]doc, defaults bool) *jsonSchema {
+	d := docs[strings.Join(names, ".")]
+	s := &jsonSchema{Type: valueType(value), Description: d.description}
+	if s.Type == "" {
+		s.Type = d.typ
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			break
+		}
+		s.Properties = map[string]*jsonSchema{}
+		for k, child := range v {
+			s.Properties[k] = inferSchema(append(names[:len(names):len(names)], k), child, docs, defaults)
+		}
+		return s
+	case []interface{}:
+		if len(v) > 0 {
+			s.Items = inferSchema(nil, v[0], nil, false)
+		}
+	}
+	if defaults {
+		s.Default = value
+	}
+	return s
+}
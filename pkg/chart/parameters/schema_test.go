@@ -0,0 +1,136 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parameters
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   string
+		expected string
+	}{
+		{
+			name:     "empty values",
+			values:   "",
+			expected: `{"$schema": "http://json-schema.org/draft-07/schema#", "type": "object"}`,
+		},
+		{
+			name: "documented values",
+			values: `# -- Number of replicas
+replicaCount: 1
+image:
+  # -- The image repository
+  repository: nginx
+  # -- (string) Overrides the image tag
+  tag:
+ingress:
+  enabled: false
+  hosts:
+  - host: foo.local
+    paths: []
+resources: {}
+`,
+			expected: `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "properties": {
+    "replicaCount": {"type": "integer", "description": "Number of replicas", "default": 1},
+    "image": {
+      "type": "object",
+      "properties": {
+        "repository": {"type": "string", "description": "The image repository", "default": "nginx"},
+        "tag": {"type": "string", "description": "Overrides the image tag"}
+      }
+    },
+    "ingress": {
+      "type": "object",
+      "properties": {
+        "enabled": {"type": "boolean", "default": false},
+        "hosts": {
+          "type": "array",
+          "default": [{"host": "foo.local", "paths": []}],
+          "items": {
+            "type": "object",
+            "properties": {
+              "host": {"type": "string"},
+              "paths": {"type": "array"}
+            }
+          }
+        }
+      }
+    },
+    "resources": {"type": "object", "default": {}}
+  }
+}`,
+		},
+		{
+			name: "plain comments",
+			values: `## Number of replicas
+replicaCount: 1
+## Image parameters
+## ref: https://hub.docker.com/r/bitnami/nginx
+image:
+  # The image repository
+  repository: nginx
+  # -- The image tag
+  tag: latest
+# Not the comment of a key
+
+service:
+  type: ClusterIP
+`,
+			expected: `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "properties": {
+    "replicaCount": {"type": "integer", "description": "Number of replicas", "default": 1},
+    "image": {
+      "type": "object",
+      "description": "Image parameters ref: https://hub.docker.com/r/bitnami/nginx",
+      "properties": {
+        "repository": {"type": "string", "description": "The image repository", "default": "nginx"},
+        "tag": {"type": "string", "description": "The image tag", "default": "latest"}
+      }
+    },
+    "service": {
+      "type": "object",
+      "properties": {
+        "type": {"type": "string", "default": "ClusterIP"}
+      }
+    }
+  }
+}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := Schema([]byte(tt.values))
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(schema))
+		})
+	}
+}
+
+func TestSchemaInvalidValues(t *testing.T) {
+	_, err := Schema([]byte("foo: [bar"))
+	assert.Error(t, err)
+}
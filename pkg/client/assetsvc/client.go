@@ -0,0 +1,270 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by pkg/openapi/gen. DO NOT EDIT.
+
+package assetsvc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client sends requests to the Kubeapps assetsvc API
+type Client struct {
+	// BaseURL is the URL the API is served at
+	BaseURL string
+	// Token is sent as bearer token if not empty
+	Token string
+	// HTTPClient sends the requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client of the API served at the given URL
+func NewClient(baseURL, token string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Token: token}
+}
+
+// Error is an error response of the API
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Decode decodes the JSON body of a response and closes it
+func Decode(res *http.Response, v interface{}) error {
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 400 {
+		defer res.Body.Close()
+		data, _ := ioutil.ReadAll(res.Body)
+		apiErr := &Error{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(data))}
+		var errorBody struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &errorBody) == nil && errorBody.Message != "" {
+			apiErr.Message = errorBody.Message
+		}
+		return nil, apiErr
+	}
+	return res, nil
+}
+
+// GetChartIcon sends a GET request to /v1/ns/{namespace}/assets/{repo}/{chartName}/logo
+//
+// Get the icon of a chart
+func (c *Client) GetChartIcon(ctx context.Context, namespace, repo, chartName string) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/assets/"+url.PathEscape(repo)+"/"+url.PathEscape(chartName)+"/logo", nil, nil)
+}
+
+// GetChartVersionReadme sends a GET request to /v1/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/README.md
+//
+// Get the README of a chart version
+func (c *Client) GetChartVersionReadme(ctx context.Context, namespace, repo, chartName, version string) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/assets/"+url.PathEscape(repo)+"/"+url.PathEscape(chartName)+"/versions/"+url.PathEscape(version)+"/README.md", nil, nil)
+}
+
+// GetChartVersionTarball sends a GET request to /v1/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/chart.tgz
+//
+// Download the mirrored tarball of a chart version
+func (c *Client) GetChartVersionTarball(ctx context.Context, namespace, repo, chartName, version string) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/assets/"+url.PathEscape(repo)+"/"+url.PathEscape(chartName)+"/versions/"+url.PathEscape(version)+"/chart.tgz", nil, nil)
+}
+
+// GetChartVersionParameters sends a GET request to /v1/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/parameters.json
+//
+// Get the parameters documented in the values of a chart version
+func (c *Client) GetChartVersionParameters(ctx context.Context, namespace, repo, chartName, version string) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/assets/"+url.PathEscape(repo)+"/"+url.PathEscape(chartName)+"/versions/"+url.PathEscape(version)+"/parameters.json", nil, nil)
+}
+
+// GetChartVersionSchema sends a GET request to /v1/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/values.schema.json
+//
+// Get the values schema of a chart version
+func (c *Client) GetChartVersionSchema(ctx context.Context, namespace, repo, chartName, version string) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/assets/"+url.PathEscape(repo)+"/"+url.PathEscape(chartName)+"/versions/"+url.PathEscape(version)+"/values.schema.json", nil, nil)
+}
+
+// GetChartVersionValues sends a GET request to /v1/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/values.yaml
+//
+// Get the default values of a chart version
+func (c *Client) GetChartVersionValues(ctx context.Context, namespace, repo, chartName, version string) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/assets/"+url.PathEscape(repo)+"/"+url.PathEscape(chartName)+"/versions/"+url.PathEscape(version)+"/values.yaml", nil, nil)
+}
+
+// ListCharts sends a GET request to /v1/ns/{namespace}/charts
+//
+// List the charts of a namespace
+func (c *Client) ListCharts(ctx context.Context, namespace string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/charts", query, nil)
+}
+
+// ListRepoCharts sends a GET request to /v1/ns/{namespace}/charts/{repo}
+//
+// List the charts of a repository
+func (c *Client) ListRepoCharts(ctx context.Context, namespace, repo string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/charts/"+url.PathEscape(repo), query, nil)
+}
+
+// GetChart sends a GET request to /v1/ns/{namespace}/charts/{repo}/{chartName}
+//
+// Get a chart
+func (c *Client) GetChart(ctx context.Context, namespace, repo, chartName string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/charts/"+url.PathEscape(repo)+"/"+url.PathEscape(chartName), query, nil)
+}
+
+// ListChartDependents sends a GET request to /v1/ns/{namespace}/charts/{repo}/{chartName}/dependents
+//
+// List the chart versions depending on a chart
+func (c *Client) ListChartDependents(ctx context.Context, namespace, repo, chartName string) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/charts/"+url.PathEscape(repo)+"/"+url.PathEscape(chartName)+"/dependents", nil, nil)
+}
+
+// GetChartVersionDiff sends a GET request to /v1/ns/{namespace}/charts/{repo}/{chartName}/diff
+//
+// Compare the values, the values schema and the README of two chart versions
+func (c *Client) GetChartVersionDiff(ctx context.Context, namespace, repo, chartName string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/charts/"+url.PathEscape(repo)+"/"+url.PathEscape(chartName)+"/diff", query, nil)
+}
+
+// ListChartVersions sends a GET request to /v1/ns/{namespace}/charts/{repo}/{chartName}/versions
+//
+// List the versions of a chart in the order of the repository index, or from the highest to the lowest if a constraint is given
+func (c *Client) ListChartVersions(ctx context.Context, namespace, repo, chartName string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/charts/"+url.PathEscape(repo)+"/"+url.PathEscape(chartName)+"/versions", query, nil)
+}
+
+// GetLatestChartVersion sends a GET request to /v1/ns/{namespace}/charts/{repo}/{chartName}/versions/latest
+//
+// Get the highest version of a chart
+func (c *Client) GetLatestChartVersion(ctx context.Context, namespace, repo, chartName string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/charts/"+url.PathEscape(repo)+"/"+url.PathEscape(chartName)+"/versions/latest", query, nil)
+}
+
+// GetChartVersion sends a GET request to /v1/ns/{namespace}/charts/{repo}/{chartName}/versions/{version}
+//
+// Get a chart version
+func (c *Client) GetChartVersion(ctx context.Context, namespace, repo, chartName, version string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/charts/"+url.PathEscape(repo)+"/"+url.PathEscape(chartName)+"/versions/"+url.PathEscape(version), query, nil)
+}
+
+// GetChartVersionDependencies sends a GET request to /v1/ns/{namespace}/charts/{repo}/{chartName}/versions/{version}/dependencies
+//
+// List the dependencies of a chart version
+func (c *Client) GetChartVersionDependencies(ctx context.Context, namespace, repo, chartName, version string) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/charts/"+url.PathEscape(repo)+"/"+url.PathEscape(chartName)+"/versions/"+url.PathEscape(version)+"/dependencies", nil, nil)
+}
+
+// GetChartVersionImages sends a GET request to /v1/ns/{namespace}/charts/{repo}/{chartName}/versions/{version}/images
+//
+// List the container images of a chart version
+func (c *Client) GetChartVersionImages(ctx context.Context, namespace, repo, chartName, version string) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/charts/"+url.PathEscape(repo)+"/"+url.PathEscape(chartName)+"/versions/"+url.PathEscape(version)+"/images", nil, nil)
+}
+
+// ListChartImages sends a GET request to /v1/ns/{namespace}/images
+//
+// List the chart versions using a container image
+func (c *Client) ListChartImages(ctx context.Context, namespace string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/images", query, nil)
+}
+
+// GetChartIndex sends a GET request to /v1/ns/{namespace}/index.yaml
+//
+// Get the Helm repository index of the charts of a namespace
+func (c *Client) GetChartIndex(ctx context.Context, namespace string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/index.yaml", query, nil)
+}
+
+// ListRepos sends a GET request to /v1/ns/{namespace}/repos
+//
+// List the synced repositories of a namespace
+func (c *Client) ListRepos(ctx context.Context, namespace string) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/repos", nil, nil)
+}
+
+// GetRepo sends a GET request to /v1/ns/{namespace}/repos/{repo}
+//
+// Get a synced repository
+func (c *Client) GetRepo(ctx context.Context, namespace, repo string) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/repos/"+url.PathEscape(repo), nil, nil)
+}
+
+// GetRepoChartIndex sends a GET request to /v1/ns/{namespace}/repos/{repo}/index.yaml
+//
+// Get the Helm repository index of the charts of a repository
+func (c *Client) GetRepoChartIndex(ctx context.Context, namespace, repo string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/repos/"+url.PathEscape(repo)+"/index.yaml", query, nil)
+}
+
+// ListSyncReports sends a GET request to /v1/ns/{namespace}/repos/{repo}/syncs
+//
+// List the latest sync reports of a repository
+func (c *Client) ListSyncReports(ctx context.Context, namespace, repo string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/repos/"+url.PathEscape(repo)+"/syncs", query, nil)
+}
+
+// SearchCharts sends a GET request to /v1/ns/{namespace}/search/charts
+//
+// Search the charts of a namespace ordered by relevance
+func (c *Client) SearchCharts(ctx context.Context, namespace string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/ns/"+url.PathEscape(namespace)+"/search/charts", query, nil)
+}
@@ -0,0 +1,21 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package assetsvc is a client of the assetsvc API generated from its OpenAPI
+// document, see pkg/openapi.
+package assetsvc
+
+//go:generate go run github.com/kubeapps/kubeapps/pkg/openapi/gen -document assetsvc -output client.go
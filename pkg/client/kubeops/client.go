@@ -0,0 +1,256 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by pkg/openapi/gen. DO NOT EDIT.
+
+package kubeops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client sends requests to the Kubeapps kubeops API
+type Client struct {
+	// BaseURL is the URL the API is served at
+	BaseURL string
+	// Token is sent as bearer token if not empty
+	Token string
+	// HTTPClient sends the requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client of the API served at the given URL
+func NewClient(baseURL, token string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Token: token}
+}
+
+// Error is an error response of the API
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Decode decodes the JSON body of a response and closes it
+func Decode(res *http.Response, v interface{}) error {
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 400 {
+		defer res.Body.Close()
+		data, _ := ioutil.ReadAll(res.Body)
+		apiErr := &Error{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(data))}
+		var errorBody struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &errorBody) == nil && errorBody.Message != "" {
+			apiErr.Message = errorBody.Message
+		}
+		return nil, apiErr
+	}
+	return res, nil
+}
+
+// GetNamespaces sends a GET request to /backend/v1/namespaces
+//
+// List the namespaces of the cluster
+func (c *Client) GetNamespaces(ctx context.Context) (*http.Response, error) {
+	return c.do(ctx, "GET", "/backend/v1/namespaces", nil, nil)
+}
+
+// CreateAppRepository sends a POST request to /backend/v1/namespaces/{namespace}/apprepositories
+//
+// Create an app repository
+func (c *Client) CreateAppRepository(ctx context.Context, namespace string, body interface{}) (*http.Response, error) {
+	return c.do(ctx, "POST", "/backend/v1/namespaces/"+url.PathEscape(namespace)+"/apprepositories", nil, body)
+}
+
+// ValidateAppRepository sends a POST request to /backend/v1/namespaces/{namespace}/apprepositories/validate
+//
+// Check that the index of a repository can be downloaded
+func (c *Client) ValidateAppRepository(ctx context.Context, namespace string, body interface{}) (*http.Response, error) {
+	return c.do(ctx, "POST", "/backend/v1/namespaces/"+url.PathEscape(namespace)+"/apprepositories/validate", nil, body)
+}
+
+// DeleteAppRepository sends a DELETE request to /backend/v1/namespaces/{namespace}/apprepositories/{name}
+//
+// Delete an app repository
+func (c *Client) DeleteAppRepository(ctx context.Context, namespace, name string) (*http.Response, error) {
+	return c.do(ctx, "DELETE", "/backend/v1/namespaces/"+url.PathEscape(namespace)+"/apprepositories/"+url.PathEscape(name), nil, nil)
+}
+
+// GetOperatorLogo sends a GET request to /backend/v1/namespaces/{namespace}/operator/{name}/logo
+//
+// Get the logo of an operator
+func (c *Client) GetOperatorLogo(ctx context.Context, namespace, name string) (*http.Response, error) {
+	return c.do(ctx, "GET", "/backend/v1/namespaces/"+url.PathEscape(namespace)+"/operator/"+url.PathEscape(name)+"/logo", nil, nil)
+}
+
+// ListClusterReleases sends a GET request to /v1/clusters/{cluster}/namespaces/{namespace}/releases
+//
+// List the releases of a namespace in a cluster
+func (c *Client) ListClusterReleases(ctx context.Context, cluster, namespace string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/clusters/"+url.PathEscape(cluster)+"/namespaces/"+url.PathEscape(namespace)+"/releases", query, nil)
+}
+
+// CreateClusterRelease sends a POST request to /v1/clusters/{cluster}/namespaces/{namespace}/releases
+//
+// Install a chart in a cluster
+func (c *Client) CreateClusterRelease(ctx context.Context, cluster, namespace string, body interface{}) (*http.Response, error) {
+	return c.do(ctx, "POST", "/v1/clusters/"+url.PathEscape(cluster)+"/namespaces/"+url.PathEscape(namespace)+"/releases", nil, body)
+}
+
+// RenderClusterRelease sends a POST request to /v1/clusters/{cluster}/namespaces/{namespace}/releases/render
+//
+// Render the manifests of a new release without installing it in a cluster
+func (c *Client) RenderClusterRelease(ctx context.Context, cluster, namespace string, body interface{}) (*http.Response, error) {
+	return c.do(ctx, "POST", "/v1/clusters/"+url.PathEscape(cluster)+"/namespaces/"+url.PathEscape(namespace)+"/releases/render", nil, body)
+}
+
+// DeleteClusterRelease sends a DELETE request to /v1/clusters/{cluster}/namespaces/{namespace}/releases/{releaseName}
+//
+// Delete a release in a cluster
+func (c *Client) DeleteClusterRelease(ctx context.Context, cluster, namespace, releaseName string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "DELETE", "/v1/clusters/"+url.PathEscape(cluster)+"/namespaces/"+url.PathEscape(namespace)+"/releases/"+url.PathEscape(releaseName), query, nil)
+}
+
+// GetClusterRelease sends a GET request to /v1/clusters/{cluster}/namespaces/{namespace}/releases/{releaseName}
+//
+// Get a release in a cluster
+func (c *Client) GetClusterRelease(ctx context.Context, cluster, namespace, releaseName string) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/clusters/"+url.PathEscape(cluster)+"/namespaces/"+url.PathEscape(namespace)+"/releases/"+url.PathEscape(releaseName), nil, nil)
+}
+
+// OperateClusterRelease sends a PUT request to /v1/clusters/{cluster}/namespaces/{namespace}/releases/{releaseName}
+//
+// Upgrade or roll back a release in a cluster
+func (c *Client) OperateClusterRelease(ctx context.Context, cluster, namespace, releaseName string, query url.Values, body interface{}) (*http.Response, error) {
+	return c.do(ctx, "PUT", "/v1/clusters/"+url.PathEscape(cluster)+"/namespaces/"+url.PathEscape(namespace)+"/releases/"+url.PathEscape(releaseName), query, body)
+}
+
+// RenderClusterReleaseUpgrade sends a POST request to /v1/clusters/{cluster}/namespaces/{namespace}/releases/{releaseName}/render
+//
+// Render the manifests of an upgrade of a release without upgrading it in a cluster
+func (c *Client) RenderClusterReleaseUpgrade(ctx context.Context, cluster, namespace, releaseName string, body interface{}) (*http.Response, error) {
+	return c.do(ctx, "POST", "/v1/clusters/"+url.PathEscape(cluster)+"/namespaces/"+url.PathEscape(namespace)+"/releases/"+url.PathEscape(releaseName)+"/render", nil, body)
+}
+
+// ListAllClusterReleases sends a GET request to /v1/clusters/{cluster}/releases
+//
+// List the releases of every namespace in a cluster
+func (c *Client) ListAllClusterReleases(ctx context.Context, cluster string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/clusters/"+url.PathEscape(cluster)+"/releases", query, nil)
+}
+
+// ListReleases sends a GET request to /v1/namespaces/{namespace}/releases
+//
+// List the releases of a namespace
+func (c *Client) ListReleases(ctx context.Context, namespace string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/namespaces/"+url.PathEscape(namespace)+"/releases", query, nil)
+}
+
+// CreateRelease sends a POST request to /v1/namespaces/{namespace}/releases
+//
+// Install a chart
+func (c *Client) CreateRelease(ctx context.Context, namespace string, body interface{}) (*http.Response, error) {
+	return c.do(ctx, "POST", "/v1/namespaces/"+url.PathEscape(namespace)+"/releases", nil, body)
+}
+
+// RenderRelease sends a POST request to /v1/namespaces/{namespace}/releases/render
+//
+// Render the manifests of a new release without installing it
+func (c *Client) RenderRelease(ctx context.Context, namespace string, body interface{}) (*http.Response, error) {
+	return c.do(ctx, "POST", "/v1/namespaces/"+url.PathEscape(namespace)+"/releases/render", nil, body)
+}
+
+// DeleteRelease sends a DELETE request to /v1/namespaces/{namespace}/releases/{releaseName}
+//
+// Delete a release
+func (c *Client) DeleteRelease(ctx context.Context, namespace, releaseName string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "DELETE", "/v1/namespaces/"+url.PathEscape(namespace)+"/releases/"+url.PathEscape(releaseName), query, nil)
+}
+
+// GetRelease sends a GET request to /v1/namespaces/{namespace}/releases/{releaseName}
+//
+// Get a release
+func (c *Client) GetRelease(ctx context.Context, namespace, releaseName string) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/namespaces/"+url.PathEscape(namespace)+"/releases/"+url.PathEscape(releaseName), nil, nil)
+}
+
+// OperateRelease sends a PUT request to /v1/namespaces/{namespace}/releases/{releaseName}
+//
+// Upgrade or roll back a release
+func (c *Client) OperateRelease(ctx context.Context, namespace, releaseName string, query url.Values, body interface{}) (*http.Response, error) {
+	return c.do(ctx, "PUT", "/v1/namespaces/"+url.PathEscape(namespace)+"/releases/"+url.PathEscape(releaseName), query, body)
+}
+
+// RenderReleaseUpgrade sends a POST request to /v1/namespaces/{namespace}/releases/{releaseName}/render
+//
+// Render the manifests of an upgrade of a release without upgrading it
+func (c *Client) RenderReleaseUpgrade(ctx context.Context, namespace, releaseName string, body interface{}) (*http.Response, error) {
+	return c.do(ctx, "POST", "/v1/namespaces/"+url.PathEscape(namespace)+"/releases/"+url.PathEscape(releaseName)+"/render", nil, body)
+}
+
+// ListAllReleases sends a GET request to /v1/releases
+//
+// List the releases of every namespace
+func (c *Client) ListAllReleases(ctx context.Context, query url.Values) (*http.Response, error) {
+	return c.do(ctx, "GET", "/v1/releases", query, nil)
+}
@@ -0,0 +1,562 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dbutils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+)
+
+// MemoryFileScheme is the scheme of the database URL of a memory catalog
+// persisted to a file
+const MemoryFileScheme = "file"
+
+// ErrNotFound is returned when a repository, chart or chart files are not in
+// a memory catalog
+var ErrNotFound = errors.New("not found")
+
+// MemoryCatalog is the content of a catalog kept in memory
+type MemoryCatalog struct {
+	// Repos are the synced repositories by namespace and name
+	Repos map[string]*MemoryRepo
+	// Tarballs are the mirrored chart tarballs by digest. The tarballs of a
+	// catalog persisted to a file are stored in a directory next to it instead.
+	Tarballs map[string][]byte `json:"-"`
+}
+
+// MemoryRepo is a synced repository with its charts and sync reports
+type MemoryRepo struct {
+	Namespace  string
+	Name       string
+	Checksum   string
+	LastUpdate time.Time
+	// Charts are the charts of the repository by ID
+	Charts map[string]*MemoryChart
+	// SyncReports are the reports of the last syncs, oldest first
+	SyncReports []models.SyncReport
+}
+
+// MemoryChart is a chart with its icon and the files of its versions. Like
+// in PostgreSQL the chart and its files are stored as JSON, so every reader
+// gets its own copy.
+type MemoryChart struct {
+	ID   string
+	Info json.RawMessage
+	Icon *models.ChartIcon `json:",omitempty"`
+	// Files are the files of the chart versions by ID
+	Files map[string]json.RawMessage
+}
+
+func newMemoryCatalog() *MemoryCatalog {
+	return &MemoryCatalog{Repos: map[string]*MemoryRepo{}, Tarballs: map[string][]byte{}}
+}
+
+func memoryRepoKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// Repo returns a repository, nil if it has not been synced
+func (c *MemoryCatalog) Repo(namespace, name string) *MemoryRepo {
+	return c.Repos[memoryRepoKey(namespace, name)]
+}
+
+// EnsureRepo returns a repository, which is added if missing
+func (c *MemoryCatalog) EnsureRepo(namespace, name string) *MemoryRepo {
+	r := c.Repo(namespace, name)
+	if r == nil {
+		r = &MemoryRepo{Namespace: namespace, Name: name, Charts: map[string]*MemoryChart{}}
+		c.Repos[memoryRepoKey(namespace, name)] = r
+	}
+	return r
+}
+
+// copy returns a copy of the catalog which can be modified without changing
+// it. The JSON documents and icons are shared since they are replaced rather
+// than modified.
+func (c *MemoryCatalog) copy() *MemoryCatalog {
+	cp := &MemoryCatalog{Repos: make(map[string]*MemoryRepo, len(c.Repos)), Tarballs: make(map[string][]byte, len(c.Tarballs))}
+	for key, r := range c.Repos {
+		repo := *r
+		repo.Charts = make(map[string]*MemoryChart, len(r.Charts))
+		for id, c := range r.Charts {
+			chart := *c
+			if c.Files != nil {
+				chart.Files = make(map[string]json.RawMessage, len(c.Files))
+				for filesID, info := range c.Files {
+					chart.Files[filesID] = info
+				}
+			}
+			repo.Charts[id] = &chart
+		}
+		repo.SyncReports = append(r.SyncReports[:0:0], r.SyncReports...)
+		cp.Repos[key] = &repo
+	}
+	for digest, tarball := range c.Tarballs {
+		cp.Tarballs[digest] = tarball
+	}
+	return cp
+}
+
+// DeleteRepo removes a repository with its charts and sync reports
+func (c *MemoryCatalog) DeleteRepo(namespace, name string) {
+	delete(c.Repos, memoryRepoKey(namespace, name))
+}
+
+// SortedRepos returns the repositories ordered by namespace and name
+func (c *MemoryCatalog) SortedRepos() []*MemoryRepo {
+	repos := make([]*MemoryRepo, 0, len(c.Repos))
+	for _, r := range c.Repos {
+		repos = append(repos, r)
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		if repos[i].Namespace != repos[j].Namespace {
+			return repos[i].Namespace < repos[j].Namespace
+		}
+		return repos[i].Name < repos[j].Name
+	})
+	return repos
+}
+
+// SortedCharts returns the charts of the repository ordered by ID
+func (r *MemoryRepo) SortedCharts() []*MemoryChart {
+	charts := make([]*MemoryChart, 0, len(r.Charts))
+	for _, c := range r.Charts {
+		charts = append(charts, c)
+	}
+	sort.Slice(charts, func(i, j int) bool { return charts[i].ID < charts[j].ID })
+	return charts
+}
+
+// Chart decodes the chart
+func (c *MemoryChart) Chart() (models.Chart, error) {
+	var chart models.Chart
+	err := json.Unmarshal(c.Info, &chart)
+	return chart, err
+}
+
+// SetChart encodes the chart, its icon is stored on its own
+func (c *MemoryChart) SetChart(chart models.Chart) error {
+	chart.RawIcon = nil
+	info, err := json.Marshal(chart)
+	if err != nil {
+		return err
+	}
+	c.Info = info
+	return nil
+}
+
+// ChartFiles decodes the files of a chart version, ErrNotFound is returned if
+// they have not been imported
+func (c *MemoryChart) ChartFiles(filesID string) (models.ChartFiles, error) {
+	var files models.ChartFiles
+	info, ok := c.Files[filesID]
+	if !ok {
+		return files, ErrNotFound
+	}
+	err := json.Unmarshal(info, &files)
+	return files, err
+}
+
+// SortedChartFiles decodes the files of every chart version ordered by ID
+func (c *MemoryChart) SortedChartFiles() ([]models.ChartFiles, error) {
+	ids := make([]string, 0, len(c.Files))
+	for id := range c.Files {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	result := make([]models.ChartFiles, 0, len(ids))
+	for _, id := range ids {
+		files, err := c.ChartFiles(id)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, files)
+	}
+	return result, nil
+}
+
+// SetChartFiles encodes the files of a chart version
+func (c *MemoryChart) SetChartFiles(files models.ChartFiles) error {
+	info, err := json.Marshal(files)
+	if err != nil {
+		return err
+	}
+	if c.Files == nil {
+		c.Files = map[string]json.RawMessage{}
+	}
+	c.Files[files.ID] = info
+	return nil
+}
+
+// memoryDB is a catalog shared by the managers opened with the same URL,
+// optionally persisted to a file
+type memoryDB struct {
+	mutex sync.Mutex
+	path  string
+	// file is the catalog file loaded, nil if it has not been loaded
+	file    os.FileInfo
+	catalog *MemoryCatalog
+}
+
+// memoryDBs are the catalogs opened by the process by URL
+var memoryDBs = struct {
+	sync.Mutex
+	dbs map[string]*memoryDB
+}{dbs: map[string]*memoryDB{}}
+
+// MemoryAssetManager keeps the catalog in memory, for development and tests.
+// Managers opened with the same database URL and name share their catalog,
+// so the asset-syncer and the assetsvc can run in a single process. A
+// file:///path URL persists the catalog to a JSON file, which is reloaded
+// when modified and locked while updated so the catalog can be shared by
+// several processes. The mirrored tarballs of such a catalog are stored in
+// the path.tarballs directory.
+type MemoryAssetManager struct {
+	config            datastore.Config
+	kubeappsNamespace string
+	db                *memoryDB
+}
+
+// NewMemoryManager creates an asset manager keeping the catalog in memory
+func NewMemoryManager(config datastore.Config, kubeappsNamespace string) *MemoryAssetManager {
+	return &MemoryAssetManager{config: config, kubeappsNamespace: kubeappsNamespace}
+}
+
+// Init opens the catalog of the database URL, loading it from its file if any
+func (m *MemoryAssetManager) Init() error {
+	path := ""
+	key := m.config.URL + "/" + m.config.Database
+	if u, err := url.Parse(m.config.URL); err == nil && u.Scheme == MemoryFileScheme {
+		if u.Path == "" {
+			return fmt.Errorf("invalid memory database URL %q, the file path is missing", m.config.URL)
+		}
+		path = filepath.Clean(u.Path)
+		key = path
+	}
+
+	memoryDBs.Lock()
+	defer memoryDBs.Unlock()
+	db, ok := memoryDBs.dbs[key]
+	if !ok {
+		db = &memoryDB{path: path, catalog: newMemoryCatalog()}
+		db.mutex.Lock()
+		err := db.reload()
+		db.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+		memoryDBs.dbs[key] = db
+	}
+	m.db = db
+	return nil
+}
+
+// Close (no-op)
+func (m *MemoryAssetManager) Close() error {
+	return nil
+}
+
+// GetKubeappsNamespace returns the namespace whose repositories are global
+func (m *MemoryAssetManager) GetKubeappsNamespace() string {
+	return m.kubeappsNamespace
+}
+
+// View runs a function reading the catalog, which must not be modified nor
+// referenced once the function returns
+func (m *MemoryAssetManager) View(fn func(c *MemoryCatalog) error) error {
+	if m.db == nil {
+		return fmt.Errorf("the memory database is not initialized")
+	}
+	m.db.mutex.Lock()
+	defer m.db.mutex.Unlock()
+	if err := m.db.reload(); err != nil {
+		return err
+	}
+	return fn(m.db.catalog)
+}
+
+// Update runs a function modifying a copy of the catalog and persists it.
+// The changes are discarded if the function returns an error.
+func (m *MemoryAssetManager) Update(fn func(c *MemoryCatalog) error) error {
+	if m.db == nil {
+		return fmt.Errorf("the memory database is not initialized")
+	}
+	m.db.mutex.Lock()
+	defer m.db.mutex.Unlock()
+	unlock, err := m.db.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := m.db.reload(); err != nil {
+		return err
+	}
+	catalog := m.db.catalog.copy()
+	if err := fn(catalog); err != nil {
+		return err
+	}
+	return m.db.save(catalog)
+}
+
+// InvalidateCache removes every repository and tarball of the catalog
+func (m *MemoryAssetManager) InvalidateCache() error {
+	return m.Update(func(c *MemoryCatalog) error {
+		*c = *newMemoryCatalog()
+		if m.db.path == "" {
+			return nil
+		}
+		return os.RemoveAll(m.db.tarballDir())
+	})
+}
+
+// tarballDir returns the directory of the tarballs of a catalog persisted to
+// a file
+func (db *memoryDB) tarballDir() string {
+	return db.path + ".tarballs"
+}
+
+// lock takes an exclusive lock on the catalog file so the processes sharing
+// it update it one at a time, it returns the function releasing the lock
+func (db *memoryDB) lock() (func(), error) {
+	if db.path == "" {
+		return func() {}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(db.path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(db.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("unable to lock the catalog %s: %v", db.path, err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// reload loads the catalog from its file if it has been modified by another
+// process, a missing file is an empty catalog
+func (db *memoryDB) reload() error {
+	if db.path == "" {
+		return nil
+	}
+	info, err := os.Stat(db.path)
+	if os.IsNotExist(err) {
+		if db.file != nil {
+			db.catalog, db.file = newMemoryCatalog(), nil
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Every save renames a new file over the catalog
+	if db.file != nil && os.SameFile(info, db.file) && info.ModTime().Equal(db.file.ModTime()) && info.Size() == db.file.Size() {
+		return nil
+	}
+	data, err := ioutil.ReadFile(db.path)
+	if err != nil {
+		return err
+	}
+	catalog := newMemoryCatalog()
+	if err := json.Unmarshal(data, catalog); err != nil {
+		return fmt.Errorf("unable to load the catalog from %s: %v", db.path, err)
+	}
+	db.catalog, db.file = catalog, info
+	return nil
+}
+
+// save replaces the catalog, writing it to a temporary file renamed once
+// complete so other processes never load a partial catalog
+func (db *memoryDB) save(catalog *MemoryCatalog) error {
+	if db.path == "" {
+		db.catalog = catalog
+		return nil
+	}
+	data, err := json.Marshal(catalog)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(db.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, filepath.Base(db.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), db.path); err != nil {
+		return err
+	}
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return err
+	}
+	db.catalog, db.file = catalog, info
+	return nil
+}
+
+// MemoryTarballStore stores the mirrored chart tarballs of a memory catalog,
+// tarballs are shared by every repository with the same digest. The tarballs
+// of a catalog persisted to a file are stored as files of its tarball
+// directory so they are not rewritten with the catalog.
+type MemoryTarballStore struct {
+	Manager *MemoryAssetManager
+}
+
+// files returns the store of the tarball directory of a catalog persisted to
+// a file, nil if the catalog is only kept in memory
+func (s MemoryTarballStore) files() (blobstore.Store, error) {
+	if s.Manager.db == nil {
+		return nil, fmt.Errorf("the memory database is not initialized")
+	}
+	if s.Manager.db.path == "" {
+		return nil, nil
+	}
+	return blobstore.NewFilesystemStore(s.Manager.db.tarballDir())
+}
+
+// Exists returns true if the tarball is stored
+func (s MemoryTarballStore) Exists(digest string) (bool, error) {
+	files, err := s.files()
+	if err != nil {
+		return false, err
+	}
+	if files != nil {
+		return files.Exists(digest)
+	}
+	var exists bool
+	err = s.Manager.View(func(c *MemoryCatalog) error {
+		_, exists = c.Tarballs[digest]
+		return nil
+	})
+	return exists, err
+}
+
+// Put stores a tarball, storing an existing tarball is a no-op
+func (s MemoryTarballStore) Put(digest string, data []byte) error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	if files != nil {
+		exists, err := files.Exists(digest)
+		if err != nil || exists {
+			return err
+		}
+		return files.Put(digest, data)
+	}
+	return s.Manager.Update(func(c *MemoryCatalog) error {
+		if _, ok := c.Tarballs[digest]; !ok {
+			c.Tarballs[digest] = append([]byte(nil), data...)
+		}
+		return nil
+	})
+}
+
+// Get returns a tarball or blobstore.ErrNotFound if it's not stored
+func (s MemoryTarballStore) Get(digest string) ([]byte, error) {
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	if files != nil {
+		return files.Get(digest)
+	}
+	var data []byte
+	err = s.Manager.View(func(c *MemoryCatalog) error {
+		tarball, ok := c.Tarballs[digest]
+		if !ok {
+			return blobstore.ErrNotFound
+		}
+		data = append([]byte(nil), tarball...)
+		return nil
+	})
+	return data, err
+}
+
+// Prune removes the tarballs of the chart versions no longer in the catalog.
+// The catalog is locked while pruning, and since syncs store the charts before
+// their tarballs, the tarballs stored meanwhile are always referenced.
+func (s MemoryTarballStore) Prune() error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	return s.Manager.Update(func(c *MemoryCatalog) error {
+		digests := map[string]bool{}
+		for _, r := range c.Repos {
+			for _, mc := range r.Charts {
+				chart, err := mc.Chart()
+				if err != nil {
+					return err
+				}
+				for _, cv := range chart.ChartVersions {
+					digests[cv.Digest] = true
+				}
+			}
+		}
+		if files == nil {
+			for digest := range c.Tarballs {
+				if !digests[digest] {
+					delete(c.Tarballs, digest)
+				}
+			}
+			return nil
+		}
+		entries, err := ioutil.ReadDir(s.Manager.db.tarballDir())
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			// The temporary files of the tarballs being stored are kept
+			if e.IsDir() || strings.Contains(e.Name(), ".tmp") || digests[e.Name()] {
+				continue
+			}
+			if err := os.Remove(filepath.Join(s.Manager.db.tarballDir(), e.Name())); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	})
+}
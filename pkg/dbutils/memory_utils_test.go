@@ -0,0 +1,315 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dbutils
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
+	"github.com/kubeapps/kubeapps/pkg/chart/models"
+)
+
+func newInitializedMemoryManager(t *testing.T, url string) *MemoryAssetManager {
+	m := NewMemoryManager(datastore.Config{URL: url, Database: "charts"}, "kubeapps")
+	if err := m.Init(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return m
+}
+
+func addMemoryRepo(t *testing.T, m *MemoryAssetManager, namespace, name string) {
+	err := m.Update(func(c *MemoryCatalog) error {
+		c.EnsureRepo(namespace, name).Checksum = "abc"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+}
+
+func memoryRepoNames(t *testing.T, m *MemoryAssetManager) []string {
+	names := []string{}
+	err := m.View(func(c *MemoryCatalog) error {
+		for _, r := range c.SortedRepos() {
+			names = append(names, r.Namespace+"/"+r.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return names
+}
+
+func TestMemoryManagersShareCatalog(t *testing.T) {
+	syncer := newInitializedMemoryManager(t, t.Name())
+	assetsvc := newInitializedMemoryManager(t, t.Name())
+	other := newInitializedMemoryManager(t, t.Name()+"-other")
+
+	addMemoryRepo(t, syncer, "default", "my-repo")
+	if got, want := memoryRepoNames(t, assetsvc), []string{"default/my-repo"}; !cmp.Equal(want, got) {
+		t.Errorf("mismatch (-want +got):\n%s", cmp.Diff(want, got))
+	}
+	if got, want := memoryRepoNames(t, other), []string{}; !cmp.Equal(want, got) {
+		t.Errorf("mismatch (-want +got):\n%s", cmp.Diff(want, got))
+	}
+
+	if err := assetsvc.InvalidateCache(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if got, want := memoryRepoNames(t, syncer), []string{}; !cmp.Equal(want, got) {
+		t.Errorf("mismatch (-want +got):\n%s", cmp.Diff(want, got))
+	}
+}
+
+func TestMemoryManagerFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memory-catalog")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "catalog", "charts.json")
+
+	m := newInitializedMemoryManager(t, "file://"+path)
+	addMemoryRepo(t, m, "default", "my-repo")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("the catalog should be persisted: %v", err)
+	}
+
+	// Another process loads the catalog from the file and sees the changes of
+	// the first one
+	otherProcess := &MemoryAssetManager{db: &memoryDB{path: path, catalog: newMemoryCatalog()}}
+	if got, want := memoryRepoNames(t, otherProcess), []string{"default/my-repo"}; !cmp.Equal(want, got) {
+		t.Errorf("mismatch (-want +got):\n%s", cmp.Diff(want, got))
+	}
+	addMemoryRepo(t, otherProcess, "default", "other-repo")
+	if got, want := memoryRepoNames(t, m), []string{"default/my-repo", "default/other-repo"}; !cmp.Equal(want, got) {
+		t.Errorf("mismatch (-want +got):\n%s", cmp.Diff(want, got))
+	}
+
+	if err := NewMemoryManager(datastore.Config{URL: "file://"}, "kubeapps").Init(); err == nil {
+		t.Errorf("Expecting an error for a URL without path")
+	}
+}
+
+func TestMemoryManagerFileSharedByProcesses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memory-catalog")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "charts.json")
+
+	// Processes updating the catalog at the same time keep the changes of
+	// each other
+	processes := []*MemoryAssetManager{
+		{db: &memoryDB{path: path, catalog: newMemoryCatalog()}},
+		{db: &memoryDB{path: path, catalog: newMemoryCatalog()}},
+	}
+	want := []string{}
+	errs := make(chan error)
+	for i, m := range processes {
+		for j := 0; j < 10; j++ {
+			name := fmt.Sprintf("repo-%d-%d", i, j)
+			want = append(want, "default/"+name)
+			go func(m *MemoryAssetManager) {
+				errs <- m.Update(func(c *MemoryCatalog) error {
+					c.EnsureRepo("default", name)
+					return nil
+				})
+			}(m)
+		}
+	}
+	for range want {
+		if err := <-errs; err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+	sort.Strings(want)
+	for _, m := range processes {
+		if got := memoryRepoNames(t, m); !cmp.Equal(want, got) {
+			t.Errorf("mismatch (-want +got):\n%s", cmp.Diff(want, got))
+		}
+	}
+}
+
+func TestMemoryManagerUpdateError(t *testing.T) {
+	m := newInitializedMemoryManager(t, t.Name())
+	addMemoryRepo(t, m, "default", "my-repo")
+
+	updateErr := errors.New("invalid chart")
+	err := m.Update(func(c *MemoryCatalog) error {
+		c.DeleteRepo("default", "my-repo")
+		c.EnsureRepo("default", "other-repo")
+		return updateErr
+	})
+	if err != updateErr {
+		t.Errorf("Expecting %v, got %v", updateErr, err)
+	}
+	// The changes of a failed update are discarded
+	if got, want := memoryRepoNames(t, m), []string{"default/my-repo"}; !cmp.Equal(want, got) {
+		t.Errorf("mismatch (-want +got):\n%s", cmp.Diff(want, got))
+	}
+}
+
+func TestMemoryManagerNotInitialized(t *testing.T) {
+	m := NewMemoryManager(datastore.Config{URL: t.Name()}, "kubeapps")
+	if err := m.View(func(c *MemoryCatalog) error { return nil }); err == nil {
+		t.Errorf("Expecting an error for a manager not initialized")
+	}
+}
+
+func TestMemoryChart(t *testing.T) {
+	chart := models.Chart{ID: "my-repo/foo", Name: "foo", RawIcon: []byte("icon"), ChartVersions: []models.ChartVersion{{Version: "1.0.0"}}}
+	info := &MemoryChart{ID: chart.ID}
+	if err := info.SetChart(chart); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	got, err := info.Chart()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	chart.RawIcon = nil
+	if !cmp.Equal(chart, got) {
+		t.Errorf("mismatch (-want +got):\n%s", cmp.Diff(chart, got))
+	}
+
+	files := models.ChartFiles{ID: "my-repo/foo-1.0.0", Readme: "# foo"}
+	if err := info.SetChartFiles(files); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	gotFiles, err := info.ChartFiles(files.ID)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if !cmp.Equal(files, gotFiles) {
+		t.Errorf("mismatch (-want +got):\n%s", cmp.Diff(files, gotFiles))
+	}
+	if _, err := info.ChartFiles("my-repo/foo-2.0.0"); err != ErrNotFound {
+		t.Errorf("Expecting %v, got %v", ErrNotFound, err)
+	}
+}
+
+func TestMemoryTarballStoreFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memory-catalog")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "charts.json")
+	m := newInitializedMemoryManager(t, "file://"+path)
+	store := MemoryTarballStore{Manager: m}
+
+	kept := strings.Repeat("a", 64)
+	pruned := strings.Repeat("b", 64)
+	for _, digest := range []string{kept, pruned} {
+		if err := store.Put(digest, []byte("tarball "+digest)); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+	err = m.Update(func(c *MemoryCatalog) error {
+		chart := &MemoryChart{ID: "my-repo/foo"}
+		c.EnsureRepo("default", "my-repo").Charts[chart.ID] = chart
+		return chart.SetChart(models.Chart{ID: chart.ID, ChartVersions: []models.ChartVersion{{Version: "1.0.0", Digest: kept}}})
+	})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// The tarballs are stored next to the catalog, not in it
+	catalog, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if strings.Contains(string(catalog), "Tarballs") {
+		t.Errorf("Expecting the tarballs not to be in the catalog, got %s", catalog)
+	}
+	if _, err := os.Stat(filepath.Join(path+".tarballs", kept)); err != nil {
+		t.Errorf("Expecting the tarball to be stored as a file: %v", err)
+	}
+
+	if err := store.Prune(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	for digest, want := range map[string]bool{kept: true, pruned: false} {
+		exists, err := store.Exists(digest)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if exists != want {
+			t.Errorf("Expecting tarball %s to exist: %v, got %v", digest, want, exists)
+		}
+	}
+	data, err := store.Get(kept)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if string(data) != "tarball "+kept {
+		t.Errorf("Expecting %q, got %q", "tarball "+kept, data)
+	}
+}
+
+func TestMemoryTarballStore(t *testing.T) {
+	m := newInitializedMemoryManager(t, t.Name())
+	store := MemoryTarballStore{Manager: m}
+	if err := store.Put("kept", []byte("kept")); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := store.Put("pruned", []byte("pruned")); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if _, err := store.Get("missing"); err != blobstore.ErrNotFound {
+		t.Errorf("Expecting %v, got %v", blobstore.ErrNotFound, err)
+	}
+
+	err := m.Update(func(c *MemoryCatalog) error {
+		chart := &MemoryChart{ID: "my-repo/foo"}
+		c.EnsureRepo("default", "my-repo").Charts[chart.ID] = chart
+		return chart.SetChart(models.Chart{ID: chart.ID, ChartVersions: []models.ChartVersion{{Version: "1.0.0", Digest: "kept"}}})
+	})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := store.Prune(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	for digest, want := range map[string]bool{"kept": true, "pruned": false} {
+		exists, err := store.Exists(digest)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if exists != want {
+			t.Errorf("Expecting tarball %s to exist: %v, got %v", digest, want, exists)
+		}
+	}
+	data, err := store.Get("kept")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if string(data) != "kept" {
+		t.Errorf("Expecting %q, got %q", "kept", data)
+	}
+}
@@ -0,0 +1,242 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dbutils
+
+import (
+	"fmt"
+)
+
+// migrationsLockID identifies the advisory lock taken while migrating so
+// concurrent syncs don't apply the same migration twice
+const migrationsLockID = 7263512
+
+// pgMigration is a change of the PostgreSQL schema
+type pgMigration struct {
+	description string
+	statements  []string
+}
+
+// pgMigrations are applied in order and the schema version is the number of
+// migrations applied. Released migrations must not be modified, schema
+// changes are appended as new migrations.
+var pgMigrations = []pgMigration{
+	{
+		description: "create repos, charts and files tables",
+		// The tables may exist if they were created before versioning the
+		// schema so they are only created if missing.
+		statements: []string{
+			fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+	ID serial NOT NULL PRIMARY KEY,
+	namespace varchar NOT NULL,
+	name varchar NOT NULL,
+	checksum varchar,
+	last_update varchar,
+	UNIQUE(namespace, name)
+)`, RepositoryTable),
+			fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+	ID serial NOT NULL PRIMARY KEY,
+	repo_name varchar NOT NULL,
+	repo_namespace varchar NOT NULL,
+	chart_id varchar,
+	info jsonb NOT NULL,
+	UNIQUE(repo_name, repo_namespace, chart_id),
+	FOREIGN KEY (repo_name, repo_namespace) REFERENCES %s (name, namespace) ON DELETE CASCADE
+)`, ChartTable, RepositoryTable),
+			fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+	ID serial NOT NULL PRIMARY KEY,
+	chart_id varchar NOT NULL,
+	repo_name varchar NOT NULL,
+	repo_namespace varchar NOT NULL,
+	chart_files_ID varchar NOT NULL,
+	info jsonb NOT NULL,
+	UNIQUE(repo_namespace, chart_files_ID),
+	FOREIGN KEY (repo_name, repo_namespace) REFERENCES %s (name, namespace) ON DELETE CASCADE,
+	FOREIGN KEY (repo_name, repo_namespace, chart_id) REFERENCES %s (repo_name, repo_namespace, chart_id) ON DELETE CASCADE
+)`, ChartFilesTable, RepositoryTable, ChartTable),
+		},
+	},
+	{
+		description: "create sync reports table",
+		statements: []string{
+			fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+	ID serial NOT NULL PRIMARY KEY,
+	repo_name varchar NOT NULL,
+	repo_namespace varchar NOT NULL,
+	info jsonb NOT NULL,
+	FOREIGN KEY (repo_name, repo_namespace) REFERENCES %s (name, namespace) ON DELETE CASCADE
+)`, SyncReportTable, RepositoryTable),
+		},
+	},
+	{
+		description: "move chart icons to the icons table",
+		statements: []string{
+			fmt.Sprintf(`
+CREATE TABLE %s (
+	ID serial NOT NULL PRIMARY KEY,
+	repo_name varchar NOT NULL,
+	repo_namespace varchar NOT NULL,
+	chart_id varchar NOT NULL,
+	content_type varchar NOT NULL,
+	digest varchar NOT NULL,
+	data bytea NOT NULL,
+	UNIQUE(repo_namespace, repo_name, chart_id),
+	FOREIGN KEY (repo_name, repo_namespace, chart_id) REFERENCES %s (repo_name, repo_namespace, chart_id) ON DELETE CASCADE
+)`, IconTable, ChartTable),
+			fmt.Sprintf(`
+INSERT INTO %s (repo_name, repo_namespace, chart_id, content_type, digest, data)
+SELECT repo_name, repo_namespace, chart_id, COALESCE(info ->> 'icon_content_type', ''), encode(sha256(decode(info ->> 'raw_icon', 'base64')), 'hex'), decode(info ->> 'raw_icon', 'base64')
+FROM %s WHERE info ->> 'raw_icon' <> ''`, IconTable, ChartTable),
+			fmt.Sprintf(`UPDATE %s SET info = info - 'raw_icon'`, ChartTable),
+		},
+	},
+	{
+		description: "add chart full-text search",
+		// The search vector is kept up to date by a trigger so every writer of
+		// the charts table gets it for free. Fields are weighted from the most
+		// relevant (name) to the least relevant (maintainers and sources).
+		statements: []string{
+			fmt.Sprintf(`ALTER TABLE %s ADD COLUMN search tsvector`, ChartTable),
+			`
+CREATE OR REPLACE FUNCTION jsonb_array_text(arr jsonb, field text) RETURNS text AS $$
+	SELECT COALESCE(string_agg(CASE WHEN field = '' THEN elem #>> '{}' ELSE elem ->> field END, ' '), '')
+	FROM jsonb_array_elements(CASE WHEN jsonb_typeof(arr) = 'array' THEN arr ELSE '[]'::jsonb END) AS elem
+$$ LANGUAGE SQL IMMUTABLE`,
+			`
+CREATE OR REPLACE FUNCTION charts_search_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search :=
+		setweight(to_tsvector('english', COALESCE(NEW.info ->> 'name', '')), 'A') ||
+		setweight(to_tsvector('english', jsonb_array_text(NEW.info -> 'keywords', '')), 'B') ||
+		setweight(to_tsvector('english', COALESCE(NEW.info ->> 'description', '')), 'C') ||
+		setweight(to_tsvector('english', jsonb_array_text(NEW.info -> 'maintainers', 'name') || ' ' || jsonb_array_text(NEW.info -> 'sources', '')), 'D');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql`,
+			fmt.Sprintf(`
+CREATE TRIGGER charts_search BEFORE INSERT OR UPDATE OF info ON %s
+FOR EACH ROW EXECUTE PROCEDURE charts_search_update()`, ChartTable),
+			fmt.Sprintf(`UPDATE %s SET info = info`, ChartTable),
+			fmt.Sprintf(`CREATE INDEX charts_search_idx ON %s USING GIN (search)`, ChartTable),
+		},
+	},
+	{
+		description: "create chart tarballs table",
+		// Tarballs are content addressed so the same chart version mirrored
+		// from several repositories is stored once.
+		statements: []string{
+			fmt.Sprintf(`
+CREATE TABLE %s (
+	digest varchar NOT NULL PRIMARY KEY,
+	data bytea NOT NULL
+)`, TarballTable),
+		},
+	},
+}
+
+// LatestSchemaVersion returns the schema version expected by this code
+func LatestSchemaVersion() int {
+	return len(pgMigrations)
+}
+
+// Migrate applies the pending migrations in a single transaction
+func (m *PostgresAssetManager) Migrate() error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	err = migrate(tx)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("%v (unable to rollback: %v)", err, rollbackErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrate(db PostgresQueryer) error {
+	_, err := db.Exec("SELECT pg_advisory_xact_lock($1)", migrationsLockID)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+	version integer NOT NULL PRIMARY KEY,
+	description varchar NOT NULL,
+	applied_at timestamp NOT NULL DEFAULT now()
+)`, SchemaVersionTable))
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = db.QueryRow(fmt.Sprintf("SELECT COALESCE(MAX(version), 0) FROM %s", SchemaVersionTable)).Scan(&current)
+	if err != nil {
+		return err
+	}
+	if current > LatestSchemaVersion() {
+		return fmt.Errorf("database schema version %d is newer than the latest known version %d", current, LatestSchemaVersion())
+	}
+
+	for i := current; i < len(pgMigrations); i++ {
+		version := i + 1
+		for _, statement := range pgMigrations[i].statements {
+			_, err = db.Exec(statement)
+			if err != nil {
+				return fmt.Errorf("unable to apply schema migration %d (%s): %v", version, pgMigrations[i].description, err)
+			}
+		}
+		_, err = db.Exec(fmt.Sprintf("INSERT INTO %s (version, description) VALUES ($1, $2)", SchemaVersionTable), version, pgMigrations[i].description)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the number of migrations applied to the database,
+// 0 if the schema is not versioned yet
+func (m *PostgresAssetManager) SchemaVersion() (int, error) {
+	var versioned bool
+	err := m.DB.QueryRow("SELECT to_regclass($1) IS NOT NULL", SchemaVersionTable).Scan(&versioned)
+	if err != nil || !versioned {
+		return 0, err
+	}
+	var version int
+	err = m.DB.QueryRow(fmt.Sprintf("SELECT COALESCE(MAX(version), 0) FROM %s", SchemaVersionTable)).Scan(&version)
+	return version, err
+}
+
+// CheckSchemaVersion returns an error if the database schema is not the one
+// expected by this code
+func (m *PostgresAssetManager) CheckSchemaVersion() error {
+	version, err := m.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version < LatestSchemaVersion() {
+		return fmt.Errorf("database schema version %d is outdated, version %d is required. Run \"asset-syncer migrate\" to update it", version, LatestSchemaVersion())
+	}
+	if version > LatestSchemaVersion() {
+		return fmt.Errorf("database schema version %d is newer than the latest known version %d", version, LatestSchemaVersion())
+	}
+	return nil
+}
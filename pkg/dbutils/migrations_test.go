@@ -0,0 +1,151 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dbutils
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func Test_Migrate(t *testing.T) {
+	tests := []struct {
+		name           string
+		currentVersion int
+		expectedErr    string
+	}{
+		{
+			name:           "it applies every migration to an empty database",
+			currentVersion: 0,
+		},
+		{
+			name:           "it applies the pending migrations",
+			currentVersion: LatestSchemaVersion() - 1,
+		},
+		{
+			name:           "it doesn't apply anything to an up to date database",
+			currentVersion: LatestSchemaVersion(),
+		},
+		{
+			name:           "it fails if the database schema is newer",
+			currentVersion: LatestSchemaVersion() + 1,
+			expectedErr:    "is newer than the latest known version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			manager := PostgresAssetManager{DB: db}
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`^SELECT pg_advisory_xact_lock\(\$1\)$`).WithArgs(migrationsLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_version").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`^SELECT COALESCE\(MAX\(version\), 0\) FROM schema_version$`).
+				WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(tt.currentVersion))
+			for i := tt.currentVersion; i < len(pgMigrations); i++ {
+				for _, statement := range pgMigrations[i].statements {
+					mock.ExpectExec(regexp.QuoteMeta(statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+				}
+				mock.ExpectExec(`^INSERT INTO schema_version \(version, description\) VALUES \(\$1, \$2\)$`).
+					WithArgs(i+1, pgMigrations[i].description).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			if tt.expectedErr == "" {
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			err = manager.Migrate()
+			if tt.expectedErr == "" && err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			if tt.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), tt.expectedErr)) {
+				t.Errorf("got: %v, want error containing %q", err, tt.expectedErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func Test_CheckSchemaVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		versioned   bool
+		version     int
+		expectedErr string
+	}{
+		{
+			name:        "it fails if the schema is not versioned",
+			versioned:   false,
+			expectedErr: "database schema version 0 is outdated",
+		},
+		{
+			name:        "it fails if the schema is outdated",
+			versioned:   true,
+			version:     LatestSchemaVersion() - 1,
+			expectedErr: "Run \"asset-syncer migrate\" to update it",
+		},
+		{
+			name:        "it fails if the schema is newer",
+			versioned:   true,
+			version:     LatestSchemaVersion() + 1,
+			expectedErr: "is newer than the latest known version",
+		},
+		{
+			name:      "it succeeds if the schema is the latest",
+			versioned: true,
+			version:   LatestSchemaVersion(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			manager := PostgresAssetManager{DB: db}
+
+			mock.ExpectQuery(`^SELECT to_regclass\(\$1\) IS NOT NULL$`).WithArgs(SchemaVersionTable).
+				WillReturnRows(sqlmock.NewRows([]string{"versioned"}).AddRow(tt.versioned))
+			if tt.versioned {
+				mock.ExpectQuery(`^SELECT COALESCE\(MAX\(version\), 0\) FROM schema_version$`).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(tt.version))
+			}
+
+			err = manager.CheckSchemaVersion()
+			if tt.expectedErr == "" && err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			if tt.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), tt.expectedErr)) {
+				t.Errorf("got: %v, want error containing %q", err, tt.expectedErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
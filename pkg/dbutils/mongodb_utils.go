@@ -18,15 +18,23 @@ package dbutils
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
 	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
 )
 
 const (
 	ChartCollection      = "charts"
 	RepositoryCollection = "repos"
 	ChartFilesCollection = "files"
+	SyncReportCollection = "sync_reports"
+	// TarballCollection contains the mirrored chart tarballs
+	TarballCollection = "tarballs"
+	// ChartTextIndex is the name of the text index used to search charts
+	ChartTextIndex = "chart_text"
 )
 
 // MongodbAssetManager struct containing mongodb info
@@ -65,8 +73,15 @@ func (m *MongodbAssetManager) InvalidateCache() error {
 	if err != nil && err.Error() != "ns not found" {
 		return err
 	}
+	return m.EnsureIndexes()
+}
 
-	err = db.C(ChartCollection).EnsureIndex(mgo.Index{
+// EnsureIndexes creates the indexes of the collections if they don't exist
+func (m *MongodbAssetManager) EnsureIndexes() error {
+	db, closer := m.DBSession.DB()
+	defer closer()
+
+	err := db.C(ChartCollection).EnsureIndex(mgo.Index{
 		Key:        []string{"chart_id", "repo.namespace", "repo.name"},
 		Unique:     true,
 		DropDups:   true,
@@ -75,6 +90,17 @@ func (m *MongodbAssetManager) InvalidateCache() error {
 	if err != nil {
 		return err
 	}
+	// Text index used to search charts, weighted like the PostgreSQL search
+	err = db.C(ChartCollection).EnsureIndex(mgo.Index{
+		Name:            ChartTextIndex,
+		Key:             []string{"$text:name", "$text:keywords", "$text:description", "$text:maintainers.name", "$text:sources"},
+		Weights:         map[string]int{"name": 8, "keywords": 4, "description": 2, "maintainers.name": 1, "sources": 1},
+		DefaultLanguage: "english",
+		Background:      false,
+	})
+	if err != nil {
+		return err
+	}
 	err = db.C(ChartFilesCollection).EnsureIndex(mgo.Index{
 		Key:        []string{"file_id", "repo.namespace", "repo.name"},
 		Background: false,
@@ -82,5 +108,97 @@ func (m *MongodbAssetManager) InvalidateCache() error {
 	if err != nil {
 		return err
 	}
+	err = db.C(SyncReportCollection).EnsureIndex(mgo.Index{
+		Key:        []string{"repo.namespace", "repo.name", "-start_time"},
+		Background: false,
+	})
+	if err != nil {
+		return err
+	}
 	return m.DBSession.Fsync(false)
 }
+
+// MongoTarballStore stores the mirrored chart tarballs in the tarballs
+// collection, tarballs are shared by every repository with the same digest
+type MongoTarballStore struct {
+	DBSession datastore.Session
+}
+
+// TarballPruneGracePeriod is the time a tarball is kept after being stored
+// even if no chart version references it. Syncs store the chart of a version
+// before its tarball, but a prune reading the referenced digests before a
+// concurrent sync stores its charts would otherwise remove the new tarballs.
+const TarballPruneGracePeriod = time.Hour
+
+type mongoTarball struct {
+	Digest string `bson:"_id"`
+	Data   []byte `bson:"data"`
+	// StoredAt is the last time the tarball was stored
+	StoredAt time.Time `bson:"stored_at,omitempty"`
+}
+
+// Exists returns true if the tarball is stored
+func (s MongoTarballStore) Exists(digest string) (bool, error) {
+	db, closer := s.DBSession.DB()
+	defer closer()
+	var tarball mongoTarball
+	err := db.C(TarballCollection).FindId(digest).Select(bson.M{"_id": 1}).One(&tarball)
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Put stores a tarball, storing an existing tarball only updates the time it
+// was stored so it's not pruned
+func (s MongoTarballStore) Put(digest string, data []byte) error {
+	db, closer := s.DBSession.DB()
+	defer closer()
+	_, err := db.C(TarballCollection).UpsertId(digest, bson.M{
+		"$setOnInsert": bson.M{"data": data},
+		"$set":         bson.M{"stored_at": time.Now()},
+	})
+	return err
+}
+
+// Get returns a tarball or blobstore.ErrNotFound if it's not stored
+func (s MongoTarballStore) Get(digest string) ([]byte, error) {
+	db, closer := s.DBSession.DB()
+	defer closer()
+	var tarball mongoTarball
+	err := db.C(TarballCollection).FindId(digest).One(&tarball)
+	if err == mgo.ErrNotFound {
+		return nil, blobstore.ErrNotFound
+	}
+	return tarball.Data, err
+}
+
+// Prune removes the tarballs of the chart versions no longer in the catalog
+// which were stored before the TarballPruneGracePeriod
+func (s MongoTarballStore) Prune() error {
+	db, closer := s.DBSession.DB()
+	defer closer()
+	// The grace period starts before reading the referenced digests so the
+	// tarballs stored while reading them are kept
+	storedBefore := time.Now().Add(-TarballPruneGracePeriod)
+	var digests []struct {
+		Digest string `bson:"_id"`
+	}
+	err := db.C(ChartCollection).Pipe([]bson.M{
+		{"$unwind": "$chartversions"},
+		{"$group": bson.M{"_id": "$chartversions.digest"}},
+	}).All(&digests)
+	if err != nil {
+		return err
+	}
+	referenced := []string{}
+	for _, d := range digests {
+		referenced = append(referenced, d.Digest)
+	}
+	// Tarballs stored before the stored_at field was added don't have it
+	_, err = db.C(TarballCollection).RemoveAll(bson.M{
+		"_id":       bson.M{"$nin": referenced},
+		"stored_at": bson.M{"$not": bson.M{"$gte": storedBefore}},
+	})
+	return err
+}
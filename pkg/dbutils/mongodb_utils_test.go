@@ -0,0 +1,77 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dbutils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubeapps/common/datastore/mockstore"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMongoTarballStorePut(t *testing.T) {
+	m := &mock.Mock{}
+	var update bson.M
+	m.On("UpsertId", "abc", mock.Anything).Run(func(args mock.Arguments) {
+		update = args.Get(1).(bson.M)
+	})
+	store := MongoTarballStore{DBSession: mockstore.NewMockSession(m)}
+
+	if err := store.Put("abc", []byte("data")); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	m.AssertExpectations(t)
+	if !cmp.Equal(update["$setOnInsert"], bson.M{"data": []byte("data")}) {
+		t.Errorf("Unexpected insert %v", update["$setOnInsert"])
+	}
+	storedAt, ok := update["$set"].(bson.M)["stored_at"].(time.Time)
+	if !ok || time.Since(storedAt) > time.Minute {
+		t.Errorf("Expecting the tarball to be stored now, got %v", update["$set"])
+	}
+}
+
+func TestMongoTarballStorePrune(t *testing.T) {
+	m := &mock.Mock{}
+	m.On("All", mock.Anything).Run(func(args mock.Arguments) {
+		*args.Get(0).(*[]struct {
+			Digest string `bson:"_id"`
+		}) = []struct {
+			Digest string `bson:"_id"`
+		}{{Digest: "abc"}, {Digest: "def"}}
+	})
+	var selector bson.M
+	m.On("RemoveAll", mock.Anything).Run(func(args mock.Arguments) {
+		selector = args.Get(0).(bson.M)
+	})
+	store := MongoTarballStore{DBSession: mockstore.NewMockSession(m)}
+
+	if err := store.Prune(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	m.AssertExpectations(t)
+	if !cmp.Equal(selector["_id"], bson.M{"$nin": []string{"abc", "def"}}) {
+		t.Errorf("Unexpected digests selector %v", selector["_id"])
+	}
+	// Only the tarballs stored before the grace period are removed
+	storedBefore, ok := selector["stored_at"].(bson.M)["$not"].(bson.M)["$gte"].(time.Time)
+	if !ok || time.Until(storedBefore) > -TarballPruneGracePeriod+time.Minute {
+		t.Errorf("Expecting the tarballs stored in the grace period to be kept, got %v", selector["stored_at"])
+	}
+}
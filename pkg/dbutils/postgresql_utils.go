@@ -23,6 +23,7 @@ import (
 	"strings"
 
 	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
 )
 
@@ -33,25 +34,41 @@ const (
 	RepositoryTable = "repos"
 	// ChartFilesTable table containing files related to other charts
 	ChartFilesTable = "files"
+	// SyncReportTable table containing the reports of each repository sync
+	SyncReportTable = "sync_reports"
+	// IconTable table containing the chart icons
+	IconTable = "icons"
+	// TarballTable table containing the mirrored chart tarballs
+	TarballTable = "tarballs"
+	// SchemaVersionTable table containing the schema migrations applied
+	SchemaVersionTable = "schema_version"
 	// EnvvarPostgresTests enables tests that run against a local postgres
 	EnvvarPostgresTests = "ENABLE_PG_INTEGRATION_TESTS"
 )
 
-type PostgresDB interface {
+// PostgresQueryer runs statements against either the database or a transaction
+type PostgresQueryer interface {
 	Query(query string, args ...interface{}) (*sql.Rows, error)
-	Begin() (*sql.Tx, error)
 	QueryRow(query string, args ...interface{}) *sql.Row
-	Close() error
 	Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
+type PostgresDB interface {
+	PostgresQueryer
+	Begin() (*sql.Tx, error)
+	Close() error
+}
+
 // PostgresAssetManagerIface represents the methods of the PG asset manager
 // The interface is used by the tests to implement a fake PostgresAssetManagerIface
 type PostgresAssetManagerIface interface {
 	AssetManager
 	QueryOne(target interface{}, query string, args ...interface{}) error
 	QueryAllCharts(query string, args ...interface{}) ([]*models.Chart, error)
+	QueryAllChartFiles(query string, args ...interface{}) ([]*models.ChartFiles, error)
+	QueryAllSyncReports(query string, args ...interface{}) ([]*models.SyncReport, error)
 	InitTables() error
+	CheckSchemaVersion() error
 	InvalidateCache() error
 	EnsureRepoExists(repoNamespace, repoName string) (int, error)
 	GetDB() PostgresDB
@@ -104,83 +121,83 @@ func (m *PostgresAssetManager) QueryOne(target interface{}, query string, args .
 	return json.Unmarshal([]byte(info), target)
 }
 
-// QueryAllCharts perform the given query and return the list of charts
-func (m *PostgresAssetManager) QueryAllCharts(query string, args ...interface{}) ([]*models.Chart, error) {
+// queryAllInfo performs the given query and calls add with the info column of
+// every row returned
+func (m *PostgresAssetManager) queryAllInfo(add func(info []byte) error, query string, args ...interface{}) error {
 	rows, err := m.DB.Query(query, args...)
 	if rows != nil {
 		defer rows.Close()
 	}
 	if err != nil {
-		return nil, err
+		return err
 	}
-	result := []*models.Chart{}
 	for rows.Next() {
 		var info string
 		err := rows.Scan(&info)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		var chart models.Chart
-		err = json.Unmarshal([]byte(info), &chart)
+		err = add([]byte(info))
 		if err != nil {
-			return nil, err
+			return err
 		}
-		result = append(result, &chart)
 	}
-	return result, nil
+	return nil
 }
 
-// InitTables creates the required tables for the postgresql backend for assets.
-func (m *PostgresAssetManager) InitTables() error {
-	// Repository table should have a namespace column, and chart table should reference repositories.
-	_, err := m.DB.Exec(fmt.Sprintf(`
-CREATE TABLE IF NOT EXISTS %s (
-	ID serial NOT NULL PRIMARY KEY,
-	namespace varchar NOT NULL,
-	name varchar NOT NULL,
-	checksum varchar,
-	last_update varchar,
-	UNIQUE(namespace, name)
-)`, RepositoryTable))
-	if err != nil {
+// QueryAllCharts perform the given query and return the list of charts
+func (m *PostgresAssetManager) QueryAllCharts(query string, args ...interface{}) ([]*models.Chart, error) {
+	result := []*models.Chart{}
+	err := m.queryAllInfo(func(info []byte) error {
+		var chart models.Chart
+		err := json.Unmarshal(info, &chart)
+		result = append(result, &chart)
 		return err
+	}, query, args...)
+	if err != nil {
+		return nil, err
 	}
+	return result, nil
+}
 
-	_, err = m.DB.Exec(fmt.Sprintf(`
-CREATE TABLE IF NOT EXISTS %s (
-	ID serial NOT NULL PRIMARY KEY,
-	repo_name varchar NOT NULL,
-	repo_namespace varchar NOT NULL,
-	chart_id varchar,
-	info jsonb NOT NULL,
-	UNIQUE(repo_name, repo_namespace, chart_id),
-	FOREIGN KEY (repo_name, repo_namespace) REFERENCES %s (name, namespace) ON DELETE CASCADE
-)`, ChartTable, RepositoryTable))
-	if err != nil {
+// QueryAllChartFiles perform the given query and return the list of chart files
+func (m *PostgresAssetManager) QueryAllChartFiles(query string, args ...interface{}) ([]*models.ChartFiles, error) {
+	result := []*models.ChartFiles{}
+	err := m.queryAllInfo(func(info []byte) error {
+		var files models.ChartFiles
+		err := json.Unmarshal(info, &files)
+		result = append(result, &files)
 		return err
+	}, query, args...)
+	if err != nil {
+		return nil, err
 	}
+	return result, nil
+}
 
-	_, err = m.DB.Exec(fmt.Sprintf(`
-CREATE TABLE IF NOT EXISTS %s (
-	ID serial NOT NULL PRIMARY KEY,
-	chart_id varchar NOT NULL,
-	repo_name varchar NOT NULL,
-	repo_namespace varchar NOT NULL,
-	chart_files_ID varchar NOT NULL,
-	info jsonb NOT NULL,
-	UNIQUE(repo_namespace, chart_files_ID),
-	FOREIGN KEY (repo_name, repo_namespace) REFERENCES %s (name, namespace) ON DELETE CASCADE,
-	FOREIGN KEY (repo_name, repo_namespace, chart_id) REFERENCES %s (repo_name, repo_namespace, chart_id) ON DELETE CASCADE
-)`, ChartFilesTable, RepositoryTable, ChartTable))
-	if err != nil {
+// QueryAllSyncReports perform the given query and return the list of sync reports
+func (m *PostgresAssetManager) QueryAllSyncReports(query string, args ...interface{}) ([]*models.SyncReport, error) {
+	result := []*models.SyncReport{}
+	err := m.queryAllInfo(func(info []byte) error {
+		var report models.SyncReport
+		err := json.Unmarshal(info, &report)
+		result = append(result, &report)
 		return err
+	}, query, args...)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return result, nil
+}
+
+// InitTables applies the pending schema migrations
+func (m *PostgresAssetManager) InitTables() error {
+	return m.Migrate()
 }
 
 // InvalidateCache for postgresql deletes and re-writes the schema
 func (m *PostgresAssetManager) InvalidateCache() error {
-	tables := strings.Join([]string{RepositoryTable, ChartTable, ChartFilesTable}, ",")
+	tables := strings.Join([]string{RepositoryTable, ChartTable, ChartFilesTable, SyncReportTable, IconTable, TarballTable, SchemaVersionTable}, ",")
 	_, err := m.DB.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", tables))
 	if err != nil {
 		return err
@@ -191,6 +208,12 @@ func (m *PostgresAssetManager) InvalidateCache() error {
 
 // EnsureRepoExists upserts to get the primary key of a repo.
 func (m *PostgresAssetManager) EnsureRepoExists(repoNamespace, repoName string) (int, error) {
+	return EnsureRepoExistsIn(m.DB, repoNamespace, repoName)
+}
+
+// EnsureRepoExistsIn is EnsureRepoExists run with the given queryer, like a
+// transaction
+func EnsureRepoExistsIn(db PostgresQueryer, repoNamespace, repoName string) (int, error) {
 	// The only query I could find for inserting a new repo or selecting the existing one
 	// to find the ID in a single query.
 	query := fmt.Sprintf(`
@@ -206,7 +229,7 @@ SELECT ID FROM %s WHERE namespace=$1 AND name=$2
 `, RepositoryTable, RepositoryTable, RepositoryTable)
 
 	var id int
-	err := m.DB.QueryRow(query, repoNamespace, repoName).Scan(&id)
+	err := db.QueryRow(query, repoNamespace, repoName).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
@@ -221,3 +244,40 @@ func (m *PostgresAssetManager) GetDB() PostgresDB {
 func (m *PostgresAssetManager) GetKubeappsNamespace() string {
 	return m.kubeappsNamespace
 }
+
+// PostgresTarballStore stores the mirrored chart tarballs in the tarballs
+// table, tarballs are shared by every repository with the same digest
+type PostgresTarballStore struct {
+	DB PostgresQueryer
+}
+
+// Exists returns true if the tarball is stored
+func (s PostgresTarballStore) Exists(digest string) (bool, error) {
+	var exists bool
+	err := s.DB.QueryRow(fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s WHERE digest = $1)", TarballTable), digest).Scan(&exists)
+	return exists, err
+}
+
+// Put stores a tarball, storing an existing tarball is a no-op
+func (s PostgresTarballStore) Put(digest string, data []byte) error {
+	_, err := s.DB.Exec(fmt.Sprintf("INSERT INTO %s (digest, data) VALUES ($1, $2) ON CONFLICT (digest) DO NOTHING", TarballTable), digest, data)
+	return err
+}
+
+// Get returns a tarball or blobstore.ErrNotFound if it's not stored
+func (s PostgresTarballStore) Get(digest string) ([]byte, error) {
+	var data []byte
+	err := s.DB.QueryRow(fmt.Sprintf("SELECT data FROM %s WHERE digest = $1", TarballTable), digest).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, blobstore.ErrNotFound
+	}
+	return data, err
+}
+
+// Prune removes the tarballs of the chart versions no longer in the catalog
+func (s PostgresTarballStore) Prune() error {
+	_, err := s.DB.Exec(fmt.Sprintf(
+		"DELETE FROM %s t WHERE NOT EXISTS (SELECT 1 FROM %s c, jsonb_array_elements(c.info -> 'chartVersions') cv WHERE cv ->> 'digest' = t.digest)",
+		TarballTable, ChartTable))
+	return err
+}
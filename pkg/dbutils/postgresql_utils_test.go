@@ -22,6 +22,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/go-cmp/cmp"
 	"github.com/kubeapps/common/datastore"
+	"github.com/kubeapps/kubeapps/pkg/blobstore"
 	"github.com/kubeapps/kubeapps/pkg/chart/models"
 )
 
@@ -108,3 +109,85 @@ func Test_QueryAll(t *testing.T) {
 		t.Errorf("Unexpected result %v", cmp.Diff(charts, expectedCharts))
 	}
 }
+
+func Test_QueryAllChartFiles(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	manager := PostgresAssetManager{
+		connStr: "localhost",
+		DB:      db,
+	}
+	query := "SELECT info from files"
+	rows := sqlmock.NewRows([]string{"info"}).
+		AddRow(`{"ID": "foo-1.0.0", "Version": "1.0.0"}`).
+		AddRow(`{"ID": "bar-2.0.0", "Version": "2.0.0"}`)
+	mock.ExpectQuery("^SELECT (.+)$").WillReturnRows(rows)
+	files, err := manager.QueryAllChartFiles(query)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	expectedFiles := []*models.ChartFiles{{ID: "foo-1.0.0", Version: "1.0.0"}, {ID: "bar-2.0.0", Version: "2.0.0"}}
+	if !cmp.Equal(files, expectedFiles) {
+		t.Errorf("Unexpected result %v", cmp.Diff(files, expectedFiles))
+	}
+}
+
+func Test_PostgresTarballStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	store := PostgresTarballStore{DB: db}
+	data := []byte("tarball")
+
+	mock.ExpectQuery(`^SELECT EXISTS\(SELECT 1 FROM tarballs WHERE digest = \$1\)$`).
+		WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	exists, err := store.Exists("abc")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !exists {
+		t.Errorf("Expecting the tarball to exist")
+	}
+
+	mock.ExpectExec(`^INSERT INTO tarballs \(digest, data\) VALUES \(\$1, \$2\) ON CONFLICT \(digest\) DO NOTHING$`).
+		WithArgs("abc", data).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := store.Put("abc", data); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	mock.ExpectQuery(`^SELECT data FROM tarballs WHERE digest = \$1$`).
+		WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(data))
+	got, err := store.Get("abc")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !cmp.Equal(got, data) {
+		t.Errorf("Unexpected result %v", cmp.Diff(got, data))
+	}
+
+	mock.ExpectQuery(`^SELECT data FROM tarballs WHERE digest = \$1$`).
+		WithArgs("def").
+		WillReturnRows(sqlmock.NewRows([]string{"data"}))
+	if _, err := store.Get("def"); err != blobstore.ErrNotFound {
+		t.Errorf("Expecting ErrNotFound, got %v", err)
+	}
+
+	mock.ExpectExec(`^DELETE FROM tarballs t WHERE NOT EXISTS \(SELECT 1 FROM charts c, jsonb_array_elements\(c.info -> 'chartVersions'\) cv WHERE cv ->> 'digest' = t.digest\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	if err := store.Prune(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -1,6 +1,7 @@
 package handlerutil
 
 import (
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"regexp"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/gorilla/mux"
 	chartUtils "github.com/kubeapps/kubeapps/pkg/chart"
+	"github.com/kubeapps/kubeapps/pkg/kubeversion"
 )
 
 // Params a key-value map of path params
@@ -44,7 +46,8 @@ func isForbidden(err error) bool {
 
 func isUnprocessable(err error) bool {
 	re := regexp.MustCompile(`[rR]elease.*failed`)
-	return re.MatchString(err.Error())
+	var incompatible *kubeversion.IncompatibleError
+	return re.MatchString(err.Error()) || errors.As(err, &incompatible)
 }
 
 // ErrorCode returns the int representing an error.
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+
+	"github.com/kubeapps/kubeapps/pkg/kubeversion"
 )
 
 func TestErrorCodeWithDefault(t *testing.T) {
@@ -18,6 +20,8 @@ func TestErrorCodeWithDefault(t *testing.T) {
 		{fmt.Errorf("Unauthorized to get release foo"), http.StatusInternalServerError, http.StatusForbidden},
 		{fmt.Errorf("release \"Foo \" failed"), http.StatusInternalServerError, http.StatusUnprocessableEntity},
 		{fmt.Errorf("Release \"Foo \" failed"), http.StatusInternalServerError, http.StatusUnprocessableEntity},
+		{&kubeversion.IncompatibleError{Chart: "foo-1.0.0", KubeVersion: ">=1.18.0", ClusterVersion: "v1.16.0"}, http.StatusInternalServerError, http.StatusUnprocessableEntity},
+		{fmt.Errorf("unable to install: %w", &kubeversion.IncompatibleError{Chart: "foo-1.0.0", KubeVersion: ">=1.18.0", ClusterVersion: "v1.16.0"}), http.StatusInternalServerError, http.StatusUnprocessableEntity},
 		{fmt.Errorf("This is an unexpected error"), http.StatusInternalServerError, http.StatusInternalServerError},
 		{fmt.Errorf("This is an unexpected error"), http.StatusUnprocessableEntity, http.StatusUnprocessableEntity},
 	}
@@ -0,0 +1,62 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kubeversion checks the kubeVersion constraints of the charts against
+// the version of a cluster.
+package kubeversion
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// IncompatibleError is returned when the kubeVersion of a chart is not
+// satisfied by the version of a cluster
+type IncompatibleError struct {
+	// Chart is the name and version of the chart, e.g. wordpress-9.0.0
+	Chart       string
+	KubeVersion string
+	// ClusterVersion is the version reported by the cluster
+	ClusterVersion string
+}
+
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("chart %s requires kubeVersion %s which is incompatible with Kubernetes %s", e.Chart, e.KubeVersion, e.ClusterVersion)
+}
+
+// Parse returns the version of a cluster without its prerelease and build
+// metadata. Managed clusters report versions like v1.16.3-gke.1 which would
+// not satisfy constraints like >=1.14.0 otherwise.
+func Parse(version string) (*semver.Version, error) {
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kubernetes version %q: %v", version, err)
+	}
+	return semver.NewVersion(fmt.Sprintf("%d.%d.%d", v.Major(), v.Minor(), v.Patch()))
+}
+
+// Compatible returns true if the version satisfies the kubeVersion constraint
+// of a chart. Every version is compatible with an empty constraint and none
+// with an invalid one, as Helm refuses to install those charts. The
+// constraint is checked like Helm does before installing a chart.
+func Compatible(constraint string, version *semver.Version) bool {
+	if constraint == "" {
+		return true
+	}
+	return chartutil.IsCompatibleRange(constraint, version.String())
+}
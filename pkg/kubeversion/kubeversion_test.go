@@ -0,0 +1,71 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeversion
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Parse(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected string
+		err      bool
+	}{
+		{"v1.16.0", "1.16.0", false},
+		{"1.17", "1.17.0", false},
+		{"v1.16.3-gke.1", "1.16.3", false},
+		{"v1.15.11-eks-af3caf+build", "1.15.11", false},
+		{"latest", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			v, err := Parse(tt.version)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, v.String())
+		})
+	}
+}
+
+func Test_Compatible(t *testing.T) {
+	tests := []struct {
+		name       string
+		constraint string
+		version    string
+		expected   bool
+	}{
+		{"no constraint", "", "v1.16.0", true},
+		{"satisfied constraint", ">=1.14.0", "v1.16.0", true},
+		{"satisfied by a managed cluster", ">=1.14.0", "v1.16.3-gke.1", true},
+		{"unsatisfied constraint", ">=1.18.0", "v1.16.0", false},
+		{"range", ">=1.10.0 <1.16.0", "v1.16.0", false},
+		{"invalid constraint", "newer than 1.10", "v1.16.0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := Parse(tt.version)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, Compatible(tt.constraint, v))
+		})
+	}
+}
@@ -0,0 +1,320 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openapi
+
+// Assetsvc returns the document of the assetsvc API. Every route but the
+// chart logos requires access to its namespace when the assetsvc authorizes
+// the requests.
+func Assetsvc() *Document {
+	doc := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:       "Kubeapps assetsvc",
+			Description: "Serves the charts of the app repositories synced by the asset-syncer. The catalog responses are revalidated with an ETag which changes every time a repository is synced.",
+			Version:     "v1",
+		},
+		Paths: map[string]PathItem{},
+		Components: Components{
+			Schemas: assetsvcSchemas(),
+			SecuritySchemes: map[string]*SecurityScheme{
+				"bearer": {Type: "http", Scheme: "bearer", Description: "A Kubernetes token with access to the namespace, required by the token and trusted-proxy auth modes"},
+			},
+		},
+	}
+
+	namespace := PathParam("namespace", "The namespace of the app repositories")
+	repo := PathParam("repo", "The name of the app repository")
+	chartName := PathParam("chartName", "The name of the chart")
+	version := PathParam("version", "The chart version")
+	page := QueryParam("page", "The page of the list, the last page is returned if out of range", false, Integer("", Min(1)))
+	size := QueryParam("size", "The number of items per page, every item is returned if 0", false, Integer("", Min(0)))
+	chartType := QueryParam("type", "Only return the charts of this type, the lists and the search return the application charts by default and the indexes every chart", false, &Schema{Type: "string", Enum: []interface{}{"application", "library", "all"}})
+	chartFilters := []*Parameter{
+		QueryParam("keyword", "Only return the charts with this keyword", false, String("")),
+		QueryParam("maintainer", "Only return the charts with this maintainer", false, String("")),
+		QueryParam("category", "Only return the charts of this category", false, String("")),
+		QueryParam("appVersion", "Only return the charts whose latest app version starts with this prefix", false, String("")),
+		QueryParam("showDuplicates", "Return the charts with the same digest in several repositories, if not empty", false, String("")),
+		chartType,
+		QueryParam("annotation", "Only return the charts whose latest version has these key=value annotations", false, ArrayOf(String(""))),
+	}
+	repoFilter := QueryParam("repo", "Only return the charts of these repositories", false, ArrayOf(String("")))
+	sortParam := QueryParam("sort", "The field the charts are sorted by, descending if prefixed with -", false, &Schema{Type: "string", Enum: []interface{}{"name", "-name", "updated", "-updated", "created", "-created"}})
+	versionFilters := []*Parameter{
+		QueryParam("constraint", "Only return the versions satisfying this semver constraint", false, String("")),
+		QueryParam("prerelease", "Return the prerelease versions, true by default", false, Boolean("")),
+		QueryParam("kubeVersion", "Only return the versions whose kubeVersion is satisfied by this Kubernetes version", false, String("")),
+	}
+	kubeVersion := QueryParam("kubeVersion", "Flag the versions whose kubeVersion is not satisfied by this Kubernetes version as incompatible", false, String(""))
+
+	notFound := ErrorResponse("The resource was not found")
+	badRequest := ErrorResponse("The request is invalid")
+	add := func(path, operationID, summary string, params []*Parameter, responses map[string]*Response) {
+		op := &Operation{
+			OperationID: operationID,
+			Summary:     summary,
+			Tags:        []string{"assetsvc"},
+			Parameters:  params,
+			Responses:   responses,
+			Security:    []map[string][]string{{"bearer": {}}},
+		}
+		op.Responses["304"] = &Response{Description: "The response of the If-None-Match ETag has not changed"}
+		op.Responses["500"] = ErrorResponse("Unexpected error")
+		doc.Paths[path] = PathItem{"get": op}
+	}
+
+	add("/v1/ns/{namespace}/charts", "listCharts", "List the charts of a namespace",
+		append([]*Parameter{namespace, page, size, sortParam, repoFilter, kubeVersion,
+			QueryParam("name", "Return the charts with this name in every repository, the version and appversion parameters are required with it. The response has no meta.", false, String("")),
+			QueryParam("version", "The chart version of the charts returned by name", false, String("")),
+			QueryParam("appversion", "The app version of the charts returned by name", false, String("")),
+		}, chartFilters...),
+		map[string]*Response{"200": JSONResponse("The charts", Ref("ChartList")), "400": badRequest})
+	add("/v1/ns/{namespace}/search/charts", "searchCharts", "Search the charts of a namespace ordered by relevance",
+		[]*Parameter{namespace, page, size,
+			QueryParam("q", "The search query", true, String("")),
+			QueryParam("repo", "Only return the charts of this repository", false, String("")),
+			chartType,
+			kubeVersion,
+		},
+		map[string]*Response{"200": JSONResponse("The matching charts", Ref("ChartSearchResults")), "400": badRequest})
+	add("/v1/ns/{namespace}/charts/{repo}", "listRepoCharts", "List the charts of a repository",
+		append([]*Parameter{namespace, repo, page, size, sortParam, kubeVersion}, chartFilters...),
+		map[string]*Response{"200": JSONResponse("The charts", Ref("ChartList")), "400": badRequest})
+	add("/v1/ns/{namespace}/charts/{repo}/{chartName}", "getChart", "Get a chart",
+		[]*Parameter{namespace, repo, chartName, kubeVersion},
+		map[string]*Response{"200": JSONResponse("The chart", Data(Ref("Resource"))), "400": badRequest, "404": notFound})
+	add("/v1/ns/{namespace}/charts/{repo}/{chartName}/dependents", "listChartDependents", "List the chart versions depending on a chart",
+		[]*Parameter{namespace, repo, chartName},
+		map[string]*Response{"200": JSONResponse("The dependent chart versions", Data(ArrayOf(Ref("ChartDependent")))), "404": notFound})
+	add("/v1/ns/{namespace}/charts/{repo}/{chartName}/diff", "getChartVersionDiff", "Compare the values, the values schema and the README of two chart versions",
+		[]*Parameter{namespace, repo, chartName,
+			QueryParam("from", "The version compared", true, String("")),
+			QueryParam("to", "The version compared to", true, String("")),
+		},
+		map[string]*Response{
+			"200": JSONResponse("The changes between the versions", Data(Ref("ChartVersionDiff"))),
+			"400": badRequest,
+			"404": notFound,
+			"422": ErrorResponse("The values or the values schema could not be parsed"),
+		})
+	add("/v1/ns/{namespace}/charts/{repo}/{chartName}/versions", "listChartVersions", "List the versions of a chart in the order of the repository index, or from the highest to the lowest if a constraint is given",
+		append([]*Parameter{namespace, repo, chartName}, versionFilters...),
+		map[string]*Response{"200": JSONResponse("The chart versions", Data(ArrayOf(Ref("Resource")))), "400": badRequest, "404": notFound})
+	add("/v1/ns/{namespace}/charts/{repo}/{chartName}/versions/latest", "getLatestChartVersion", "Get the highest version of a chart",
+		append([]*Parameter{namespace, repo, chartName}, versionFilters...),
+		map[string]*Response{"200": JSONResponse("The chart version", Data(Ref("Resource"))), "400": badRequest, "404": notFound})
+	add("/v1/ns/{namespace}/charts/{repo}/{chartName}/versions/{version}", "getChartVersion", "Get a chart version",
+		[]*Parameter{namespace, repo, chartName, version, kubeVersion},
+		map[string]*Response{"200": JSONResponse("The chart version", Data(Ref("Resource"))), "400": badRequest, "404": notFound})
+	add("/v1/ns/{namespace}/charts/{repo}/{chartName}/versions/{version}/dependencies", "getChartVersionDependencies", "List the dependencies of a chart version",
+		[]*Parameter{namespace, repo, chartName, version},
+		map[string]*Response{"200": JSONResponse("The dependencies", Data(ArrayOf(Ref("ChartDependency")))), "404": notFound})
+	add("/v1/ns/{namespace}/charts/{repo}/{chartName}/versions/{version}/images", "getChartVersionImages", "List the container images of a chart version",
+		[]*Parameter{namespace, repo, chartName, version},
+		map[string]*Response{"200": JSONResponse("The images", Data(ArrayOf(String("")))), "404": notFound})
+	add("/v1/ns/{namespace}/images", "listChartImages", "List the chart versions using a container image",
+		[]*Parameter{namespace, QueryParam("image", "A part of the image name", true, String(""))},
+		map[string]*Response{"200": JSONResponse("The chart versions with their matching images", Data(ArrayOf(Ref("ChartImage")))), "400": badRequest})
+	add("/v1/ns/{namespace}/index.yaml", "getChartIndex", "Get the Helm repository index of the charts of a namespace",
+		append([]*Parameter{namespace, repoFilter}, chartFilters...),
+		map[string]*Response{"200": ContentResponse("The index", "application/x-yaml")})
+	add("/v1/ns/{namespace}/repos/{repo}/index.yaml", "getRepoChartIndex", "Get the Helm repository index of the charts of a repository",
+		append([]*Parameter{namespace, repo}, chartFilters...),
+		map[string]*Response{"200": ContentResponse("The index", "application/x-yaml")})
+	add("/v1/ns/{namespace}/repos", "listRepos", "List the synced repositories of a namespace",
+		[]*Parameter{namespace},
+		map[string]*Response{"200": JSONResponse("The repositories", Data(ArrayOf(Ref("RepoSummary"))))})
+	add("/v1/ns/{namespace}/repos/{repo}", "getRepo", "Get a synced repository",
+		[]*Parameter{namespace, repo},
+		map[string]*Response{"200": JSONResponse("The repository", Data(Ref("RepoSummary"))), "404": notFound})
+	add("/v1/ns/{namespace}/repos/{repo}/syncs", "listSyncReports", "List the latest sync reports of a repository",
+		[]*Parameter{namespace, repo, QueryParam("limit", "The number of reports, 10 by default", false, Integer("", Min(1)))},
+		map[string]*Response{"200": JSONResponse("The reports from the latest", Data(ArrayOf(Ref("SyncReport")))), "400": badRequest})
+	add("/v1/ns/{namespace}/assets/{repo}/{chartName}/logo", "getChartIcon", "Get the icon of a chart",
+		[]*Parameter{namespace, repo, chartName},
+		map[string]*Response{"200": ContentResponse("The icon", "image/*"), "404": {Description: "The chart has no icon"}})
+	add("/v1/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/README.md", "getChartVersionReadme", "Get the README of a chart version",
+		[]*Parameter{namespace, repo, chartName, version},
+		map[string]*Response{"200": ContentResponse("The README", "text/plain"), "404": {Description: "The chart version has no README"}})
+	add("/v1/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/values.yaml", "getChartVersionValues", "Get the default values of a chart version",
+		[]*Parameter{namespace, repo, chartName, version},
+		map[string]*Response{"200": ContentResponse("The values", "text/plain"), "404": {Description: "The chart version was not found"}})
+	schemaResponse := ContentResponse("The values schema, inferred from the default values if the chart has none", "application/json")
+	schemaResponse.Headers = map[string]*Header{
+		"X-Kubeapps-Schema-Generated": {Description: "Set to true if the schema is inferred from the default values", Schema: String("")},
+	}
+	add("/v1/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/values.schema.json", "getChartVersionSchema", "Get the values schema of a chart version",
+		[]*Parameter{namespace, repo, chartName, version},
+		map[string]*Response{"200": schemaResponse, "404": {Description: "The chart version was not found"}})
+	add("/v1/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/parameters.json", "getChartVersionParameters", "Get the parameters documented in the values of a chart version",
+		[]*Parameter{namespace, repo, chartName, version},
+		map[string]*Response{"200": JSONResponse("The parameters", ArrayOf(Ref("ChartParameter"))), "404": {Description: "The chart version was not found"}})
+	add("/v1/ns/{namespace}/assets/{repo}/{chartName}/versions/{version}/chart.tgz", "getChartVersionTarball", "Download the mirrored tarball of a chart version",
+		[]*Parameter{namespace, repo, chartName, version},
+		map[string]*Response{"200": ContentResponse("The tarball", "application/gzip"), "404": {Description: "The tarball is not mirrored"}})
+
+	// Chart logos are public
+	doc.Paths["/v1/ns/{namespace}/assets/{repo}/{chartName}/logo"]["get"].Security = nil
+	return doc
+}
+
+func assetsvcSchemas() map[string]*Schema {
+	repo := Object("An app repository", map[string]*Schema{
+		"namespace": String(""),
+		"name":      String(""),
+		"url":       String(""),
+	})
+	changes := ArrayOf(Ref("KeyChange"))
+	return map[string]*Schema{
+		"Error": ErrorSchema,
+		"Repo":  repo,
+		"Maintainer": Object("A chart maintainer", map[string]*Schema{
+			"name":  String(""),
+			"email": String(""),
+			"url":   String(""),
+		}),
+		"Chart": Object("A chart with its latest version", map[string]*Schema{
+			"ID":                String("The repository and name of the chart"),
+			"name":              String(""),
+			"repo":              Ref("Repo"),
+			"description":       String(""),
+			"home":              String(""),
+			"keywords":          ArrayOf(String("")),
+			"maintainers":       ArrayOf(Ref("Maintainer")),
+			"sources":           ArrayOf(String("")),
+			"icon":              String("The path of the chart icon, empty if the chart has none"),
+			"icon_content_type": String(""),
+			"category":          String(""),
+			"chartVersions":     ArrayOf(Ref("ChartVersion")),
+		}),
+		"ChartVersion": Object("A chart version", map[string]*Schema{
+			"version":      String(""),
+			"app_version":  String(""),
+			"created":      {Type: "string", Format: "date-time"},
+			"digest":       String(""),
+			"urls":         ArrayOf(String("")),
+			"readme":       String("The path of the README"),
+			"values":       String("The path of the default values"),
+			"schema":       String(""),
+			"apiVersion":   String("The apiVersion of the Chart.yaml"),
+			"kubeVersion":  String("The Kubernetes versions supported by the chart version"),
+			"type":         &Schema{Type: "string", Description: "application if empty", Enum: []interface{}{"application", "library"}},
+			"deprecated":   Boolean(""),
+			"condition":    String(""),
+			"tags":         String(""),
+			"annotations":  {Type: "object", AdditionalProperties: String("")},
+			"dependencies": ArrayOf(Ref("ChartDependency")),
+			"incompatible": Boolean("Set if the kubeVersion is not satisfied by the Kubernetes version of the request"),
+		}),
+		"Resource": Object("A chart or chart version resource", map[string]*Schema{
+			"id":            String(""),
+			"type":          {Type: "string", Enum: []interface{}{"chart", "chartVersion"}},
+			"attributes":    Object("The chart or the chart version", nil),
+			"links":         Object("", map[string]*Schema{"self": String("")}),
+			"relationships": {Type: "object", Description: "The latest version of a chart or the chart of a version", AdditionalProperties: Object("", map[string]*Schema{"data": Object("", nil), "links": Object("", map[string]*Schema{"self": String("")})})},
+		}),
+		"FacetCount": Object("The number of charts with a value", map[string]*Schema{
+			"value": String(""),
+			"count": Integer("", nil),
+		}),
+		"ChartList": DataWithMeta(ArrayOf(Ref("Resource")), Object("", map[string]*Schema{
+			"totalPages": Integer("", nil),
+			"facets": Object("The values of the charts matching the filters from the most common", map[string]*Schema{
+				"keywords":    ArrayOf(Ref("FacetCount")),
+				"maintainers": ArrayOf(Ref("FacetCount")),
+				"categories":  ArrayOf(Ref("FacetCount")),
+				"repos":       ArrayOf(Ref("FacetCount")),
+			}),
+		})),
+		"ChartSearchResults": DataWithMeta(ArrayOf(Ref("Resource")), Object("", map[string]*Schema{
+			"totalPages": Integer("", nil),
+		})),
+		"ChartDependency": Object("A dependency of a chart version", map[string]*Schema{
+			"name":       String(""),
+			"version":    String("The version or version constraint of the dependency"),
+			"repository": String(""),
+			"condition":  String("The values path enabling the dependency"),
+			"tags":       ArrayOf(String("")),
+			"alias":      String(""),
+		}),
+		"ChartDependent": Object("A chart version depending on a chart", map[string]*Schema{
+			"chartID":    String(""),
+			"version":    String(""),
+			"repo":       Ref("Repo"),
+			"dependency": Ref("ChartDependency"),
+		}),
+		"ChartImage": Object("A container image of a chart version", map[string]*Schema{
+			"chartID": String(""),
+			"version": String(""),
+			"repo":    Ref("Repo"),
+			"image":   String(""),
+		}),
+		"ChartParameter": Object("A value documented by the comments of a values.yaml, either with the @param annotations of the Bitnami readme generator or the comments of helm-docs", map[string]*Schema{
+			"path":        String("The dotted path of the value"),
+			"type":        String("The JSON type of the value, omitted if unknown"),
+			"default":     {Description: "The default value"},
+			"description": String(""),
+		}),
+		"KeyChange": Object("A key changed between two versions in the dotted notation of helm --set", map[string]*Schema{
+			"path":     String(""),
+			"type":     {Type: "string", Enum: []interface{}{"added", "removed", "changed"}},
+			"oldValue": {Description: "The value in the from version"},
+			"newValue": {Description: "The value in the to version"},
+		}),
+		"ChartVersionDiff": Object("The changes between two chart versions", map[string]*Schema{
+			"from":   String(""),
+			"to":     String(""),
+			"values": changes,
+			"schema": changes,
+			"readme": String("The unified diff of the README"),
+		}),
+		"RepoSummary": Object("A synced repository", map[string]*Schema{
+			"namespace":    String(""),
+			"name":         String(""),
+			"url":          String(""),
+			"lastUpdate":   {Type: "string", Format: "date-time"},
+			"checksum":     String(""),
+			"chartCount":   Integer("", nil),
+			"versionCount": Integer("", nil),
+		}),
+		"SyncFailure": Object("An asset which could not be synced", map[string]*Schema{
+			"chartID": String(""),
+			"version": String("Empty for the failures of the chart rather than of a version"),
+			"asset":   String("The asset, like icon, files, parameters, schema or tarball"),
+			"error":   String(""),
+		}),
+		"SyncMissingAsset": Object("An optional asset a chart doesn't have", map[string]*Schema{
+			"chartID": String(""),
+			"version": String("Empty for the assets of the chart rather than of a version"),
+			"asset":   String("The asset, like icon, readme, values or schema"),
+		}),
+		"SyncReport": Object("The report of a repository sync", map[string]*Schema{
+			"repo":          Ref("Repo"),
+			"startTime":     {Type: "string", Format: "date-time"},
+			"endTime":       {Type: "string", Format: "date-time"},
+			"checksum":      String(""),
+			"chartsAdded":   ArrayOf(String("")),
+			"chartsUpdated": ArrayOf(String("")),
+			"chartsRemoved": ArrayOf(String("")),
+			"failures":      ArrayOf(Ref("SyncFailure")),
+			"missing":       ArrayOf(Ref("SyncMissingAsset")),
+			"skipped":       Boolean("Set if the repository didn't change since its last sync"),
+			"error":         String("Set if the sync could not be completed"),
+		}),
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command gen writes the Go client of the OpenAPI document of a Kubeapps
+// service. It's run by go generate in the pkg/client packages.
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+
+	"github.com/kubeapps/kubeapps/pkg/openapi"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	document := flag.String("document", "", "Document of the client: assetsvc or kubeops")
+	output := flag.String("output", "client.go", "File the client is written to")
+	flag.Parse()
+
+	var doc *openapi.Document
+	switch *document {
+	case "assetsvc":
+		doc = openapi.Assetsvc()
+	case "kubeops":
+		doc = openapi.Kubeops()
+	default:
+		log.Fatalf("Unsupported document %q", *document)
+	}
+
+	src, err := openapi.GenerateClient(doc, *document)
+	if err != nil {
+		log.Fatalf("Unable to generate the %s client: %v", *document, err)
+	}
+	if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		log.Fatalf("Unable to write the %s client: %v", *document, err)
+	}
+}
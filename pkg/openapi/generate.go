@@ -0,0 +1,215 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// pathParamRegex matches the parameters of a path template
+var pathParamRegex = regexp.MustCompile(`\{([^}]+)\}`)
+
+// clientMethod is an operation of a generated client
+type clientMethod struct {
+	Name    string
+	Summary string
+	Method  string
+	Path    string
+	// Args are the path parameters of the method, in path order
+	Args []string
+	// Params declares the path parameters in the signature of the method
+	Params string
+	// PathExpr is the Go expression building the path of a request
+	PathExpr string
+	HasQuery bool
+	HasBody  bool
+}
+
+// GenerateClient returns the source of a Go package with a client of the
+// operations of a document. The methods return the responses of the API so
+// the callers can read any media type, errors are returned as *Error.
+func GenerateClient(doc *Document, packageName string) ([]byte, error) {
+	methods := []clientMethod{}
+	for _, route := range doc.Routes() {
+		op := route.Operation
+		if op.OperationID == "" {
+			return nil, fmt.Errorf("the %s operation of %s has no operationId", route.Method, route.Path)
+		}
+		m := clientMethod{
+			Name:    strings.ToUpper(op.OperationID[:1]) + op.OperationID[1:],
+			Summary: op.Summary,
+			Method:  route.Method,
+			Path:    route.Path,
+			HasBody: op.RequestBody != nil,
+		}
+		for _, p := range op.Parameters {
+			if p.In == InQuery {
+				m.HasQuery = true
+			}
+		}
+		exprs := []string{}
+		last := 0
+		for _, match := range pathParamRegex.FindAllStringSubmatchIndex(route.Path, -1) {
+			name := route.Path[match[2]:match[3]]
+			m.Args = append(m.Args, name)
+			exprs = append(exprs, fmt.Sprintf("%q", route.Path[last:match[0]]), fmt.Sprintf("url.PathEscape(%s)", name))
+			last = match[1]
+		}
+		if last < len(route.Path) {
+			exprs = append(exprs, fmt.Sprintf("%q", route.Path[last:]))
+		}
+		m.PathExpr = strings.Join(exprs, " + ")
+		if len(m.Args) > 0 {
+			m.Params = ", " + strings.Join(m.Args, ", ") + " string"
+		}
+		methods = append(methods, m)
+	}
+
+	var src bytes.Buffer
+	err := clientTemplate.Execute(&src, map[string]interface{}{
+		"Package": packageName,
+		"Title":   doc.Info.Title,
+		"Methods": methods,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(src.Bytes())
+}
+
+var clientTemplate = template.Must(template.New("client").Parse(`/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by pkg/openapi/gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client sends requests to the {{.Title}} API
+type Client struct {
+	// BaseURL is the URL the API is served at
+	BaseURL string
+	// Token is sent as bearer token if not empty
+	Token string
+	// HTTPClient sends the requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client of the API served at the given URL
+func NewClient(baseURL, token string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Token: token}
+}
+
+// Error is an error response of the API
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Decode decodes the JSON body of a response and closes it
+func Decode(res *http.Response, v interface{}) error {
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 400 {
+		defer res.Body.Close()
+		data, _ := ioutil.ReadAll(res.Body)
+		apiErr := &Error{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(data))}
+		var errorBody struct {
+			Message string ` + "`json:\"message\"`" + `
+		}
+		if json.Unmarshal(data, &errorBody) == nil && errorBody.Message != "" {
+			apiErr.Message = errorBody.Message
+		}
+		return nil, apiErr
+	}
+	return res, nil
+}
+{{range .Methods}}
+// {{.Name}} sends a {{.Method}} request to {{.Path}}{{if .Summary}}
+//
+// {{.Summary}}{{end}}
+func (c *Client) {{.Name}}(ctx context.Context{{.Params}}{{if .HasQuery}}, query url.Values{{end}}{{if .HasBody}}, body interface{}{{end}}) (*http.Response, error) {
+	return c.do(ctx, "{{.Method}}", {{.PathExpr}}, {{if .HasQuery}}query{{else}}nil{{end}}, {{if .HasBody}}body{{else}}nil{{end}})
+}
+{{end}}`))
@@ -0,0 +1,236 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openapi
+
+// Kubeops returns the document of the kubeops API. The operations are
+// performed with the token of the user so Kubernetes authorizes them.
+func Kubeops() *Document {
+	doc := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:       "Kubeapps kubeops",
+			Description: "Manages the Helm 3 releases and the app repositories of the users. The assetsvc API is proxied under /assetsvc.",
+			Version:     "v1",
+		},
+		Paths: map[string]PathItem{},
+		Components: Components{
+			Schemas: kubeopsSchemas(),
+			SecuritySchemes: map[string]*SecurityScheme{
+				"bearer": {Type: "http", Scheme: "bearer", Description: "The Kubernetes token of the user"},
+			},
+		},
+	}
+
+	namespace := PathParam("namespace", "The namespace of the resource")
+	releaseName := PathParam("releaseName", "The name of the release")
+	statuses := QueryParam("statuses", "Return the releases of every status with \"all\", only the deployed and failed releases by default", false, String(""))
+	textError := func(description string) *Response {
+		return ContentResponse(description, "text/plain")
+	}
+
+	add := func(method, path, operationID, summary, tag string, params []*Parameter, body *RequestBody, responses map[string]*Response) {
+		op := &Operation{
+			OperationID: operationID,
+			Summary:     summary,
+			Tags:        []string{tag},
+			Parameters:  params,
+			RequestBody: body,
+			Responses:   responses,
+			Security:    []map[string][]string{{"bearer": {}}},
+		}
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = PathItem{}
+		}
+		doc.Paths[path][method] = op
+	}
+
+	// Releases
+	releaseErrors := func(responses map[string]*Response) map[string]*Response {
+		responses["403"] = ErrorResponse("The user is not allowed to perform the operation, the message lists the forbidden actions as JSON")
+		responses["500"] = ErrorResponse("Unexpected error")
+		return responses
+	}
+	// The routes under /v1/clusters/{cluster} manage the releases of the
+	// configured clusters, the other ones the releases of the default cluster
+	cluster := PathParam("cluster", "The name of the cluster in the clusters configuration of kubeops")
+	for _, family := range []struct {
+		prefix, operation, cluster string
+		params                     []*Parameter
+	}{
+		{prefix: "/v1", operation: "Release"},
+		{prefix: "/v1/clusters/{cluster}", operation: "ClusterRelease", cluster: " in a cluster", params: []*Parameter{cluster}},
+	} {
+		p := family.prefix
+		id := func(verb string) string {
+			return verb + family.operation
+		}
+		notFound := func(description string) string {
+			if family.cluster == "" {
+				return description
+			}
+			return description + ", or the cluster is not configured"
+		}
+		params := func(params ...*Parameter) []*Parameter {
+			return append(append([]*Parameter{}, family.params...), params...)
+		}
+		list := func() map[string]*Response {
+			responses := releaseErrors(map[string]*Response{"200": JSONResponse("The releases", Data(ArrayOf(Ref("AppOverview"))))})
+			if family.cluster != "" {
+				responses["404"] = ErrorResponse("The cluster is not configured")
+			}
+			return responses
+		}
+		add("get", p+"/releases", id("listAll")+"s", "List the releases of every namespace"+family.cluster, "releases",
+			params(statuses), nil, list())
+		add("get", p+"/namespaces/{namespace}/releases", id("list")+"s", "List the releases of a namespace"+family.cluster, "releases",
+			params(namespace, statuses), nil, list())
+		add("post", p+"/namespaces/{namespace}/releases", id("create"), "Install a chart"+family.cluster, "releases",
+			params(namespace), JSONBody("The chart to install", true, Ref("CreateReleaseRequest")),
+			releaseErrors(map[string]*Response{
+				"200": JSONResponse("The release", Data(Ref("Release"))),
+				"404": ErrorResponse(notFound("The chart was not found")),
+				"422": ErrorResponse("The chart could not be installed or its kubeVersion is not satisfied by the cluster"),
+			}))
+		add("get", p+"/namespaces/{namespace}/releases/{releaseName}", id("get"), "Get a release"+family.cluster, "releases",
+			params(namespace, releaseName), nil,
+			releaseErrors(map[string]*Response{"200": JSONResponse("The release", Data(Ref("Release"))), "404": ErrorResponse(notFound("The release was not found"))}))
+		add("put", p+"/namespaces/{namespace}/releases/{releaseName}", id("operate"), "Upgrade or roll back a release"+family.cluster, "releases",
+			params(namespace, releaseName,
+				QueryParam("action", "The operation, upgrade by default", false, &Schema{Type: "string", Enum: []interface{}{"upgrade", "rollback"}}),
+				QueryParam("revision", "The revision to roll back to, required by the rollback action", false, Integer("", Min(1))),
+			), JSONBody("The chart to upgrade to, required by the upgrade action", false, Ref("UpgradeReleaseRequest")),
+			releaseErrors(map[string]*Response{
+				"200": JSONResponse("The release", Data(Ref("Release"))),
+				"404": ErrorResponse(notFound("The release or the chart was not found")),
+				"422": ErrorResponse("The release could not be upgraded or rolled back, or the kubeVersion of the chart is not satisfied by the cluster"),
+			}))
+		add("delete", p+"/namespaces/{namespace}/releases/{releaseName}", id("delete"), "Delete a release"+family.cluster, "releases",
+			params(namespace, releaseName,
+				QueryParam("purge", "Delete the history of the release too", false, Boolean("")),
+			), nil,
+			releaseErrors(map[string]*Response{"200": ContentResponse("The release was deleted", "text/plain"), "404": ErrorResponse(notFound("The release was not found"))}))
+		add("post", p+"/namespaces/{namespace}/releases/render", id("render"), "Render the manifests of a new release without installing it"+family.cluster, "releases",
+			params(namespace), JSONBody("The chart to render", true, Ref("CreateReleaseRequest")),
+			releaseErrors(map[string]*Response{
+				"200": JSONResponse("The rendered manifests", Data(Ref("RenderedRelease"))),
+				"404": ErrorResponse(notFound("The chart was not found")),
+				"409": ErrorResponse("The release already exists"),
+				"422": JSONResponse("The templates could not be rendered or validated", Ref("RenderError")),
+			}))
+		add("post", p+"/namespaces/{namespace}/releases/{releaseName}/render", id("render")+"Upgrade", "Render the manifests of an upgrade of a release without upgrading it"+family.cluster, "releases",
+			params(namespace, releaseName), JSONBody("The chart to render", true, Ref("UpgradeReleaseRequest")),
+			releaseErrors(map[string]*Response{
+				"200": JSONResponse("The rendered manifests", Data(Ref("RenderedRelease"))),
+				"404": ErrorResponse(notFound("The release or the chart was not found")),
+				"422": JSONResponse("The templates could not be rendered or validated", Ref("RenderError")),
+			}))
+	}
+
+	// Backend
+	add("get", "/backend/v1/namespaces", "getNamespaces", "List the namespaces of the cluster", "backend",
+		nil, nil,
+		map[string]*Response{"200": JSONResponse("The namespaces", Ref("NamespaceList")), "403": textError("The user can't list the namespaces")})
+	add("post", "/backend/v1/namespaces/{namespace}/apprepositories", "createAppRepository", "Create an app repository", "backend",
+		[]*Parameter{namespace}, JSONBody("The app repository", true, Ref("AppRepositoryRequest")),
+		map[string]*Response{
+			"201": JSONResponse("The app repository", Object("", map[string]*Schema{"appRepository": Ref("AppRepository")})),
+			"403": textError("The user can't create app repositories in the namespace"),
+			"409": textError("The app repository already exists"),
+		})
+	add("post", "/backend/v1/namespaces/{namespace}/apprepositories/validate", "validateAppRepository", "Check that the index of a repository can be downloaded", "backend",
+		[]*Parameter{namespace}, JSONBody("The app repository", true, Ref("AppRepositoryValidationRequest")),
+		map[string]*Response{
+			"200":     ContentResponse("The index of the repository was downloaded", "text/plain"),
+			"default": textError("The response of the repository"),
+		})
+	add("delete", "/backend/v1/namespaces/{namespace}/apprepositories/{name}", "deleteAppRepository", "Delete an app repository", "backend",
+		[]*Parameter{namespace, PathParam("name", "The name of the app repository")}, nil,
+		map[string]*Response{"200": {Description: "The app repository was deleted"}, "404": textError("The app repository was not found")})
+	add("get", "/backend/v1/namespaces/{namespace}/operator/{name}/logo", "getOperatorLogo", "Get the logo of an operator", "backend",
+		[]*Parameter{namespace, PathParam("name", "The name of the package manifest of the operator")}, nil,
+		map[string]*Response{"200": ContentResponse("The logo", "image/*"), "500": textError("The logo could not be retrieved")})
+	doc.Paths["/backend/v1/namespaces/{namespace}/operator/{name}/logo"]["get"].Security = nil
+	return doc
+}
+
+func kubeopsSchemas() map[string]*Schema {
+	chartDetails := func(description string, required ...string) *Schema {
+		return Object(description, map[string]*Schema{
+			"appRepositoryResourceName": {Type: "string", Description: "The app repository of the chart", MinLength: MinLen(1)},
+			"chartName":                 String("The name of the chart within the repository"),
+			"releaseName":               String(""),
+			"version":                   String("The chart version"),
+			"values":                    String("The values of the release as YAML"),
+		}, required...)
+	}
+	appRepository := func(description string, required ...string) *Schema {
+		return Object("", map[string]*Schema{
+			"appRepository": Object(description, map[string]*Schema{
+				"name":               String(""),
+				"repoURL":            String(""),
+				"authHeader":         String("The Authorization header sent to the repository"),
+				"customCA":           String("The CA certificate of the repository"),
+				"syncJobPodTemplate": Object("The template of the pods syncing the repository", nil),
+				"resyncRequests":     Integer("Incremented to sync the repository again", Min(0)),
+			}, required...),
+		}, "appRepository")
+	}
+	return map[string]*Schema{
+		"Error":                          ErrorSchema,
+		"CreateReleaseRequest":           chartDetails("The chart of a new release", "appRepositoryResourceName", "chartName", "releaseName", "version"),
+		"UpgradeReleaseRequest":          chartDetails("The chart a release is upgraded to", "appRepositoryResourceName", "chartName", "version"),
+		"AppRepositoryRequest":           appRepository("The app repository", "name", "repoURL"),
+		"AppRepositoryValidationRequest": appRepository("The app repository", "repoURL"),
+		"AppOverview": Object("A release with the metadata of its chart", map[string]*Schema{
+			"releaseName":   String(""),
+			"version":       String("The chart version"),
+			"namespace":     String(""),
+			"icon":          String(""),
+			"status":        String(""),
+			"chart":         String("The chart name"),
+			"chartMetadata": Object("The Chart.yaml of the chart", nil),
+		}),
+		"Release": Object("A release in the Helm 2 format", nil),
+		"RenderedRelease": Object("The manifests of a release rendered by a dry run", map[string]*Schema{
+			"manifests": ArrayOf(Ref("RenderedManifest")),
+			"hooks":     ArrayOf(Ref("RenderedManifest")),
+			"notes":     String("The rendered NOTES.txt of the chart"),
+		}, "manifests", "hooks", "notes"),
+		"RenderedManifest": Object("A rendered resource", map[string]*Schema{
+			"template":   String("The template the resource is rendered from"),
+			"apiVersion": String(""),
+			"kind":       String(""),
+			"name":       String(""),
+			"events":     ArrayOf(String("")),
+			"manifest":   String("The YAML manifest of the resource"),
+		}, "template", "apiVersion", "kind", "name", "manifest"),
+		"RenderError": Object("An error rendering or validating the templates", map[string]*Schema{
+			"code":     Integer("The HTTP status code", nil),
+			"message":  String("The error message"),
+			"template": String("The template of the error, when known"),
+			"line":     Integer("The line of the template, or of the rendered document for the YAML errors", Min(1)),
+			"context": ArrayOf(Object("A line of the template around the line of the error", map[string]*Schema{
+				"line": Integer("", Min(1)),
+				"text": String(""),
+			})),
+		}, "code", "message"),
+		"AppRepository": Object("An AppRepository resource", nil),
+		"NamespaceList": Object("", map[string]*Schema{
+			"namespaces": ArrayOf(Object("A Namespace resource", nil)),
+		}),
+	}
+}
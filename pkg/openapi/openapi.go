@@ -0,0 +1,272 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package openapi describes the HTTP APIs of the Kubeapps services with
+// OpenAPI 3 documents. The documents are served by the services, validate
+// their requests and generate the Go clients of the pkg/client packages.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Version is the OpenAPI version of the documents
+const Version = "3.0.3"
+
+// Path is the path the services serve their document at
+const Path = "/openapi.json"
+
+// Parameter locations
+const (
+	InPath  = "path"
+	InQuery = "query"
+)
+
+// Document is an OpenAPI document. Only the fields used by the Kubeapps APIs
+// are supported.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []Server            `json:"servers,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info describes an API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server is a base URL of an API
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem are the operations of a path by lowercase HTTP method
+type PathItem map[string]*Operation
+
+// Operation is an HTTP method of a path
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path or query parameter of an operation
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body of a request by media type
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+// Response is a response of an operation by media type
+type Response struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// Header is a header of a response
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// MediaType is the schema of a request or response body
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Components are the schemas and security schemes referenced by the
+// operations
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is an authentication method of an API
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Schema is the subset of the OpenAPI schema objects compatible with JSON
+// schema used by the Kubeapps APIs
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Operation returns the operation of a method of a path template, nil if it's
+// not documented
+func (d *Document) Operation(method, path string) *Operation {
+	return d.Paths[path][strings.ToLower(method)]
+}
+
+// Route is a documented operation with its method and path template
+type Route struct {
+	Method    string
+	Path      string
+	Operation *Operation
+}
+
+// Routes returns the documented operations ordered by path and method
+func (d *Document) Routes() []Route {
+	routes := []Route{}
+	for path, item := range d.Paths {
+		for method, op := range item {
+			routes = append(routes, Route{Method: strings.ToUpper(method), Path: path, Operation: op})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// Handler serves the document as JSON
+func (d *Document) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := json.Marshal(d)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
+
+// Ref returns a schema referencing a schema of the document components
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// String returns a string schema
+func String(description string) *Schema {
+	return &Schema{Type: "string", Description: description}
+}
+
+// Integer returns an integer schema with an optional minimum
+func Integer(description string, minimum *float64) *Schema {
+	return &Schema{Type: "integer", Description: description, Minimum: minimum}
+}
+
+// Boolean returns a boolean schema
+func Boolean(description string) *Schema {
+	return &Schema{Type: "boolean", Description: description}
+}
+
+// ArrayOf returns an array schema of the given items
+func ArrayOf(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// Object returns an object schema with the given properties
+func Object(description string, properties map[string]*Schema, required ...string) *Schema {
+	return &Schema{Type: "object", Description: description, Properties: properties, Required: required}
+}
+
+// Min returns a pointer to a minimum value
+func Min(v float64) *float64 {
+	return &v
+}
+
+// MinLen returns a pointer to a minimum length
+func MinLen(v int) *int {
+	return &v
+}
+
+// PathParam returns a required path parameter
+func PathParam(name, description string) *Parameter {
+	return &Parameter{Name: name, In: InPath, Description: description, Required: true, Schema: String("")}
+}
+
+// QueryParam returns a query parameter
+func QueryParam(name, description string, required bool, schema *Schema) *Parameter {
+	return &Parameter{Name: name, In: InQuery, Description: description, Required: required, Schema: schema}
+}
+
+// JSONBody returns a JSON request body
+func JSONBody(description string, required bool, schema *Schema) *RequestBody {
+	return &RequestBody{Description: description, Required: required, Content: map[string]*MediaType{"application/json": {Schema: schema}}}
+}
+
+// JSONResponse returns a JSON response
+func JSONResponse(description string, schema *Schema) *Response {
+	return &Response{Description: description, Content: map[string]*MediaType{"application/json": {Schema: schema}}}
+}
+
+// ContentResponse returns a response of the given media type
+func ContentResponse(description, mediaType string) *Response {
+	return &Response{Description: description, Content: map[string]*MediaType{mediaType: {}}}
+}
+
+// ErrorResponse returns an error response of the Kubeapps APIs
+func ErrorResponse(description string) *Response {
+	return JSONResponse(description, Ref("Error"))
+}
+
+// Data returns the schema of a response of the Kubeapps APIs wrapping the
+// given schema in its data field
+func Data(schema *Schema) *Schema {
+	return Object("", map[string]*Schema{"data": schema}, "data")
+}
+
+// DataWithMeta returns the schema of a response of the Kubeapps APIs with
+// data and meta fields
+func DataWithMeta(schema, meta *Schema) *Schema {
+	return Object("", map[string]*Schema{"data": schema, "meta": meta}, "data")
+}
+
+// ErrorSchema is the schema of the error responses of the Kubeapps APIs
+var ErrorSchema = Object("An error", map[string]*Schema{
+	"code":    Integer("The HTTP status code", nil),
+	"message": String("The error message"),
+})
@@ -0,0 +1,108 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// walkSchemas calls f with every schema nested in a schema
+func walkSchemas(s *Schema, f func(*Schema)) {
+	if s == nil {
+		return
+	}
+	f(s)
+	walkSchemas(s.Items, f)
+	walkSchemas(s.AdditionalProperties, f)
+	for _, p := range s.Properties {
+		walkSchemas(p, f)
+	}
+}
+
+func Test_Documents(t *testing.T) {
+	documents := map[string]*Document{"assetsvc": Assetsvc(), "kubeops": Kubeops()}
+	for name, doc := range documents {
+		t.Run(name, func(t *testing.T) {
+			checkRefs := func(s *Schema) {
+				walkSchemas(s, func(s *Schema) {
+					_, err := doc.resolve(s)
+					assert.NoError(t, err)
+				})
+			}
+			for _, s := range doc.Components.Schemas {
+				checkRefs(s)
+			}
+			operationIDs := map[string]bool{}
+			for _, route := range doc.Routes() {
+				op := route.Operation
+				assert.False(t, operationIDs[op.OperationID], "duplicated operationId %s", op.OperationID)
+				operationIDs[op.OperationID] = true
+				for _, match := range pathParamRegex.FindAllStringSubmatch(route.Path, -1) {
+					found := false
+					for _, p := range op.Parameters {
+						found = found || (p.In == InPath && p.Name == match[1])
+					}
+					assert.True(t, found, "the %s %s operation should document the %s parameter", route.Method, route.Path, match[1])
+				}
+				for _, p := range op.Parameters {
+					checkRefs(p.Schema)
+				}
+				if op.RequestBody != nil {
+					for _, m := range op.RequestBody.Content {
+						checkRefs(m.Schema)
+					}
+				}
+				for _, r := range op.Responses {
+					for _, m := range r.Content {
+						checkRefs(m.Schema)
+					}
+				}
+			}
+		})
+	}
+}
+
+func Test_Handler(t *testing.T) {
+	w := httptest.NewRecorder()
+	Kubeops().Handler().ServeHTTP(w, httptest.NewRequest("GET", Path, nil))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var doc map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, Version, doc["openapi"])
+	assert.Contains(t, doc["paths"], "/v1/namespaces/{namespace}/releases")
+}
+
+// tests that the clients of pkg/client are generated from the current
+// documents, run go generate ./pkg/client/... to update them
+func Test_GeneratedClients(t *testing.T) {
+	documents := map[string]*Document{"assetsvc": Assetsvc(), "kubeops": Kubeops()}
+	for name, doc := range documents {
+		t.Run(name, func(t *testing.T) {
+			src, err := GenerateClient(doc, name)
+			assert.NoError(t, err)
+			current, err := ioutil.ReadFile(filepath.Join("..", "client", name, "client.go"))
+			assert.NoError(t, err)
+			assert.Equal(t, string(current), string(src), "the %s client is outdated", name)
+		})
+	}
+}
@@ -0,0 +1,284 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/kubeapps/common/response"
+)
+
+// Validate is a mux middleware rejecting with a 400 the requests of the
+// documented operations not matching their parameters or request body. The
+// requests of undocumented routes are served without validation.
+func (d *Document) Validate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if route := mux.CurrentRoute(req); route != nil {
+			path, err := route.GetPathTemplate()
+			if err == nil {
+				if op := d.Operation(req.Method, path); op != nil {
+					if err := d.ValidateRequest(op, req, mux.Vars(req)); err != nil {
+						response.NewErrorResponse(http.StatusBadRequest, err.Error()).Write(w)
+						return
+					}
+				}
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// ValidateRequest returns an error if a request doesn't match the parameters
+// or the request body of an operation. Empty query parameters are ignored like
+// the handlers do. The body is restored so the handler can read it again.
+func (d *Document) ValidateRequest(op *Operation, req *http.Request, pathParams map[string]string) error {
+	query := req.URL.Query()
+	for _, p := range op.Parameters {
+		var values []string
+		switch p.In {
+		case InPath:
+			if v, ok := pathParams[p.Name]; ok {
+				values = []string{v}
+			}
+		case InQuery:
+			for _, v := range query[p.Name] {
+				if v != "" {
+					values = append(values, v)
+				}
+			}
+		}
+		if len(values) == 0 {
+			if p.Required {
+				return fmt.Errorf("the %s parameter %q is required", p.In, p.Name)
+			}
+			continue
+		}
+		if err := d.validateParameter(p, values); err != nil {
+			return err
+		}
+	}
+
+	if op.RequestBody == nil {
+		return nil
+	}
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return fmt.Errorf("unable to read the request body: %v", err)
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return fmt.Errorf("a request body is required")
+		}
+		return nil
+	}
+	mediaType, ok := op.RequestBody.Content["application/json"]
+	if !ok || mediaType.Schema == nil {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("unable to parse the request body: %v", err)
+	}
+	return d.ValidateValue(mediaType.Schema, value, "body")
+}
+
+// validateParameter converts the values of a parameter to the type of its
+// schema and validates them. Only the first value of parameters which are not
+// arrays is used, like http.Request.FormValue does.
+func (d *Document) validateParameter(p *Parameter, values []string) error {
+	schema, err := d.resolve(p.Schema)
+	if err != nil {
+		return err
+	}
+	if schema.Type != "array" {
+		values = values[:1]
+	} else if schema.Items != nil {
+		if schema, err = d.resolve(schema.Items); err != nil {
+			return err
+		}
+	}
+	for _, v := range values {
+		value, err := parseParameter(schema.Type, v)
+		if err != nil {
+			return fmt.Errorf("the %s parameter %q should be %s", p.In, p.Name, typeDescription(schema.Type))
+		}
+		if err := d.ValidateValue(schema, value, p.Name); err != nil {
+			return fmt.Errorf("invalid %s parameter: %v", p.In, err)
+		}
+	}
+	return nil
+}
+
+// parseParameter returns the value of a parameter as decoded from JSON
+func parseParameter(schemaType, value string) (interface{}, error) {
+	switch schemaType {
+	case "integer":
+		i, err := strconv.ParseInt(value, 10, 64)
+		return float64(i), err
+	case "number":
+		return strconv.ParseFloat(value, 64)
+	case "boolean":
+		return strconv.ParseBool(value)
+	default:
+		return value, nil
+	}
+}
+
+// ValidateValue returns an error if a value decoded from JSON doesn't match
+// a schema. The name identifies the value in the error.
+func (d *Document) ValidateValue(schema *Schema, value interface{}, name string) error {
+	schema, err := d.resolve(schema)
+	if err != nil {
+		return err
+	}
+
+	if len(schema.Enum) > 0 {
+		found := false
+		for _, e := range schema.Enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s should be one of %v", name, schema.Enum)
+		}
+	}
+
+	switch schema.Type {
+	case "":
+		return nil
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			break
+		}
+		if schema.MinLength != nil && utf8.RuneCountInString(s) < *schema.MinLength {
+			return fmt.Errorf("%s should have at least %d characters", name, *schema.MinLength)
+		}
+		return nil
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok || (schema.Type == "integer" && n != math.Trunc(n)) {
+			break
+		}
+		if schema.Minimum != nil && n < *schema.Minimum {
+			return fmt.Errorf("%s should be at least %v", name, *schema.Minimum)
+		}
+		return nil
+	case "boolean":
+		if _, ok := value.(bool); ok {
+			return nil
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			break
+		}
+		if schema.Items == nil {
+			return nil
+		}
+		for i, item := range items {
+			if err := d.ValidateValue(schema.Items, item, fmt.Sprintf("%s[%d]", name, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			break
+		}
+		return d.validateObject(schema, object, name)
+	default:
+		return fmt.Errorf("unsupported type %q in the schema of %s", schema.Type, name)
+	}
+	return fmt.Errorf("%s should be %s", name, typeDescription(schema.Type))
+}
+
+// validateObject validates the required fields and the properties of an
+// object. Properties without a schema are allowed unless the schema sets the
+// additional properties.
+func (d *Document) validateObject(schema *Schema, object map[string]interface{}, name string) error {
+	for _, field := range schema.Required {
+		if _, ok := object[field]; !ok {
+			return fmt.Errorf("%s.%s is required", name, field)
+		}
+	}
+	// Keys are sorted so the same error is returned for the same object
+	keys := make([]string, 0, len(object))
+	for k := range object {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		property, ok := schema.Properties[k]
+		if !ok {
+			property = schema.AdditionalProperties
+		}
+		if property == nil {
+			continue
+		}
+		if err := d.ValidateValue(property, object[k], name+"."+k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve returns the schema referenced by a schema of the document, if any
+func (d *Document) resolve(schema *Schema) (*Schema, error) {
+	if schema == nil {
+		return &Schema{}, nil
+	}
+	if schema.Ref == "" {
+		return schema, nil
+	}
+	name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+	resolved, ok := d.Components.Schemas[name]
+	if !ok || name == schema.Ref {
+		return nil, fmt.Errorf("unable to resolve the schema %q", schema.Ref)
+	}
+	return d.resolve(resolved)
+}
+
+// typeDescription returns the description of a schema type used in errors
+func typeDescription(schemaType string) string {
+	switch schemaType {
+	case "integer", "array", "object":
+		return "an " + schemaType
+	default:
+		return "a " + schemaType
+	}
+}
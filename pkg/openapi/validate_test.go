@@ -0,0 +1,139 @@
+/*
+Copyright (c) 2020 Bitnami
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openapi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func testDocument() *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: "test", Version: "v1"},
+		Paths: map[string]PathItem{
+			"/v1/things/{name}": {
+				"get": {
+					OperationID: "getThing",
+					Parameters: []*Parameter{
+						PathParam("name", ""),
+						QueryParam("page", "", false, Integer("", Min(1))),
+						QueryParam("tag", "", false, ArrayOf(&Schema{Type: "string", Enum: []interface{}{"a", "b"}})),
+						QueryParam("q", "", true, String("")),
+					},
+				},
+				"put": {
+					OperationID: "putThing",
+					Parameters:  []*Parameter{PathParam("name", "")},
+					RequestBody: JSONBody("", true, Ref("Thing")),
+				},
+			},
+		},
+		Components: Components{Schemas: map[string]*Schema{
+			"Thing": Object("", map[string]*Schema{
+				"name":   {Type: "string", MinLength: MinLen(1)},
+				"size":   Integer("", Min(0)),
+				"labels": {Type: "object", AdditionalProperties: String("")},
+				"parts":  ArrayOf(Ref("Thing")),
+			}, "name"),
+		}},
+	}
+}
+
+func Test_ValidateRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		err    string
+	}{
+		{"valid query", "GET", "/v1/things/foo?q=bar&page=2&tag=a&tag=b", "", ""},
+		{"empty query values are ignored", "GET", "/v1/things/foo?q=bar&page=", "", ""},
+		{"missing required query", "GET", "/v1/things/foo?page=1", "", `the query parameter "q" is required`},
+		{"empty required query", "GET", "/v1/things/foo?q=", "", `the query parameter "q" is required`},
+		{"not an integer", "GET", "/v1/things/foo?q=bar&page=one", "", `the query parameter "page" should be an integer`},
+		{"below the minimum", "GET", "/v1/things/foo?q=bar&page=0", "", "invalid query parameter: page should be at least 1"},
+		{"not in the enum", "GET", "/v1/things/foo?q=bar&tag=a&tag=c", "", "invalid query parameter: tag should be one of [a b]"},
+		{"valid body", "PUT", "/v1/things/foo", `{"name": "foo", "size": 1, "labels": {"a": "b"}, "parts": [{"name": "bar"}]}`, ""},
+		{"missing body", "PUT", "/v1/things/foo", "", "a request body is required"},
+		{"invalid JSON", "PUT", "/v1/things/foo", "{", "unable to parse the request body: unexpected end of JSON input"},
+		{"missing field", "PUT", "/v1/things/foo", `{"size": 1}`, "body.name is required"},
+		{"empty string", "PUT", "/v1/things/foo", `{"name": ""}`, "body.name should have at least 1 characters"},
+		{"not an integer field", "PUT", "/v1/things/foo", `{"name": "foo", "size": 1.5}`, "body.size should be an integer"},
+		{"invalid additional property", "PUT", "/v1/things/foo", `{"name": "foo", "labels": {"a": 1}}`, "body.labels.a should be a string"},
+		{"invalid nested item", "PUT", "/v1/things/foo", `{"name": "foo", "parts": [{"name": "bar"}, {}]}`, "body.parts[1].name is required"},
+	}
+	doc := testDocument()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			err := doc.ValidateRequest(doc.Operation(tt.method, "/v1/things/{name}"), req, map[string]string{"name": "foo"})
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func Test_ValidateRequestRestoresBody(t *testing.T) {
+	doc := testDocument()
+	req := httptest.NewRequest("PUT", "/v1/things/foo", strings.NewReader(`{"name": "foo"}`))
+	err := doc.ValidateRequest(doc.Operation("PUT", "/v1/things/{name}"), req, map[string]string{"name": "foo"})
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(req.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name": "foo"}`, string(body))
+}
+
+func Test_ValidateMiddleware(t *testing.T) {
+	doc := testDocument()
+	r := mux.NewRouter()
+	r.Use(doc.Validate)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	r.Methods("GET").Path("/v1/things/{name}").Handler(ok)
+	r.Methods("GET").Path("/v1/undocumented").Handler(ok)
+
+	tests := []struct {
+		name string
+		url  string
+		code int
+		body string
+	}{
+		{"valid request", "/v1/things/foo?q=bar", http.StatusOK, "OK"},
+		{"invalid request", "/v1/things/foo", http.StatusBadRequest, `{"code":400,"message":"the query parameter \"q\" is required"}`},
+		{"undocumented route", "/v1/undocumented", http.StatusOK, "OK"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.body, strings.TrimSpace(w.Body.String()))
+		})
+	}
+}